@@ -23,18 +23,24 @@ import (
 
 	"github.com/cloudprivacylabs/lsa/layers/cmd/cmdutil"
 	"github.com/cloudprivacylabs/lsa/layers/cmd/pipeline"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
 
 	lscsv "github.com/cloudprivacylabs/lsa/pkg/csv"
 )
 
 type CSVExport struct {
+	BaseIngestParams
 	SpecFile string `json:"specFile" yaml:"specFile"`
 	lscsv.Writer
+	// If MultiWriter has tables, multiple CSV files are written
+	lscsv.MultiWriter
 	File string `json:"file" yaml:"file"`
 
 	initialized   bool
 	writtenHeader bool
 	csvWriter     *csv.Writer
+	tableFiles    []*os.File
+	tableWriters  map[string]*csv.Writer
 }
 
 func (CSVExport) Name() string { return "export/csv" }
@@ -53,10 +59,85 @@ params:`)
   - name: column name. This name is written to the output as the column header
     query: column query. If empty, the query is
         match (root)-[]->(n:DocumentNode {attributeName: <attributeName>}) return n
-        The query is evauated with 'root' pointing to the current row root node`)
+        The query is evauated with 'root' pointing to the current row root node
+    attribute: schema attribute id. If given, the column value is the value
+        of the instance of this attribute under the row root
+
+  # Multiple tables
+  tables:
+  - name: table name
+    file: output file. If empty, <name>.csv
+    parent: parent table name. Rows of this table are written for each
+        row of the parent table
+    attribute: schema attribute id of a repeating group. The rows are the
+        instances of this attribute under the parent row root. If this is an
+        array, the array elements are the rows
+    rowQuery: openCypher query that returns the row root nodes. For child
+        tables, it is evaluated with 'parent' pointing to the parent row root
+    autoColumns: if true, columns are derived from the schema attributes
+    columns: columns, same as above
+  keyColumn: name of the generated row key column (default _id)
+  parentKeyColumn: name of the generated parent key column (default _parent)`)
+	fmt.Println(baseIngestParamsHelp)
+}
+
+func (ecsv *CSVExport) Flush(*pipeline.PipelineContext) error {
+	for _, f := range ecsv.tableFiles {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	ecsv.tableFiles = nil
+	return nil
+}
+
+// openCSVFile opens the file for appending, and returns true if the
+// file is not empty
+func openCSVFile(name string) (*os.File, bool, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, false, err
+	}
+	off, err := f.Seek(0, 2)
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+	return f, off > 0, nil
 }
 
-func (*CSVExport) Flush(*pipeline.PipelineContext) error {
+// initTables prepares the multi-table writer and opens the table
+// files. Headers are written to the files that are empty.
+func (ecsv *CSVExport) initTables(pipeline *pipeline.PipelineContext) error {
+	var layer *ls.Layer
+	if ecsv.IsEmptySchema() {
+		layer, _ = pipeline.Properties["layer"].(*ls.Layer)
+	} else {
+		var err error
+		layer, err = LoadSchemaFromFile(pipeline.Context, ecsv.CompiledSchema, ecsv.Schema, ecsv.Type, ecsv.Bundle)
+		if err != nil {
+			return err
+		}
+	}
+	if err := ecsv.MultiWriter.Prepare(layer); err != nil {
+		return err
+	}
+	ecsv.tableWriters = make(map[string]*csv.Writer)
+	for i := range ecsv.Tables {
+		table := &ecsv.Tables[i]
+		f, hasData, err := openCSVFile(table.GetFile())
+		if err != nil {
+			return err
+		}
+		ecsv.tableFiles = append(ecsv.tableFiles, f)
+		w := csv.NewWriter(f)
+		ecsv.tableWriters[table.Name] = w
+		if !hasData {
+			if err := w.Write(ecsv.MultiWriter.Header(table)); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -66,17 +147,20 @@ func (ecsv *CSVExport) Run(pipeline *pipeline.PipelineContext) error {
 			if err := cmdutil.ReadJSONOrYAML(ecsv.SpecFile, &ecsv.Writer); err != nil {
 				return err
 			}
+			if err := cmdutil.ReadJSONOrYAML(ecsv.SpecFile, &ecsv.MultiWriter); err != nil {
+				return err
+			}
 		}
-		if len(ecsv.File) > 0 {
-			f, err := os.OpenFile(ecsv.File, os.O_CREATE|os.O_WRONLY, 0644)
-			if err != nil {
+		if len(ecsv.Tables) > 0 {
+			if err := ecsv.initTables(pipeline); err != nil {
 				return err
 			}
-			off, err := f.Seek(0, 2)
+		} else if len(ecsv.File) > 0 {
+			f, hasData, err := openCSVFile(ecsv.File)
 			if err != nil {
 				return err
 			}
-			if off > 0 {
+			if hasData {
 				// Assume header written
 				ecsv.writtenHeader = true
 			}
@@ -86,6 +170,18 @@ func (ecsv *CSVExport) Run(pipeline *pipeline.PipelineContext) error {
 		}
 		ecsv.initialized = true
 	}
+	if len(ecsv.Tables) > 0 {
+		if err := ecsv.MultiWriter.WriteRows(pipeline.Graph, ecsv.tableWriters); err != nil {
+			return err
+		}
+		for _, w := range ecsv.tableWriters {
+			w.Flush()
+			if err := w.Error(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 	if !ecsv.writtenHeader {
 		ecsv.Writer.WriteHeader(ecsv.csvWriter)
 		ecsv.writtenHeader = true
@@ -99,6 +195,8 @@ func init() {
 	exportCmd.AddCommand(exportCSVCmd)
 	exportCSVCmd.Flags().String("input", "json", "Input graph format (json, jsonld)")
 	exportCSVCmd.Flags().String("spec", "", "Export spec")
+	addSchemaFlags(exportCSVCmd.Flags())
+	exportCSVCmd.Flags().String("compiledschema", "", "Use the given compiled schema")
 
 	pipeline.RegisterPipelineStep("export/csv", func() pipeline.Step { return &CSVExport{} })
 }
@@ -124,10 +222,32 @@ The colum queries are evaluated with 'root' predefined to point to the current
 row root node. If a column query is not specified, it is assumed to be:
 
   (root) -[]-> (:DocumentNode {attributeName: <attrName>})
+
+A spec file can declare multiple tables. Each table is written to its
+own file, with a generated _id column containing the row root node id.
+Child tables are written for each row of their parent table, with a
+_parent column containing the parent row id. Use autoColumns to
+derive the columns from the schema attributes.
+
+{
+  "tables": [
+    {
+      "name": "person",
+      "autoColumns": true
+    },
+    {
+      "name": "phones",
+      "parent": "person",
+      "attribute": "<schema attribute id of the phones array>",
+      "autoColumns": true
+    }
+  ]
+}
 `,
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		step := &CSVExport{}
+		step.fromCmd(cmd)
 		step.SpecFile, _ = cmd.Flags().GetString("spec")
 		p := []pipeline.Step{
 			NewReadGraphStep(cmd),
@@ -15,16 +15,49 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"text/template"
 
 	"github.com/spf13/cobra"
 
 	"github.com/cloudprivacylabs/lpg/v2"
 	"github.com/cloudprivacylabs/lsa/layers/cmd/pipeline"
 	jsoningest "github.com/cloudprivacylabs/lsa/pkg/json"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
 )
 
-type JSONExport struct{}
+type JSONExport struct {
+	// If TypedValues is set, values are exported based on their value types
+	TypedValues bool `json:"typedValues" yaml:"typedValues"`
+	// EmptyValues is null, omit, or empty
+	EmptyValues   string   `json:"emptyValues" yaml:"emptyValues"`
+	IncludeLabels []string `json:"includeLabels" yaml:"includeLabels"`
+	IncludeTerms  []string `json:"includeTerms" yaml:"includeTerms"`
+	ExcludeLabels []string `json:"excludeLabels" yaml:"excludeLabels"`
+	ExcludeTerms  []string `json:"excludeTerms" yaml:"excludeTerms"`
+	// KeyTerm is the term used as the object keys. If empty,
+	// attributeName is used
+	KeyTerm            string `json:"keyTerm" yaml:"keyTerm"`
+	ExportTypeProperty bool   `json:"exportTypeProperty" yaml:"exportTypeProperty"`
+	// File is the output file name template. If empty, the output is
+	// written to stdout
+	File string `json:"file" yaml:"file"`
+
+	initialized  bool
+	fileTemplate *template.Template
+	index        int
+}
+
+// jsonExportFileData is the data passed to the output file name
+// template
+type jsonExportFileData struct {
+	// ID of the root node
+	ID string
+	// Index is the number of root nodes exported before this one
+	Index int
+}
 
 func (JSONExport) Name() string { return "export/json" }
 
@@ -34,21 +67,93 @@ Export the graph in the pipeline context as a JSON file.
 The output is constructed using "attributeName" annotations.
 
 operation: export/json
-params:`)
+params:
+  typedValues: If true, export values based on their value types. Numbers and
+    booleans are exported as JSON numbers and booleans, dates and times as
+    ISO 8601 strings, and measures as {"value":..., "unit":...}
+  emptyValues: null, omit, or empty. How to export null values and empty strings
+  includeLabels: If given, export only the value nodes with one of these labels
+  includeTerms: If given, export only the value nodes with one of these terms
+  excludeLabels: Do not export the nodes with one of these labels
+  excludeTerms: Do not export the nodes with one of these terms
+  keyTerm: Use the value of this term as object keys instead of attributeName
+  exportTypeProperty: If true, export non-LS types as "@type"
+  file: Output file name template. Each root node is written to a separate
+    file. The template is a Go template with {{.ID}} for the root node id, and
+    {{.Index}} for the root node index. If empty, writes to stdout.`)
 }
 
 func (*JSONExport) Flush(*pipeline.PipelineContext) error {
 	return nil
 }
 
-func (*JSONExport) Run(pipeline *pipeline.PipelineContext) error {
+func (je *JSONExport) exportOptions() (jsoningest.ExportOptions, error) {
+	switch je.EmptyValues {
+	case "", jsoningest.EmptyValueNull, jsoningest.EmptyValueOmit, jsoningest.EmptyValueString:
+	default:
+		return jsoningest.ExportOptions{}, fmt.Errorf("Invalid emptyValues: %s", je.EmptyValues)
+	}
+	ret := jsoningest.ExportOptions{
+		ExportTypeProperty: je.ExportTypeProperty,
+		TypedValues:        je.TypedValues,
+		EmptyValues:        je.EmptyValues,
+		IncludeLabels:      je.IncludeLabels,
+		IncludeTerms:       je.IncludeTerms,
+		ExcludeLabels:      je.ExcludeLabels,
+		ExcludeTerms:       je.ExcludeTerms,
+	}
+	if len(je.KeyTerm) > 0 {
+		ret.BuildNodeKeyFunc = jsoningest.GetBuildNodeKeyByTermFunc(je.KeyTerm)
+	}
+	return ret, nil
+}
+
+func (je *JSONExport) Run(pipeline *pipeline.PipelineContext) error {
+	if !je.initialized {
+		if len(je.File) > 0 {
+			var err error
+			je.fileTemplate, err = template.New("file").Parse(je.File)
+			if err != nil {
+				return err
+			}
+		}
+		je.initialized = true
+	}
+	exportOptions, err := je.exportOptions()
+	if err != nil {
+		return err
+	}
 	for _, node := range lpg.Sources(pipeline.Graph) {
-		exportOptions := jsoningest.ExportOptions{}
 		data, err := jsoningest.Export(node, exportOptions)
 		if err != nil {
-			failErr(err)
+			return err
+		}
+		if data == nil {
+			continue
+		}
+		if je.fileTemplate == nil {
+			if err := data.Encode(ExportTarget); err != nil {
+				return err
+			}
+			je.index++
+			continue
+		}
+		fileName := bytes.Buffer{}
+		if err := je.fileTemplate.Execute(&fileName, jsonExportFileData{ID: ls.GetNodeID(node), Index: je.index}); err != nil {
+			return err
+		}
+		je.index++
+		f, err := os.Create(fileName.String())
+		if err != nil {
+			return err
+		}
+		if err := data.Encode(f); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
 		}
-		data.Encode(ExportTarget)
 	}
 	return nil
 }
@@ -56,6 +161,15 @@ func (*JSONExport) Run(pipeline *pipeline.PipelineContext) error {
 func init() {
 	exportCmd.AddCommand(exportJSONCmd)
 	exportJSONCmd.Flags().String("input", "json", "Input graph format (json, jsonld)")
+	exportJSONCmd.Flags().Bool("typedValues", false, "Export values based on their value types")
+	exportJSONCmd.Flags().String("emptyValues", "", "Export empty values as null, omit, or empty")
+	exportJSONCmd.Flags().StringSlice("includeLabels", nil, "Export only the value nodes with these labels")
+	exportJSONCmd.Flags().StringSlice("includeTerms", nil, "Export only the value nodes with these terms")
+	exportJSONCmd.Flags().StringSlice("excludeLabels", nil, "Do not export the nodes with these labels")
+	exportJSONCmd.Flags().StringSlice("excludeTerms", nil, "Do not export the nodes with these terms")
+	exportJSONCmd.Flags().String("keyTerm", "", "Use the value of this term as object keys")
+	exportJSONCmd.Flags().Bool("exportTypeProperty", false, "Export non-LS types as @type")
+	exportJSONCmd.Flags().String("file", "", "Output file name template, e.g. out-{{.Index}}.json")
 
 	pipeline.RegisterPipelineStep("export/json", func() pipeline.Step { return &JSONExport{} })
 }
@@ -66,6 +180,15 @@ var exportJSONCmd = &cobra.Command{
 	Args:  cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		step := &JSONExport{}
+		step.TypedValues, _ = cmd.Flags().GetBool("typedValues")
+		step.EmptyValues, _ = cmd.Flags().GetString("emptyValues")
+		step.IncludeLabels, _ = cmd.Flags().GetStringSlice("includeLabels")
+		step.IncludeTerms, _ = cmd.Flags().GetStringSlice("includeTerms")
+		step.ExcludeLabels, _ = cmd.Flags().GetStringSlice("excludeLabels")
+		step.ExcludeTerms, _ = cmd.Flags().GetStringSlice("excludeTerms")
+		step.KeyTerm, _ = cmd.Flags().GetString("keyTerm")
+		step.ExportTypeProperty, _ = cmd.Flags().GetBool("exportTypeProperty")
+		step.File, _ = cmd.Flags().GetString("file")
 		p := []pipeline.Step{
 			NewReadGraphStep(cmd),
 			step,
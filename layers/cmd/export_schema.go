@@ -0,0 +1,129 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cloudprivacylabs/lsa/pkg/codegen"
+	jsoningest "github.com/cloudprivacylabs/lsa/pkg/json"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+func init() {
+	rootCmd.AddCommand(exportSchemaCmd)
+	addSchemaFlags(exportSchemaCmd.PersistentFlags())
+	exportSchemaCmd.PersistentFlags().String("compiledschema", "", "Use the given compiled schema")
+	exportSchemaCmd.PersistentFlags().String("output", "", "Output file. If empty, writes to stdout")
+
+	exportSchemaCmd.AddCommand(exportJSONSchemaCmd)
+	for _, c := range []*cobra.Command{exportGoCmd, exportProtoCmd} {
+		c.Flags().String("package", "model", "Package name")
+		c.Flags().String("typeName", "", "Name of the root type. Defaults to the schema value type or id")
+		exportSchemaCmd.AddCommand(c)
+	}
+}
+
+var exportSchemaCmd = &cobra.Command{
+	Use:   "export-schema",
+	Short: "Generate schemas and code from a layered schema",
+}
+
+// writeExportSchemaOutput writes data to the output file given in
+// the command line, or to stdout
+func writeExportSchemaOutput(cmd *cobra.Command, data []byte) error {
+	output, _ := cmd.Flags().GetString("output")
+	if len(output) == 0 {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(output, data, 0644)
+}
+
+var exportJSONSchemaCmd = &cobra.Command{
+	Use:   "jsonschema",
+	Short: "Generate a Draft 2020-12 JSON schema from a layered schema",
+	Long: `Generate a Draft 2020-12 JSON schema from a layered schema.
+
+References are written under $defs, and referred to using $ref.
+Polymorphic attributes are written as oneOf.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		layer := loadSchemaCmd(getContext(), cmd)
+		if layer == nil {
+			fail("Schema is required")
+		}
+		sch, err := jsoningest.ExportJSONSchema(layer)
+		if err != nil {
+			return err
+		}
+		var compact bytes.Buffer
+		if err := sch.Encode(&compact); err != nil {
+			return err
+		}
+		var out bytes.Buffer
+		if err := json.Indent(&out, compact.Bytes(), "", "  "); err != nil {
+			return err
+		}
+		out.WriteString("\n")
+		return writeExportSchemaOutput(cmd, out.Bytes())
+	},
+}
+
+// runCodegen loads the schema and writes the output of the generator
+func runCodegen(cmd *cobra.Command, generate func(*ls.Layer, codegen.Options) ([]byte, error)) error {
+	layer := loadSchemaCmd(getContext(), cmd)
+	if layer == nil {
+		fail("Schema is required")
+	}
+	var options codegen.Options
+	options.Package, _ = cmd.Flags().GetString("package")
+	options.RootName, _ = cmd.Flags().GetString("typeName")
+	out, err := generate(layer, options)
+	if err != nil {
+		return err
+	}
+	return writeExportSchemaOutput(cmd, out)
+}
+
+var exportGoCmd = &cobra.Command{
+	Use:   "go",
+	Short: "Generate Go struct definitions from a layered schema",
+	Long: `Generate Go struct definitions from a layered schema.
+
+Objects become structs with json tags from attributeName, arrays
+become slices, and references become shared struct types.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCodegen(cmd, codegen.GenerateGo)
+	},
+}
+
+var exportProtoCmd = &cobra.Command{
+	Use:   "proto",
+	Short: "Generate proto3 message definitions from a layered schema",
+	Long: `Generate proto3 message definitions from a layered schema.
+
+Objects become messages, arrays become repeated fields, and
+references become shared messages.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCodegen(cmd, codegen.GenerateProto)
+	},
+}
@@ -0,0 +1,229 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	// SQLite driver
+	_ "modernc.org/sqlite"
+
+	"github.com/cloudprivacylabs/lsa/layers/cmd/pipeline"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/relational"
+)
+
+type SQLExport struct {
+	BaseIngestParams
+	// CreateTables writes the CREATE TABLE statements before the
+	// first INSERT, or creates the tables in the SQLite database
+	CreateTables bool `json:"createTables" yaml:"createTables"`
+	// File is the output file for the SQL statements. If empty, writes
+	// to stdout
+	File string `json:"file" yaml:"file"`
+	// SQLite is the SQLite database file. If given, rows are inserted
+	// into the database instead of writing SQL statements
+	SQLite string `json:"sqlite" yaml:"sqlite"`
+
+	initialized bool
+	model       *relational.Model
+	out         io.Writer
+	file        *os.File
+	db          *sql.DB
+}
+
+func (SQLExport) Name() string { return "export/sql" }
+
+func (SQLExport) Help() {
+	fmt.Println(`Export Graph as SQL
+Export the entities of the graph in the pipeline context as rows of
+relational tables derived from the schema. There is one table for each
+entity, with columns for the value attributes. Arrays are written to
+child tables with _parent and _index columns.
+
+operation: export/sql
+params:
+  createTables: If true, write CREATE TABLE statements, or create the
+    tables in the SQLite database
+  file: Output file for the SQL statements. If empty, writes to stdout
+  sqlite: SQLite database file. If given, rows are inserted into the
+    database instead of writing INSERT statements`)
+	fmt.Println(baseIngestParamsHelp)
+}
+
+func (s *SQLExport) Flush(pipeline *pipeline.PipelineContext) error {
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return err
+		}
+		s.file = nil
+	}
+	if s.db != nil {
+		if err := s.db.Close(); err != nil {
+			return err
+		}
+		s.db = nil
+	}
+	return pipeline.FlushNext()
+}
+
+func (s *SQLExport) init(pipeline *pipeline.PipelineContext) error {
+	var layer *ls.Layer
+	if s.IsEmptySchema() {
+		layer, _ = pipeline.Properties["layer"].(*ls.Layer)
+	} else {
+		var err error
+		layer, err = LoadSchemaFromFile(pipeline.Context, s.CompiledSchema, s.Schema, s.Type, s.Bundle)
+		if err != nil {
+			return err
+		}
+	}
+	if layer == nil {
+		return fmt.Errorf("Schema is required for SQL export")
+	}
+	var err error
+	s.model, err = relational.BuildModel(layer)
+	if err != nil {
+		return err
+	}
+	if len(s.SQLite) > 0 {
+		s.db, err = sql.Open("sqlite", s.SQLite)
+		if err != nil {
+			return err
+		}
+		if s.CreateTables {
+			return s.model.CreateTables(pipeline.Context, s.db)
+		}
+		return nil
+	}
+	s.out = ExportTarget
+	if len(s.File) > 0 {
+		s.file, err = os.Create(s.File)
+		if err != nil {
+			return err
+		}
+		s.out = s.file
+	}
+	if s.CreateTables {
+		if err := s.model.WriteDDL(s.out); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(s.out, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLExport) Run(pipeline *pipeline.PipelineContext) error {
+	if !s.initialized {
+		if err := s.init(pipeline); err != nil {
+			return err
+		}
+		s.initialized = true
+	}
+	rows, err := s.model.Rows(pipeline.Graph)
+	if err != nil {
+		return err
+	}
+	if s.db != nil {
+		tx, err := s.db.BeginTx(pipeline.Context, nil)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := row.Insert(pipeline.Context, tx, nil); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		return pipeline.Next()
+	}
+	for _, row := range rows {
+		if _, err := io.WriteString(s.out, row.InsertStatement()+"\n"); err != nil {
+			return err
+		}
+	}
+	return pipeline.Next()
+}
+
+func init() {
+	exportCmd.AddCommand(exportSQLCmd)
+	exportSQLCmd.Flags().String("input", "json", "Input graph format (json, jsonld)")
+	exportSQLCmd.Flags().Bool("createTables", false, "Write CREATE TABLE statements, or create the tables in the SQLite database")
+	exportSQLCmd.Flags().String("file", "", "Output file for SQL statements")
+	exportSQLCmd.Flags().String("sqlite", "", "Insert rows into this SQLite database")
+	addSchemaFlags(exportSQLCmd.Flags())
+	exportSQLCmd.Flags().String("compiledschema", "", "Use the given compiled schema")
+
+	exportSchemaCmd.AddCommand(exportSQLDDLCmd)
+
+	pipeline.RegisterPipelineStep("export/sql", func() pipeline.Step { return &SQLExport{} })
+}
+
+var exportSQLCmd = &cobra.Command{
+	Use:   "sql",
+	Short: "Export the entities of a graph as SQL INSERT statements, or into a SQLite database",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		step := &SQLExport{}
+		step.fromCmd(cmd)
+		step.CreateTables, _ = cmd.Flags().GetBool("createTables")
+		step.File, _ = cmd.Flags().GetString("file")
+		step.SQLite, _ = cmd.Flags().GetString("sqlite")
+		p := []pipeline.Step{
+			NewReadGraphStep(cmd),
+			step,
+		}
+		_, err := runPipeline(p, Environment, "", args)
+		return err
+	},
+}
+
+var exportSQLDDLCmd = &cobra.Command{
+	Use:   "sql",
+	Short: "Generate CREATE TABLE statements from a layered schema",
+	Long: `Generate CREATE TABLE statements from a layered schema.
+
+There is one table for each entity, with columns for the value
+attributes. Nested objects are flattened into the entity table. Arrays
+are written to child tables with _parent and _index columns. Reference
+link specs become foreign keys to the id columns of the target entity.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		layer := loadSchemaCmd(getContext(), cmd)
+		if layer == nil {
+			fail("Schema is required")
+		}
+		model, err := relational.BuildModel(layer)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := model.WriteDDL(&buf); err != nil {
+			return err
+		}
+		return writeExportSchemaOutput(cmd, buf.Bytes())
+	},
+}
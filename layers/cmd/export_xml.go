@@ -0,0 +1,122 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/lsa/layers/cmd/pipeline"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	xmlingest "github.com/cloudprivacylabs/lsa/pkg/xml"
+)
+
+type XMLExport struct {
+	BaseIngestParams
+	// Prefixes maps namespaces to prefixes
+	Prefixes map[string]string `json:"prefixes" yaml:"prefixes"`
+	Indent   string            `json:"indent" yaml:"indent"`
+	// RootElement wraps the exported elements if the graph has more
+	// than one root
+	RootElement string `json:"rootElement" yaml:"rootElement"`
+
+	initialized bool
+	layer       *ls.Layer
+}
+
+func (XMLExport) Name() string { return "export/xml" }
+
+func (XMLExport) Help() {
+	fmt.Println(`Export XML Data from Graph
+Export the graph in the pipeline context as an XML document.
+Element and attribute names are constructed using "attributeName" and
+"xmlns" annotations. Schema attributes with "xmlattribute" are written
+as XML attributes, and values of schema attributes with "xmlvalueAttr"
+are written to the named attribute.
+
+operation: export/xml
+params:
+  prefixes:
+    <namespace>: <prefix>  # Namespace prefixes. The root element namespace is the default namespace
+  indent: Indentation string. If empty, the output is not indented
+  rootElement: Name of the element that wraps the exported elements if
+     the graph has more than one root. If empty, such graphs cannot be
+     exported
+
+  # Specify the schema the input graph was ingested with. If the schema
+  # is given, objects are written in attributeList order`)
+	fmt.Println(baseIngestParamsHelp)
+}
+
+func (*XMLExport) Flush(pipeline *pipeline.PipelineContext) error {
+	return pipeline.FlushNext()
+}
+
+func (x *XMLExport) Run(pipeline *pipeline.PipelineContext) error {
+	if !x.initialized {
+		if x.IsEmptySchema() {
+			x.layer, _ = pipeline.Properties["layer"].(*ls.Layer)
+		} else {
+			var err error
+			x.layer, err = LoadSchemaFromFile(pipeline.Context, x.CompiledSchema, x.Schema, x.Type, x.Bundle)
+			if err != nil {
+				return err
+			}
+		}
+		x.initialized = true
+	}
+	exportOptions := xmlingest.ExportOptions{
+		Prefixes:    x.Prefixes,
+		Indent:      x.Indent,
+		RootElement: xml.Name{Local: x.RootElement},
+	}
+	if err := xmlingest.ExportNodes(lpg.Sources(pipeline.Graph), x.layer, exportOptions, ExportTarget); err != nil {
+		return err
+	}
+	return pipeline.Next()
+}
+
+func init() {
+	exportCmd.AddCommand(exportXMLCmd)
+	exportXMLCmd.Flags().String("input", "json", "Input graph format (json, jsonld)")
+	exportXMLCmd.Flags().StringToString("prefix", nil, "Namespace prefixes as namespace=prefix")
+	exportXMLCmd.Flags().String("indent", "  ", "Indentation string")
+	exportXMLCmd.Flags().String("root", "", "Root element wrapping multiple exported elements")
+	addSchemaFlags(exportXMLCmd.Flags())
+
+	pipeline.RegisterPipelineStep("export/xml", func() pipeline.Step { return &XMLExport{} })
+}
+
+var exportXMLCmd = &cobra.Command{
+	Use:   "xml",
+	Short: "Export a graph as an XML document",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		step := &XMLExport{}
+		step.fromCmd(cmd)
+		step.Prefixes, _ = cmd.Flags().GetStringToString("prefix")
+		step.Indent, _ = cmd.Flags().GetString("indent")
+		step.RootElement, _ = cmd.Flags().GetString("root")
+		p := []pipeline.Step{
+			NewReadGraphStep(cmd),
+			step,
+		}
+		_, err := runPipeline(p, Environment, "", args)
+		return err
+	},
+}
@@ -41,6 +41,9 @@ func init() {
 	ingestCmd.PersistentFlags().Bool("embedSchemaNodes", true, "Embed schema nodes into document nodes")
 	ingestCmd.PersistentFlags().Bool("onlySchemaAttributes", false, "Only ingest nodes that have an associated schema attribute")
 	ingestCmd.PersistentFlags().Bool("ingestNullValues", false, "Ingest values even if they are empty")
+	ingestCmd.PersistentFlags().String("entityIndex", "", "Persistent entity index file used to link entities across runs")
+	ingestCmd.PersistentFlags().String("linkRecords", "", "Append the links across runs to this file as JSON lines")
+	ingestCmd.PersistentFlags().String("linkReport", "", "Write unresolved and ambiguous references to this CSV file")
 }
 
 type BaseIngestParams struct {
@@ -51,6 +54,12 @@ type BaseIngestParams struct {
 	EmbedSchemaNodes     bool     `json:"embedSchemaNodes" yaml:"embedSchemaNodes"`
 	OnlySchemaAttributes bool     `json:"onlySchemaAttributes" yaml:"onlySchemaAttributes"`
 	IngestNullValues     bool     `json:"ingestNullValues" yaml:"ingestNullValues"`
+	EntityIndex          string   `json:"entityIndex" yaml:"entityIndex"`
+	LinkRecords          string   `json:"linkRecords" yaml:"linkRecords"`
+	LinkReport           string   `json:"linkReport" yaml:"linkReport"`
+
+	crossLinks *crossGraphLinks
+	refReport  *referenceReport
 }
 
 // IsEmptySchema returns true if none of the schema properties are set
@@ -66,6 +75,9 @@ func (b *BaseIngestParams) fromCmd(cmd *cobra.Command) {
 	b.EmbedSchemaNodes, _ = cmd.Flags().GetBool("embedSchemaNodes")
 	b.OnlySchemaAttributes, _ = cmd.Flags().GetBool("onlySchemaAttributes")
 	b.IngestNullValues, _ = cmd.Flags().GetBool("ingestNullValues")
+	b.EntityIndex, _ = cmd.Flags().GetString("entityIndex")
+	b.LinkRecords, _ = cmd.Flags().GetString("linkRecords")
+	b.LinkReport, _ = cmd.Flags().GetString("linkReport")
 }
 
 const baseIngestParamsHelp = `  
@@ -84,7 +96,13 @@ const baseIngestParamsHelp = `
   # Ingestion control
 
   embedSchemaNodes: false
-  onlySchemaAttributes: false`
+  onlySchemaAttributes: false
+
+  # Linking across runs
+
+  entityIndex: entity index file. References to entities of earlier runs are resolved using this index
+  linkRecords: links across runs are appended to this file as JSON lines
+  linkReport: unresolved and ambiguous references are written to this CSV file`
 
 var ingestCmd = &cobra.Command{
 	Use:   "ingest",
@@ -124,6 +142,33 @@ type. The bundle is a JSON file:
   layers ingest csv --compiledSchema <schemaGraphFile> --schema <schemaId>
 
 This form will use a previously compiled schema.
+
+References are resolved within the ingested graph. When related
+entities arrive in separate files or runs, a persistent entity index
+records the entity ids and node ids of ingested entities:
+
+  layers ingest json --schema order.json --entityIndex entities.db --linkRecords links.jsonl orders.json
+
+References to entities ingested in earlier runs are written to the
+link records file as {"from": nodeId, "to": nodeId, "label": label}.
+References to entities that are not ingested yet are kept in the
+index, and written to the link records file when the entity is
+ingested. Node ids must be stable across runs.
+
+The referencePolicy annotation of a reference gives what to do if a
+foreign key does not match an entity, or matches more than one entity
+when the reference is not multi:
+
+  fail:              Stop with an error
+  skip:              Do not link
+  createPlaceholder: Link unresolved references to a new placeholder
+                     entity with ls:placeholder=true, and ambiguous
+                     references to all targets
+  linkAll:           Link ambiguous references to all targets, and skip
+                     unresolved references (default)
+
+Use --linkReport to write these references with their source entities
+to a CSV file.
 `,
 }
 
@@ -71,6 +71,9 @@ params:`)
 }
 
 func (ci *CSVIngester) Flush(ctx *pipeline.PipelineContext) error {
+	if err := ci.closeLinkOutputs(); err != nil {
+		return err
+	}
 	return ctx.FlushNext()
 }
 
@@ -156,10 +159,12 @@ func (ci *CSVIngester) Run(pipeline *pipeline.PipelineContext) error {
 				if ci.IngestByRows {
 					pipeline.SetGraph(cmdutil.NewDocumentGraph())
 				}
-				builder := ls.NewGraphBuilder(pipeline.Graph, ls.GraphBuilderOptions{
-					EmbedSchemaNodes:     ci.EmbedSchemaNodes,
-					OnlySchemaAttributes: ci.OnlySchemaAttributes,
-				})
+				options, err := ci.graphBuilderOptions()
+				if err != nil {
+					doneErr = err
+					return
+				}
+				builder := ls.NewGraphBuilder(pipeline.Graph, options)
 				templateData := map[string]interface{}{
 					"rowIndex":  row,
 					"dataIndex": row - ci.StartRow,
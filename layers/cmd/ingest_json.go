@@ -46,6 +46,9 @@ params:`)
 }
 
 func (ji *JSONIngester) Flush(pipeline *pipeline.PipelineContext) error {
+	if err := ji.closeLinkOutputs(); err != nil {
+		return err
+	}
 	return pipeline.FlushNext()
 }
 
@@ -85,13 +88,15 @@ func (ji *JSONIngester) Run(pipeline *pipeline.PipelineContext) error {
 				}
 			}()
 			pipeline.SetGraph(cmdutil.NewDocumentGraph())
-			builder := ls.NewGraphBuilder(pipeline.Graph, ls.GraphBuilderOptions{
-				EmbedSchemaNodes:     ji.EmbedSchemaNodes,
-				OnlySchemaAttributes: ji.OnlySchemaAttributes,
-			})
+			options, err := ji.graphBuilderOptions()
+			if err != nil {
+				doneErr = err
+				return
+			}
+			builder := ls.NewGraphBuilder(pipeline.Graph, options)
 			baseID := ji.ID
 
-			_, err := jsoningest.IngestStream(pipeline.Context, baseID, stream, ji.parser, builder, ji.ingester)
+			_, err = jsoningest.IngestStream(pipeline.Context, baseID, stream, ji.parser, builder, ji.ingester)
 			if err != nil {
 				doneErr = err
 				return
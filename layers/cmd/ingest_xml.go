@@ -28,10 +28,13 @@ import (
 
 type XMLIngester struct {
 	BaseIngestParams
-	ID          string
-	initialized bool
-	parser      xmlingest.Parser
-	ingester    *ls.Ingester
+	ID string
+	// If true, values are not validated during ingestion, so a
+	// following validate step can report all violations
+	SkipValueValidation bool `json:"skipValueValidation" yaml:"skipValueValidation"`
+	initialized         bool
+	parser              xmlingest.Parser
+	ingester            *ls.Ingester
 }
 
 func (XMLIngester) Name() string { return "ingest/xml" }
@@ -43,10 +46,14 @@ Ingest an XML file based on a schema variant and output a graph
 operation: ingest/xml
 params:`)
 	fmt.Println(baseIngestParamsHelp)
-	fmt.Println(`  id:""   # Base ID for the root node`)
+	fmt.Println(`  id:""   # Base ID for the root node
+  skipValueValidation: false # Do not validate values during ingestion`)
 }
 
 func (xml *XMLIngester) Flush(pipeline *pipeline.PipelineContext) error {
+	if err := xml.closeLinkOutputs(); err != nil {
+		return err
+	}
 	return pipeline.FlushNext()
 }
 
@@ -62,6 +69,7 @@ func (xml *XMLIngester) Run(pipeline *pipeline.PipelineContext) error {
 		xml.parser = xmlingest.Parser{
 			OnlySchemaAttributes: xml.OnlySchemaAttributes,
 			IngestEmptyValues:    xml.IngestNullValues,
+			SkipValueValidation:  xml.SkipValueValidation,
 			Layer:                layer,
 		}
 		xml.initialized = true
@@ -86,10 +94,12 @@ func (xml *XMLIngester) Run(pipeline *pipeline.PipelineContext) error {
 				}
 			}()
 			pipeline.SetGraph(cmdutil.NewDocumentGraph())
-			builder := ls.NewGraphBuilder(pipeline.Graph, ls.GraphBuilderOptions{
-				EmbedSchemaNodes:     xml.EmbedSchemaNodes,
-				OnlySchemaAttributes: xml.OnlySchemaAttributes,
-			})
+			options, err := xml.graphBuilderOptions()
+			if err != nil {
+				doneErr = err
+				return
+			}
+			builder := ls.NewGraphBuilder(pipeline.Graph, options)
 
 			baseID := xml.ID
 
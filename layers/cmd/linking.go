@@ -0,0 +1,156 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cloudprivacylabs/lsa/pkg/entityindex"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+// crossGraphLinks keeps the persistent entity index and the link
+// record output of an ingestion step
+type crossGraphLinks struct {
+	index *entityindex.BoltIndex
+	out   *os.File
+	enc   *json.Encoder
+	// Links are written once
+	seen map[ls.LinkRecord]struct{}
+	err  error
+}
+
+func (c *crossGraphLinks) write(link ls.LinkRecord) {
+	if c.err != nil {
+		return
+	}
+	if _, ok := c.seen[link]; ok {
+		return
+	}
+	c.seen[link] = struct{}{}
+	c.err = c.enc.Encode(link)
+}
+
+// referenceReport collects the unresolved and ambiguous references
+type referenceReport struct {
+	refs []ls.UnresolvedReference
+	// A graph can be linked more than once, so references are
+	// recorded once
+	seen map[string]struct{}
+}
+
+func (r *referenceReport) add(ref ls.UnresolvedReference) {
+	key := strings.Join([]string{ref.SchemaNodeID, ref.SourceEntity, strings.Join(ref.ForeignKey, "\x00")}, "\x01")
+	if _, ok := r.seen[key]; ok {
+		return
+	}
+	r.seen[key] = struct{}{}
+	r.refs = append(r.refs, ref)
+}
+
+// writeCSV writes the references with columns reference,
+// targetEntity, foreignKey, sourceEntity, status, targets, and policy
+func (r *referenceReport) writeCSV(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"reference", "targetEntity", "foreignKey", "sourceEntity", "status", "targets", "policy"})
+	for _, ref := range r.refs {
+		status := "unresolved"
+		if ref.IsAmbiguous() {
+			status = "ambiguous"
+		}
+		w.Write([]string{ref.SchemaNodeID, ref.TargetEntity, strings.Join(ref.ForeignKey, ","), ref.SourceEntity, status, strings.Join(ref.Targets, "; "), ref.Policy})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// graphBuilderOptions returns the graph builder options for the
+// ingestion parameters. The entity index and the link record file
+// are opened when first called.
+func (b *BaseIngestParams) graphBuilderOptions() (ls.GraphBuilderOptions, error) {
+	ret := ls.GraphBuilderOptions{
+		EmbedSchemaNodes:     b.EmbedSchemaNodes,
+		OnlySchemaAttributes: b.OnlySchemaAttributes,
+	}
+	if len(b.LinkReport) > 0 {
+		if b.refReport == nil {
+			b.refReport = &referenceReport{seen: make(map[string]struct{})}
+		}
+		ret.UnresolvedReferenceFunc = b.refReport.add
+	}
+	if len(b.EntityIndex) == 0 {
+		return ret, nil
+	}
+	if b.crossLinks == nil {
+		if len(b.LinkRecords) == 0 {
+			return ret, fmt.Errorf("linkRecords file is required with entityIndex")
+		}
+		index, err := entityindex.Open(b.EntityIndex)
+		if err != nil {
+			return ret, err
+		}
+		out, err := os.OpenFile(b.LinkRecords, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			index.Close()
+			return ret, err
+		}
+		b.crossLinks = &crossGraphLinks{
+			index: index,
+			out:   out,
+			enc:   json.NewEncoder(out),
+			seen:  make(map[ls.LinkRecord]struct{}),
+		}
+	}
+	if b.crossLinks.err != nil {
+		return ret, b.crossLinks.err
+	}
+	ret.EntityIndex = b.crossLinks.index
+	ret.LinkRecordFunc = b.crossLinks.write
+	return ret, nil
+}
+
+// closeLinkOutputs writes the reference report, and closes the
+// entity index and the link record file if they are open
+func (b *BaseIngestParams) closeLinkOutputs() error {
+	if b.refReport != nil {
+		rep := b.refReport
+		b.refReport = nil
+		if err := rep.writeCSV(b.LinkReport); err != nil {
+			return err
+		}
+	}
+	if b.crossLinks == nil {
+		return nil
+	}
+	c := b.crossLinks
+	b.crossLinks = nil
+	err := c.err
+	if e := c.out.Close(); err == nil {
+		err = e
+	}
+	if e := c.index.Close(); err == nil {
+		err = e
+	}
+	return err
+}
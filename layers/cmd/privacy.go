@@ -0,0 +1,155 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cloudprivacylabs/lsa/layers/cmd/cmdutil"
+	"github.com/cloudprivacylabs/lsa/layers/cmd/pipeline"
+	"github.com/cloudprivacylabs/lsa/pkg/privacy"
+)
+
+const defaultPrivacySecretEnv = "LSA_PRIVACY_SECRET"
+
+type PrivacyStep struct {
+	PolicyFile string `json:"policyFile" yaml:"policyFile"`
+	privacy.Policy
+	SecretEnv  string `json:"secretEnv" yaml:"secretEnv"`
+	ReportFile string `json:"reportFile" yaml:"reportFile"`
+
+	initialized bool
+	processor   privacy.Processor
+	report      privacy.Report
+}
+
+func (PrivacyStep) Name() string { return "privacy" }
+
+func (PrivacyStep) Help() {
+	fmt.Println(`Privacy transformations
+Redact, mask, tokenize, generalize, or drop document nodes based on schema annotations
+
+operation: privacy
+params:
+  policyFile: File containing the rules, or
+  rules:
+  - term: schema term to look for, e.g. http://example.org/privacyClassification
+    values:
+    - PII    # If given, the term must have one of these values
+    action: redact, mask, tokenize, generalize, or drop
+    params:
+      mask.keep: 4
+  ignoreSchemaActions: false # If true, privacy/action annotations are ignored
+  secretEnv: Environment variable containing the tokenization key (default LSA_PRIVACY_SECRET)
+  reportFile: Write the transformation report to this file as JSON
+
+If none of the rules match a node, the privacy/action annotation of the
+schema node is used.`)
+}
+
+func (ps *PrivacyStep) Flush(pipeline *pipeline.PipelineContext) error {
+	return pipeline.FlushNext()
+}
+
+func (ps *PrivacyStep) Run(pipeline *pipeline.PipelineContext) error {
+	if !ps.initialized {
+		if len(ps.PolicyFile) > 0 {
+			if err := cmdutil.ReadJSONOrYAML(ps.PolicyFile, &ps.Policy); err != nil {
+				return err
+			}
+		}
+		env := ps.SecretEnv
+		if len(env) == 0 {
+			env = defaultPrivacySecretEnv
+		}
+		secret, ok := pipeline.Env[env]
+		if !ok {
+			secret = os.Getenv(env)
+		}
+		ps.processor = privacy.Processor{
+			Policy: ps.Policy,
+			Secret: []byte(secret),
+		}
+		ps.initialized = true
+	}
+	report, err := ps.processor.ProcessGraph(pipeline.Context, pipeline.Graph)
+	if err != nil {
+		return err
+	}
+	ps.report.Merge(report)
+	pipeline.Properties["privacyReport"] = ps.report
+	if len(ps.ReportFile) > 0 {
+		data, err := json.MarshalIndent(ps.report.Sorted(), "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(ps.ReportFile, data, 0644); err != nil {
+			return err
+		}
+	}
+	return pipeline.Next()
+}
+
+func init() {
+	rootCmd.AddCommand(privacyCmd)
+	privacyCmd.Flags().String("input", "json", "Input graph format (json, jsonld)")
+	privacyCmd.Flags().String("output", "json", "Output format, json, jsonld, or dot")
+	privacyCmd.Flags().String("policy", "", "Privacy policy file")
+	privacyCmd.Flags().String("secretEnv", defaultPrivacySecretEnv, "Environment variable containing the tokenization key")
+	privacyCmd.Flags().String("report", "", "Write the transformation report to this file")
+
+	pipeline.RegisterPipelineStep("privacy", func() pipeline.Step { return &PrivacyStep{} })
+}
+
+var privacyCmd = &cobra.Command{
+	Use:   "privacy",
+	Short: "Apply privacy transformations to a graph",
+	Long: `Apply privacy transformations to an ingested graph.
+
+The transformations are selected by the privacy/action annotations of the
+schema nodes, or by the rules given in a policy file:
+
+{
+  "rules": [
+    {
+      "term": "http://example.org/privacyClassification",
+      "values": ["PII"],
+      "action": "mask",
+      "params": { "mask.keep": "4" }
+    }
+  ]
+}
+
+The available actions are redact, mask, tokenize, generalize, and drop.
+Tokenization uses HMAC with the key given in the secretEnv environment variable.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		step := &PrivacyStep{}
+		step.PolicyFile, _ = cmd.Flags().GetString("policy")
+		step.SecretEnv, _ = cmd.Flags().GetString("secretEnv")
+		step.ReportFile, _ = cmd.Flags().GetString("report")
+		p := []pipeline.Step{
+			NewReadGraphStep(cmd),
+			step,
+			NewWriteGraphStep(cmd),
+		}
+		_, err := runPipeline(p, Environment, "", args)
+		return err
+	},
+}
@@ -15,19 +15,25 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 
 	"github.com/cloudprivacylabs/lsa/layers/cmd/cmdutil"
 	"github.com/cloudprivacylabs/lsa/layers/cmd/pipeline"
 	"github.com/cloudprivacylabs/lsa/pkg/ls"
 	"github.com/cloudprivacylabs/lsa/pkg/transform"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 )
 
 type ReshapeStep struct {
 	BaseIngestParams
 	ScriptFile  string `json:"scriptFile" yaml:"scriptFile"`
+	TraceFile   string `json:"traceFile" yaml:"traceFile"`
+	DryRun      bool   `json:"dryRun" yaml:"dryRun"`
 	layer       *ls.Layer
+	traceOut    *os.File
 	script      *transform.TransformScript
 	initialized bool
 	ingester    *ls.Ingester
@@ -36,6 +42,12 @@ type ReshapeStep struct {
 func (ReshapeStep) Name() string { return "reshape" }
 
 func (rs *ReshapeStep) Flush(pipeline *pipeline.PipelineContext) error {
+	if rs.traceOut != nil {
+		if err := rs.traceOut.Close(); err != nil {
+			return err
+		}
+		rs.traceOut = nil
+	}
 	return pipeline.FlushNext()
 }
 
@@ -46,6 +58,10 @@ operation: reshape
 params:
   # Specify the schema the input graph should be reshaped to
   scriptFile: transformation script file
+  # Write the reshape trace to this file, one JSON object per input graph
+  traceFile: trace.json
+  # If true, evaluate the script but do not build the output graph
+  dryRun: false
 
 The scriptFile contains transformation scripts. This is a YAML or JSON file of the following format:
 
@@ -67,6 +83,22 @@ reshapeNodes:
      - value
      - value
 
+functions:
+  functionName:
+    params:
+      - param1
+      - param2
+    expr: openCypher query using param1 and param2
+
+The functions section defines functions that can be called from the
+expressions of the script. The parameters are available as variables
+in the function query. If the query returns a single value, that is
+the function result. Functions can call other functions, up to 100
+nested calls. The variables of the calling expression are also
+visible in the function query, so functions should only use their
+parameters. Functions registered by Go packages, such as
+types.parseDate and types.parseDateTime, can also be called.
+
 The map section deals with field mappings. Nodes that are instances of
 sourceSchemaNodeId are mapped to the instances of targetSchemaNodeIds.
 
@@ -94,7 +126,11 @@ https://lschema.org/transform namespace:
   the target schema node Id.
 
   https://lschema.org/transform/mapContext: This is an openCypher expression that
-  evaluates into a node. Any mapProperty lookups will be performed under this node.`)
+  evaluates into a node. Any mapProperty lookups will be performed under this node.
+
+The trace file records, for each target schema node, the evaluated
+expressions and their results, exported variables, source nodes
+selected by mappings, and why nodes were or were not generated.`)
 	fmt.Println(baseIngestParamsHelp)
 }
 
@@ -121,20 +157,39 @@ func (rs *ReshapeStep) Run(pipeline *pipeline.PipelineContext) error {
 				return err
 			}
 		}
+		if len(rs.TraceFile) > 0 {
+			rs.traceOut, err = os.Create(rs.TraceFile)
+			if err != nil {
+				return err
+			}
+		}
 		rs.initialized = true
 		rs.ingester = &ls.Ingester{Schema: rs.layer}
 	}
 	reshaper := transform.Reshaper{
 		Script: rs.script,
+		DryRun: rs.DryRun,
+	}
+	if rs.traceOut != nil {
+		reshaper.Trace = &transform.ReshapeTrace{}
 	}
 	reshaper.TargetSchema = rs.layer
 	reshaper.Builder = ls.NewGraphBuilder(nil, ls.GraphBuilderOptions{
 		EmbedSchemaNodes: true,
 	})
 	err = reshaper.Reshape(pipeline.Context, pipeline.Graph, rs.ingester)
+	if reshaper.Trace != nil {
+		// Write the trace even if reshape failed
+		if terr := json.NewEncoder(rs.traceOut).Encode(reshaper.Trace); terr != nil && err == nil {
+			err = terr
+		}
+	}
 	if err != nil {
 		return err
 	}
+	if rs.DryRun {
+		return nil
+	}
 	pipeline.SetGraph(reshaper.Builder.GetGraph())
 	if err := pipeline.Next(); err != nil {
 		return err
@@ -149,6 +204,12 @@ func init() {
 	reshapeCmd.Flags().String("input", "json", "Input graph format (json, jsonld)")
 	reshapeCmd.PersistentFlags().String("output", "json", "Output format, json, jsonld, or dot")
 	reshapeCmd.Flags().String("script", "", "Transformation script file")
+	reshapeCmd.Flags().String("trace", "", "Write the reshape trace to this file")
+	reshapeCmd.Flags().Bool("dryRun", false, "Evaluate the script without building the output graph")
+
+	reshapeCmd.AddCommand(reshapeInvertCmd)
+	reshapeInvertCmd.Flags().String("script", "", "Transformation script file")
+	reshapeInvertCmd.Flags().String("format", "yaml", "Output format, yaml or json")
 
 	pipeline.RegisterPipelineStep("reshape", func() pipeline.Step { return &ReshapeStep{} })
 }
@@ -161,6 +222,8 @@ var reshapeCmd = &cobra.Command{
 		step := &ReshapeStep{}
 		step.fromCmd(cmd)
 		step.ScriptFile, _ = cmd.Flags().GetString("script")
+		step.TraceFile, _ = cmd.Flags().GetString("trace")
+		step.DryRun, _ = cmd.Flags().GetBool("dryRun")
 		p := []pipeline.Step{
 			NewReadGraphStep(cmd),
 			step,
@@ -170,3 +233,49 @@ var reshapeCmd = &cobra.Command{
 		return err
 	},
 }
+
+var reshapeInvertCmd = &cobra.Command{
+	Use:   "invert",
+	Short: "Generate the inverse of a reshape script",
+	Long: `Generate a reshape script that maps the target schema of the given
+script back to its source schema.
+
+Only the reshape nodes that copy a single source node can be
+inverted. These are reshape nodes that contain only a source mapping,
+or only a valueExpr of the form:
+
+  match (n) where n.` + "`https://lschema.org/schemaNodeId`" + `='sourceId' return n
+
+The inverse script uses source mappings. The reshape nodes that cannot
+be inverted are listed on stderr.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scriptFile, _ := cmd.Flags().GetString("script")
+		if len(scriptFile) == 0 {
+			return fmt.Errorf("Script file is required")
+		}
+		var script transform.TransformScript
+		if err := cmdutil.ReadJSONOrYAML(scriptFile, &script); err != nil {
+			return err
+		}
+		inverse, nonInvertible := script.Invert()
+		for _, x := range nonInvertible {
+			fmt.Fprintf(os.Stderr, "Not invertible: %s\n", x)
+		}
+		var data []byte
+		var err error
+		switch format, _ := cmd.Flags().GetString("format"); format {
+		case "yaml":
+			data, err = yaml.Marshal(inverse)
+		case "json":
+			data, err = json.MarshalIndent(inverse, "", "  ")
+		default:
+			return fmt.Errorf("Unknown output format: %s", format)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	},
+}
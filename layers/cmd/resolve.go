@@ -0,0 +1,189 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cloudprivacylabs/lsa/layers/cmd/pipeline"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/resolution"
+)
+
+type ResolveStep struct {
+	BaseIngestParams
+	// Action overrides the er/action annotation of the schema
+	Action string `json:"action" yaml:"action"`
+	// Threshold overrides the er/threshold annotation of the schema
+	Threshold  *float64 `json:"threshold" yaml:"threshold"`
+	ReportFile string   `json:"reportFile" yaml:"reportFile"`
+
+	initialized bool
+	resolver    *resolution.Resolver
+	report      []resolveReportItem
+}
+
+type resolveReportItem struct {
+	Entity1 string  `json:"entity1"`
+	Entity2 string  `json:"entity2"`
+	Score   float64 `json:"score"`
+}
+
+func (ResolveStep) Name() string { return "resolve" }
+
+func (ResolveStep) Help() {
+	fmt.Println(`Entity resolution
+Find the entities that refer to the same real-world entity using the
+er/ annotations of the schema, and link or merge them
+
+operation: resolve
+params:
+  action: link or merge. Overrides the er/action annotation of the schema root
+  threshold: Minimum match score. Overrides the er/threshold annotation of the schema root
+  reportFile: Write the matching entity pairs to this file as JSON
+
+  # Specify the schema the input graph was ingested with`)
+	fmt.Println(baseIngestParamsHelp)
+}
+
+func (rs *ResolveStep) Flush(pipeline *pipeline.PipelineContext) error {
+	if len(rs.ReportFile) > 0 {
+		data, err := json.MarshalIndent(rs.report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(rs.ReportFile, data, 0644); err != nil {
+			return err
+		}
+	}
+	return pipeline.FlushNext()
+}
+
+func (rs *ResolveStep) Run(pipeline *pipeline.PipelineContext) error {
+	if !rs.initialized {
+		var layer *ls.Layer
+		if rs.IsEmptySchema() {
+			layer, _ = pipeline.Properties["layer"].(*ls.Layer)
+		} else {
+			var err error
+			layer, err = LoadSchemaFromFile(pipeline.Context, rs.CompiledSchema, rs.Schema, rs.Type, rs.Bundle)
+			if err != nil {
+				return err
+			}
+		}
+		if layer == nil {
+			return fmt.Errorf("No schema")
+		}
+		var err error
+		rs.resolver, err = resolution.NewResolver(layer)
+		if err != nil {
+			return err
+		}
+		if rs.resolver == nil {
+			return fmt.Errorf("No entity resolution fields in schema")
+		}
+		switch rs.Action {
+		case "":
+		case resolution.ActionLink, resolution.ActionMerge:
+			rs.resolver.Action = rs.Action
+		default:
+			return fmt.Errorf("Unknown entity resolution action: %s", rs.Action)
+		}
+		if rs.Threshold != nil {
+			rs.resolver.Threshold = *rs.Threshold
+		}
+		rs.report = make([]resolveReportItem, 0)
+		rs.initialized = true
+	}
+	for _, m := range rs.resolver.Resolve(pipeline.Graph) {
+		rs.report = append(rs.report, resolveReportItem{
+			Entity1: ls.GetNodeID(m.Entity1),
+			Entity2: ls.GetNodeID(m.Entity2),
+			Score:   m.Score,
+		})
+	}
+	return pipeline.Next()
+}
+
+func init() {
+	rootCmd.AddCommand(resolveCmd)
+	resolveCmd.Flags().String("input", "json", "Input graph format (json, jsonld)")
+	resolveCmd.Flags().String("output", "json", "Output format, json, jsonld, or dot")
+	resolveCmd.Flags().String("action", "", "link or merge. Overrides the schema annotation")
+	resolveCmd.Flags().Float64("threshold", 0, "Minimum match score. Overrides the schema annotation")
+	resolveCmd.Flags().String("report", "", "Write the matching entity pairs to this file")
+	addSchemaFlags(resolveCmd.Flags())
+
+	pipeline.RegisterPipelineStep("resolve", func() pipeline.Step { return &ResolveStep{} })
+}
+
+var resolveCmd = &cobra.Command{
+	Use:   "resolve",
+	Short: "Find and link or merge matching entities in a graph",
+	Long: `Find the entities in an ingested graph that refer to the same
+real-world entity, such as patient records coming from different
+systems without a shared key.
+
+The matching fields are annotated in the schema:
+
+  "lastName": {
+    "@type": "Value",
+    "erComparator": "phonetic",  // exact, phonetic, date, or similarity
+    "erM": 0.95,                 // P(agree | same entity), default 0.9
+    "erU": 0.01,                 // P(agree | different entities), default 0.1
+    "erBlock": [ "name" ]        // Blocking keys containing this field
+  },
+  "dob": {
+    "@type": "Value",
+    "erComparator": "date",
+    "erDateTolerance": 1         // Days
+  }
+
+Similarity fields use Jaro-Winkler similarity with the
+erSimilarityThreshold (default 0.85). Only the entities sharing a
+blocking key are compared. If there are no blocking keys, all pairs are
+compared.
+
+Pairs are scored using the Fellegi-Sunter model: each field adds
+log2(m/u) if the values agree, and log2((1-m)/(1-u)) if they
+disagree. Pairs scoring at least the erThreshold of the schema root
+match. The default threshold is half of the maximum score.
+
+If the erAction of the schema root is "link" (default), matching
+entities are connected with https://lschema.org/er/sameAs edges
+carrying the score. If it is "merge", matching entities are merged.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		step := &ResolveStep{}
+		step.fromCmd(cmd)
+		step.Action, _ = cmd.Flags().GetString("action")
+		if cmd.Flags().Changed("threshold") {
+			th, _ := cmd.Flags().GetFloat64("threshold")
+			step.Threshold = &th
+		}
+		step.ReportFile, _ = cmd.Flags().GetString("report")
+		p := []pipeline.Step{
+			NewReadGraphStep(cmd),
+			step,
+			NewWriteGraphStep(cmd),
+		}
+		_, err := runPipeline(p, Environment, "", args)
+		return err
+	},
+}
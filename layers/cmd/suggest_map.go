@@ -0,0 +1,106 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/cloudprivacylabs/lsa/pkg/transform"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	rootCmd.AddCommand(suggestMapCmd)
+	suggestMapCmd.Flags().String("source", "", "Source schema file")
+	suggestMapCmd.Flags().String("sourceType", "", "Source type name if the source is a bundle")
+	suggestMapCmd.Flags().String("target", "", "Target schema file")
+	suggestMapCmd.Flags().String("targetType", "", "Target type name if the target is a bundle")
+	suggestMapCmd.Flags().StringSlice("bundle", nil, "Schema bundle(s)")
+	suggestMapCmd.Flags().Float64("threshold", 0.75, "Minimum score for a match to be included in the script")
+	suggestMapCmd.Flags().Float64("minScore", 0.4, "Minimum score for a candidate to be reported")
+	suggestMapCmd.Flags().Int("maxCandidates", 3, "Maximum number of candidates reported for an unmatched attribute")
+	suggestMapCmd.Flags().StringSlice("conceptTerm", []string{transform.OWLSameAs}, "Attributes sharing a value for these terms are matched")
+	suggestMapCmd.Flags().Bool("report", false, "Output the scored candidates for all target attributes instead of the script")
+	suggestMapCmd.Flags().String("output", "yaml", "Output format, yaml or json")
+}
+
+var suggestMapCmd = &cobra.Command{
+	Use:   "suggest-map",
+	Short: "Generate a draft reshape script by matching source and target schema attributes",
+	Long: `Compare the value attributes of source and target schemas, and
+generate a draft reshape script.
+
+Attributes are compared using their names, the names of the enclosing
+attributes, value types, and descriptions. Attributes that share a
+value for any of the concept terms (owl:sameAs by default) are always
+matched.
+
+Target attributes with a confident match get a valueExpr selecting the
+instances of the matching source attribute. Other target attributes
+get a todo entry listing the best candidates. Edit or remove the todo
+entries before using the script with reshape.
+
+  layers suggest-map --source src.schema.json --target tgt.schema.json > script.yaml`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := getContext()
+		bundles, _ := cmd.Flags().GetStringSlice("bundle")
+		sourceName, _ := cmd.Flags().GetString("source")
+		sourceType, _ := cmd.Flags().GetString("sourceType")
+		targetName, _ := cmd.Flags().GetString("target")
+		targetType, _ := cmd.Flags().GetString("targetType")
+		if (len(sourceName) == 0 && len(sourceType) == 0) || (len(targetName) == 0 && len(targetType) == 0) {
+			return fmt.Errorf("Source and target schemas are required")
+		}
+		source, err := LoadSchemaFromFile(ctx, "", sourceName, sourceType, bundles)
+		if err != nil {
+			return err
+		}
+		target, err := LoadSchemaFromFile(ctx, "", targetName, targetType, bundles)
+		if err != nil {
+			return err
+		}
+		var options transform.SuggestOptions
+		options.Threshold, _ = cmd.Flags().GetFloat64("threshold")
+		options.MinScore, _ = cmd.Flags().GetFloat64("minScore")
+		options.MaxCandidates, _ = cmd.Flags().GetInt("maxCandidates")
+		options.ConceptTerms, _ = cmd.Flags().GetStringSlice("conceptTerm")
+		suggestions := transform.SuggestMappings(source, target, options)
+
+		var out any
+		if report, _ := cmd.Flags().GetBool("report"); report {
+			out = suggestions
+		} else {
+			out = transform.BuildDraftScript(suggestions)
+		}
+		var data []byte
+		switch output, _ := cmd.Flags().GetString("output"); output {
+		case "yaml":
+			data, err = yaml.Marshal(out)
+		case "json":
+			data, err = json.MarshalIndent(out, "", "  ")
+		default:
+			return fmt.Errorf("Unknown output format: %s", output)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	},
+}
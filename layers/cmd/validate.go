@@ -15,16 +15,117 @@
 package cmd
 
 import (
+	"fmt"
+	"io"
+	"os"
+
 	"github.com/spf13/cobra"
+
+	"github.com/cloudprivacylabs/lsa/layers/cmd/pipeline"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/validators"
 )
 
 func init() {
 	validateCmd.PersistentFlags().StringP("schema", "s", "", "Schema")
 	validateCmd.MarkFlagRequired("schema")
+	validateCmd.PersistentFlags().String("format", "json", "Report format, json or junit")
+	validateCmd.PersistentFlags().String("report", "", "Write the report to this file instead of stdout")
 	rootCmd.AddCommand(validateCmd)
+
+	pipeline.RegisterPipelineStep("validate", func() pipeline.Step {
+		return &ValidateStep{
+			Format: "json",
+		}
+	})
 }
 
 var validateCmd = &cobra.Command{
 	Use:   "validate",
 	Short: "Validate a document using a schema",
+	Long: `Validate documents using a schema, and write a validation report
+listing all the violations. The report is written in JSON or JUnit
+XML format.`,
+}
+
+// ValidateStep validates the ingested graphs using the schema of the
+// ingestion step, and writes a validation report when the pipeline
+// is flushed
+type ValidateStep struct {
+	Format string `json:"format" yaml:"format"`
+	Report string `json:"report" yaml:"report"`
+
+	report validators.ValidationReport
+}
+
+func (ValidateStep) Name() string { return "validate" }
+
+func (ValidateStep) Help() {
+	fmt.Println(`Validate ingested graphs
+Validate the ingested graphs using the schema of the ingestion step,
+and write a report listing all violations after all input is processed.
+
+operation: validate
+params:
+  format: json or junit. Json is the default
+  report: Report file name. If empty, the report is written to stdout`)
+}
+
+func (vs *ValidateStep) Run(pipeline *pipeline.PipelineContext) error {
+	layer, _ := pipeline.Properties["layer"].(*ls.Layer)
+	if layer == nil {
+		return fmt.Errorf("No schema to validate")
+	}
+	vs.report.ValidateGraph(pipeline.Graph, layer, "")
+	return pipeline.Next()
+}
+
+func (vs *ValidateStep) Flush(pipeline *pipeline.PipelineContext) error {
+	if err := vs.writeReport(); err != nil {
+		return err
+	}
+	return pipeline.FlushNext()
+}
+
+func (vs *ValidateStep) writeReport() error {
+	var w io.Writer = os.Stdout
+	if len(vs.Report) > 0 {
+		f, err := os.Create(vs.Report)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return writeValidationReport(&vs.report, vs.Format, w)
+}
+
+func writeValidationReport(report *validators.ValidationReport, format string, w io.Writer) error {
+	switch format {
+	case "", "json":
+		return report.WriteJSON(w)
+	case "junit":
+		return report.WriteJUnit(w)
+	}
+	return fmt.Errorf("Unknown report format: %s", format)
+}
+
+func newValidateStep(cmd *cobra.Command) *ValidateStep {
+	vs := &ValidateStep{}
+	vs.Format, _ = cmd.Flags().GetString("format")
+	vs.Report, _ = cmd.Flags().GetString("report")
+	return vs
+}
+
+// runValidation runs the ingestion step followed by a validation
+// step, and exits with an error if there are violations
+func runValidation(cmd *cobra.Command, ingest pipeline.Step, args []string) error {
+	vs := newValidateStep(cmd)
+	if _, err := runPipeline([]pipeline.Step{ingest, vs}, Environment, "", args); err != nil {
+		return err
+	}
+	if vs.report.Failed > 0 {
+		failErr(fmt.Errorf("Validation failed: %d violations in %d documents", len(vs.report.Violations), vs.report.Failed))
+	}
+	return nil
 }
@@ -0,0 +1,59 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	validateCmd.AddCommand(validateCSVCmd)
+	validateCSVCmd.Flags().String("type", "", "Use if a bundle is given for data types. The type name to validate.")
+	validateCSVCmd.Flags().StringSlice("bundle", nil, "Schema bundle(s).")
+	validateCSVCmd.Flags().Int("startRow", 1, "Start row 0-based")
+	validateCSVCmd.Flags().Int("endRow", -1, "End row 0-based")
+	validateCSVCmd.Flags().Int("headerRow", 0, "Header row 0-based (default: 0) ")
+	validateCSVCmd.Flags().String("delimiter", ",", "Delimiter char")
+}
+
+var validateCSVCmd = &cobra.Command{
+	Use:   "csv",
+	Short: "Validate a CSV document using a schema",
+	Long: `Validate a CSV document using a schema. Each row is ingested and
+validated separately, and all violations are written to the report.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ing := CSVIngester{
+			BaseIngestParams: BaseIngestParams{
+				EmbedSchemaNodes: true,
+			},
+			ID:           "row_{{.rowIndex}}",
+			IngestByRows: true,
+		}
+		ing.Schema, _ = cmd.Flags().GetString("schema")
+		ing.Type, _ = cmd.Flags().GetString("type")
+		ing.Bundle, _ = cmd.Flags().GetStringSlice("bundle")
+		ing.StartRow, _ = cmd.Flags().GetInt("startRow")
+		ing.EndRow, _ = cmd.Flags().GetInt("endRow")
+		ing.HeaderRow, _ = cmd.Flags().GetInt("headerRow")
+		ing.Delimiter, _ = cmd.Flags().GetString("delimiter")
+		if ing.HeaderRow >= ing.StartRow {
+			return fmt.Errorf("Header row is ahead of start row")
+		}
+		return runValidation(cmd, &ing, args)
+	},
+}
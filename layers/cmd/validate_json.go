@@ -15,15 +15,76 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
 	"github.com/cloudprivacylabs/lsa/layers/cmd/cmdutil"
 	"github.com/cloudprivacylabs/lsa/pkg/json/jsonschema"
-	"github.com/spf13/cobra"
+	"github.com/cloudprivacylabs/lsa/pkg/validators"
 )
 
 func init() {
 	validateCmd.AddCommand(validateJsonCmd)
 }
 
+// jsonPointerValue returns the value at the JSON pointer location in
+// data as a string
+func jsonPointerValue(data interface{}, pointer string) string {
+	if len(pointer) > 0 {
+		for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+			switch d := data.(type) {
+			case map[string]interface{}:
+				data = d[token]
+			case []interface{}:
+				i, err := strconv.Atoi(token)
+				if err != nil || i < 0 || i >= len(d) {
+					return ""
+				}
+				data = d[i]
+			default:
+				return ""
+			}
+		}
+	}
+	switch d := data.(type) {
+	case nil:
+		return ""
+	case string:
+		return d
+	}
+	out, _ := json.Marshal(data)
+	return string(out)
+}
+
+// jsonSchemaViolations returns the leaf errors of the validation
+// error tree as violations
+func jsonSchemaViolations(verr *jsonschema.ValidationError, data interface{}) []validators.Violation {
+	if len(verr.Causes) == 0 {
+		keyword := verr.KeywordLocation
+		if ix := strings.LastIndex(keyword, "/"); ix != -1 {
+			keyword = keyword[ix+1:]
+		}
+		return []validators.Violation{{
+			Validator: keyword,
+			Attribute: verr.KeywordLocation,
+			Path:      verr.InstanceLocation,
+			Value:     jsonPointerValue(data, verr.InstanceLocation),
+			Message:   verr.Message,
+		}}
+	}
+	ret := make([]validators.Violation, 0)
+	for _, cause := range verr.Causes {
+		ret = append(ret, jsonSchemaViolations(cause, data)...)
+	}
+	return ret
+}
+
 var validateJsonCmd = &cobra.Command{
 	Use:   "json",
 	Short: "Validate a JSON document using a schema",
@@ -43,9 +104,24 @@ var validateJsonCmd = &cobra.Command{
 		if err != nil {
 			failErr(err)
 		}
+		report := validators.ValidationReport{}
 		err = sch.Validate(data)
-		if err != nil {
+		var verr *jsonschema.ValidationError
+		switch {
+		case err == nil:
+			report.AddDocument(args[0])
+		case errors.As(err, &verr):
+			report.AddDocument(args[0], jsonSchemaViolations(verr, data)...)
+		default:
 			failErr(err)
 		}
+		step := newValidateStep(cmd)
+		step.report = report
+		if err := step.writeReport(); err != nil {
+			failErr(err)
+		}
+		if report.Failed > 0 {
+			failErr(fmt.Errorf("Validation failed: %d violations", len(report.Violations)))
+		}
 	},
 }
@@ -0,0 +1,47 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	validateCmd.AddCommand(validateXMLCmd)
+	validateXMLCmd.Flags().String("type", "", "Use if a bundle is given for data types. The type name to validate.")
+	validateXMLCmd.Flags().StringSlice("bundle", nil, "Schema bundle(s).")
+	validateXMLCmd.Flags().String("id", "http://example.org/root", "Base ID to use for ingested nodes")
+}
+
+var validateXMLCmd = &cobra.Command{
+	Use:   "xml",
+	Short: "Validate XML documents using a schema",
+	Long: `Validate XML documents using a schema. Each file is ingested and
+validated separately, and all violations are written to the report.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ing := XMLIngester{
+			BaseIngestParams: BaseIngestParams{
+				EmbedSchemaNodes: true,
+			},
+			SkipValueValidation: true,
+		}
+		ing.Schema, _ = cmd.Flags().GetString("schema")
+		ing.Type, _ = cmd.Flags().GetString("type")
+		ing.Bundle, _ = cmd.Flags().GetStringSlice("bundle")
+		ing.ID, _ = cmd.Flags().GetString("id")
+		return runValidation(cmd, &ing, args)
+	},
+}
@@ -0,0 +1,122 @@
+package valueset
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+var boltCacheBucket = []byte("valuesets")
+
+// BoltCache is a file-backed valueset cache that persists between
+// runs. Cached responses expire after the TTL. A zero TTL means
+// cached responses never expire.
+type BoltCache struct {
+	db  *bolt.DB
+	ttl time.Duration
+	// now returns the current time. Replaced in tests
+	now func() time.Time
+	cacheStats
+}
+
+type boltCacheEntry struct {
+	KeyValues map[string]string `json:"kv"`
+	Score     float64           `json:"score,omitempty"`
+	// Expiration time as unix seconds, 0 if the entry does not expire
+	Expires int64 `json:"exp,omitempty"`
+}
+
+// OpenBoltCache opens or creates a cache file
+func OpenBoltCache(file string, ttl time.Duration) (*BoltCache, error) {
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltCacheBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltCache{db: db, ttl: ttl, now: time.Now}, nil
+}
+
+// Close closes the cache file
+func (cache *BoltCache) Close() error {
+	return cache.db.Close()
+}
+
+func (cache *BoltCache) expired(entry boltCacheEntry) bool {
+	return entry.Expires != 0 && cache.now().Unix() >= entry.Expires
+}
+
+// Lookup returns the cached response if it exists and it is not expired
+func (cache *BoltCache) Lookup(req ls.ValuesetLookupRequest) (ls.ValuesetLookupResponse, bool) {
+	var entry boltCacheEntry
+	found := false
+	cache.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltCacheBucket).Get([]byte(generateHashFromRequest(req)))
+		if data == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil
+		}
+		found = !cache.expired(entry)
+		return nil
+	})
+	cache.record(req, found)
+	if !found {
+		return ls.ValuesetLookupResponse{}, false
+	}
+	return ls.ValuesetLookupResponse{KeyValues: entry.KeyValues, Score: entry.Score}, true
+}
+
+// Set stores the response in the cache. Errors are ignored, the
+// response will be looked up again next time.
+func (cache *BoltCache) Set(req ls.ValuesetLookupRequest, res ls.ValuesetLookupResponse) {
+	entry := boltCacheEntry{KeyValues: res.KeyValues, Score: res.Score}
+	if cache.ttl > 0 {
+		entry.Expires = cache.now().Add(cache.ttl).Unix()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	cache.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltCacheBucket).Put([]byte(generateHashFromRequest(req)), data)
+	})
+}
+
+// Purge removes the expired entries from the cache, and returns the
+// number of entries removed
+func (cache *BoltCache) Purge() (int, error) {
+	n := 0
+	err := cache.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltCacheBucket)
+		expired := make([][]byte, 0)
+		err := bucket.ForEach(func(k, v []byte) error {
+			var entry boltCacheEntry
+			if err := json.Unmarshal(v, &entry); err != nil || cache.expired(entry) {
+				expired = append(expired, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(expired)
+		return nil
+	})
+	return n, err
+}
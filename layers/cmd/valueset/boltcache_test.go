@@ -0,0 +1,57 @@
+package valueset
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+func TestBoltCache(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache.db")
+	cache, err := OpenBoltCache(file, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	req := ls.ValuesetLookupRequest{TableIDs: []string{"gender"}, KeyValues: map[string]string{"": "M"}}
+	if _, ok := cache.Lookup(req); ok {
+		t.Errorf("Unexpected cache hit")
+	}
+	cache.Set(req, ls.ValuesetLookupResponse{KeyValues: map[string]string{"": "Male"}, Score: 0.9})
+	cache.Close()
+
+	// Entries persist between runs
+	cache, err = OpenBoltCache(file, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	cache.now = func() time.Time { return now.Add(30 * time.Minute) }
+	rsp, ok := cache.Lookup(req)
+	if !ok {
+		t.Fatalf("Cache miss")
+	}
+	if !reflect.DeepEqual(rsp, ls.ValuesetLookupResponse{KeyValues: map[string]string{"": "Male"}, Score: 0.9}) {
+		t.Errorf("Wrong response: %v", rsp)
+	}
+	cache.Lookup(ls.ValuesetLookupRequest{TableIDs: []string{"race"}, KeyValues: map[string]string{"": "X"}})
+
+	// Expired entries are misses
+	cache.now = func() time.Time { return now.Add(2 * time.Hour) }
+	if _, ok := cache.Lookup(req); ok {
+		t.Errorf("Expected expired entry")
+	}
+	stats := cache.Stats()
+	if !reflect.DeepEqual(stats, []CacheStats{{Table: "gender", Hits: 1, Misses: 1}, {Table: "race", Misses: 1}}) {
+		t.Errorf("Wrong stats: %v", stats)
+	}
+	n, err := cache.Purge()
+	if err != nil || n != 1 {
+		t.Errorf("Purge: %d %v", n, err)
+	}
+}
@@ -29,6 +29,15 @@ type ValuesetDB interface {
 	Close() error
 }
 
+// BatchValuesetDB is implemented by the backends that can look up
+// multiple requests for a table at once. The results must be in the
+// same order as the queries. A query without a result has an empty
+// result.
+type BatchValuesetDB interface {
+	ValuesetDB
+	ValueSetBatchLookup(ctx context.Context, tableId string, queries []map[string]string) ([]map[string]string, error)
+}
+
 var valuesetFactory = make(map[string]func(interface{}, map[string]string) (ValuesetDB, error))
 
 func RegisterDB(name string, fn func(interface{}, map[string]string) (ValuesetDB, error)) {
@@ -46,9 +55,9 @@ func UnmarshalDatabasesConfig(configMap []map[string]interface{}, env map[string
 	}
 	for _, rec := range configMap {
 		for _, mp := range rec {
-			for key := range mp.(map[string]interface{}) {
+			for key, value := range mp.(map[string]interface{}) {
 				if fn, ok := valuesetFactory[key]; ok {
-					vsdb, err := fn(mp, env)
+					vsdb, err := fn(value, env)
 					if err != nil {
 						return Config{}, err
 					}
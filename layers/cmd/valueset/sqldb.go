@@ -0,0 +1,377 @@
+package valueset
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	// Database drivers
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	RegisterDB("sqlite", NewSQLiteValuesetDB)
+	RegisterDB("postgres", NewPostgresValuesetDB)
+}
+
+// SQLParams contains the database connection parameters. String
+// values can refer to environment variables as ${name}.
+type SQLParams struct {
+	// DSN is the data source name. For sqlite, this is the database
+	// file name. For postgres, this is the connection URI or keyword/value
+	// connection string. If empty, the postgres connection string is
+	// built from the individual parameters
+	DSN string `json:"dsn" yaml:"dsn" mapstructure:"dsn"`
+
+	Host     string `json:"host" yaml:"host" mapstructure:"host"`
+	Port     string `json:"port" yaml:"port" mapstructure:"port"`
+	Database string `json:"db" yaml:"db" mapstructure:"db"`
+	User     string `json:"user" yaml:"user" mapstructure:"user"`
+	Pwd      string `json:"pwd" yaml:"pwd" mapstructure:"pwd"`
+	SSLMode  string `json:"sslmode" yaml:"sslmode" mapstructure:"sslmode"`
+
+	// Connection pool settings
+	MaxOpenConns    int    `json:"maxOpenConns" yaml:"maxOpenConns" mapstructure:"maxOpenConns"`
+	MaxIdleConns    int    `json:"maxIdleConns" yaml:"maxIdleConns" mapstructure:"maxIdleConns"`
+	ConnMaxLifetime string `json:"connMaxLifetime" yaml:"connMaxLifetime" mapstructure:"connMaxLifetime"`
+}
+
+// SQLValueset contains the lookup queries for a table id
+type SQLValueset struct {
+	TableId string     `json:"tableId" yaml:"tableId" mapstructure:"tableId"`
+	Queries []SQLQuery `json:"queries" yaml:"queries" mapstructure:"queries"`
+}
+
+// SQLQuery is a parameterized lookup query. Query parameters are
+// given as @name or %(name)s, and they are bound to the values of the
+// lookup request with the same keys. If the request has a single
+// value without a key, it is bound to the only parameter of the
+// query. The query returns at most one row. The result contains the
+// given columns, or all the columns of the row if no columns are given.
+type SQLQuery struct {
+	Query   string   `json:"query" yaml:"query" mapstructure:"query"`
+	Columns []string `json:"columns" yaml:"columns" mapstructure:"columns"`
+
+	compiled string
+	params   []string
+}
+
+// SQLValuesetDB is a valueset backend that runs lookups using SQL
+// queries
+type SQLValuesetDB struct {
+	Params    SQLParams     `json:"params" yaml:"params" mapstructure:"params"`
+	Valuesets []SQLValueset `json:"valuesets" yaml:"valuesets" mapstructure:"valuesets"`
+
+	db       *sql.DB
+	tableIds map[string]struct{}
+	queries  map[string][]SQLQuery
+}
+
+// NewSQLiteValuesetDB returns a new sqlite valueset backend from the configuration
+func NewSQLiteValuesetDB(value interface{}, env map[string]string) (ValuesetDB, error) {
+	return newSQLValuesetDB("sqlite", func(n int) string { return "?" + strconv.Itoa(n) }, value, env)
+}
+
+// NewPostgresValuesetDB returns a new postgres valueset backend from the configuration
+func NewPostgresValuesetDB(value interface{}, env map[string]string) (ValuesetDB, error) {
+	return newSQLValuesetDB("pgx", func(n int) string { return "$" + strconv.Itoa(n) }, value, env)
+}
+
+func newSQLValuesetDB(driver string, placeholder func(int) string, value interface{}, env map[string]string) (*SQLValuesetDB, error) {
+	ret := &SQLValuesetDB{}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		Result:           ret,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(value); err != nil {
+		return nil, err
+	}
+	ret.Params.expand(env)
+	ret.tableIds = make(map[string]struct{})
+	ret.queries = make(map[string][]SQLQuery)
+	for _, vs := range ret.Valuesets {
+		if len(vs.TableId) == 0 {
+			return nil, fmt.Errorf("Missing tableId in %s valueset configuration", driver)
+		}
+		ret.tableIds[vs.TableId] = struct{}{}
+		for _, q := range vs.Queries {
+			q.compiled, q.params = compileSQLQuery(q.Query, placeholder)
+			ret.queries[vs.TableId] = append(ret.queries[vs.TableId], q)
+		}
+	}
+	dsn := ret.Params.DSN
+	if driver == "pgx" && len(dsn) == 0 {
+		dsn = ret.Params.postgresDSN()
+	}
+	if len(dsn) == 0 {
+		return nil, fmt.Errorf("Missing database connection parameters for %s", driver)
+	}
+	ret.db, err = sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Params.MaxOpenConns > 0 {
+		ret.db.SetMaxOpenConns(ret.Params.MaxOpenConns)
+	}
+	if ret.Params.MaxIdleConns > 0 {
+		ret.db.SetMaxIdleConns(ret.Params.MaxIdleConns)
+	}
+	if len(ret.Params.ConnMaxLifetime) > 0 {
+		d, err := time.ParseDuration(ret.Params.ConnMaxLifetime)
+		if err != nil {
+			ret.db.Close()
+			return nil, fmt.Errorf("Invalid connMaxLifetime: %w", err)
+		}
+		ret.db.SetConnMaxLifetime(d)
+	}
+	return ret, nil
+}
+
+func (p *SQLParams) expand(env map[string]string) {
+	mapping := func(s string) string {
+		if v, ok := env[s]; ok {
+			return v
+		}
+		return os.Getenv(s)
+	}
+	for _, s := range []*string{&p.DSN, &p.Host, &p.Port, &p.Database, &p.User, &p.Pwd, &p.SSLMode} {
+		*s = os.Expand(*s, mapping)
+	}
+}
+
+func (p SQLParams) postgresDSN() string {
+	items := make([]string, 0)
+	add := func(key, value string) {
+		if len(value) > 0 {
+			value = strings.ReplaceAll(strings.ReplaceAll(value, `\`, `\\`), `'`, `\'`)
+			items = append(items, fmt.Sprintf("%s='%s'", key, value))
+		}
+	}
+	add("host", p.Host)
+	add("port", p.Port)
+	add("dbname", p.Database)
+	add("user", p.User)
+	add("password", p.Pwd)
+	add("sslmode", p.SSLMode)
+	return strings.Join(items, " ")
+}
+
+func isParamChar(c byte, first bool) bool {
+	if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		return true
+	}
+	return !first && c >= '0' && c <= '9'
+}
+
+// compileSQLQuery replaces the named parameters in the query with
+// positional placeholders, and returns the parameter names in order
+func compileSQLQuery(query string, placeholder func(int) string) (string, []string) {
+	var out strings.Builder
+	params := make([]string, 0)
+	paramIndex := make(map[string]int)
+	addParam := func(name string) {
+		ix, ok := paramIndex[name]
+		if !ok {
+			params = append(params, name)
+			ix = len(params)
+			paramIndex[name] = ix
+		}
+		out.WriteString(placeholder(ix))
+	}
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			// Copy quoted strings as is
+			end := strings.IndexByte(query[i+1:], c)
+			if end == -1 {
+				out.WriteString(query[i:])
+				i = len(query)
+				continue
+			}
+			out.WriteString(query[i : i+end+2])
+			i += end + 1
+		case c == '@' && i+1 < len(query) && isParamChar(query[i+1], true):
+			j := i + 1
+			for j < len(query) && isParamChar(query[j], false) {
+				j++
+			}
+			addParam(query[i+1 : j])
+			i = j - 1
+		case c == '%' && strings.HasPrefix(query[i:], "%("):
+			end := strings.Index(query[i:], ")s")
+			if end == -1 {
+				out.WriteByte(c)
+				continue
+			}
+			addParam(query[i+2 : i+end])
+			i += end + 1
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String(), params
+}
+
+// GetTableIds returns the table ids that have queries
+func (s *SQLValuesetDB) GetTableIds() map[string]struct{} { return s.tableIds }
+
+// Close closes the database connections
+func (s *SQLValuesetDB) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// queryArgs returns the query arguments from the request
+// values. Returns false if a parameter does not have a value.
+func (q SQLQuery) queryArgs(queryParams map[string]string) ([]interface{}, bool) {
+	args := make([]interface{}, 0, len(q.params))
+	for _, p := range q.params {
+		v, ok := queryParams[p]
+		if !ok {
+			if single, hasSingle := queryParams[""]; hasSingle && len(queryParams) == 1 && len(q.params) == 1 {
+				v, ok = single, true
+			}
+		}
+		if !ok {
+			return nil, false
+		}
+		args = append(args, v)
+	}
+	return args, true
+}
+
+// ValueSetLookup runs the queries for the table id in order, and
+// returns the result of the first query that returns a row
+func (s *SQLValuesetDB) ValueSetLookup(ctx context.Context, tableId string, queryParams map[string]string) (map[string]string, error) {
+	for _, q := range s.queries[tableId] {
+		args, ok := q.queryArgs(queryParams)
+		if !ok {
+			continue
+		}
+		result, err := s.runQuery(ctx, q, args)
+		if err != nil {
+			if _, multiple := err.(ErrMultipleValues); multiple {
+				return nil, ErrMultipleValues{Query: queryParams, TableId: tableId}
+			}
+			return nil, fmt.Errorf("Valueset query for %s failed: %w", tableId, err)
+		}
+		if result != nil {
+			return result, nil
+		}
+	}
+	return nil, nil
+}
+
+// ValueSetBatchLookup runs the lookup queries of the table id for all
+// the requests. The queries are prepared once, and run on the same
+// connection.
+func (s *SQLValuesetDB) ValueSetBatchLookup(ctx context.Context, tableId string, queries []map[string]string) ([]map[string]string, error) {
+	ret := make([]map[string]string, len(queries))
+	tableQueries := s.queries[tableId]
+	if len(tableQueries) == 0 || len(queries) == 0 {
+		return ret, nil
+	}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stmts := make([]*sql.Stmt, 0, len(tableQueries))
+	defer func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
+	for _, q := range tableQueries {
+		stmt, err := conn.PrepareContext(ctx, q.compiled)
+		if err != nil {
+			return nil, fmt.Errorf("Valueset query for %s failed: %w", tableId, err)
+		}
+		stmts = append(stmts, stmt)
+	}
+	for i, queryParams := range queries {
+		for qi, q := range tableQueries {
+			args, ok := q.queryArgs(queryParams)
+			if !ok {
+				continue
+			}
+			rows, err := stmts[qi].QueryContext(ctx, args...)
+			if err != nil {
+				return nil, fmt.Errorf("Valueset query for %s failed: %w", tableId, err)
+			}
+			result, err := q.scanResult(rows)
+			if err != nil {
+				if _, multiple := err.(ErrMultipleValues); multiple {
+					return nil, ErrMultipleValues{Query: queryParams, TableId: tableId}
+				}
+				return nil, fmt.Errorf("Valueset query for %s failed: %w", tableId, err)
+			}
+			if result != nil {
+				ret[i] = result
+				break
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (s *SQLValuesetDB) runQuery(ctx context.Context, q SQLQuery, args []interface{}) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, q.compiled, args...)
+	if err != nil {
+		return nil, err
+	}
+	return q.scanResult(rows)
+}
+
+// scanResult returns the result columns of the only row, and closes
+// the rows. Returns nil if there are no rows.
+func (q SQLQuery) scanResult(rows *sql.Rows) (map[string]string, error) {
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]sql.NullString, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+	if rows.Next() {
+		return nil, ErrMultipleValues{}
+	}
+	all := make(map[string]string, len(columns))
+	for i, c := range columns {
+		if values[i].Valid {
+			all[c] = values[i].String
+		}
+	}
+	if len(q.Columns) == 0 {
+		return all, rows.Err()
+	}
+	ret := make(map[string]string, len(q.Columns))
+	for _, c := range q.Columns {
+		if v, ok := all[c]; ok {
+			ret[c] = v
+		}
+	}
+	return ret, rows.Err()
+}
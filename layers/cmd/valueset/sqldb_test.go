@@ -0,0 +1,84 @@
+package valueset
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cloudprivacylabs/lsa/layers/cmd/cmdutil"
+)
+
+func TestSQLiteValueset(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "vs.db")
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`create table concepts (concept_id integer, concept_name text, vocabulary_id text, concept_code text)`,
+		`insert into concepts values (1, 'Male', 'Gender', 'M')`,
+		`insert into concepts values (2, 'Female', 'Gender', 'F')`,
+		`insert into concepts values (3, 'Female', 'Gender', 'W')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	var cfg map[string]interface{}
+	if err := cmdutil.ReadJSONOrYAML("testdata/sqlite-valueset.yaml", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	vsdb, err := UnmarshalSingleDatabaseConfig(cfg, map[string]string{"dbfile": dbFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vsdb.Close()
+	if _, ok := vsdb.GetTableIds()["gender"]; !ok {
+		t.Errorf("Missing table id")
+	}
+	testCases := []struct {
+		query    map[string]string
+		expected map[string]string
+	}{
+		{map[string]string{"code": "M"}, map[string]string{"concept_id": "1", "concept_name": "Male"}},
+		{map[string]string{"": "M"}, map[string]string{"concept_id": "1", "concept_name": "Male"}},
+		{map[string]string{"name": "Male"}, map[string]string{"concept_id": "1"}},
+		{map[string]string{"code": "X"}, nil},
+		{map[string]string{"other": "M"}, nil},
+	}
+	batch := make([]map[string]string, 0)
+	for _, tc := range testCases {
+		result, err := vsdb.ValueSetLookup(context.Background(), "gender", tc.query)
+		if err != nil {
+			t.Errorf("%v: %v", tc.query, err)
+		}
+		if !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("%v: Got %v expected %v", tc.query, result, tc.expected)
+		}
+		batch = append(batch, tc.query)
+	}
+	results, err := vsdb.(BatchValuesetDB).ValueSetBatchLookup(context.Background(), "gender", batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tc := range testCases {
+		if !reflect.DeepEqual(results[i], tc.expected) {
+			t.Errorf("Batch %v: Got %v expected %v", tc.query, results[i], tc.expected)
+		}
+	}
+	if _, err := vsdb.ValueSetLookup(context.Background(), "gender", map[string]string{"name": "Female"}); !errors.As(err, &ErrMultipleValues{}) {
+		t.Errorf("Expecting multiple values error, got %v", err)
+	}
+}
+
+func TestCompileSQLQuery(t *testing.T) {
+	q, params := compileSQLQuery(`select a from t where b=@x and c='@y' and d=%(z)s and e=@x`, func(n int) string { return "$" + string(rune('0'+n)) })
+	if q != `select a from t where b=$1 and c='@y' and d=$2 and e=$1` || !reflect.DeepEqual(params, []string{"x", "z"}) {
+		t.Errorf("Wrong query: %s %v", q, params)
+	}
+}
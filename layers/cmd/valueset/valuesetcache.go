@@ -4,6 +4,8 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"sort"
+	"strings"
+	"sync"
 
 	"github.com/cloudprivacylabs/lsa/pkg/ls"
 	lru "github.com/hashicorp/golang-lru/v2"
@@ -14,6 +16,55 @@ const cache_size = 65000
 type ValuesetCache interface {
 	Lookup(req ls.ValuesetLookupRequest) (ls.ValuesetLookupResponse, bool)
 	Set(req ls.ValuesetLookupRequest, res ls.ValuesetLookupResponse)
+	// Stats returns the cache hits and misses for each table
+	Stats() []CacheStats
+	Close() error
+}
+
+// CacheStats gives the number of cache hits and misses for a
+// table. If a request has multiple tables, they are reported
+// together, separated by comma.
+type CacheStats struct {
+	Table  string `json:"table"`
+	Hits   int    `json:"hits"`
+	Misses int    `json:"misses"`
+}
+
+// cacheStats collects cache hits and misses per table
+type cacheStats struct {
+	sync.Mutex
+	tables map[string]*CacheStats
+}
+
+func (c *cacheStats) record(req ls.ValuesetLookupRequest, hit bool) {
+	table := strings.Join(req.TableIDs, ",")
+	c.Lock()
+	defer c.Unlock()
+	if c.tables == nil {
+		c.tables = make(map[string]*CacheStats)
+	}
+	st := c.tables[table]
+	if st == nil {
+		st = &CacheStats{Table: table}
+		c.tables[table] = st
+	}
+	if hit {
+		st.Hits++
+	} else {
+		st.Misses++
+	}
+}
+
+// Stats returns the collected stats sorted by table
+func (c *cacheStats) Stats() []CacheStats {
+	c.Lock()
+	defer c.Unlock()
+	ret := make([]CacheStats, 0, len(c.tables))
+	for _, st := range c.tables {
+		ret = append(ret, *st)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Table < ret[j].Table })
+	return ret
 }
 
 type NoCache struct{}
@@ -24,36 +75,45 @@ func (NoCache) Lookup(req ls.ValuesetLookupRequest) (ls.ValuesetLookupResponse,
 
 func (NoCache) Set(req ls.ValuesetLookupRequest, res ls.ValuesetLookupResponse) {}
 
-type LRUCache[K string, V map[string]string] struct {
-	ARCCache *lru.ARCCache[K, V]
+func (NoCache) Stats() []CacheStats { return nil }
+
+func (NoCache) Close() error { return nil }
+
+type LRUCache[K string] struct {
+	ARCCache *lru.ARCCache[K, ls.ValuesetLookupResponse]
+	cacheStats
 }
 
-func NewValuesetLRUCache[K string, V map[string]string]() (*LRUCache[K, V], error) {
-	cache, err := lru.NewARC[K, V](cache_size)
+func NewValuesetLRUCache[K string]() (*LRUCache[K], error) {
+	cache, err := lru.NewARC[K, ls.ValuesetLookupResponse](cache_size)
 	if err != nil {
 		return nil, err
 	}
-	return &LRUCache[K, V]{ARCCache: cache}, nil
+	return &LRUCache[K]{ARCCache: cache}, nil
 }
 
 // ValuesetCache.Lookup returns the cached ValuesetLookupResponse if exists
-func (cache *LRUCache[K, V]) Lookup(req ls.ValuesetLookupRequest) (ls.ValuesetLookupResponse, bool) {
+func (cache *LRUCache[K]) Lookup(req ls.ValuesetLookupRequest) (ls.ValuesetLookupResponse, bool) {
 	val, ok := cache.ARCCache.Get(K(generateHashFromRequest(req)))
+	cache.record(req, ok)
 	if !ok {
 		return ls.ValuesetLookupResponse{}, false
 	}
-	return ls.ValuesetLookupResponse{KeyValues: V(val)}, true
+	return val, true
 }
 
 // ValuesetCache.Set caches a generated hash as a key, storing the request as its corresponding value
-func (cache *LRUCache[K, V]) Set(req ls.ValuesetLookupRequest, res ls.ValuesetLookupResponse) {
+func (cache *LRUCache[K]) Set(req ls.ValuesetLookupRequest, res ls.ValuesetLookupResponse) {
 	kv := make(map[string]string, len(res.KeyValues))
 	for k, v := range res.KeyValues {
 		kv[k] = v
 	}
-	cache.ARCCache.Add(K(generateHashFromRequest(req)), V(kv))
+	cache.ARCCache.Add(K(generateHashFromRequest(req)), ls.ValuesetLookupResponse{KeyValues: kv, Score: res.Score})
 }
 
+// Close is a no-op for the in-memory cache
+func (cache *LRUCache[K]) Close() error { return nil }
+
 func generateHashFromRequest(req ls.ValuesetLookupRequest) string {
 	collection := make([]string, 0, len(req.KeyValues)*2+len(req.TableIDs))
 	collection = append(collection, req.TableIDs...)
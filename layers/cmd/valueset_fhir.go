@@ -0,0 +1,624 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cloudprivacylabs/lsa/layers/cmd/cmdutil"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+// Keys used in valueset lookups for FHIR terminology resources
+const (
+	FHIRCodeKey        = "code"
+	FHIRSystemKey      = "system"
+	FHIRDisplayKey     = "display"
+	FHIREquivalenceKey = "equivalence"
+)
+
+type fhirConcept struct {
+	Code     string                   `json:"code"`
+	Display  string                   `json:"display"`
+	Property []map[string]interface{} `json:"property"`
+	Concept  []fhirConcept            `json:"concept"`
+}
+
+type fhirCodeSystem struct {
+	ID            string        `json:"id"`
+	URL           string        `json:"url"`
+	CaseSensitive bool          `json:"caseSensitive"`
+	Concept       []fhirConcept `json:"concept"`
+}
+
+type fhirValueSetInclude struct {
+	System  string `json:"system"`
+	Concept []struct {
+		Code    string `json:"code"`
+		Display string `json:"display"`
+	} `json:"concept"`
+	Filter []struct {
+		Property string `json:"property"`
+		Op       string `json:"op"`
+		Value    string `json:"value"`
+	} `json:"filter"`
+	ValueSet []string `json:"valueSet"`
+}
+
+type fhirContains struct {
+	System   string         `json:"system"`
+	Code     string         `json:"code"`
+	Display  string         `json:"display"`
+	Contains []fhirContains `json:"contains"`
+}
+
+type fhirValueSet struct {
+	ID      string `json:"id"`
+	URL     string `json:"url"`
+	Compose *struct {
+		Include []fhirValueSetInclude `json:"include"`
+		Exclude []fhirValueSetInclude `json:"exclude"`
+	} `json:"compose"`
+	Expansion *struct {
+		Contains []fhirContains `json:"contains"`
+	} `json:"expansion"`
+}
+
+type fhirConceptMap struct {
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	Group []struct {
+		Source  string `json:"source"`
+		Target  string `json:"target"`
+		Element []struct {
+			Code    string `json:"code"`
+			Display string `json:"display"`
+			Target  []struct {
+				Code         string `json:"code"`
+				Display      string `json:"display"`
+				Equivalence  string `json:"equivalence"`
+				Relationship string `json:"relationship"`
+			} `json:"target"`
+		} `json:"element"`
+		Unmapped *struct {
+			Mode    string `json:"mode"`
+			Code    string `json:"code"`
+			Display string `json:"display"`
+		} `json:"unmapped"`
+	} `json:"group"`
+}
+
+// fhirCode is a code in a code system
+type fhirCode struct {
+	system  string
+	code    string
+	display string
+}
+
+// localCodeSystem is a code system with the concept hierarchy and
+// properties used to evaluate valueset filters
+type localCodeSystem struct {
+	url           string
+	caseSensitive bool
+	// Concepts in definition order
+	codes      []fhirCode
+	display    map[string]string
+	parents    map[string][]string
+	properties map[string]map[string][]string
+}
+
+func newLocalCodeSystem(cs fhirCodeSystem) *localCodeSystem {
+	ret := &localCodeSystem{
+		url:           cs.URL,
+		caseSensitive: cs.CaseSensitive,
+		display:       make(map[string]string),
+		parents:       make(map[string][]string),
+		properties:    make(map[string]map[string][]string),
+	}
+	var add func(parent string, concepts []fhirConcept)
+	add = func(parent string, concepts []fhirConcept) {
+		for _, c := range concepts {
+			ret.codes = append(ret.codes, fhirCode{system: cs.URL, code: c.Code, display: c.Display})
+			ret.display[c.Code] = c.Display
+			if len(parent) > 0 {
+				ret.parents[c.Code] = append(ret.parents[c.Code], parent)
+			}
+			props := make(map[string][]string)
+			for _, p := range c.Property {
+				code, _ := p["code"].(string)
+				for k, v := range p {
+					if strings.HasPrefix(k, "value") {
+						props[code] = append(props[code], fmt.Sprint(v))
+					}
+				}
+			}
+			// parent and subsumedBy properties also define the hierarchy
+			ret.parents[c.Code] = append(ret.parents[c.Code], props["parent"]...)
+			ret.parents[c.Code] = append(ret.parents[c.Code], props["subsumedBy"]...)
+			ret.properties[c.Code] = props
+			add(c.Code, c.Concept)
+		}
+	}
+	add("", cs.Concept)
+	return ret
+}
+
+// isA returns true if code is ancestor, or a descendant of ancestor
+func (cs *localCodeSystem) isA(code, ancestor string) bool {
+	seen := make(map[string]struct{})
+	queue := []string{code}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		if c == ancestor {
+			return true
+		}
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+		queue = append(queue, cs.parents[c]...)
+	}
+	return false
+}
+
+func (cs *localCodeSystem) propertyValues(code, property string) []string {
+	switch property {
+	case "code", "concept":
+		return []string{code}
+	case "display":
+		return []string{cs.display[code]}
+	}
+	return cs.properties[code][property]
+}
+
+// filter returns the codes of the code system that pass the filter
+func (cs *localCodeSystem) filter(property, op, value string) ([]fhirCode, error) {
+	var pred func(code string) bool
+	anyValue := func(code string, f func(string) bool) bool {
+		for _, v := range cs.propertyValues(code, property) {
+			if f(v) {
+				return true
+			}
+		}
+		return false
+	}
+	switch op {
+	case "=":
+		pred = func(code string) bool { return anyValue(code, func(v string) bool { return v == value }) }
+	case "is-a":
+		pred = func(code string) bool { return cs.isA(code, value) }
+	case "descendent-of":
+		pred = func(code string) bool { return code != value && cs.isA(code, value) }
+	case "is-not-a":
+		pred = func(code string) bool { return !cs.isA(code, value) }
+	case "generalizes":
+		pred = func(code string) bool { return cs.isA(value, code) }
+	case "regex":
+		rx, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, err
+		}
+		pred = func(code string) bool { return anyValue(code, rx.MatchString) }
+	case "in", "not-in":
+		set := make(map[string]struct{})
+		for _, x := range strings.Split(value, ",") {
+			set[strings.TrimSpace(x)] = struct{}{}
+		}
+		in := func(code string) bool {
+			return anyValue(code, func(v string) bool { _, ok := set[v]; return ok })
+		}
+		if op == "in" {
+			pred = in
+		} else {
+			pred = func(code string) bool { return !in(code) }
+		}
+	case "exists":
+		pred = func(code string) bool { return (len(cs.propertyValues(code, property)) > 0) == (value == "true") }
+	default:
+		return nil, fmt.Errorf("Unsupported valueset filter operation: %s", op)
+	}
+	ret := make([]fhirCode, 0)
+	for _, c := range cs.codes {
+		if pred(c.code) {
+			ret = append(ret, c)
+		}
+	}
+	return ret, nil
+}
+
+// fhirTerminology collects the FHIR terminology resources and
+// converts them to valuesets
+type fhirTerminology struct {
+	codeSystems map[string]*localCodeSystem
+	valueSets   map[string]fhirValueSet
+	conceptMaps []fhirConceptMap
+	// Expanded valuesets
+	expanded map[string][]fhirCode
+}
+
+func newFHIRTerminology() *fhirTerminology {
+	return &fhirTerminology{
+		codeSystems: make(map[string]*localCodeSystem),
+		valueSets:   make(map[string]fhirValueSet),
+		expanded:    make(map[string][]fhirCode),
+	}
+}
+
+func fhirResourceID(url, id string) string {
+	if len(url) > 0 {
+		return url
+	}
+	return id
+}
+
+// add adds a FHIR resource. Bundles are processed recursively, and
+// non-terminology resources are ignored.
+func (t *fhirTerminology) add(resource json.RawMessage) error {
+	var hdr struct {
+		ResourceType string `json:"resourceType"`
+		Entry        []struct {
+			Resource json.RawMessage `json:"resource"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(resource, &hdr); err != nil {
+		return err
+	}
+	switch hdr.ResourceType {
+	case "Bundle":
+		for _, e := range hdr.Entry {
+			if len(e.Resource) == 0 {
+				continue
+			}
+			if err := t.add(e.Resource); err != nil {
+				return err
+			}
+		}
+	case "CodeSystem":
+		var cs fhirCodeSystem
+		if err := json.Unmarshal(resource, &cs); err != nil {
+			return err
+		}
+		if len(cs.URL) == 0 {
+			return fmt.Errorf("CodeSystem %s has no url", cs.ID)
+		}
+		t.codeSystems[cs.URL] = newLocalCodeSystem(cs)
+	case "ValueSet":
+		var vs fhirValueSet
+		if err := json.Unmarshal(resource, &vs); err != nil {
+			return err
+		}
+		t.valueSets[fhirResourceID(vs.URL, vs.ID)] = vs
+	case "ConceptMap":
+		var cm fhirConceptMap
+		if err := json.Unmarshal(resource, &cm); err != nil {
+			return err
+		}
+		t.conceptMaps = append(t.conceptMaps, cm)
+	}
+	return nil
+}
+
+// expandInclude returns the codes for a compose.include or exclude
+func (t *fhirTerminology) expandInclude(inc fhirValueSetInclude, stack map[string]struct{}) ([]fhirCode, error) {
+	var codes []fhirCode
+	if len(inc.System) > 0 {
+		cs := t.codeSystems[inc.System]
+		switch {
+		case len(inc.Concept) > 0 && len(inc.Filter) > 0:
+			return nil, fmt.Errorf("Valueset include for %s has both concepts and filters", inc.System)
+		case len(inc.Concept) > 0:
+			for _, c := range inc.Concept {
+				display := c.Display
+				if len(display) == 0 && cs != nil {
+					display = cs.display[c.Code]
+				}
+				codes = append(codes, fhirCode{system: inc.System, code: c.Code, display: display})
+			}
+		case cs == nil:
+			return nil, fmt.Errorf("Code system not available: %s", inc.System)
+		case len(inc.Filter) == 0:
+			codes = cs.codes
+		default:
+			for i, f := range inc.Filter {
+				filtered, err := cs.filter(f.Property, f.Op, f.Value)
+				if err != nil {
+					return nil, err
+				}
+				if i == 0 {
+					codes = filtered
+				} else {
+					codes = intersectCodes(codes, filtered)
+				}
+			}
+		}
+	}
+	for i, ref := range inc.ValueSet {
+		vsCodes, err := t.expand(ref, stack)
+		if err != nil {
+			return nil, err
+		}
+		if len(inc.System) == 0 && i == 0 {
+			codes = vsCodes
+		} else {
+			codes = intersectCodes(codes, vsCodes)
+		}
+	}
+	return codes, nil
+}
+
+func codeKey(c fhirCode) string { return c.system + "|" + c.code }
+
+func intersectCodes(a, b []fhirCode) []fhirCode {
+	set := make(map[string]struct{}, len(b))
+	for _, x := range b {
+		set[codeKey(x)] = struct{}{}
+	}
+	ret := make([]fhirCode, 0)
+	for _, x := range a {
+		if _, ok := set[codeKey(x)]; ok {
+			ret = append(ret, x)
+		}
+	}
+	return ret
+}
+
+// expand returns the codes of a valueset
+func (t *fhirTerminology) expand(url string, stack map[string]struct{}) ([]fhirCode, error) {
+	if codes, ok := t.expanded[url]; ok {
+		return codes, nil
+	}
+	vs, ok := t.valueSets[url]
+	if !ok {
+		return nil, fmt.Errorf("ValueSet not available: %s", url)
+	}
+	if _, ok := stack[url]; ok {
+		return nil, fmt.Errorf("Circular ValueSet reference: %s", url)
+	}
+	stack[url] = struct{}{}
+	defer delete(stack, url)
+
+	codes := make([]fhirCode, 0)
+	seen := make(map[string]struct{})
+	addCode := func(c fhirCode) {
+		if _, ok := seen[codeKey(c)]; ok {
+			return
+		}
+		seen[codeKey(c)] = struct{}{}
+		codes = append(codes, c)
+	}
+	switch {
+	case vs.Expansion != nil && len(vs.Expansion.Contains) > 0:
+		var add func([]fhirContains)
+		add = func(contains []fhirContains) {
+			for _, c := range contains {
+				if len(c.Code) > 0 {
+					addCode(fhirCode{system: c.System, code: c.Code, display: c.Display})
+				}
+				add(c.Contains)
+			}
+		}
+		add(vs.Expansion.Contains)
+	case vs.Compose != nil:
+		for _, inc := range vs.Compose.Include {
+			incCodes, err := t.expandInclude(inc, stack)
+			if err != nil {
+				return nil, fmt.Errorf("In ValueSet %s: %w", url, err)
+			}
+			for _, c := range incCodes {
+				addCode(c)
+			}
+		}
+		for _, exc := range vs.Compose.Exclude {
+			excCodes, err := t.expandInclude(exc, stack)
+			if err != nil {
+				return nil, fmt.Errorf("In ValueSet %s: %w", url, err)
+			}
+			excluded := make(map[string]struct{})
+			for _, c := range excCodes {
+				excluded[codeKey(c)] = struct{}{}
+			}
+			filtered := make([]fhirCode, 0, len(codes))
+			for _, c := range codes {
+				if _, ok := excluded[codeKey(c)]; !ok {
+					filtered = append(filtered, c)
+				}
+			}
+			codes = filtered
+		}
+	}
+	t.expanded[url] = codes
+	return codes, nil
+}
+
+func fhirCodeValue(c fhirCode, caseSensitive bool) ValuesetValue {
+	ret := ValuesetValue{
+		KeyValues:     map[string]string{FHIRCodeKey: c.code, FHIRSystemKey: c.system},
+		ResultValues:  map[string]string{FHIRCodeKey: c.code, FHIRSystemKey: c.system},
+		CaseSensitive: caseSensitive,
+	}
+	if len(c.display) > 0 {
+		ret.KeyValues[FHIRDisplayKey] = c.display
+		ret.ResultValues[FHIRDisplayKey] = c.display
+	}
+	return ret
+}
+
+// equivalenceRank ranks concept map equivalences. Lower is
+// stronger. Returns -1 for equivalences that are not mappings.
+func equivalenceRank(eq string) int {
+	switch eq {
+	case "", "equivalent", "equal":
+		return 0
+	case "wider", "subsumes", "source-is-narrower-than-target":
+		return 1
+	case "narrower", "specializes", "source-is-broader-than-target":
+		return 2
+	case "inexact", "relatedto", "related-to":
+		return 3
+	}
+	// unmatched, disjoint, not-related-to
+	return -1
+}
+
+func (t *fhirTerminology) conceptMapValueset(cm fhirConceptMap) Valueset {
+	ret := Valueset{ID: fhirResourceID(cm.URL, cm.ID)}
+	for _, group := range cm.Group {
+		for _, element := range group.Element {
+			// Only use the targets with the strongest equivalence
+			best := -1
+			for _, target := range element.Target {
+				eq := target.Equivalence
+				if len(eq) == 0 {
+					eq = target.Relationship
+				}
+				if r := equivalenceRank(eq); r != -1 && (best == -1 || r < best) {
+					best = r
+				}
+			}
+			if best == -1 {
+				continue
+			}
+			for _, target := range element.Target {
+				eq := target.Equivalence
+				if len(eq) == 0 {
+					eq = target.Relationship
+				}
+				if equivalenceRank(eq) != best {
+					continue
+				}
+				if len(eq) == 0 {
+					eq = "equivalent"
+				}
+				v := ValuesetValue{
+					KeyValues:    map[string]string{FHIRCodeKey: element.Code, FHIRSystemKey: group.Source},
+					ResultValues: map[string]string{FHIRCodeKey: target.Code, FHIRSystemKey: group.Target, FHIREquivalenceKey: eq},
+				}
+				display := target.Display
+				if len(display) == 0 {
+					if cs := t.codeSystems[group.Target]; cs != nil {
+						display = cs.display[target.Code]
+					}
+				}
+				if len(display) > 0 {
+					v.ResultValues[FHIRDisplayKey] = display
+				}
+				ret.Values = append(ret.Values, v)
+			}
+		}
+		if group.Unmapped != nil && group.Unmapped.Mode == "fixed" {
+			v := ValuesetValue{
+				ResultValues: map[string]string{FHIRCodeKey: group.Unmapped.Code, FHIRSystemKey: group.Target},
+			}
+			if len(group.Unmapped.Display) > 0 {
+				v.ResultValues[FHIRDisplayKey] = group.Unmapped.Display
+			}
+			ret.Values = append(ret.Values, v)
+		}
+	}
+	return ret
+}
+
+// valuesets converts the resources to valuesets. Code systems and
+// value sets are converted to valuesets whose values are keyed by
+// code and system, and return code, system, and display. Concept maps
+// are converted to valuesets that map the source code and system to
+// the target code, system, display, and equivalence. The valueset ids
+// are the canonical urls of the resources.
+func (t *fhirTerminology) valuesets() ([]Valueset, error) {
+	ret := make([]Valueset, 0)
+	csURLs := make([]string, 0, len(t.codeSystems))
+	for url := range t.codeSystems {
+		csURLs = append(csURLs, url)
+	}
+	sort.Strings(csURLs)
+	for _, url := range csURLs {
+		cs := t.codeSystems[url]
+		vs := Valueset{ID: url}
+		for _, c := range cs.codes {
+			vs.Values = append(vs.Values, fhirCodeValue(c, cs.caseSensitive))
+		}
+		ret = append(ret, vs)
+	}
+	vsURLs := make([]string, 0, len(t.valueSets))
+	for url := range t.valueSets {
+		vsURLs = append(vsURLs, url)
+	}
+	sort.Strings(vsURLs)
+	for _, url := range vsURLs {
+		codes, err := t.expand(url, make(map[string]struct{}))
+		if err != nil {
+			return nil, err
+		}
+		vs := Valueset{ID: url}
+		for _, c := range codes {
+			caseSensitive := false
+			if cs := t.codeSystems[c.system]; cs != nil {
+				caseSensitive = cs.caseSensitive
+			}
+			vs.Values = append(vs.Values, fhirCodeValue(c, caseSensitive))
+		}
+		ret = append(ret, vs)
+	}
+	for _, cm := range t.conceptMaps {
+		ret = append(ret, t.conceptMapValueset(cm))
+	}
+	return ret, nil
+}
+
+// LoadFHIRTerminology reads FHIR CodeSystem, ValueSet, and ConceptMap
+// resources, or bundles containing them, and returns the
+// corresponding valusets. Valueset compose filters are evaluated
+// using the code systems in the given files.
+func LoadFHIRTerminology(files []string) ([]Valueset, error) {
+	t := newFHIRTerminology()
+	for _, file := range files {
+		data, err := cmdutil.ReadURL(file)
+		if err != nil {
+			return nil, fmt.Errorf("While reading %s: %w", file, err)
+		}
+		if err := t.add(data); err != nil {
+			return nil, fmt.Errorf("While reading %s: %w", file, err)
+		}
+	}
+	return t.valuesets()
+}
+
+// LoadFHIRResources loads the FHIR terminology resources as valuesets
+func (vsets *Valuesets) LoadFHIRResources(ctx *ls.Context, reldir string) error {
+	if len(vsets.FHIR) == 0 {
+		return nil
+	}
+	files := make([]string, 0, len(vsets.FHIR))
+	for _, f := range vsets.FHIR {
+		files = append(files, getRelativeFileName(reldir, f))
+	}
+	sets, err := LoadFHIRTerminology(files)
+	if err != nil {
+		return err
+	}
+	for _, vs := range sets {
+		if _, exists := vsets.Sets[vs.ID]; exists {
+			return fmt.Errorf("Value set %s already defined", vs.ID)
+		}
+		vsets.Sets[vs.ID] = vs
+		ctx.GetLogger().Debug(map[string]interface{}{"valueset": vs.ID, "fhir": true})
+	}
+	return nil
+}
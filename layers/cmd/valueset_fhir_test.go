@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	vs "github.com/cloudprivacylabs/lsa/layers/cmd/valueset"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+func TestFHIRValuesets(t *testing.T) {
+	vsets := &Valuesets{}
+	if err := LoadValuesetFiles(ls.DefaultContext(), nil, vsets, vs.NoCache{}, []string{"testdata/fhir-valuesets.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+	const (
+		conditions = "http://example.org/fhir/CodeSystem/conditions"
+		diabetes   = "http://example.org/fhir/ValueSet/diabetes"
+		chronic    = "http://example.org/fhir/ValueSet/chronic"
+		icd10      = "http://example.org/fhir/ConceptMap/conditions-to-icd10"
+	)
+	codes := func(id string) []string {
+		ret := make([]string, 0)
+		for _, v := range vsets.Sets[id].Values {
+			ret = append(ret, v.KeyValues[FHIRCodeKey])
+		}
+		return ret
+	}
+	if c := codes(conditions); !reflect.DeepEqual(c, []string{"DM", "DM1", "DM2", "FLU", "HTN"}) {
+		t.Errorf("Wrong code system: %v", c)
+	}
+	if c := codes(diabetes); !reflect.DeepEqual(c, []string{"DM1", "DM2"}) {
+		t.Errorf("Wrong is-a expansion: %v", c)
+	}
+	if c := codes(chronic); !reflect.DeepEqual(c, []string{"DM", "HTN"}) {
+		t.Errorf("Wrong property filter expansion: %v", c)
+	}
+
+	for _, tc := range []struct {
+		table    string
+		req      map[string]string
+		expected map[string]string
+	}{
+		{conditions, map[string]string{"code": "DM2"}, map[string]string{"code": "DM2", "system": conditions, "display": "Type 2 diabetes"}},
+		{conditions, map[string]string{"code": "dm2"}, nil},
+		{diabetes, map[string]string{"code": "DM1", "system": conditions}, map[string]string{"code": "DM1", "system": conditions, "display": "Type 1 diabetes"}},
+		{diabetes, map[string]string{"code": "HTN"}, nil},
+		{icd10, map[string]string{"code": "DM1", "system": conditions}, map[string]string{"code": "E10", "system": "http://hl7.org/fhir/sid/icd-10", "display": "Type 1 diabetes mellitus", "equivalence": "equivalent"}},
+		{icd10, map[string]string{"code": "HTN"}, map[string]string{"code": "I10", "system": "http://hl7.org/fhir/sid/icd-10", "display": "Essential hypertension", "equivalence": "wider"}},
+		{icd10, map[string]string{"code": "FLU"}, nil},
+	} {
+		rsp, err := vsets.Lookup(ls.DefaultContext(), ls.ValuesetLookupRequest{TableIDs: []string{tc.table}, KeyValues: tc.req})
+		if err != nil {
+			t.Errorf("%s %v: %v", tc.table, tc.req, err)
+			continue
+		}
+		if len(rsp.KeyValues) == 0 && tc.expected == nil {
+			continue
+		}
+		if !reflect.DeepEqual(rsp.KeyValues, tc.expected) {
+			t.Errorf("%s %v: got %v expected %v", tc.table, tc.req, rsp.KeyValues, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/cloudprivacylabs/lsa/pkg/similarity"
+)
+
+// Valueset matching strategies
+const (
+	MatchExact       = "exact"
+	MatchTokenSet    = "tokenSet"
+	MatchLevenshtein = "levenshtein"
+	MatchJaroWinkler = "jaroWinkler"
+)
+
+// DefaultMatchThreshold is the minimum score for fuzzy matching
+// strategies if no threshold is given
+const DefaultMatchThreshold = 0.85
+
+// MatchOptions specify how the input values are compared to the
+// valueset values.
+type MatchOptions struct {
+	// Strategy is one of exact, tokenSet, levenshtein, or
+	// jaroWinkler. Default is exact.
+	Strategy string `json:"strategy" yaml:"strategy"`
+	// Threshold is the minimum match score between 0 and 1. If zero,
+	// DefaultMatchThreshold is used for fuzzy strategies.
+	Threshold float64 `json:"threshold" yaml:"threshold"`
+	// If true, values are Unicode normalized: accents are removed,
+	// compatibility characters are decomposed, and punctuation is
+	// treated as space.
+	Normalize bool `json:"normalize" yaml:"normalize"`
+	// Synonyms maps a canonical word or phrase to its
+	// alternatives. Alternatives are replaced with the canonical value
+	// before comparison.
+	Synonyms map[string][]string `json:"synonyms" yaml:"synonyms"`
+}
+
+// IsEmpty returns true if no matching options are specified. Lookups
+// using the default options do not report a match score.
+func (opt MatchOptions) IsEmpty() bool {
+	return len(opt.Strategy) == 0 && opt.Threshold == 0 && !opt.Normalize && len(opt.Synonyms) == 0
+}
+
+type valuesetMatcher struct {
+	strategy  string
+	threshold float64
+	normalize bool
+	// normalized alternative -> normalized canonical value
+	synonyms map[string]string
+}
+
+func newValuesetMatcher(opt MatchOptions) (*valuesetMatcher, error) {
+	ret := &valuesetMatcher{
+		strategy:  opt.Strategy,
+		threshold: opt.Threshold,
+		normalize: opt.Normalize,
+	}
+	switch ret.strategy {
+	case "":
+		ret.strategy = MatchExact
+	case MatchExact, MatchTokenSet, MatchLevenshtein, MatchJaroWinkler:
+	default:
+		return nil, fmt.Errorf("Unknown valueset match strategy: %s", opt.Strategy)
+	}
+	if ret.threshold < 0 || ret.threshold > 1 {
+		return nil, fmt.Errorf("Invalid valueset match threshold: %v", opt.Threshold)
+	}
+	if ret.threshold == 0 {
+		if ret.strategy == MatchExact {
+			ret.threshold = 1
+		} else {
+			ret.threshold = DefaultMatchThreshold
+		}
+	}
+	if len(opt.Synonyms) > 0 {
+		ret.synonyms = make(map[string]string)
+		for canonical, alternatives := range opt.Synonyms {
+			c := ret.clean(canonical)
+			for _, alt := range alternatives {
+				ret.synonyms[strings.ToLower(ret.clean(alt))] = c
+			}
+		}
+	}
+	return ret, nil
+}
+
+// exactMatcher is the matcher for the default match options
+var exactMatcher, _ = newValuesetMatcher(MatchOptions{})
+
+var stripMarks = transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// clean normalizes the input if necessary, and collapses whitespace
+func (m *valuesetMatcher) clean(s string) string {
+	if m.normalize {
+		if out, _, err := transform.String(stripMarks, s); err == nil {
+			s = out
+		}
+		s = strings.Map(func(r rune) rune {
+			if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+				return ' '
+			}
+			return r
+		}, s)
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// prepare returns the normalized input with synonyms replaced
+func (m *valuesetMatcher) prepare(s string, caseSensitive bool) string {
+	s = m.clean(s)
+	if len(m.synonyms) > 0 {
+		if c, ok := m.synonyms[strings.ToLower(s)]; ok {
+			s = c
+		} else {
+			words := strings.Fields(s)
+			for i, w := range words {
+				if c, ok := m.synonyms[strings.ToLower(w)]; ok {
+					words[i] = c
+				}
+			}
+			s = strings.Join(words, " ")
+		}
+	}
+	if !caseSensitive {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// score returns the similarity of the two values between 0 and 1
+func (m *valuesetMatcher) score(s1, s2 string, caseSensitive bool) float64 {
+	s1 = m.prepare(s1, caseSensitive)
+	s2 = m.prepare(s2, caseSensitive)
+	if s1 == s2 {
+		return 1
+	}
+	switch m.strategy {
+	case MatchTokenSet:
+		return similarity.TokenSetSimilarity(s1, s2)
+	case MatchLevenshtein:
+		return similarity.LevenshteinSimilarity(s1, s2)
+	case MatchJaroWinkler:
+		return similarity.JaroWinklerSimilarity(s1, s2)
+	}
+	return 0
+}
+
+// matches returns the score and whether it is above the threshold
+func (m *valuesetMatcher) matches(s1, s2 string, caseSensitive bool) (float64, bool) {
+	score := m.score(s1, s2, caseSensitive)
+	return score, score >= m.threshold
+}
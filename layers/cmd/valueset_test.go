@@ -1,13 +1,17 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"path/filepath"
 	"reflect"
 	"sync"
 	"testing"
 
+	"github.com/cloudprivacylabs/lpg/v2"
 	"github.com/cloudprivacylabs/lsa/layers/cmd/cmdutil"
 	"github.com/cloudprivacylabs/lsa/layers/cmd/valueset"
 	vs "github.com/cloudprivacylabs/lsa/layers/cmd/valueset"
@@ -280,3 +284,199 @@ func TestLoadValuesetConfig(t *testing.T) {
 		}
 	}
 }
+
+func TestFuzzyMatch(t *testing.T) {
+	values := []ValuesetValue{
+		{Values: []string{"Essential hypertension"}, Result: "I10"},
+		{Values: []string{"Type 2 diabetes mellitus"}, Result: "E11"},
+		{Values: []string{"Café au lait spots"}, Result: "L81.3"},
+	}
+	for _, tc := range []struct {
+		opt      MatchOptions
+		input    string
+		expected string
+		score    float64
+	}{
+		{MatchOptions{}, "essential  hypertension", "I10", 0},
+		{MatchOptions{}, "Hypertension, essential", "", 0},
+		{MatchOptions{Strategy: MatchTokenSet}, "Hypertension, essential", "I10", 1},
+		{MatchOptions{Strategy: MatchTokenSet}, "hypertension", "", 0},
+		{MatchOptions{Strategy: MatchTokenSet, Threshold: 0.5}, "hypertension", "I10", 0.5},
+		{MatchOptions{Strategy: MatchTokenSet, Synonyms: map[string][]string{"hypertension": {"HTN", "high blood pressure"}}}, "essential HTN", "I10", 1},
+		{MatchOptions{Synonyms: map[string][]string{"Type 2 diabetes mellitus": {"T2DM"}}}, "t2dm", "E11", 1},
+		{MatchOptions{Strategy: MatchLevenshtein}, "Essential hypertensoin", "I10", 1 - 2.0/22},
+		{MatchOptions{Strategy: MatchJaroWinkler, Threshold: 0.9}, "Type 2 diabetis mellitus", "E11", -1},
+		{MatchOptions{Strategy: MatchJaroWinkler, Threshold: 0.9}, "Asthma", "", 0},
+		{MatchOptions{}, "cafe au lait spots", "", 0},
+		{MatchOptions{Normalize: true}, "CAFE-AU-LAIT SPOTS", "L81.3", 1},
+	} {
+		vs := Valueset{ID: "conditions", Values: values, Options: Options{Match: tc.opt}}
+		rsp, err := vs.Lookup(ls.ValuesetLookupRequest{KeyValues: map[string]string{"": tc.input}})
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+			continue
+		}
+		if rsp.KeyValues[""] != tc.expected {
+			t.Errorf("%s: got %v expected %s", tc.input, rsp.KeyValues, tc.expected)
+			continue
+		}
+		if tc.score >= 0 && (rsp.Score < tc.score-1e-9 || rsp.Score > tc.score+1e-9) {
+			t.Errorf("%s: wrong score %v expected %v", tc.input, rsp.Score, tc.score)
+		}
+		if tc.score < 0 && (rsp.Score < 0.9 || rsp.Score >= 1) {
+			t.Errorf("%s: wrong score %v", tc.input, rsp.Score)
+		}
+	}
+
+	// Best match wins, ties are errors
+	vs := Valueset{ID: "x", Values: []ValuesetValue{
+		{Values: []string{"abcdef"}, Result: "1"},
+		{Values: []string{"abcdxy"}, Result: "2"},
+		{Values: []string{"abcdxz"}, Result: "3"},
+	}, Options: Options{Match: MatchOptions{Strategy: MatchLevenshtein, Threshold: 0.5}}}
+	rsp, err := vs.Lookup(ls.ValuesetLookupRequest{KeyValues: map[string]string{"": "abcdeg"}})
+	if err != nil || rsp.KeyValues[""] != "1" {
+		t.Errorf("Expected best match: %v %v", rsp, err)
+	}
+	if _, err := vs.Lookup(ls.ValuesetLookupRequest{KeyValues: map[string]string{"": "abcdx"}}); err == nil {
+		t.Errorf("Expected ambiguous match error")
+	}
+	// A tie that is not at the best score is not an error
+	vs = Valueset{ID: "y", Values: []ValuesetValue{
+		{Values: []string{"abcdefwxyz"}, Result: "A"},
+		{Values: []string{"vwxyefghij"}, Result: "B"},
+		{Values: []string{"abcdefghiz"}, Result: "C"},
+	}, Options: Options{Match: MatchOptions{Strategy: MatchLevenshtein, Threshold: 0.5}}}
+	rsp, err = vs.Lookup(ls.ValuesetLookupRequest{KeyValues: map[string]string{"": "abcdefghij"}})
+	if err != nil || rsp.KeyValues[""] != "C" {
+		t.Errorf("Expected best match after tie: %v %v", rsp, err)
+	}
+	vs.Options.Match.Strategy = "soundex"
+	if _, err := vs.Lookup(ls.ValuesetLookupRequest{KeyValues: map[string]string{"": "abcdef"}}); err == nil {
+		t.Errorf("Expected unknown strategy error")
+	}
+}
+
+func TestWarmupCache(t *testing.T) {
+	requests, err := ReadValuesetRequests([][]string{
+		{"tableId", "", "code"},
+		{"gender", "M", ""},
+		{"gender; other", "", "F"},
+		{"gender", "X", ""},
+		{"", "", ""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 3 || !reflect.DeepEqual(requests[1], ls.ValuesetLookupRequest{TableIDs: []string{"gender", "other"}, KeyValues: map[string]string{"code": "F"}}) {
+		t.Fatalf("Wrong requests: %v", requests)
+	}
+	requests = requests[:1]
+	cache, err := valueset.OpenBoltCache(filepath.Join(t.TempDir(), "cache.db"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	vsets := Valuesets{
+		Sets: map[string]Valueset{"gender": {ID: "gender", Values: []ValuesetValue{
+			{Values: []string{"M"}, Result: "Male"},
+		}}},
+		cache: cache,
+	}
+	found := vsets.WarmupCache(ls.DefaultContext(), requests, func(req ls.ValuesetLookupRequest, err error) { t.Errorf("%v: %v", req, err) })
+	if found != 1 {
+		t.Errorf("Found: %d", found)
+	}
+	rsp, ok := cache.Lookup(requests[0])
+	if !ok || rsp.KeyValues[""] != "Male" {
+		t.Errorf("Not cached: %v", rsp)
+	}
+}
+
+type mockBatchDB struct {
+	batches [][]map[string]string
+	single  int
+}
+
+func (m *mockBatchDB) GetTableIds() map[string]struct{} { return map[string]struct{}{"db": {}} }
+
+func (m *mockBatchDB) Close() error { return nil }
+
+func (m *mockBatchDB) ValueSetLookup(ctx context.Context, tableId string, queryParams map[string]string) (map[string]string, error) {
+	m.single++
+	return nil, nil
+}
+
+func (m *mockBatchDB) ValueSetBatchLookup(ctx context.Context, tableId string, queries []map[string]string) ([]map[string]string, error) {
+	m.batches = append(m.batches, queries)
+	ret := make([]map[string]string, len(queries))
+	for i, q := range queries {
+		if q[""] == "X" {
+			ret[i] = map[string]string{"": "found"}
+		}
+	}
+	return ret, nil
+}
+
+func TestBatchLookup(t *testing.T) {
+	db := &mockBatchDB{}
+	vsets := Valuesets{
+		Sets: map[string]Valueset{"gender": {ID: "gender", Values: []ValuesetValue{
+			{Values: []string{"M"}, Result: "Male"},
+		}}},
+		databases: []valueset.ValuesetDB{db},
+		cache:     valueset.NoCache{},
+	}
+	rsp, err := vsets.BatchLookup(ls.DefaultContext(), []ls.ValuesetLookupRequest{
+		{TableIDs: []string{"db"}, KeyValues: map[string]string{"": "X"}},
+		{TableIDs: []string{"gender"}, KeyValues: map[string]string{"": "M"}},
+		{TableIDs: []string{"db"}, KeyValues: map[string]string{"": "Y"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp) != 3 || rsp[0].KeyValues[""] != "found" || rsp[1].KeyValues[""] != "Male" || len(rsp[2].KeyValues) != 0 {
+		t.Errorf("Wrong responses: %v", rsp)
+	}
+	if len(db.batches) != 1 || len(db.batches[0]) != 2 || db.single != 0 {
+		t.Errorf("Wrong db calls: %v %d", db.batches, db.single)
+	}
+}
+
+func TestUnmatchedReport(t *testing.T) {
+	report := UnmatchedReport{MaxSamples: 2}
+	g := ls.NewDocumentGraph()
+	docs := make([]*lpg.Node, 0)
+	for i := 0; i < 3; i++ {
+		node := g.NewNode([]string{ls.DocumentNodeTerm.Name}, nil)
+		ls.SetNodeID(node, fmt.Sprintf("doc%d", i))
+		docs = append(docs, node)
+	}
+	match := ls.ValuesetLookupResponse{KeyValues: map[string]string{"": "x"}}
+	gender := []string{"gender"}
+	report.Record(ls.ValuesetLookupRequest{TableIDs: gender, KeyValues: map[string]string{"": "M"}}, match, docs[0])
+	for _, doc := range docs {
+		report.Record(ls.ValuesetLookupRequest{TableIDs: gender, KeyValues: map[string]string{"": "Q"}}, ls.ValuesetLookupResponse{}, doc)
+	}
+	report.Record(ls.ValuesetLookupRequest{TableIDs: []string{"race"}, KeyValues: map[string]string{"code": "1", "system": "s"}}, ls.ValuesetLookupResponse{}, nil)
+	report.Record(ls.ValuesetLookupRequest{TableIDs: []string{"race"}, KeyValues: map[string]string{"code": "2", "system": "s"}}, match, nil)
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `tableId,keyValues,count,sampleDocuments
+gender,Q,3,doc0; doc1
+race,code=1; system=s,1,
+`
+	if buf.String() != expected {
+		t.Errorf("Got %s", buf.String())
+	}
+	if err := report.CheckRate(0.75); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	var rateErr ErrUnmatchedRate
+	if err := report.CheckRate(0.6); !errors.As(err, &rateErr) || rateErr.Table != "gender" {
+		t.Errorf("Expected rate error for gender: %v", err)
+	}
+}
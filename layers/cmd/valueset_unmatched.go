@@ -0,0 +1,191 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+// DefaultUnmatchedSamples is the number of sample document ids kept
+// for each unmatched request
+const DefaultUnmatchedSamples = 5
+
+// UnmatchedReport collects the valueset lookup requests that did not
+// match any valueset entry
+type UnmatchedReport struct {
+	// MaxSamples is the number of sample document ids kept for each
+	// request. If zero, DefaultUnmatchedSamples is used
+	MaxSamples int
+
+	mu       sync.Mutex
+	requests map[string]*unmatchedRequest
+	tables   map[string]*tableLookups
+}
+
+type unmatchedRequest struct {
+	table     string
+	keyValues string
+	count     int
+	samples   []string
+}
+
+type tableLookups struct {
+	total     int
+	unmatched int
+}
+
+// ErrUnmatchedRate is returned if the ratio of unmatched lookups for a
+// table is above the threshold
+type ErrUnmatchedRate struct {
+	Table     string
+	Rate      float64
+	Threshold float64
+}
+
+func (e ErrUnmatchedRate) Error() string {
+	return fmt.Sprintf("Unmatched valueset lookups for %s: %.2f%%, above threshold %.2f%%", e.Table, e.Rate*100, e.Threshold*100)
+}
+
+// formatKeyValues returns the request key-values as sorted key=value
+// pairs. A value without a key is written as is.
+func formatKeyValues(kv map[string]string) string {
+	items := make([]string, 0, len(kv))
+	for k, v := range kv {
+		if len(k) == 0 {
+			items = append(items, v)
+		} else {
+			items = append(items, k+"="+v)
+		}
+	}
+	sort.Strings(items)
+	return strings.Join(items, "; ")
+}
+
+// Record records the result of a lookup. The document id of the
+// context node is kept as a sample if the lookup did not match.
+func (r *UnmatchedReport) Record(req ls.ValuesetLookupRequest, rsp ls.ValuesetLookupResponse, contextDocNode *lpg.Node) {
+	table := strings.Join(req.TableIDs, ",")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tables == nil {
+		r.tables = make(map[string]*tableLookups)
+		r.requests = make(map[string]*unmatchedRequest)
+	}
+	tl := r.tables[table]
+	if tl == nil {
+		tl = &tableLookups{}
+		r.tables[table] = tl
+	}
+	tl.total++
+	if len(rsp.KeyValues) > 0 {
+		return
+	}
+	tl.unmatched++
+	kv := formatKeyValues(req.KeyValues)
+	key := table + "\x00" + kv
+	entry := r.requests[key]
+	if entry == nil {
+		entry = &unmatchedRequest{table: table, keyValues: kv}
+		r.requests[key] = entry
+	}
+	entry.count++
+	maxSamples := r.MaxSamples
+	if maxSamples == 0 {
+		maxSamples = DefaultUnmatchedSamples
+	}
+	if contextDocNode == nil || len(entry.samples) >= maxSamples {
+		return
+	}
+	docID := ls.GetNodeID(contextDocNode)
+	if root := ls.GetEntityRootNode(contextDocNode); root != nil {
+		docID = ls.GetNodeID(root)
+	}
+	for _, s := range entry.samples {
+		if s == docID {
+			return
+		}
+	}
+	entry.samples = append(entry.samples, docID)
+}
+
+// UnmatchedRates returns the ratio of unmatched lookups for each table
+func (r *UnmatchedReport) UnmatchedRates() map[string]float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ret := make(map[string]float64, len(r.tables))
+	for table, tl := range r.tables {
+		ret[table] = float64(tl.unmatched) / float64(tl.total)
+	}
+	return ret
+}
+
+// CheckRate returns an error if the unmatched ratio of a table is
+// above the threshold
+func (r *UnmatchedReport) CheckRate(threshold float64) error {
+	rates := r.UnmatchedRates()
+	tables := make([]string, 0, len(rates))
+	for t := range rates {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	for _, t := range tables {
+		if rates[t] > threshold {
+			return ErrUnmatchedRate{Table: t, Rate: rates[t], Threshold: threshold}
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes the unmatched requests as CSV, with columns
+// tableId, keyValues, count, and sampleDocuments. Requests are sorted
+// by table, and then by descending count.
+func (r *UnmatchedReport) WriteCSV(w io.Writer) error {
+	r.mu.Lock()
+	entries := make([]*unmatchedRequest, 0, len(r.requests))
+	for _, e := range r.requests {
+		entries = append(entries, e)
+	}
+	r.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].table != entries[j].table {
+			return entries[i].table < entries[j].table
+		}
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].keyValues < entries[j].keyValues
+	})
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"tableId", "keyValues", "count", "sampleDocuments"}); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := cw.Write([]string{e.table, e.keyValues, strconv.Itoa(e.count), strings.Join(e.samples, "; ")}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cloudprivacylabs/lsa/layers/cmd/cmdutil"
+	"github.com/cloudprivacylabs/lsa/layers/cmd/valueset"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+func init() {
+	valuesetCmd.AddCommand(valuesetWarmupCmd)
+	valuesetWarmupCmd.Flags().StringSlice("valueset", nil, "Valueset file(s)")
+}
+
+// ReadValuesetRequests reads valueset lookup requests from a
+// spreadsheet. The first row is the header. The "tableId" column
+// gives the table ids separated by ';'. The other columns give the
+// request keys. A column with an empty header gives the value for
+// requests without a key. Empty cells are not included in the
+// request.
+func ReadValuesetRequests(sheet [][]string) ([]ls.ValuesetLookupRequest, error) {
+	if len(sheet) == 0 {
+		return nil, nil
+	}
+	header := sheet[0]
+	tableCol := -1
+	for i, h := range header {
+		if strings.TrimSpace(h) == "tableId" {
+			tableCol = i
+			break
+		}
+	}
+	if tableCol == -1 {
+		return nil, fmt.Errorf("No tableId column in valueset requests")
+	}
+	ret := make([]ls.ValuesetLookupRequest, 0, len(sheet)-1)
+	for _, row := range sheet[1:] {
+		req := ls.ValuesetLookupRequest{KeyValues: make(map[string]string)}
+		for i, cell := range row {
+			if i >= len(header) || len(cell) == 0 {
+				continue
+			}
+			if i == tableCol {
+				for _, t := range strings.Split(cell, ";") {
+					if t = strings.TrimSpace(t); len(t) > 0 {
+						req.TableIDs = append(req.TableIDs, t)
+					}
+				}
+				continue
+			}
+			req.KeyValues[strings.TrimSpace(header[i])] = cell
+		}
+		if len(req.KeyValues) == 0 {
+			continue
+		}
+		ret = append(ret, req)
+	}
+	return ret, nil
+}
+
+// WarmupCache looks up all the requests and stores the results in
+// the cache, replacing any cached results. It returns the number of
+// requests that found a value. Lookup errors are reported to the
+// errFunc, and the warm-up continues with the next request.
+func (vsets Valuesets) WarmupCache(ctx *ls.Context, requests []ls.ValuesetLookupRequest, errFunc func(ls.ValuesetLookupRequest, error)) int {
+	found := 0
+	for _, req := range requests {
+		rsp, err := vsets.lookup(ctx, req)
+		if err != nil {
+			errFunc(req, err)
+			continue
+		}
+		vsets.cache.Set(req, rsp)
+		if len(rsp.KeyValues) > 0 {
+			found++
+		}
+	}
+	return found
+}
+
+var valuesetWarmupCmd = &cobra.Command{
+	Use:   "warmup",
+	Short: "Pre-populate the valueset lookup cache",
+	Long: `Pre-populate the persistent valueset lookup cache from a CSV or
+Excel file of known requests:
+
+  layers valueset warmup --cache valuesets.cache --valueset vs.yaml requests.csv
+
+The first row of the file is the header. The "tableId" column gives
+the valueset ids separated by ';'. The other columns give the request
+keys, and a column with an empty header gives the value for requests
+without a key:
+
+  tableId,,code,system
+  gender,M,,
+  conditions,,I10,http://hl7.org/fhir/sid/icd-10
+
+All requests are looked up, and their results replace the cached
+results. Expired entries are removed from the cache.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cacheFile, _ := cmd.Flags().GetString("cache")
+		if len(cacheFile) == 0 {
+			fail("Cache file is required")
+		}
+		ttl, _ := cmd.Flags().GetString("cache-ttl")
+		cache, err := openValuesetCache(cacheFile, ttl)
+		if err != nil {
+			failErr(err)
+		}
+		defer cache.Close()
+		if bc, ok := cache.(*valueset.BoltCache); ok {
+			if _, err := bc.Purge(); err != nil {
+				failErr(err)
+			}
+		}
+		ctx := getContext()
+		var vsets Valuesets
+		vsf, _ := cmd.Flags().GetStringSlice("valueset")
+		if err := LoadValuesetFiles(ctx, Environment, &vsets, cache, vsf); err != nil {
+			failErr(err)
+		}
+		defer vsets.Close()
+		sheets, err := cmdutil.ReadSheets(args[0])
+		if err != nil {
+			failErr(err)
+		}
+		requests := make([]ls.ValuesetLookupRequest, 0)
+		for _, sheet := range sheets {
+			r, err := ReadValuesetRequests(sheet)
+			if err != nil {
+				failErr(err)
+			}
+			requests = append(requests, r...)
+		}
+		nErrors := 0
+		found := vsets.WarmupCache(ctx, requests, func(req ls.ValuesetLookupRequest, err error) {
+			nErrors++
+			fmt.Fprintf(os.Stderr, "%v: %v\n", req, err)
+		})
+		fmt.Printf("Requests: %d, found: %d, errors: %d\n", len(requests), found, nErrors)
+	},
+}
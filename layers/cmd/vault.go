@@ -0,0 +1,243 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cloudprivacylabs/lsa/layers/cmd/pipeline"
+	"github.com/cloudprivacylabs/lsa/pkg/privacy"
+)
+
+const defaultVaultKeyEnv = "LSA_VAULT_KEY"
+
+type openVaultEntry struct {
+	vault privacy.Vault
+	key   string
+	refs  int
+}
+
+var (
+	openVaults   = map[string]*openVaultEntry{}
+	openVaultsMu sync.Mutex
+)
+
+// openVault returns the vault for the file. The vault file is locked
+// while it is open, so tokenize and detokenize steps of the same
+// process share the same vault. All steps using the same vault file
+// must use the same key. The vault must be released with
+// releaseVault.
+func openVault(pipeline *pipeline.PipelineContext, file, keyEnv string) (privacy.Vault, error) {
+	if len(file) == 0 {
+		return nil, fmt.Errorf("Vault file is required")
+	}
+	if len(keyEnv) == 0 {
+		keyEnv = defaultVaultKeyEnv
+	}
+	key, ok := pipeline.Env[keyEnv]
+	if !ok {
+		key = os.Getenv(keyEnv)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("Vault key is not set in %s", keyEnv)
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	openVaultsMu.Lock()
+	defer openVaultsMu.Unlock()
+	if entry, ok := openVaults[abs]; ok {
+		if entry.key != key {
+			return nil, fmt.Errorf("Vault %s is already open with a different key", file)
+		}
+		entry.refs++
+		return entry.vault, nil
+	}
+	v, err := privacy.OpenBoltVault(abs, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	openVaults[abs] = &openVaultEntry{vault: v, key: key, refs: 1}
+	return v, nil
+}
+
+// releaseVault closes the vault when it is no longer used by any step
+func releaseVault(vault privacy.Vault) error {
+	openVaultsMu.Lock()
+	defer openVaultsMu.Unlock()
+	for k, entry := range openVaults {
+		if entry.vault != vault {
+			continue
+		}
+		entry.refs--
+		if entry.refs > 0 {
+			return nil
+		}
+		delete(openVaults, k)
+		return vault.Close()
+	}
+	return nil
+}
+
+type VaultStep struct {
+	VaultFile string `json:"vault" yaml:"vault"`
+	KeyEnv    string `json:"keyEnv" yaml:"keyEnv"`
+
+	processor *privacy.VaultProcessor
+}
+
+func (vs *VaultStep) getProcessor(pipeline *pipeline.PipelineContext) (*privacy.VaultProcessor, error) {
+	if vs.processor != nil {
+		return vs.processor, nil
+	}
+	v, err := openVault(pipeline, vs.VaultFile, vs.KeyEnv)
+	if err != nil {
+		return nil, err
+	}
+	vs.processor = &privacy.VaultProcessor{Vault: v}
+	return vs.processor, nil
+}
+
+func (vs *VaultStep) Flush(pipeline *pipeline.PipelineContext) error {
+	err := pipeline.FlushNext()
+	if vs.processor != nil {
+		if e := releaseVault(vs.processor.Vault); e != nil && err == nil {
+			err = e
+		}
+		vs.processor = nil
+	}
+	return err
+}
+
+type TokenizeStep struct {
+	VaultStep
+}
+
+func (TokenizeStep) Name() string { return "tokenize" }
+
+func (TokenizeStep) Help() {
+	fmt.Println(`Reversible tokenization
+Replace the values of the nodes annotated with privacy/vault with
+format-preserving tokens. The token-value mappings are stored in an
+encrypted vault file, so the tokens can be reversed using detokenize.
+
+operation: tokenize
+params:
+  vault: Vault file name. Created if it does not exist
+  keyEnv: Environment variable containing the vault key (default LSA_VAULT_KEY)`)
+}
+
+func (ts *TokenizeStep) Run(pipeline *pipeline.PipelineContext) error {
+	prc, err := ts.getProcessor(pipeline)
+	if err != nil {
+		return err
+	}
+	if _, err := prc.Tokenize(pipeline.Context, pipeline.Graph); err != nil {
+		return err
+	}
+	return pipeline.Next()
+}
+
+type DetokenizeStep struct {
+	VaultStep
+}
+
+func (DetokenizeStep) Name() string { return "detokenize" }
+
+func (DetokenizeStep) Help() {
+	fmt.Println(`Reverse tokenization
+Replace the tokens in the nodes annotated with privacy/vault with the
+original values stored in the vault.
+
+operation: detokenize
+params:
+  vault: Vault file name
+  keyEnv: Environment variable containing the vault key (default LSA_VAULT_KEY)`)
+}
+
+func (ds *DetokenizeStep) Run(pipeline *pipeline.PipelineContext) error {
+	prc, err := ds.getProcessor(pipeline)
+	if err != nil {
+		return err
+	}
+	if _, err := prc.Detokenize(pipeline.Context, pipeline.Graph); err != nil {
+		return err
+	}
+	return pipeline.Next()
+}
+
+func init() {
+	rootCmd.AddCommand(tokenizeCmd)
+	rootCmd.AddCommand(detokenizeCmd)
+	for _, c := range []*cobra.Command{tokenizeCmd, detokenizeCmd} {
+		c.Flags().String("input", "json", "Input graph format (json, jsonld)")
+		c.Flags().String("output", "json", "Output format, json, jsonld, or dot")
+		c.Flags().String("vault", "", "Vault file")
+		c.Flags().String("keyEnv", defaultVaultKeyEnv, "Environment variable containing the vault key")
+		c.MarkFlagRequired("vault")
+	}
+
+	pipeline.RegisterPipelineStep("tokenize", func() pipeline.Step { return &TokenizeStep{} })
+	pipeline.RegisterPipelineStep("detokenize", func() pipeline.Step { return &DetokenizeStep{} })
+}
+
+func vaultStepFromCmd(cmd *cobra.Command) VaultStep {
+	vs := VaultStep{}
+	vs.VaultFile, _ = cmd.Flags().GetString("vault")
+	vs.KeyEnv, _ = cmd.Flags().GetString("keyEnv")
+	return vs
+}
+
+var tokenizeCmd = &cobra.Command{
+	Use:   "tokenize",
+	Short: "Replace annotated values with reversible tokens",
+	Long: `Replace the values of the nodes annotated with privacy/vault with
+format-preserving tokens. The token-value mappings are stored in an
+encrypted vault file. The vault key is read from the environment
+variable given by --keyEnv.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		step := &TokenizeStep{VaultStep: vaultStepFromCmd(cmd)}
+		p := []pipeline.Step{
+			NewReadGraphStep(cmd),
+			step,
+			NewWriteGraphStep(cmd),
+		}
+		_, err := runPipeline(p, Environment, "", args)
+		return err
+	},
+}
+
+var detokenizeCmd = &cobra.Command{
+	Use:   "detokenize",
+	Short: "Replace tokens with the original values from the vault",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		step := &DetokenizeStep{VaultStep: vaultStepFromCmd(cmd)}
+		p := []pipeline.Step{
+			NewReadGraphStep(cmd),
+			step,
+			NewWriteGraphStep(cmd),
+		}
+		_, err := runPipeline(p, Environment, "", args)
+		return err
+	},
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudprivacylabs/lsa/layers/cmd/pipeline"
+	"github.com/cloudprivacylabs/lsa/pkg/privacy"
+)
+
+func TestOpenVaultKeyMismatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "vault.db")
+	ctx := &pipeline.PipelineContext{Env: map[string]string{"K1": "key1", "K2": "key2"}}
+	v1, err := openVault(ctx, file, "K1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := openVault(ctx, file, "K1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1 != v2 {
+		t.Errorf("Vault is not shared")
+	}
+	if _, err := openVault(ctx, file, "K2"); err == nil {
+		t.Errorf("Expecting key mismatch error")
+	}
+	releaseVault(v1)
+	releaseVault(v2)
+	// The vault is closed, and it was created with a different key
+	if _, err := openVault(ctx, file, "K2"); err != privacy.ErrVaultKeyMismatch {
+		t.Errorf("Expecting ErrVaultKeyMismatch, got %v", err)
+	}
+	v3, err := openVault(ctx, file, "K1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseVault(v3)
+}
@@ -0,0 +1,201 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/cloudprivacylabs/lsa/pkg/jsonld"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+var testSchemas = map[string]string{
+	"http://example.org/Person": `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/Person",
+ "@type": "Schema",
+ "valueType": "Person",
+ "layer": {
+  "@type": "Object",
+  "@id": "person",
+  "description": "A person",
+  "attributes": {
+   "person.id": {
+     "@type": "Value",
+     "attributeName":"id",
+     "valueType": "xsd:integer"
+   },
+   "person.lastUpdated": {
+     "@type": "Value",
+     "attributeName":"lastUpdated",
+     "valueType": "xsd:dateTime"
+   },
+   "person.name": {
+     "@type": "Object",
+     "attributeName":"name",
+     "attributes": {
+       "person.name.given": {
+         "@type": "Value",
+         "attributeName": "given_name"
+       }
+     }
+   },
+   "person.phones": {
+     "@type": "Array",
+     "attributeName":"phones",
+     "arrayElements": {
+       "@type": "Value",
+       "@id": "person.phones.item"
+     }
+   },
+   "person.addresses": {
+     "@type": "Array",
+     "attributeName": "addresses",
+     "arrayElements": {
+       "@type": "Reference",
+       "@id": "person.addresses.item",
+       "ref": "http://example.org/Address"
+     }
+   },
+   "person.work": {
+     "@type": "Reference",
+     "attributeName": "workAddress",
+     "ref": "http://example.org/Address"
+   },
+   "person.contact": {
+     "@type": "Polymorphic",
+     "attributeName": "contact",
+     "oneOf": [
+       {
+         "@id": "person.contact.email",
+         "@type": "Value"
+       },
+       {
+         "@id": "person.contact.address",
+         "@type": "Reference",
+         "ref": "http://example.org/Address"
+       }
+     ]
+   }
+  }
+ }
+}`,
+	"http://example.org/Address": `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/Address",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "address",
+  "attributes": {
+   "address.city": {
+     "@type": "Value",
+     "attributeName":"city",
+     "description": "City name"
+   }
+  }
+ }
+}`,
+}
+
+func compileTestSchema(t *testing.T) *ls.Layer {
+	compiler := ls.Compiler{
+		Loader: ls.SchemaLoaderFunc(func(ref string) (*ls.Layer, error) {
+			s, ok := testSchemas[ref]
+			if !ok {
+				return nil, fmt.Errorf("Not found: %s", ref)
+			}
+			var v interface{}
+			if err := json.Unmarshal([]byte(s), &v); err != nil {
+				return nil, err
+			}
+			return jsonld.UnmarshalLayer(v, nil)
+		}),
+	}
+	layer, err := compiler.Compile(ls.DefaultContext(), "http://example.org/Person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer
+}
+
+func TestGenerateGo(t *testing.T) {
+	out, err := GenerateGo(compileTestSchema(t), Options{Package: "person"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "// Code generated by layers export-schema. DO NOT EDIT.\n\npackage person\n\nimport \"time\"\n\n" +
+		"// A person\n" +
+		"type Person struct {\n" +
+		"\tAddresses   []*Address  `json:\"addresses,omitempty\"`\n" +
+		"\tContact     interface{} `json:\"contact,omitempty\"`\n" +
+		"\tID          int64       `json:\"id,omitempty\"`\n" +
+		"\tLastUpdated time.Time   `json:\"lastUpdated,omitempty\"`\n" +
+		"\tName        *PersonName `json:\"name,omitempty\"`\n" +
+		"\tPhones      []string    `json:\"phones,omitempty\"`\n" +
+		"\tWorkAddress *Address    `json:\"workAddress,omitempty\"`\n" +
+		"}\n\n" +
+		"type Address struct {\n" +
+		"\t// City name\n" +
+		"\tCity string `json:\"city,omitempty\"`\n" +
+		"}\n\n" +
+		"type PersonName struct {\n" +
+		"\tGivenName string `json:\"given_name,omitempty\"`\n" +
+		"}\n"
+	if string(out) != expected {
+		t.Errorf("Got %s", string(out))
+	}
+}
+
+func TestGenerateProto(t *testing.T) {
+	out, err := GenerateProto(compileTestSchema(t), Options{Package: "person"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `// Code generated by layers export-schema. DO NOT EDIT.
+
+syntax = "proto3";
+
+package person;
+
+import "google/protobuf/struct.proto";
+import "google/protobuf/timestamp.proto";
+
+// A person
+message Person {
+  repeated Address addresses = 1;
+  google.protobuf.Value contact = 2;
+  int64 id = 3;
+  google.protobuf.Timestamp last_updated = 4;
+  PersonName name = 5;
+  repeated string phones = 6;
+  Address work_address = 7;
+}
+
+message Address {
+  // City name
+  string city = 1;
+}
+
+message PersonName {
+  string given_name = 1 [json_name = "given_name"];
+}
+`
+	if string(out) != expected {
+		t.Errorf("Got %s", string(out))
+	}
+}
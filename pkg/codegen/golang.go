@@ -0,0 +1,109 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/types"
+)
+
+// goPrimitives maps primitive kinds to Go types
+var goPrimitives = map[types.Primitive]string{
+	types.PrimitiveString:   "string",
+	types.PrimitiveInteger:  "int64",
+	types.PrimitiveNumber:   "float64",
+	types.PrimitiveBoolean:  "bool",
+	types.PrimitiveDate:     "string",
+	types.PrimitiveDateTime: "time.Time",
+	types.PrimitiveTime:     "string",
+}
+
+// goType returns the Go type for the field type. Messages are
+// pointers so optional and recursive fields are representable
+func goType(t fieldType) string {
+	switch {
+	case t.elem != nil:
+		return "[]" + goType(*t.elem)
+	case t.any:
+		return "interface{}"
+	case len(t.message) > 0:
+		return "*" + t.message
+	}
+	return goPrimitives[t.primitive]
+}
+
+func usesTime(t fieldType) bool {
+	if t.elem != nil {
+		return usesTime(*t.elem)
+	}
+	return t.primitive == types.PrimitiveDateTime
+}
+
+// writeComment writes a multi-line comment
+func writeComment(buf *bytes.Buffer, indent, comment string) {
+	for _, line := range strings.Split(comment, "\n") {
+		fmt.Fprintf(buf, "%s// %s\n", indent, line)
+	}
+}
+
+// GenerateGo generates Go struct definitions for the compiled
+// layer. Fields have json tags from attributeName, and types based
+// on valueType. Nested objects become separate structs, arrays
+// become slices, and polymorphic attributes become interface{}.
+func GenerateGo(layer *ls.Layer, options Options) ([]byte, error) {
+	m, err := buildModel(layer, options)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by layers export-schema. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", options.packageName())
+	imports := false
+	for _, msg := range m.messages {
+		for _, f := range msg.fields {
+			if usesTime(f.typ) {
+				imports = true
+			}
+		}
+	}
+	if imports {
+		buf.WriteString("import \"time\"\n\n")
+	}
+	for _, msg := range m.messages {
+		if len(msg.description) > 0 {
+			writeComment(&buf, "", msg.description)
+		}
+		fmt.Fprintf(&buf, "type %s struct {\n", msg.name)
+		used := make(map[string]int)
+		for _, f := range msg.fields {
+			if len(f.description) > 0 {
+				writeComment(&buf, "\t", f.description)
+			}
+			name := exportedName(f.name)
+			used[name]++
+			if n := used[name]; n > 1 {
+				name = fmt.Sprintf("%s%d", name, n)
+			}
+			fmt.Fprintf(&buf, "\t%s %s `json:\"%s,omitempty\"`\n", name, goType(f.typ), f.name)
+		}
+		buf.WriteString("}\n\n")
+	}
+	return format.Source(buf.Bytes())
+}
@@ -0,0 +1,255 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package codegen generates type definitions from compiled layered
+// schemas. Object attributes become structs or messages, arrays
+// become slices or repeated fields, and compiled references become
+// shared named types.
+package codegen
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/types"
+)
+
+// Options control code generation
+type Options struct {
+	// Package is the name of the generated Go or proto package. If
+	// empty, "model" is used
+	Package string
+	// RootName is the name of the type generated for the schema
+	// root. If empty, it is derived from the schema value type or the
+	// schema id
+	RootName string
+}
+
+// ErrCannotGenerate is returned if a schema attribute cannot be
+// represented in the target language
+type ErrCannotGenerate struct {
+	ID  string
+	Msg string
+}
+
+func (e ErrCannotGenerate) Error() string {
+	return fmt.Sprintf("Cannot generate code for %s: %s", e.ID, e.Msg)
+}
+
+// fieldType is the type of a field. Exactly one of primitive,
+// message, elem, or any is set
+type fieldType struct {
+	primitive types.Primitive
+	message   string
+	elem      *fieldType
+	any       bool
+}
+
+type field struct {
+	// attributeName of the schema attribute
+	name        string
+	description string
+	typ         fieldType
+}
+
+type message struct {
+	name        string
+	description string
+	fields      []field
+}
+
+// model is the language independent representation of the types
+// generated from a schema
+type model struct {
+	messages []*message
+	// Used type names
+	names map[string]struct{}
+	// Reference -> type name
+	refs   map[string]string
+	rootID string
+}
+
+func (opt Options) packageName() string {
+	if len(opt.Package) == 0 {
+		return "model"
+	}
+	return opt.Package
+}
+
+// buildModel builds the types for the layer. The first message is the
+// root type
+func buildModel(layer *ls.Layer, options Options) (*model, error) {
+	root := layer.GetSchemaRootNode()
+	if root == nil {
+		return nil, ErrCannotGenerate{ID: layer.GetID(), Msg: "No schema root"}
+	}
+	m := &model{
+		names:  make(map[string]struct{}),
+		refs:   make(map[string]string),
+		rootID: ls.EntitySchemaTerm.PropertyValue(root),
+	}
+	rootName := options.RootName
+	if len(rootName) == 0 {
+		rootName = ls.IRILastSegment(layer.GetValueType())
+	}
+	if len(rootName) == 0 {
+		rootName = ls.IRILastSegment(layer.GetID())
+	}
+	if len(rootName) == 0 {
+		rootName = "Root"
+	}
+	if !root.HasLabel(ls.AttributeTypeObject.Name) {
+		return nil, ErrCannotGenerate{ID: ls.GetNodeID(root), Msg: "Schema root is not an object"}
+	}
+	name := m.uniqueName(exportedName(rootName))
+	if len(m.rootID) > 0 {
+		m.refs[m.rootID] = name
+	}
+	if _, err := m.object(root, name); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// uniqueName returns a type name based on name that is not used
+// before, and reserves it
+func (m *model) uniqueName(name string) string {
+	base := name
+	for i := 1; ; i++ {
+		if _, used := m.names[name]; !used {
+			m.names[name] = struct{}{}
+			return name
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+// object generates a message for the object attribute
+func (m *model) object(node *lpg.Node, name string) (*message, error) {
+	msg := &message{name: name, description: ls.GetDescription(node)}
+	m.messages = append(m.messages, msg)
+	children := ls.GetObjectAttributeNodes(node)
+	ls.SortNodes(children)
+	for _, child := range children {
+		fieldName := ls.GetAttributeLocalName(child)
+		typ, err := m.attributeType(child, name+exportedName(fieldName))
+		if err != nil {
+			return nil, err
+		}
+		msg.fields = append(msg.fields, field{
+			name:        fieldName,
+			description: ls.GetDescription(child),
+			typ:         typ,
+		})
+	}
+	return msg, nil
+}
+
+// attributeType returns the type of the attribute. If a new message
+// is needed for the attribute, it is named using typeName
+func (m *model) attributeType(node *lpg.Node, typeName string) (fieldType, error) {
+	if !node.HasLabel(ls.AttributeTypeValue.Name) && !node.HasLabel(ls.AttributeTypeReference.Name) {
+		if ref := ls.ReferenceTerm.PropertyValue(node); len(ref) > 0 {
+			// Compiled reference
+			if name, ok := m.refs[ref]; ok {
+				return fieldType{message: name}, nil
+			}
+			name := m.uniqueName(exportedName(ls.IRILastSegment(ref)))
+			m.refs[ref] = name
+			if node.HasLabel(ls.AttributeTypeObject.Name) {
+				if _, err := m.object(node, name); err != nil {
+					return fieldType{}, err
+				}
+				return fieldType{message: name}, nil
+			}
+			delete(m.refs, ref)
+		}
+	}
+	switch {
+	case node.HasLabel(ls.AttributeTypeValue.Name):
+		valueType, _ := ls.GetPropertyValueAs[string](node, ls.ValueTypeTerm.Name)
+		return fieldType{primitive: types.GetPrimitive(valueType)}, nil
+
+	case node.HasLabel(ls.AttributeTypeObject.Name):
+		name := m.uniqueName(typeName)
+		if _, err := m.object(node, name); err != nil {
+			return fieldType{}, err
+		}
+		return fieldType{message: name}, nil
+
+	case node.HasLabel(ls.AttributeTypeArray.Name):
+		elem := ls.GetArrayElementNode(node)
+		if elem == nil {
+			return fieldType{elem: &fieldType{any: true}}, nil
+		}
+		elemType, err := m.attributeType(elem, typeName+"Item")
+		if err != nil {
+			return fieldType{}, err
+		}
+		return fieldType{elem: &elemType}, nil
+
+	case node.HasLabel(ls.AttributeTypePolymorphic.Name), node.HasLabel(ls.AttributeTypeReference.Name):
+		// Polymorphic attributes and uncompiled references can be
+		// anything
+		return fieldType{any: true}, nil
+	}
+	return fieldType{}, ErrCannotGenerate{ID: ls.GetNodeID(node), Msg: "Unknown attribute type"}
+}
+
+// initialisms are written in upper case in Go names
+var initialisms = map[string]struct{}{
+	"ID": {}, "URL": {}, "URI": {}, "HTTP": {}, "JSON": {}, "XML": {}, "API": {}, "UUID": {},
+}
+
+// exportedName returns an exported Go/proto type or field name for
+// name
+func exportedName(name string) string {
+	var out strings.Builder
+	for _, w := range ls.SplitWords(name) {
+		if _, ok := initialisms[strings.ToUpper(w)]; ok {
+			out.WriteString(strings.ToUpper(w))
+			continue
+		}
+		r := []rune(w)
+		out.WriteRune(unicode.ToUpper(r[0]))
+		out.WriteString(string(r[1:]))
+	}
+	ret := out.String()
+	if len(ret) == 0 {
+		return "X"
+	}
+	if unicode.IsDigit([]rune(ret)[0]) {
+		ret = "X" + ret
+	}
+	return ret
+}
+
+// snakeName returns a lower case, underscore separated name
+func snakeName(name string) string {
+	words := ls.SplitWords(name)
+	for i := range words {
+		words[i] = strings.ToLower(words[i])
+	}
+	ret := strings.Join(words, "_")
+	if len(ret) == 0 {
+		return "x"
+	}
+	if unicode.IsDigit([]rune(ret)[0]) {
+		ret = "x" + ret
+	}
+	return ret
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/types"
+)
+
+// protoPrimitives maps primitive kinds to proto3 types
+var protoPrimitives = map[types.Primitive]string{
+	types.PrimitiveString:   "string",
+	types.PrimitiveInteger:  "int64",
+	types.PrimitiveNumber:   "double",
+	types.PrimitiveBoolean:  "bool",
+	types.PrimitiveDate:     "string",
+	types.PrimitiveDateTime: "google.protobuf.Timestamp",
+	types.PrimitiveTime:     "string",
+}
+
+const (
+	protoValue     = "google.protobuf.Value"
+	protoValueFile = "google/protobuf/struct.proto"
+	protoTimeFile  = "google/protobuf/timestamp.proto"
+)
+
+// protoType returns the proto type of a field and the proto file
+// that needs to be imported for it, if any
+func protoType(t fieldType) (string, string) {
+	switch {
+	case t.any:
+		return protoValue, protoValueFile
+	case len(t.message) > 0:
+		return t.message, ""
+	case t.primitive == types.PrimitiveDateTime:
+		return protoPrimitives[t.primitive], protoTimeFile
+	}
+	return protoPrimitives[t.primitive], ""
+}
+
+// protoJSONName returns the default JSON name protoc assigns to a
+// field
+func protoJSONName(fieldName string) string {
+	var out strings.Builder
+	upper := false
+	for _, r := range fieldName {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// GenerateProto generates proto3 message definitions for the
+// compiled layer. Field names are snake case attribute names, with
+// json_name set to the attributeName if necessary. Arrays become
+// repeated fields, datetime values become google.protobuf.Timestamp,
+// and polymorphic attributes become google.protobuf.Value. Arrays of
+// arrays cannot be represented.
+func GenerateProto(layer *ls.Layer, options Options) ([]byte, error) {
+	m, err := buildModel(layer, options)
+	if err != nil {
+		return nil, err
+	}
+	imports := make(map[string]struct{})
+	var body bytes.Buffer
+	for _, msg := range m.messages {
+		if len(msg.description) > 0 {
+			writeComment(&body, "", msg.description)
+		}
+		fmt.Fprintf(&body, "message %s {\n", msg.name)
+		used := make(map[string]int)
+		for i, f := range msg.fields {
+			if len(f.description) > 0 {
+				writeComment(&body, "  ", f.description)
+			}
+			typ := f.typ
+			repeated := ""
+			if typ.elem != nil {
+				repeated = "repeated "
+				typ = *typ.elem
+				if typ.elem != nil {
+					return nil, ErrCannotGenerate{ID: msg.name + "." + f.name, Msg: "Nested arrays cannot be represented in proto"}
+				}
+			}
+			typeName, imp := protoType(typ)
+			if len(imp) > 0 {
+				imports[imp] = struct{}{}
+			}
+			name := snakeName(f.name)
+			used[name]++
+			if n := used[name]; n > 1 {
+				name = fmt.Sprintf("%s_%d", name, n)
+			}
+			fmt.Fprintf(&body, "  %s%s %s = %d", repeated, typeName, name, i+1)
+			if protoJSONName(name) != f.name {
+				fmt.Fprintf(&body, " [json_name = %q]", f.name)
+			}
+			body.WriteString(";\n")
+		}
+		body.WriteString("}\n\n")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by layers export-schema. DO NOT EDIT.\n\n")
+	buf.WriteString("syntax = \"proto3\";\n\n")
+	fmt.Fprintf(&buf, "package %s;\n\n", options.packageName())
+	if len(imports) > 0 {
+		files := make([]string, 0, len(imports))
+		for x := range imports {
+			files = append(files, x)
+		}
+		sort.Strings(files)
+		for _, x := range files {
+			fmt.Fprintf(&buf, "import %q;\n", x)
+		}
+		buf.WriteString("\n")
+	}
+	buf.Write(bytes.TrimRight(body.Bytes(), "\n"))
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
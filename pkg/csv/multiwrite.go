@@ -0,0 +1,412 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csv
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/opencypher"
+)
+
+const (
+	// DefaultKeyColumn is the default name of the generated row key
+	// column
+	DefaultKeyColumn = "_id"
+	// DefaultParentKeyColumn is the default name of the generated
+	// column containing the parent row key
+	DefaultParentKeyColumn = "_parent"
+)
+
+// TableSpec specifies one of the tables of a multi-table export.
+type TableSpec struct {
+	// Name of the table
+	Name string `json:"name" yaml:"name"`
+	// Output file. If empty, <name>.csv is used
+	File string `json:"file" yaml:"file"`
+	// Parent is the name of the parent table. If given, rows of this
+	// table are generated for each row of the parent table, and the
+	// parent row key is written to the parent key column
+	Parent string `json:"parent" yaml:"parent"`
+	// Attribute is the schema attribute id of a repeating group. If
+	// given, the rows of this table are the instances of this
+	// attribute under the parent row root. If the attribute is an
+	// array, the array elements are the rows.
+	Attribute string `json:"attribute" yaml:"attribute"`
+	// openCypher query giving the root nodes for each row of data. For
+	// child tables, the query is evaluated with `parent` set to the
+	// parent row root. If both Attribute and RowQuery are empty, the
+	// root nodes of the graph are the rows.
+	RowQuery string `json:"rowQuery" yaml:"rowQuery"`
+	// If AutoColumns is true, the columns are derived from the schema
+	// attributes of the row. Nested objects are flattened, and arrays
+	// are skipped. Auto columns are added after the given columns.
+	AutoColumns bool           `json:"autoColumns" yaml:"autoColumns"`
+	Columns     []WriterColumn `json:"columns" yaml:"columns"`
+
+	parsedRowQuery opencypher.Evaluatable
+	children       []*TableSpec
+}
+
+// MultiWriter writes multiple CSV tables from a graph. Each table
+// has a generated key column containing the row root node id. Child
+// tables also have a parent key column containing the key of the
+// parent row.
+type MultiWriter struct {
+	Tables []TableSpec `json:"tables" yaml:"tables"`
+	// KeyColumn is the name of the key column. If empty,
+	// DefaultKeyColumn is used
+	KeyColumn string `json:"keyColumn" yaml:"keyColumn"`
+	// ParentKeyColumn is the name of the parent key column. If empty,
+	// DefaultParentKeyColumn is used
+	ParentKeyColumn string `json:"parentKeyColumn" yaml:"parentKeyColumn"`
+
+	roots []*TableSpec
+}
+
+// GetFile returns the output file name of the table
+func (t *TableSpec) GetFile() string {
+	if len(t.File) > 0 {
+		return t.File
+	}
+	return t.Name + ".csv"
+}
+
+// Prepare validates the table specs, parses the queries, and derives
+// the auto columns from the layer. The layer is only required if
+// there are tables with auto columns.
+func (mw *MultiWriter) Prepare(layer *ls.Layer) error {
+	byName := make(map[string]*TableSpec)
+	for i := range mw.Tables {
+		t := &mw.Tables[i]
+		if len(t.Name) == 0 {
+			return fmt.Errorf("Table name is required")
+		}
+		if _, ok := byName[t.Name]; ok {
+			return fmt.Errorf("Duplicate table: %s", t.Name)
+		}
+		byName[t.Name] = t
+		t.children = nil
+	}
+	mw.roots = nil
+	for i := range mw.Tables {
+		t := &mw.Tables[i]
+		if len(t.Parent) == 0 {
+			mw.roots = append(mw.roots, t)
+		} else {
+			parent := byName[t.Parent]
+			if parent == nil {
+				return fmt.Errorf("Parent table not found for %s: %s", t.Name, t.Parent)
+			}
+			parent.children = append(parent.children, t)
+		}
+		if len(t.RowQuery) > 0 {
+			ev, err := opencypher.Parse(t.RowQuery)
+			if err != nil {
+				return err
+			}
+			t.parsedRowQuery = ev
+		}
+		for k, col := range t.Columns {
+			if len(col.Query) > 0 {
+				ev, err := opencypher.Parse(col.Query)
+				if err != nil {
+					return err
+				}
+				t.Columns[k].parsedQuery = ev
+			}
+		}
+		if t.AutoColumns {
+			if layer == nil {
+				return fmt.Errorf("Schema is required for auto columns of %s", t.Name)
+			}
+			if err := t.addAutoColumns(layer); err != nil {
+				return err
+			}
+		}
+	}
+	// Detect cycles
+	seen := make(map[*TableSpec]struct{})
+	var visit func(*TableSpec)
+	visit = func(t *TableSpec) {
+		seen[t] = struct{}{}
+		for _, c := range t.children {
+			visit(c)
+		}
+	}
+	for _, t := range mw.roots {
+		visit(t)
+	}
+	if len(seen) != len(mw.Tables) {
+		return fmt.Errorf("Cyclic table parents")
+	}
+	return nil
+}
+
+// addAutoColumns adds a column for each value attribute of the row
+// schema node
+func (t *TableSpec) addAutoColumns(layer *ls.Layer) error {
+	var rowNode *lpg.Node
+	if len(t.Attribute) > 0 {
+		rowNode = layer.GetAttributeByID(t.Attribute)
+		if rowNode == nil {
+			return fmt.Errorf("Attribute not found for %s: %s", t.Name, t.Attribute)
+		}
+		if rowNode.HasLabel(ls.AttributeTypeArray.Name) {
+			rowNode = ls.GetArrayElementNode(rowNode)
+		}
+	} else {
+		rowNode = layer.GetSchemaRootNode()
+	}
+	if rowNode == nil {
+		return fmt.Errorf("Cannot determine the schema attribute of %s", t.Name)
+	}
+	var add func(*lpg.Node, []string)
+	add = func(node *lpg.Node, path []string) {
+		switch {
+		case node.HasLabel(ls.AttributeTypeValue.Name):
+			name := strings.Join(path, ".")
+			if len(name) == 0 {
+				name = "value"
+			}
+			t.Columns = append(t.Columns, WriterColumn{Name: name, Attribute: ls.GetNodeID(node)})
+		case node.HasLabel(ls.AttributeTypeObject.Name):
+			children := ls.GetObjectAttributeNodes(node)
+			ls.SortNodes(children)
+			for _, child := range children {
+				add(child, append(path, ls.AttributeNameTerm.PropertyValue(child)))
+			}
+		case node.HasLabel(ls.AttributeTypePolymorphic.Name):
+			options := ls.GetPolymorphicOptions(node)
+			ls.SortNodes(options)
+			for _, option := range options {
+				add(option, path)
+			}
+		}
+	}
+	add(rowNode, nil)
+	return nil
+}
+
+// docChildren returns the document nodes connected to the node with
+// has edges
+func docChildren(node *lpg.Node) []*lpg.Node {
+	ret := make([]*lpg.Node, 0)
+	for _, n := range lpg.TargetNodes(node.GetEdgesWithLabel(lpg.OutgoingEdge, ls.HasTerm.Name)) {
+		if n.HasLabel(ls.DocumentNodeTerm.Name) {
+			ret = append(ret, n)
+		}
+	}
+	ls.SortNodes(ret)
+	return ret
+}
+
+// findAttributeInstances returns the instances of the schema
+// attribute under root. The search does not descend into the
+// instances, or into arrays if skipArrays is set.
+func findAttributeInstances(root *lpg.Node, attributeID string, skipArrays bool) []*lpg.Node {
+	ret := make([]*lpg.Node, 0)
+	var find func(*lpg.Node)
+	find = func(node *lpg.Node) {
+		if ls.SchemaNodeIDTerm.PropertyValue(node) == attributeID {
+			ret = append(ret, node)
+			return
+		}
+		if skipArrays && node != root && node.HasLabel(ls.AttributeTypeArray.Name) {
+			return
+		}
+		for _, child := range docChildren(node) {
+			find(child)
+		}
+	}
+	find(root)
+	return ret
+}
+
+// findAttributeInstance returns the first instance of the schema
+// attribute under root, without descending into arrays
+func findAttributeInstance(root *lpg.Node, attributeID string) *lpg.Node {
+	nodes := findAttributeInstances(root, attributeID, true)
+	if len(nodes) == 0 {
+		return nil
+	}
+	return nodes[0]
+}
+
+func (mw *MultiWriter) keyColumn() string {
+	if len(mw.KeyColumn) > 0 {
+		return mw.KeyColumn
+	}
+	return DefaultKeyColumn
+}
+
+func (mw *MultiWriter) parentKeyColumn() string {
+	if len(mw.ParentKeyColumn) > 0 {
+		return mw.ParentKeyColumn
+	}
+	return DefaultParentKeyColumn
+}
+
+// Header returns the column names of the table, including the
+// generated key columns
+func (mw *MultiWriter) Header(t *TableSpec) []string {
+	ret := []string{mw.keyColumn()}
+	if len(t.Parent) > 0 {
+		ret = append(ret, mw.parentKeyColumn())
+	}
+	for _, c := range t.Columns {
+		ret = append(ret, c.Name)
+	}
+	return ret
+}
+
+// WriteHeaders writes the headers of all tables. The writers map
+// contains a writer for each table name
+func (mw *MultiWriter) WriteHeaders(writers map[string]*csv.Writer) error {
+	for i := range mw.Tables {
+		w := writers[mw.Tables[i].Name]
+		if w == nil {
+			continue
+		}
+		if err := w.Write(mw.Header(&mw.Tables[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rowRoots returns the row roots of the table. For root tables, parent
+// is nil
+func (t *TableSpec) rowRoots(g *lpg.Graph, parent *lpg.Node) ([]*lpg.Node, error) {
+	if len(t.Attribute) > 0 && parent != nil {
+		ret := make([]*lpg.Node, 0)
+		for _, node := range findAttributeInstances(parent, t.Attribute, false) {
+			if node.HasLabel(ls.AttributeTypeArray.Name) {
+				ret = append(ret, docChildren(node)...)
+			} else {
+				ret = append(ret, node)
+			}
+		}
+		return ret, nil
+	}
+	if t.parsedRowQuery == nil {
+		if parent != nil {
+			return nil, fmt.Errorf("Attribute or rowQuery is required for child table %s", t.Name)
+		}
+		ret := make([]*lpg.Node, 0)
+		for _, node := range lpg.Sources(g) {
+			if node.HasLabel(ls.DocumentNodeTerm.Name) {
+				ret = append(ret, node)
+			}
+		}
+		ls.SortNodes(ret)
+		return ret, nil
+	}
+	ctx := ls.NewEvalContext(g)
+	if parent != nil {
+		ctx.SetVar("parent", opencypher.RValue{Value: parent})
+	}
+	v, err := t.parsedRowQuery.Evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rs, ok := v.Get().(opencypher.ResultSet)
+	if !ok {
+		return nil, opencypher.ErrExpectingResultSet
+	}
+	ret := make([]*lpg.Node, 0, len(rs.Rows))
+	for _, row := range rs.Rows {
+		for _, v := range row {
+			node, ok := v.Get().(*lpg.Node)
+			if !ok {
+				return nil, fmt.Errorf("Expecting a node in resultset")
+			}
+			ret = append(ret, node)
+		}
+	}
+	return ret, nil
+}
+
+// buildRow returns the row for the row root
+func (mw *MultiWriter) buildRow(t *TableSpec, root, parent *lpg.Node) ([]string, error) {
+	row := []string{ls.GetNodeID(root)}
+	if len(t.Parent) > 0 {
+		row = append(row, ls.GetNodeID(parent))
+	}
+	for _, col := range t.Columns {
+		val := ""
+		switch {
+		case len(col.Attribute) > 0:
+			if node := findAttributeInstance(root, col.Attribute); node != nil {
+				val, _ = ls.GetRawNodeValue(node)
+			}
+		case col.parsedQuery != nil:
+			var err error
+			val, err = col.queryValue(root)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			for _, node := range docChildren(root) {
+				if ls.AttributeNameTerm.PropertyValue(node) == col.Name {
+					val, _ = ls.GetRawNodeValue(node)
+					break
+				}
+			}
+		}
+		row = append(row, val)
+	}
+	return row, nil
+}
+
+// WriteRows writes the rows of all tables for the graph. Prepare must
+// be called before. The writers map contains a writer for each table
+// name. Tables without a writer are not written, but their child
+// tables are.
+func (mw *MultiWriter) WriteRows(g *lpg.Graph, writers map[string]*csv.Writer) error {
+	var write func(*TableSpec, *lpg.Node) error
+	write = func(t *TableSpec, parent *lpg.Node) error {
+		roots, err := t.rowRoots(g, parent)
+		if err != nil {
+			return err
+		}
+		for _, root := range roots {
+			if w := writers[t.Name]; w != nil {
+				row, err := mw.buildRow(t, root, parent)
+				if err != nil {
+					return err
+				}
+				if err := w.Write(row); err != nil {
+					return err
+				}
+			}
+			for _, child := range t.children {
+				if err := write(child, root); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, t := range mw.roots {
+		if err := write(t, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -32,6 +32,9 @@ type WriterColumn struct {
 	// column name, and the map value is an opencypher query that is
 	// evaluated with `root` node set to the current root node.
 	Query string `json:"query" yaml:"query"`
+	// Optional schema attribute id. If given, the column value is the
+	// value of the instance of this attribute under the row root
+	Attribute string `json:"attribute" yaml:"attribute"`
 
 	parsedQuery opencypher.Evaluatable
 }
@@ -91,37 +94,53 @@ func (wr *Writer) BuildRow(root *lpg.Node) ([]string, error) {
 	}
 
 	for i, col := range wr.Columns {
+		if len(col.Attribute) > 0 {
+			if node := findAttributeInstance(root, col.Attribute); node != nil {
+				row[i], _ = ls.GetRawNodeValue(node)
+			}
+			continue
+		}
 		if col.parsedQuery == nil {
 			continue
 		}
-		ctx := ls.NewEvalContext(root.GetGraph())
-		ctx.SetVar("root", opencypher.RValue{Value: root})
-		result, err := col.parsedQuery.Evaluate(ctx)
+		val, err := col.queryValue(root)
 		if err != nil {
 			return nil, err
 		}
-		// Expexting a single result
-		rs, ok := result.Get().(opencypher.ResultSet)
+		row[i] = val
+	}
+	return row, nil
+}
+
+// queryValue evaluates the column query with `root` set to the row
+// root, and returns the value of the resulting node
+func (col WriterColumn) queryValue(root *lpg.Node) (string, error) {
+	ctx := ls.NewEvalContext(root.GetGraph())
+	ctx.SetVar("root", opencypher.RValue{Value: root})
+	result, err := col.parsedQuery.Evaluate(ctx)
+	if err != nil {
+		return "", err
+	}
+	// Expexting a single result
+	rs, ok := result.Get().(opencypher.ResultSet)
+	if !ok {
+		return "", opencypher.ErrExpectingResultSet
+	}
+	if len(rs.Rows) == 0 {
+		return "", nil
+	}
+	if len(rs.Rows) > 1 {
+		return "", ErrMultipleNodesMatched
+	}
+	val := ""
+	for _, v := range rs.Rows[0] {
+		node, ok := v.Get().(*lpg.Node)
 		if !ok {
-			return nil, opencypher.ErrExpectingResultSet
-		}
-		if len(rs.Rows) == 0 {
-			row[i] = ""
-			continue
-		}
-		if len(rs.Rows) > 1 {
-			return nil, ErrMultipleNodesMatched
-		}
-		for _, v := range rs.Rows[0] {
-			node, ok := v.Get().(*lpg.Node)
-			if !ok {
-				return nil, fmt.Errorf("Expecting a node in resultset")
-			}
-			val, _ := ls.GetRawNodeValue(node)
-			row[i] = val
+			return "", fmt.Errorf("Expecting a node in resultset")
 		}
+		val, _ = ls.GetRawNodeValue(node)
 	}
-	return row, nil
+	return val, nil
 }
 
 func (wr *Writer) WriteRow(writer *csv.Writer, root *lpg.Node) error {
@@ -17,8 +17,11 @@ package csv
 import (
 	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"testing"
 
+	jsoningest "github.com/cloudprivacylabs/lsa/pkg/json"
+	"github.com/cloudprivacylabs/lsa/pkg/jsonld"
 	"github.com/cloudprivacylabs/lsa/pkg/ls"
 )
 
@@ -75,3 +78,131 @@ func TestBasicWrite(t *testing.T) {
 		t.Errorf(buf.String())
 	}
 }
+
+func TestMultiWrite(t *testing.T) {
+	schStr := `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/Person",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "person",
+  "attributeList": [
+   {
+     "@id": "person.id",
+     "@type": "Value",
+     "attributeName":"id"
+   },
+   {
+     "@id": "person.name",
+     "@type": "Object",
+     "attributeName":"name",
+     "attributeList": [
+       {
+         "@id": "person.name.given",
+         "@type": "Value",
+         "attributeName": "given"
+       }
+     ]
+   },
+   {
+     "@id": "person.phones",
+     "@type": "Array",
+     "attributeName":"phones",
+     "arrayElements": {
+       "@type": "Value",
+       "@id": "person.phones.item"
+     }
+   },
+   {
+     "@id": "person.addresses",
+     "@type": "Array",
+     "attributeName": "addresses",
+     "arrayElements": {
+       "@type": "Object",
+       "@id": "person.addresses.item",
+       "attributeList": [
+         {
+           "@id": "person.addresses.city",
+           "@type": "Value",
+           "attributeName": "city"
+         },
+         {
+           "@id": "person.addresses.lines",
+           "@type": "Array",
+           "attributeName": "lines",
+           "arrayElements": {
+             "@type": "Value",
+             "@id": "person.addresses.lines.item"
+           }
+         }
+       ]
+     }
+   }
+  ]
+ }
+}`
+	var schMap interface{}
+	if err := json.Unmarshal([]byte(schStr), &schMap); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := jsonld.UnmarshalLayer(schMap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := `{"id": "1", "name": {"given": "John"}, "phones": ["123", "456"], "addresses": [{"city": "Denver", "lines": ["a", "b"]}, {"city": "Boston"}]}`
+	builder := ls.NewGraphBuilder(nil, ls.GraphBuilderOptions{})
+	parser := jsoningest.Parser{Layer: layer}
+	if _, err := jsoningest.IngestBytes(ls.DefaultContext(), "p", []byte(input), parser, builder, &ls.Ingester{Schema: layer}); err != nil {
+		t.Fatal(err)
+	}
+
+	mw := MultiWriter{
+		Tables: []TableSpec{
+			{Name: "person", AutoColumns: true},
+			{Name: "phones", Parent: "person", Attribute: "person.phones", AutoColumns: true},
+			{Name: "addresses", Parent: "person", Attribute: "person.addresses", Columns: []WriterColumn{{Name: "city"}}},
+			{Name: "lines", Parent: "addresses", Attribute: "person.addresses.lines", AutoColumns: true},
+		},
+	}
+	if err := mw.Prepare(layer); err != nil {
+		t.Fatal(err)
+	}
+	buffers := make(map[string]*bytes.Buffer)
+	writers := make(map[string]*csv.Writer)
+	for _, x := range mw.Tables {
+		buffers[x.Name] = &bytes.Buffer{}
+		writers[x.Name] = csv.NewWriter(buffers[x.Name])
+	}
+	if err := mw.WriteHeaders(writers); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.WriteRows(builder.GetGraph(), writers); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range writers {
+		w.Flush()
+	}
+	expected := map[string]string{
+		"person": `_id,id,name.given
+p,1,John
+`,
+		"phones": `_id,_parent,value
+p.phones.0,p,123
+p.phones.1,p,456
+`,
+		"addresses": `_id,_parent,city
+p.addresses.0,p,Denver
+p.addresses.1,p,Boston
+`,
+		"lines": `_id,_parent,value
+p.addresses.0.lines.0,p.addresses.0,a
+p.addresses.0.lines.1,p.addresses.0,b
+`,
+	}
+	for name, exp := range expected {
+		if buffers[name].String() != exp {
+			t.Errorf("%s: got %s", name, buffers[name].String())
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package entityindex contains a file-backed persistent entity index
+// used to link entities ingested in different runs.
+package entityindex
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+var (
+	entitiesBucket = []byte("entities")
+	pendingBucket  = []byte("pending")
+)
+
+// BoltIndex is a persistent entity index stored in a bolt database
+type BoltIndex struct {
+	db *bolt.DB
+}
+
+var _ ls.PersistentEntityIndex = &BoltIndex{}
+
+// Open opens or creates an entity index file
+func Open(file string) (*BoltIndex, error) {
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(entitiesBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(pendingBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltIndex{db: db}, nil
+}
+
+// Close closes the index file
+func (ix *BoltIndex) Close() error {
+	return ix.db.Close()
+}
+
+func entityKey(entityType string, id []string) []byte {
+	return []byte(entityType + "\x00" + strings.Join(id, "\x1f"))
+}
+
+// AddEntity records the node id of the entity
+func (ix *BoltIndex) AddEntity(entityType string, id []string, nodeID string) error {
+	return ix.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(entitiesBucket)
+		key := entityKey(entityType, id)
+		var nodeIDs []string
+		if data := bucket.Get(key); data != nil {
+			if err := json.Unmarshal(data, &nodeIDs); err != nil {
+				return err
+			}
+		}
+		for _, x := range nodeIDs {
+			if x == nodeID {
+				return nil
+			}
+		}
+		nodeIDs = append(nodeIDs, nodeID)
+		data, err := json.Marshal(nodeIDs)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, data)
+	})
+}
+
+// FindEntity returns the node ids of the entity
+func (ix *BoltIndex) FindEntity(entityType string, id []string) ([]string, error) {
+	var nodeIDs []string
+	err := ix.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(entitiesBucket).Get(entityKey(entityType, id))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &nodeIDs)
+	})
+	return nodeIDs, err
+}
+
+// AddPendingLink records a link waiting for the entity. Duplicate
+// links are recorded once.
+func (ix *BoltIndex) AddPendingLink(entityType string, id []string, link ls.LinkRecord) error {
+	return ix.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pendingBucket)
+		key := entityKey(entityType, id)
+		var links []ls.LinkRecord
+		if data := bucket.Get(key); data != nil {
+			if err := json.Unmarshal(data, &links); err != nil {
+				return err
+			}
+		}
+		for _, x := range links {
+			if x == link {
+				return nil
+			}
+		}
+		links = append(links, link)
+		data, err := json.Marshal(links)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, data)
+	})
+}
+
+// TakePendingLinks returns and removes the links waiting for the entity
+func (ix *BoltIndex) TakePendingLinks(entityType string, id []string) ([]ls.LinkRecord, error) {
+	var links []ls.LinkRecord
+	err := ix.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pendingBucket)
+		key := entityKey(entityType, id)
+		data := bucket.Get(key)
+		if data == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &links); err != nil {
+			return err
+		}
+		return bucket.Delete(key)
+	})
+	return links, err
+}
+
+// PendingLinks returns the number of links waiting for entities that
+// are not ingested yet
+func (ix *BoltIndex) PendingLinks() (int, error) {
+	n := 0
+	err := ix.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).ForEach(func(_, v []byte) error {
+			var links []ls.LinkRecord
+			if err := json.Unmarshal(v, &links); err != nil {
+				return err
+			}
+			n += len(links)
+			return nil
+		})
+	})
+	return n, err
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entityindex
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+func TestBoltIndex(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "entities.db")
+	ix, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := ls.LinkRecord{From: "https://order1", Label: "patient"}
+	if err := ix.AddPendingLink("Patient", []string{"123"}, link); err != nil {
+		t.Fatal(err)
+	}
+	// Duplicates are ignored
+	ix.AddPendingLink("Patient", []string{"123"}, link)
+	ix.AddEntity("Patient", []string{"456"}, "https://p456")
+	ix.AddEntity("Patient", []string{"456"}, "https://p456")
+	ix.Close()
+
+	ix, err = Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	if n, _ := ix.PendingLinks(); n != 1 {
+		t.Errorf("Expecting 1 pending link, got %d", n)
+	}
+	ids, err := ix.FindEntity("Patient", []string{"456"})
+	if err != nil || !reflect.DeepEqual(ids, []string{"https://p456"}) {
+		t.Errorf("Wrong entity: %v %v", ids, err)
+	}
+	if ids, _ := ix.FindEntity("Patient", []string{"123"}); len(ids) != 0 {
+		t.Errorf("Unexpected entity: %v", ids)
+	}
+	links, err := ix.TakePendingLinks("Patient", []string{"123"})
+	if err != nil || !reflect.DeepEqual(links, []ls.LinkRecord{link}) {
+		t.Errorf("Wrong pending links: %v %v", links, err)
+	}
+	if links, _ := ix.TakePendingLinks("Patient", []string{"123"}); len(links) != 0 {
+		t.Errorf("Pending links not removed")
+	}
+}
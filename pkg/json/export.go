@@ -18,10 +18,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/bserdar/jsonom"
 	"github.com/cloudprivacylabs/lpg/v2"
 	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/types"
+)
+
+// Empty value handling options. Empty values are values that are
+// null, or empty strings.
+const (
+	// EmptyValueNull exports empty values as null
+	EmptyValueNull = "null"
+	// EmptyValueOmit omits empty values from the output
+	EmptyValueOmit = "omit"
+	// EmptyValueString exports empty values as empty strings
+	EmptyValueString = "empty"
 )
 
 // ExportOptions are used to produce the output from the document
@@ -32,6 +45,33 @@ type ExportOptions struct {
 	// If ExportTypeProperty is set, exports "@type" properties that
 	// have non-LS related types
 	ExportTypeProperty bool
+
+	// If TypedValues is set, values are exported based on their value
+	// types: numbers and booleans as JSON numbers and booleans, dates
+	// and times as ISO 8601 strings, and measures as objects with
+	// value and unit. Otherwise, only the values that are Go numbers,
+	// booleans, or strings are exported as such, and others are
+	// exported using their raw values.
+	TypedValues bool
+
+	// EmptyValues determines how empty values are exported. If empty,
+	// null values are exported as null, and empty strings as empty
+	// strings. Can be EmptyValueNull, EmptyValueOmit, or
+	// EmptyValueString.
+	EmptyValues string
+
+	// If IncludeLabels or IncludeTerms is nonempty, only the value
+	// nodes that have one of the labels or one of the terms as a
+	// property are exported. The terms are also looked up in the
+	// schema nodes.
+	IncludeLabels []string
+	IncludeTerms  []string
+
+	// The nodes that have one of the ExcludeLabels or one of the
+	// ExcludeTerms as a property are not exported. The terms are also
+	// looked up in the schema nodes.
+	ExcludeLabels []string
+	ExcludeTerms  []string
 }
 
 // GetBuildNodeKeyBySchemaNodeFunc returns a function that gets the
@@ -48,6 +88,60 @@ func GetBuildNodeKeyBySchemaNodeFunc(f func(schemaNode, docNode *lpg.Node) (stri
 	}
 }
 
+// GetBuildNodeKeyByTermFunc returns a function that uses the value of
+// the term as the node key. The term is looked up in the node first,
+// and then in its schema node. If none of them has the term, the
+// attribute name is used.
+func GetBuildNodeKeyByTermFunc(term string) func(*lpg.Node) (string, bool, error) {
+	return func(node *lpg.Node) (string, bool, error) {
+		for _, n := range append([]*lpg.Node{node}, ls.InstanceOf(node)...) {
+			v, ok := n.GetProperty(term)
+			if !ok {
+				continue
+			}
+			if pv, ok := v.(ls.PropertyValue); ok {
+				if s := pv.AsStringSlice(); len(s) > 0 && len(s[0]) > 0 {
+					return s[0], true, nil
+				}
+			}
+		}
+		return DefaultBuildNodeKeyFunc(node)
+	}
+}
+
+// hasAnyLabelOrTerm returns true if the node or its schema node has
+// one of the labels or one of the terms as a property
+func hasAnyLabelOrTerm(node *lpg.Node, labels, terms []string) bool {
+	nodes := append([]*lpg.Node{node}, ls.InstanceOf(node)...)
+	for _, n := range nodes {
+		for _, l := range labels {
+			if n.HasLabel(l) {
+				return true
+			}
+		}
+		for _, t := range terms {
+			if _, ok := n.GetProperty(t); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsExcluded returns true if the node should not be exported
+func (options ExportOptions) IsExcluded(node *lpg.Node) bool {
+	if hasAnyLabelOrTerm(node, options.ExcludeLabels, options.ExcludeTerms) {
+		return true
+	}
+	if len(options.IncludeLabels) == 0 && len(options.IncludeTerms) == 0 {
+		return false
+	}
+	if !node.HasLabel(ls.AttributeTypeValue.Name) {
+		return false
+	}
+	return !hasAnyLabelOrTerm(node, options.IncludeLabels, options.IncludeTerms)
+}
+
 func (options ExportOptions) BuildNodeKey(node *lpg.Node) (string, bool, error) {
 	if options.BuildNodeKeyFunc != nil {
 		return options.BuildNodeKeyFunc(node)
@@ -135,6 +229,9 @@ func exportJSON(node *lpg.Node, options ExportOptions, seen map[*lpg.Node]struct
 		// Not a document node
 		return nil, nil
 	}
+	if options.IsExcluded(node) {
+		return nil, nil
+	}
 	types := node.GetLabels()
 
 	getTypes := func() jsonom.Node {
@@ -174,7 +271,9 @@ func exportJSON(node *lpg.Node, options ExportOptions, seen map[*lpg.Node]struct
 				if err != nil {
 					return nil, err
 				}
-				ret.Set(key, value)
+				if value != nil {
+					ret.Set(key, value)
+				}
 			}
 		}
 		return ret, nil
@@ -192,7 +291,9 @@ func exportJSON(node *lpg.Node, options ExportOptions, seen map[*lpg.Node]struct
 			if err != nil {
 				return nil, err
 			}
-			ret.Append(value)
+			if value != nil {
+				ret.Append(value)
+			}
 		}
 		return ret, nil
 
@@ -201,13 +302,26 @@ func exportJSON(node *lpg.Node, options ExportOptions, seen map[*lpg.Node]struct
 		if err != nil {
 			return nil, err
 		}
-		if nativeValue == nil {
-			return jsonom.NewValue(nil), nil
+		if nativeValue == nil || nativeValue == "" {
+			switch options.EmptyValues {
+			case EmptyValueOmit:
+				return nil, nil
+			case EmptyValueNull:
+				return jsonom.NewValue(nil), nil
+			case EmptyValueString:
+				return jsonom.StringValue(""), nil
+			}
+			return jsonom.NewValue(nativeValue), nil
 		}
 		switch nativeValue.(type) {
 		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool, string, json.Number:
 			return jsonom.NewValue(nativeValue), nil
 		}
+		if options.TypedValues {
+			if value := exportTypedValue(nativeValue); value != nil {
+				return value, nil
+			}
+		}
 		raw, ok := ls.GetRawNodeValue(node)
 		if !ok {
 			return nil, nil
@@ -216,3 +330,32 @@ func exportJSON(node *lpg.Node, options ExportOptions, seen map[*lpg.Node]struct
 	}
 	return nil, nil
 }
+
+// exportTypedValue returns the JSON representation of a native
+// value. Returns nil if the value type is not known.
+func exportTypedValue(value interface{}) jsonom.Node {
+	switch v := value.(type) {
+	case types.Date:
+		return jsonom.StringValue(v.ToTime().Format("2006-01-02"))
+	case types.DateTime:
+		return jsonom.StringValue(v.ToTime().Format(time.RFC3339Nano))
+	case types.TimeOfDay:
+		return jsonom.StringValue(v.ToTime().Format("15:04:05.999999999Z07:00"))
+	case types.UnixTime:
+		return jsonom.StringValue(v.ToTime().Format(time.RFC3339))
+	case types.UnixTimeNano:
+		return jsonom.StringValue(v.ToTime().Format(time.RFC3339Nano))
+	case types.Measure:
+		ret := jsonom.NewObject()
+		if _, err := json.Number(v.Value).Float64(); err == nil {
+			ret.Set("value", jsonom.NewValue(json.Number(v.Value)))
+		} else {
+			ret.Set("value", jsonom.StringValue(v.Value))
+		}
+		ret.Set("unit", jsonom.StringValue(v.Unit))
+		return ret
+	case fmt.Stringer:
+		return jsonom.StringValue(v.String())
+	}
+	return nil
+}
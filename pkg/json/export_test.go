@@ -15,7 +15,13 @@
 package json
 
 import (
+	"bytes"
+	"encoding/json"
 	"testing"
+
+	"github.com/cloudprivacylabs/lsa/pkg/jsonld"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	_ "github.com/cloudprivacylabs/lsa/pkg/types"
 )
 
 func TestExport(t *testing.T) {
@@ -50,3 +56,82 @@ func TestExport(t *testing.T) {
 	// t.Log(out.String())
 
 }
+
+func TestExportOptions(t *testing.T) {
+	schStr := `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/id",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "root",
+  "attributes": {
+   "id": {
+     "@type": "Value",
+     "attributeName":"id",
+     "valueType": "xsd:integer",
+     "https://example.org/key": "identifier"
+   },
+   "dob": {
+     "@type": "Value",
+     "attributeName":"dob",
+     "valueType": "xsd:date",
+     "https://example.org/private": true
+   },
+   "active": {
+     "@type": "Value",
+     "attributeName":"active",
+     "valueType": "xsd:boolean"
+   },
+   "name": {
+     "@type": "Value",
+     "attributeName":"name"
+   },
+   "nickname": {
+     "@type": "Value",
+     "attributeName":"nickname"
+   }
+  }
+ }
+}`
+	inputStr := `{"id": "12", "dob": "2001-02-03", "active": "true", "name": "John", "nickname": null}`
+
+	var schMap interface{}
+	if err := json.Unmarshal([]byte(schStr), &schMap); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := jsonld.UnmarshalLayer(schMap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bldr := ls.NewGraphBuilder(nil, ls.GraphBuilderOptions{EmbedSchemaNodes: true})
+	parser := Parser{Layer: schema, IngestNullValues: true}
+	root, err := IngestBytes(ls.DefaultContext(), "http://base", []byte(inputStr), parser, bldr, &ls.Ingester{Schema: schema})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	export := func(options ExportOptions) string {
+		node, err := Export(root, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := bytes.Buffer{}
+		node.Encode(&out)
+		var v interface{}
+		if err := json.Unmarshal(out.Bytes(), &v); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	if s := export(ExportOptions{TypedValues: true}); s != `{"active":true,"dob":"2001-02-03","id":12,"name":"John","nickname":""}` {
+		t.Errorf("Typed: %s", s)
+	}
+	if s := export(ExportOptions{EmptyValues: EmptyValueOmit, ExcludeTerms: []string{"https://example.org/private"}}); s != `{"active":true,"id":12,"name":"John"}` {
+		t.Errorf("Exclude: %s", s)
+	}
+	if s := export(ExportOptions{EmptyValues: EmptyValueString, IncludeTerms: []string{ls.ValueTypeTerm.Name}, BuildNodeKeyFunc: GetBuildNodeKeyByTermFunc("https://example.org/key")}); s != `{"active":true,"dob":"2001-02-03","identifier":12}` {
+		t.Errorf("Include: %s", s)
+	}
+}
@@ -16,7 +16,9 @@ package json
 
 import (
 	"fmt"
+	"math/big"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/cloudprivacylabs/lsa/pkg/json/jsonschema"
@@ -363,6 +365,7 @@ func importSchema(ctx *importContext, sch *jsonschema.Schema) (*schemaProperty,
 		// TODO: patternProperties, etc
 	case sch.Items != nil:
 		target.array = &arraySchema{}
+		importCardinality(target, sch)
 		var err error
 		if itemSchema, ok := sch.Items.(*jsonschema.Schema); ok {
 			target.array.items, err = importSchema(ctx, itemSchema)
@@ -374,6 +377,7 @@ func importSchema(ctx *importContext, sch *jsonschema.Schema) (*schemaProperty,
 		}
 	case sch.Items2020 != nil:
 		target.array = &arraySchema{}
+		importCardinality(target, sch)
 		var err error
 		target.array.items, err = importSchema(ctx, sch.Items2020)
 		if err != nil {
@@ -406,6 +410,12 @@ func importSchema(ctx *importContext, sch *jsonschema.Schema) (*schemaProperty,
 		if sch.Pattern != nil {
 			target.pattern = sch.Pattern.String()
 		}
+		target.minimum = ratString(sch.Minimum)
+		target.maximum = ratString(sch.Maximum)
+		target.exclusiveMinimum = ratString(sch.ExclusiveMinimum)
+		target.exclusiveMaximum = ratString(sch.ExclusiveMaximum)
+		target.minLength = optionalInt(sch.MinLength)
+		target.maxLength = optionalInt(sch.MaxLength)
 		if len(sch.Description) > 0 {
 			target.description = sch.Description
 		}
@@ -418,3 +428,33 @@ func importSchema(ctx *importContext, sch *jsonschema.Schema) (*schemaProperty,
 
 	return target, nil
 }
+
+// ratString returns the decimal representation of a JSON schema
+// numeric bound, or nil
+func ratString(r *big.Rat) *string {
+	if r == nil {
+		return nil
+	}
+	var s string
+	if r.IsInt() {
+		s = r.RatString()
+	} else {
+		f, _ := r.Float64()
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return &s
+}
+
+// optionalInt returns nil if the JSON schema value is not specified (-1)
+func optionalInt(v int) *int {
+	if v == -1 {
+		return nil
+	}
+	return &v
+}
+
+func importCardinality(target *schemaProperty, sch *jsonschema.Schema) {
+	target.minItems = optionalInt(sch.MinItems)
+	target.maxItems = optionalInt(sch.MaxItems)
+	target.uniqueItems = sch.UniqueItems
+}
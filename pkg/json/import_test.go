@@ -16,7 +16,9 @@ package json
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
+	"sort"
 	"strings"
 	"testing"
 
@@ -24,6 +26,7 @@ import (
 
 	"github.com/cloudprivacylabs/lpg/v2"
 	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/validators"
 )
 
 func TestAnnotations(t *testing.T) {
@@ -118,3 +121,102 @@ func TestLoop(t *testing.T) {
 		return
 	}
 }
+
+func TestImportConstraints(t *testing.T) {
+	compiler := jsonschema.NewCompiler()
+	compiler.AddResource("/schema", strings.NewReader(`{
+ "type":"object",
+ "properties": {
+   "age": {
+     "type": "integer",
+     "minimum": 0,
+     "exclusiveMaximum": 150.5
+   },
+   "name": {
+     "type": "string",
+     "minLength": 1,
+     "maxLength": 5
+   },
+   "tags": {
+     "type": "array",
+     "items": {"type": "string"},
+     "minItems": 1,
+     "maxItems": 3,
+     "uniqueItems": true
+   }
+ }
+}`))
+	compiled, err := CompileEntitiesWith(compiler, Entity{Ref: "/schema", LayerID: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := BuildEntityGraph(lpg.NewGraph(), ls.SchemaTerm.Name, LinkRefsBySchemaRef, compiled[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := (&ls.Compiler{}).CompileSchema(ls.DefaultContext(), layers[0].Layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attr := func(name string) *lpg.Node {
+		node, _ := layer.FindFirstAttribute(func(n *lpg.Node) bool {
+			return ls.AttributeNameTerm.PropertyValue(n) == name
+		})
+		return node
+	}
+	for _, x := range []struct {
+		attr, term, value string
+	}{
+		{"age", validators.MinimumTerm.Name, "0"},
+		{"age", validators.ExclusiveMaximumTerm.Name, "150.5"},
+		{"name", validators.MinLengthTerm.Name, "1"},
+		{"name", validators.MaxLengthTerm.Name, "5"},
+		{"tags", validators.MinItemsTerm.Name, "1"},
+		{"tags", validators.MaxItemsTerm.Name, "3"},
+		{"tags", validators.UniqueItemsTerm.Name, "true"},
+	} {
+		if s, _ := ls.GetPropertyValueAs[string](attr(x.attr), x.term); s != x.value {
+			t.Errorf("Wrong %s for %s: %s", x.term, x.attr, s)
+		}
+	}
+
+	ingest := func(doc string) (*lpg.Graph, error) {
+		bldr := ls.NewGraphBuilder(nil, ls.GraphBuilderOptions{EmbedSchemaNodes: true})
+		_, err := IngestBytes(ls.DefaultContext(), "http://base", []byte(doc), Parser{Layer: layer}, bldr, &ls.Ingester{Schema: layer})
+		return bldr.GetGraph(), err
+	}
+	validate := func(g *lpg.Graph) []string {
+		ret := make([]string, 0)
+		ls.ValidateGraph(g, layer, func(_, _ *lpg.Node, err error) bool {
+			var verr ls.ErrValidation
+			if errors.As(err, &verr) {
+				ret = append(ret, verr.Validator)
+			} else {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			return true
+		})
+		sort.Strings(ret)
+		return ret
+	}
+	g, err := ingest(`{"age": 150, "name": "john", "tags": ["a","b"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := validate(g); len(errs) != 0 {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+	g, err = ingest(`{"age": 10, "name": "john", "tags": ["a","b","a","c"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := validate(g); len(errs) != 2 || errs[0] != validators.MaxItemsTerm.Name || errs[1] != validators.UniqueItemsTerm.Name {
+		t.Errorf("Wrong errors: %v", errs)
+	}
+	if _, err = ingest(`{"age": 151}`); !errors.As(err, &ls.ErrValidation{}) {
+		t.Errorf("Expecting validation error: %v", err)
+	}
+	if _, err = ingest(`{"name": "johnny"}`); !errors.As(err, &ls.ErrValidation{}) {
+		t.Errorf("Expecting validation error: %v", err)
+	}
+}
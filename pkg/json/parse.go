@@ -48,9 +48,12 @@ func (i ParsedDocNode) GetAttributeName() string              { return i.name }
 type Parser struct {
 	OnlySchemaAttributes bool
 	IngestNullValues     bool
-	Layer                *ls.Layer
-	objectCache          map[*lpg.Node]map[string][]*lpg.Node
-	discriminator        map[*lpg.Node][]*lpg.Node
+	// If true, values are not validated during parsing. The ingested
+	// graph can be validated using ls.ValidateGraph
+	SkipValueValidation bool
+	Layer               *ls.Layer
+	objectCache         map[*lpg.Node]map[string][]*lpg.Node
+	discriminator       map[*lpg.Node][]*lpg.Node
 }
 
 type parserContext struct {
@@ -295,7 +298,7 @@ func (ing *Parser) parseValue(ctx parserContext, input *jsonom.Value) (*ParsedDo
 			value = fmt.Sprint(v)
 		}
 	}
-	if ctx.schemaNode != nil {
+	if ctx.schemaNode != nil && !ing.SkipValueValidation {
 		if err := ls.ValidateValueBySchema(&value, ctx.schemaNode); err != nil {
 			return nil, err
 		}
@@ -0,0 +1,374 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bserdar/jsonom"
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/types"
+	"github.com/cloudprivacylabs/lsa/pkg/validators"
+)
+
+// JSONSchemaDraft is the $schema of the generated JSON schemas
+const JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// ErrCannotGenerateSchema is returned if a schema attribute cannot be
+// represented in JSON schema
+type ErrCannotGenerateSchema struct {
+	ID  string
+	Msg string
+}
+
+func (e ErrCannotGenerateSchema) Error() string {
+	return fmt.Sprintf("Cannot generate JSON schema for %s: %s", e.ID, e.Msg)
+}
+
+// ExportJSONSchema generates a Draft 2020-12 JSON schema from a
+// compiled layer. Object attributes become properties keyed by
+// attributeName, array elements become items, and polymorphic
+// attributes become oneOf. Compiled references are written to $defs
+// once, and referred to using $ref. Value types, enumerations,
+// patterns, formats, ranges, required attributes, default values,
+// and descriptions are included.
+func ExportJSONSchema(layer *ls.Layer) (*jsonom.Object, error) {
+	root := layer.GetSchemaRootNode()
+	if root == nil {
+		return nil, ErrCannotGenerateSchema{ID: layer.GetID(), Msg: "No schema root"}
+	}
+	gen := jsonSchemaGenerator{
+		defNames: make(map[string]string),
+		defs:     jsonom.NewObject(),
+		rootID:   ls.EntitySchemaTerm.PropertyValue(root),
+	}
+	ret := jsonom.NewObject()
+	ret.Set("$schema", jsonom.StringValue(JSONSchemaDraft))
+	if id := layer.GetID(); len(id) > 0 {
+		ret.Set("$id", jsonom.StringValue(id))
+	}
+	body, err := gen.attribute(root, true)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < body.Len(); i++ {
+		ret.AddOrSet(body.N(i))
+	}
+	if gen.defs.Len() > 0 {
+		ret.Set("$defs", gen.defs)
+	}
+	return ret, nil
+}
+
+type jsonSchemaGenerator struct {
+	// Reference -> $defs key
+	defNames map[string]string
+	defs     *jsonom.Object
+	// The schema ID of the root. References to the root are written
+	// as "#"
+	rootID string
+}
+
+// defName returns a $defs key for the reference
+func (gen *jsonSchemaGenerator) defName(ref string) string {
+	name := ref
+	if ix := strings.LastIndexAny(strings.TrimRight(name, "/#"), "/#:"); ix != -1 {
+		name = name[ix+1:]
+	}
+	name = strings.Trim(name, "/#")
+	if len(name) == 0 {
+		name = "def"
+	}
+	base := name
+	for i := 1; ; i++ {
+		used := false
+		for _, x := range gen.defNames {
+			if x == name {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return name
+		}
+		name = base + strconv.Itoa(i)
+	}
+}
+
+// reference returns a $ref to the referenced schema, generating the
+// definition if necessary
+func (gen *jsonSchemaGenerator) reference(node *lpg.Node, ref string) (*jsonom.Object, error) {
+	ret := jsonom.NewObject()
+	if ref == gen.rootID {
+		ret.Set("$ref", jsonom.StringValue("#"))
+		return ret, nil
+	}
+	name, exists := gen.defNames[ref]
+	if !exists {
+		name = gen.defName(ref)
+		gen.defNames[ref] = name
+		// Reserve the name to preserve the order and to handle loops
+		gen.defs.Set(name, jsonom.NewObject())
+		def, err := gen.attribute(node, true)
+		if err != nil {
+			return nil, err
+		}
+		gen.defs.Set(name, def)
+	}
+	ret.Set("$ref", jsonom.StringValue("#/$defs/"+name))
+	return ret, nil
+}
+
+// childAttributes returns the child attributes of an object in order
+func childAttributes(node *lpg.Node) []*lpg.Node {
+	ret := ls.GetObjectAttributeNodes(node)
+	ls.SortNodes(ret)
+	return ret
+}
+
+// attribute returns the schema for the attribute. If the attribute
+// is a compiled reference and inline is false, a $ref is returned.
+func (gen *jsonSchemaGenerator) attribute(node *lpg.Node, inline bool) (*jsonom.Object, error) {
+	if !inline && !node.HasLabel(ls.AttributeTypeValue.Name) {
+		if ref := ls.ReferenceTerm.PropertyValue(node); len(ref) > 0 {
+			if node.HasLabel(ls.AttributeTypeReference.Name) {
+				// Not compiled
+				ret := jsonom.NewObject()
+				ret.Set("$ref", jsonom.StringValue(ref))
+				return ret, nil
+			}
+			return gen.reference(node, ref)
+		}
+	}
+	ret := jsonom.NewObject()
+	if desc := ls.GetDescription(node); len(desc) > 0 {
+		ret.Set("description", jsonom.StringValue(desc))
+	}
+	switch {
+	case node.HasLabel(ls.AttributeTypeValue.Name):
+		if err := setValueSchema(ret, node); err != nil {
+			return nil, err
+		}
+
+	case node.HasLabel(ls.AttributeTypeObject.Name):
+		ret.Set("type", jsonom.StringValue("object"))
+		properties := jsonom.NewObject()
+		required := make([]string, 0)
+		requiredIDs := make(map[string]struct{})
+		if pv, ok := ls.GetPropertyValue(node, validators.RequiredTerm.Name); ok {
+			for _, x := range pv.AsStringSlice() {
+				requiredIDs[x] = struct{}{}
+			}
+		}
+		for _, child := range childAttributes(node) {
+			name := ls.AttributeNameTerm.PropertyValue(child)
+			if len(name) == 0 {
+				name = ls.GetNodeID(child)
+			}
+			schema, err := gen.attribute(child, false)
+			if err != nil {
+				return nil, err
+			}
+			properties.Set(name, schema)
+			_, req := requiredIDs[ls.GetNodeID(child)]
+			if !req {
+				_, req = requiredIDs[name]
+			}
+			if req || isRequired(child) {
+				required = append(required, name)
+			}
+		}
+		ret.Set("properties", properties)
+		if len(required) > 0 {
+			arr := jsonom.NewArray()
+			for _, x := range required {
+				arr.Append(jsonom.StringValue(x))
+			}
+			ret.Set("required", arr)
+		}
+
+	case node.HasLabel(ls.AttributeTypeArray.Name):
+		ret.Set("type", jsonom.StringValue("array"))
+		if elem := ls.GetArrayElementNode(node); elem != nil {
+			items, err := gen.attribute(elem, false)
+			if err != nil {
+				return nil, err
+			}
+			ret.Set("items", items)
+		}
+		setIntValidators(ret, node, validators.MinItemsTerm.Name, "minItems", validators.MaxItemsTerm.Name, "maxItems")
+		if v, _ := propertyString(node, validators.UniqueItemsTerm.Name); v == "true" {
+			ret.Set("uniqueItems", jsonom.BoolValue(true))
+		}
+
+	case node.HasLabel(ls.AttributeTypePolymorphic.Name):
+		options := jsonom.NewArray()
+		optionNodes := ls.GetPolymorphicOptions(node)
+		ls.SortNodes(optionNodes)
+		for _, option := range optionNodes {
+			schema, err := gen.attribute(option, false)
+			if err != nil {
+				return nil, err
+			}
+			options.Append(schema)
+		}
+		ret.Set("oneOf", options)
+
+	case node.HasLabel(ls.AttributeTypeReference.Name):
+		ret.Set("$ref", jsonom.StringValue(ls.ReferenceTerm.PropertyValue(node)))
+
+	default:
+		return nil, ErrCannotGenerateSchema{ID: ls.GetNodeID(node), Msg: "Unknown attribute type"}
+	}
+	return ret, nil
+}
+
+// propertyString returns the property value as a string
+func propertyString(node *lpg.Node, term string) (string, bool) {
+	pv, ok := ls.GetPropertyValue(node, term)
+	if !ok {
+		return "", false
+	}
+	if s := pv.AsStringSlice(); len(s) == 1 {
+		return s[0], true
+	}
+	return fmt.Sprint(pv.Value()), true
+}
+
+// isRequired returns true if the attribute is marked as required
+// using a boolean
+func isRequired(node *lpg.Node) bool {
+	pv, ok := ls.GetPropertyValue(node, validators.RequiredTerm.Name)
+	if !ok {
+		return false
+	}
+	v, _ := ls.BooleanType{}.Coerce(pv.Value())
+	b, _ := v.(bool)
+	return b
+}
+
+// jsonSchemaFormats maps primitive types to JSON schema formats
+var jsonSchemaFormats = map[types.Primitive]string{
+	types.PrimitiveDate:     "date",
+	types.PrimitiveDateTime: "date-time",
+	types.PrimitiveTime:     "time",
+}
+
+func setValueSchema(ret *jsonom.Object, node *lpg.Node) error {
+	typ := "string"
+	format := ""
+	if valueType, _ := propertyString(node, ls.ValueTypeTerm.Name); len(valueType) > 0 {
+		switch p := types.GetPrimitive(valueType); p {
+		case types.PrimitiveInteger, types.PrimitiveNumber, types.PrimitiveBoolean:
+			typ = string(p)
+		default:
+			format = jsonSchemaFormats[p]
+		}
+	}
+	if f, _ := propertyString(node, validators.JsonFormatTerm.Name); len(f) > 0 {
+		format = f
+	}
+	ret.Set("type", jsonom.StringValue(typ))
+	if len(format) > 0 {
+		ret.Set("format", jsonom.StringValue(format))
+	}
+	if pattern, ok := propertyString(node, validators.PatternTerm.Name); ok {
+		ret.Set("pattern", jsonom.StringValue(pattern))
+	}
+	if pv, ok := ls.GetPropertyValue(node, validators.EnumTerm.Name); ok {
+		arr := jsonom.NewArray()
+		for _, x := range pv.AsStringSlice() {
+			v, err := typedJSONValue(x, typ)
+			if err != nil {
+				return ErrCannotGenerateSchema{ID: ls.GetNodeID(node), Msg: err.Error()}
+			}
+			arr.Append(v)
+		}
+		ret.Set("enum", arr)
+	}
+	if c, ok := propertyString(node, validators.ConstTerm.Name); ok {
+		v, err := typedJSONValue(c, typ)
+		if err != nil {
+			return ErrCannotGenerateSchema{ID: ls.GetNodeID(node), Msg: err.Error()}
+		}
+		ret.Set("const", v)
+	}
+	// Bounds of formatted values such as dates are written using the
+	// format keywords. Other non-numeric bounds, such as measures,
+	// cannot be represented and are skipped.
+	for _, x := range []struct {
+		term      string
+		key       string
+		formatKey string
+	}{
+		{validators.MinimumTerm.Name, "minimum", "formatMinimum"},
+		{validators.MaximumTerm.Name, "maximum", "formatMaximum"},
+		{validators.ExclusiveMinimumTerm.Name, "exclusiveMinimum", "formatExclusiveMinimum"},
+		{validators.ExclusiveMaximumTerm.Name, "exclusiveMaximum", "formatExclusiveMaximum"},
+	} {
+		v, ok := propertyString(node, x.term)
+		if !ok {
+			continue
+		}
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			ret.Set(x.key, jsonom.NewValue(json.Number(v)))
+		} else if len(format) > 0 {
+			ret.Set(x.formatKey, jsonom.StringValue(v))
+		}
+	}
+	setIntValidators(ret, node, validators.MinLengthTerm.Name, "minLength", validators.MaxLengthTerm.Name, "maxLength")
+	if d, ok := propertyString(node, ls.DefaultValueTerm.Name); ok {
+		v, err := typedJSONValue(d, typ)
+		if err == nil {
+			ret.Set("default", v)
+		}
+	}
+	return nil
+}
+
+// setIntValidators sets the integer valued keywords of the
+// schema. termKeys is a list of term, keyword pairs
+func setIntValidators(ret *jsonom.Object, node *lpg.Node, termKeys ...string) {
+	for i := 0; i+1 < len(termKeys); i += 2 {
+		if s, ok := propertyString(node, termKeys[i]); ok {
+			if v, err := strconv.Atoi(s); err == nil {
+				ret.Set(termKeys[i+1], jsonom.NewValue(v))
+			}
+		}
+	}
+}
+
+// typedJSONValue converts a string value to a JSON value of the given
+// JSON schema type
+func typedJSONValue(value, typ string) (jsonom.Node, error) {
+	switch typ {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("Invalid number: %s", value)
+		}
+		return jsonom.NewValue(json.Number(value)), nil
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid boolean: %s", value)
+		}
+		return jsonom.BoolValue(b), nil
+	}
+	return jsonom.StringValue(value), nil
+}
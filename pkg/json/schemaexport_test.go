@@ -0,0 +1,147 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/cloudprivacylabs/lsa/pkg/jsonld"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+func TestExportJSONSchema(t *testing.T) {
+	schemas := map[string]string{
+		"http://example.org/Person": `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/Person",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "person",
+  "description": "A person",
+  "required": ["person.id"],
+  "attributes": {
+   "person.id": {
+     "@type": "Value",
+     "attributeName":"id",
+     "valueType": "xsd:integer",
+     "minimum": "1"
+   },
+   "person.dob": {
+     "@type": "Value",
+     "attributeName":"dob",
+     "valueType": "xsd:date",
+     "maximum": "2030-01-01"
+   },
+   "person.weight": {
+     "@type": "Value",
+     "attributeName":"weight",
+     "maximum": "200 kg"
+   },
+   "person.kind": {
+     "@type": "Value",
+     "attributeName":"kind",
+     "https://lschema.org/validation/const": "person"
+   },
+   "person.status": {
+     "@type": "Value",
+     "attributeName":"status",
+     "enumeration": ["active","inactive"],
+     "required": true
+   },
+   "person.phones": {
+     "@type": "Array",
+     "attributeName":"phones",
+     "minItems": "1",
+     "arrayElements": {
+       "@type": "Value",
+       "@id": "person.phones.item",
+       "pattern": "^[0-9]+$"
+     }
+   },
+   "person.address": {
+     "@type": "Reference",
+     "attributeName": "address",
+     "ref": "http://example.org/Address"
+   },
+   "person.contact": {
+     "@type": "Polymorphic",
+     "attributeName": "contact",
+     "oneOf": [
+       {
+         "@id": "person.contact.email",
+         "@type": "Value",
+         "https://lschema.org/validation/json/format": "email"
+       },
+       {
+         "@id": "person.contact.address",
+         "@type": "Reference",
+         "ref": "http://example.org/Address"
+       }
+     ]
+   }
+  }
+ }
+}`,
+		"http://example.org/Address": `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/Address",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "address",
+  "attributes": {
+   "address.city": {
+     "@type": "Value",
+     "attributeName":"city",
+     "maxLength": "50"
+   }
+  }
+ }
+}`,
+	}
+	compiler := ls.Compiler{
+		Loader: ls.SchemaLoaderFunc(func(ref string) (*ls.Layer, error) {
+			s, ok := schemas[ref]
+			if !ok {
+				return nil, fmt.Errorf("Not found: %s", ref)
+			}
+			var v interface{}
+			if err := json.Unmarshal([]byte(s), &v); err != nil {
+				return nil, err
+			}
+			return jsonld.UnmarshalLayer(v, nil)
+		}),
+	}
+	layer, err := compiler.Compile(ls.DefaultContext(), "http://example.org/Person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sch, err := ExportJSONSchema(layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := bytes.Buffer{}
+	if err := sch.Encode(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"$schema":"https://json-schema.org/draft/2020-12/schema","$id":"http://example.org/Person","description":"A person","type":"object","properties":{"address":{"$ref":"#/$defs/Address"},"contact":{"oneOf":[{"type":"string","format":"email"},{"$ref":"#/$defs/Address"}]},"dob":{"type":"string","format":"date","formatMaximum":"2030-01-01"},"id":{"type":"integer","minimum":1},"kind":{"type":"string","const":"person"},"phones":{"type":"array","items":{"type":"string","pattern":"^[0-9]+$"},"minItems":1},"status":{"type":"string","enum":["active","inactive"]},"weight":{"type":"string"}},"required":["id","status"],"$defs":{"Address":{"type":"object","properties":{"city":{"type":"string","maxLength":50}}}}}`
+	if out.String() != expected {
+		t.Errorf("Got %s", out.String())
+	}
+}
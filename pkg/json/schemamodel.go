@@ -42,6 +42,17 @@ type schemaProperty struct {
 	defaultValue *string
 	annotations  map[string]any
 
+	// Range, length, and cardinality constraints. Nil if not specified
+	minimum          *string
+	maximum          *string
+	exclusiveMinimum *string
+	exclusiveMaximum *string
+	minLength        *int
+	maxLength        *int
+	minItems         *int
+	maxItems         *int
+	uniqueItems      bool
+
 	node *lpg.Node
 
 	localReference *schemaProperty
@@ -172,6 +183,15 @@ func (imp schemaImporter) schemaAttrs(attr *schemaProperty, path schemaPath, key
 		attr.allOf = attr.localReference.allOf
 		attr.oneOf = attr.localReference.oneOf
 		attr.typ = attr.localReference.typ
+		attr.minimum = attr.localReference.minimum
+		attr.maximum = attr.localReference.maximum
+		attr.exclusiveMinimum = attr.localReference.exclusiveMinimum
+		attr.exclusiveMaximum = attr.localReference.exclusiveMaximum
+		attr.minLength = attr.localReference.minLength
+		attr.maxLength = attr.localReference.maxLength
+		attr.minItems = attr.localReference.minItems
+		attr.maxItems = attr.localReference.maxItems
+		attr.uniqueItems = attr.localReference.uniqueItems
 		//attr.description = attr.localReference.description
 		for k, v := range attr.localReference.annotations {
 			if attr.annotations == nil {
@@ -208,6 +228,35 @@ func (imp schemaImporter) setNodeProperties(attr *schemaProperty, newNode *lpg.N
 	if len(attr.pattern) > 0 {
 		newNode.SetProperty(validators.PatternTerm.Name, ls.NewPropertyValue(validators.PatternTerm.Name, attr.pattern))
 	}
+	for _, x := range []struct {
+		term  string
+		value *string
+	}{
+		{validators.MinimumTerm.Name, attr.minimum},
+		{validators.MaximumTerm.Name, attr.maximum},
+		{validators.ExclusiveMinimumTerm.Name, attr.exclusiveMinimum},
+		{validators.ExclusiveMaximumTerm.Name, attr.exclusiveMaximum},
+	} {
+		if x.value != nil {
+			newNode.SetProperty(x.term, ls.NewPropertyValue(x.term, *x.value))
+		}
+	}
+	for _, x := range []struct {
+		term  string
+		value *int
+	}{
+		{validators.MinLengthTerm.Name, attr.minLength},
+		{validators.MaxLengthTerm.Name, attr.maxLength},
+		{validators.MinItemsTerm.Name, attr.minItems},
+		{validators.MaxItemsTerm.Name, attr.maxItems},
+	} {
+		if x.value != nil {
+			newNode.SetProperty(x.term, ls.NewPropertyValue(x.term, strconv.Itoa(*x.value)))
+		}
+	}
+	if attr.uniqueItems {
+		newNode.SetProperty(validators.UniqueItemsTerm.Name, ls.NewPropertyValue(validators.UniqueItemsTerm.Name, "true"))
+	}
 	//if len(attr.description) > 0 {
 	//	newNode.SetProperty(ls.DescriptionTerm, ls.NewPropertyValue(attr.description))
 	//}
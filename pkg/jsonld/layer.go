@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/cloudprivacylabs/lpg/v2"
@@ -251,7 +252,7 @@ func UnmarshalLayer(in any, interner ls.Interner) (*ls.Layer, error) {
 
 	// Link graphNode to its children using term edges
 	link := func(root unmarshalInfo, elements []any, term string) error {
-		for _, el := range elements {
+		for index, el := range elements {
 			element, ok := el.(map[string]any)
 			if !ok {
 				return ls.MakeErrInvalidInput(root.id, "Unrecognized child element")
@@ -265,6 +266,11 @@ func UnmarshalLayer(in any, interner ls.Interner) (*ls.Layer, error) {
 				return ls.MakeErrInvalidInput(root.id, fmt.Sprintf("Cannot find child with id %s", childId))
 			}
 			layerGraph.NewEdge(root.graphNode, childInfo.graphNode, term, nil)
+			// Keep the attribute list order, edge order is not preserved
+			// when the layer is copied
+			if term == ls.ObjectAttributeListTerm.Name || term == ls.OneOfTerm.Name {
+				ls.SetNodeIndex(childInfo.graphNode, index)
+			}
 		}
 		return nil
 	}
@@ -438,8 +444,9 @@ func MarshalLayer(layer *ls.Layer) (any, error) {
 		}
 
 		type outgoing struct {
-			id   string
-			node map[string]any
+			id    string
+			node  map[string]any
+			index int
 		}
 
 		outgoingEdges := make(map[string][]outgoing)
@@ -461,9 +468,14 @@ func MarshalLayer(layer *ls.Layer) (any, error) {
 				if childId != "" && childId != label {
 					nd["@id"] = childId
 				}
+				if label == ls.ObjectAttributeListTerm.Name || label == ls.OneOfTerm.Name {
+					// The index is the position in the list
+					delete(nd, ls.AttributeIndexTerm.Name)
+				}
 				outgoingEdges[label] = append(outgoingEdges[label], outgoing{
-					id:   childId,
-					node: nd,
+					id:    childId,
+					node:  nd,
+					index: ls.GetNodeIndex(edge.GetTo()),
 				})
 			}
 		}
@@ -477,6 +489,7 @@ func MarshalLayer(layer *ls.Layer) (any, error) {
 					label == ls.OneOfTerm.Name ||
 					label == ls.ObjectAttributeListTerm.Name ||
 					label == ls.AttributeOverlaysTerm.Name {
+					sort.SliceStable(edge, func(i, j int) bool { return edge[i].index < edge[j].index })
 					arr := make([]any, 0, len(edge))
 					for _, x := range edge {
 						arr = append(arr, x.node)
@@ -131,26 +131,27 @@ func IndexEntityInfo(entityInfo map[*lpg.Node]EntityInfo) EntityInfoIndex {
 		indexByType: make(map[string]map[string][]*lpg.Node),
 	}
 
-	add := func(t, hash string, node *lpg.Node) {
-		m := ix.indexByType[t]
-		if m == nil {
-			m = make(map[string][]*lpg.Node)
-			ix.indexByType[t] = m
-		}
-		m[hash] = append(m[hash], node)
-	}
 	for node, ei := range entityInfo {
 		hash := ix.getFkHash(ei.GetID())
-		add(ei.sch, hash, node)
+		ix.add(ei.sch, hash, node)
 		for _, t := range ei.valueType {
 			if t != ei.sch {
-				add(t, hash, node)
+				ix.add(t, hash, node)
 			}
 		}
 	}
 	return ix
 }
 
+func (e EntityInfoIndex) add(t, hash string, node *lpg.Node) {
+	m := e.indexByType[t]
+	if m == nil {
+		m = make(map[string][]*lpg.Node)
+		e.indexByType[t] = m
+	}
+	m[hash] = append(m[hash], node)
+}
+
 // GetParentDocumentNodes returns the document nodes that have incoming edges to this node
 func GetParentDocumentNodes(node *lpg.Node) []*lpg.Node {
 	out := make(map[*lpg.Node]struct{})
@@ -392,3 +393,44 @@ func GetAttributeReferenceBySchemaPath(schemaPath []*lpg.Node, docContextNode *l
 	}
 	return AttributeReference{}, false
 }
+
+// GetDocumentNodePath returns the path of the document node from the
+// document root, for instance "address[0].street". Each path element
+// is the attribute name of the node, or the attribute index if the
+// node does not have a name. The root node is not included in the
+// path.
+func GetDocumentNodePath(node *lpg.Node) string {
+	elements := make([]string, 0)
+	seen := make(map[*lpg.Node]struct{})
+	for node != nil {
+		if _, ok := seen[node]; ok {
+			break
+		}
+		seen[node] = struct{}{}
+		var parent *lpg.Node
+		for edges := node.GetEdges(lpg.IncomingEdge); edges.Next(); {
+			if from := edges.Edge().GetFrom(); IsDocumentNode(from) && from != node {
+				parent = from
+				break
+			}
+		}
+		if parent == nil {
+			break
+		}
+		name := AttributeNameTerm.PropertyValue(node)
+		switch {
+		case parent.GetLabels().Has(AttributeTypeArray.Name):
+			elements = append(elements, fmt.Sprintf("[%d]", GetNodeIndex(node)))
+		case len(name) > 0:
+			elements = append(elements, "."+name)
+		default:
+			elements = append(elements, fmt.Sprintf(".%d", GetNodeIndex(node)))
+		}
+		node = parent
+	}
+	var builder strings.Builder
+	for i := len(elements) - 1; i >= 0; i-- {
+		builder.WriteString(elements[i])
+	}
+	return strings.TrimPrefix(builder.String(), ".")
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ls
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+)
+
+// PersistentEntityIndex records the entities ingested in earlier
+// graphs, so references can be resolved across graphs. Entities are
+// recorded by their type and entity id, and identified by their node
+// ids. The node ids must be stable across runs for the link records
+// to be meaningful.
+type PersistentEntityIndex interface {
+	// AddEntity records that the entity with the given type and id
+	// has the node id
+	AddEntity(entityType string, id []string, nodeID string) error
+	// FindEntity returns the node ids of the entities with the given
+	// type and id
+	FindEntity(entityType string, id []string) ([]string, error)
+	// AddPendingLink records a reference to an entity that is not
+	// ingested yet
+	AddPendingLink(entityType string, id []string, link LinkRecord) error
+	// TakePendingLinks returns and removes the pending links waiting
+	// for the given entity. The To fields of the returned links are
+	// empty.
+	TakePendingLinks(entityType string, id []string) ([]LinkRecord, error)
+}
+
+// LinkRecord is a link between nodes of different graphs. The link
+// is from the node with id From to the node with id To.
+type LinkRecord struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Label string `json:"label"`
+	// Pending links are from an entity to a target that is not
+	// ingested yet. If Reverse is set, the link is from the target to
+	// the entity.
+	Reverse bool `json:"reverse,omitempty"`
+}
+
+// recordEntities adds the entities of the graph to the persistent
+// index, and emits the pending links that were waiting for them. If
+// a link spec normalizes the foreign keys referring to an entity
+// type, the entities of that type are also recorded using their
+// normalized ids.
+func (gb GraphBuilder) recordEntities(entityInfo map[*lpg.Node]EntityInfo, specs []*LinkSpec) error {
+	index := gb.options.EntityIndex
+	nodes := make([]*lpg.Node, 0, len(entityInfo))
+	for node := range entityInfo {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].GetID() < nodes[j].GetID() })
+	for _, node := range nodes {
+		ei := entityInfo[node]
+		if len(ei.GetID()) == 0 || PlaceholderTerm.PropertyValue(node) {
+			continue
+		}
+		nodeID := GetNodeID(node)
+		types := []string{ei.GetEntitySchema()}
+		for _, t := range ei.GetValueType() {
+			if t != ei.GetEntitySchema() {
+				types = append(types, t)
+			}
+		}
+		seen := make(map[string]struct{})
+		record := func(t string, id []string) error {
+			k := t + "\x00" + strings.Join(id, "\x00")
+			if _, ok := seen[k]; ok {
+				return nil
+			}
+			seen[k] = struct{}{}
+			if err := index.AddEntity(t, id, nodeID); err != nil {
+				return err
+			}
+			pending, err := index.TakePendingLinks(t, id)
+			if err != nil {
+				return err
+			}
+			for _, link := range pending {
+				gb.emitLink(link, nodeID)
+			}
+			return nil
+		}
+		for _, t := range types {
+			if err := record(t, ei.GetID()); err != nil {
+				return err
+			}
+			for _, spec := range specs {
+				if spec.TargetEntity != t || !spec.HasKeyTransform() {
+					continue
+				}
+				key, err := spec.NormalizeKey(ei.GetID())
+				if err != nil {
+					return err
+				}
+				if len(key) == 0 {
+					continue
+				}
+				if err := record(t, key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// emitLink completes a pending link with the target node id, and
+// passes it to the LinkRecordFunc
+func (gb GraphBuilder) emitLink(link LinkRecord, targetNodeID string) {
+	if gb.options.LinkRecordFunc == nil {
+		return
+	}
+	if link.Reverse {
+		gb.options.LinkRecordFunc(LinkRecord{From: targetNodeID, To: link.From, Label: link.Label})
+		return
+	}
+	gb.options.LinkRecordFunc(LinkRecord{From: link.From, To: targetNodeID, Label: link.Label})
+}
+
+// linkAcrossGraphs resolves a reference that is not found in the
+// graph using the persistent index. If the target entity was
+// ingested before, link records are emitted and it returns
+// true. Otherwise, a pending link is recorded. The foreign key is
+// normalized using the link spec.
+func (gb GraphBuilder) linkAcrossGraphs(spec *LinkSpec, sourceNode *lpg.Node, fk []string) (bool, error) {
+	index := gb.options.EntityIndex
+	link := LinkRecord{
+		From:    GetNodeID(sourceNode),
+		Label:   spec.Label,
+		Reverse: !spec.Forward,
+	}
+	targets, err := index.FindEntity(spec.TargetEntity, fk)
+	if err != nil {
+		return false, err
+	}
+	if len(targets) == 0 {
+		return false, index.AddPendingLink(spec.TargetEntity, fk, link)
+	}
+	for _, target := range targets {
+		gb.emitLink(link, target)
+	}
+	return true, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ls
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type memEntityIndex struct {
+	entities map[string][]string
+	pending  map[string][]LinkRecord
+}
+
+func (m *memEntityIndex) key(t string, id []string) string { return t + " " + strings.Join(id, " ") }
+
+func (m *memEntityIndex) AddEntity(t string, id []string, nodeID string) error {
+	m.entities[m.key(t, id)] = append(m.entities[m.key(t, id)], nodeID)
+	return nil
+}
+
+func (m *memEntityIndex) FindEntity(t string, id []string) ([]string, error) {
+	return m.entities[m.key(t, id)], nil
+}
+
+func (m *memEntityIndex) AddPendingLink(t string, id []string, link LinkRecord) error {
+	m.pending[m.key(t, id)] = append(m.pending[m.key(t, id)], link)
+	return nil
+}
+
+func (m *memEntityIndex) TakePendingLinks(t string, id []string) ([]LinkRecord, error) {
+	ret := m.pending[m.key(t, id)]
+	delete(m.pending, m.key(t, id))
+	return ret, nil
+}
+
+func TestCrossGraphLink(t *testing.T) {
+	layers := compileLinkTestLayers(t, "testdata/link_1/root.json", "testdata/link_1/2.json")
+	rootLayer, layer2 := layers[0], layers[1]
+
+	index := &memEntityIndex{entities: map[string][]string{}, pending: map[string][]LinkRecord{}}
+	links := make([]LinkRecord, 0)
+	newBuilder := func() GraphBuilder {
+		return NewGraphBuilder(nil, GraphBuilderOptions{
+			EmbedSchemaNodes: true,
+			EntityIndex:      index,
+			LinkRecordFunc:   func(l LinkRecord) { links = append(links, l) },
+		})
+	}
+	ingest2 := func(nodeID string) {
+		builder := newBuilder()
+		_, root, _ := builder.ObjectAsNode(layer2.GetSchemaRootNode(), nil)
+		SetNodeID(root, nodeID)
+		builder.RawValueAsNode(layer2.GetAttributeByID("idField"), root, nodeID)
+		builder.RawValueAsNode(layer2.GetAttributeByID("https://rootid"), root, "123")
+		if err := builder.LinkNodes(DefaultContext(), layer2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The referenced entity is not ingested yet
+	ingest2("https://a")
+	if len(links) != 0 || len(index.pending) != 1 {
+		t.Fatalf("Expecting pending link: %v %v", links, index.pending)
+	}
+
+	// The pending link is emitted when the target is ingested
+	builder := newBuilder()
+	_, root1, _ := builder.ObjectAsNode(rootLayer.GetSchemaRootNode(), nil)
+	SetNodeID(root1, "https://root1")
+	builder.RawValueAsNode(rootLayer.GetAttributeByID("https://idField"), root1, "123")
+	if err := builder.LinkNodes(DefaultContext(), rootLayer); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(links, []LinkRecord{{From: "https://root1", To: "https://a"}}) {
+		t.Errorf("Wrong links: %v", links)
+	}
+	if len(index.pending) != 0 {
+		t.Errorf("Pending links not removed")
+	}
+
+	// References to entities ingested earlier are emitted immediately
+	ingest2("https://b")
+	if !reflect.DeepEqual(links, []LinkRecord{{From: "https://root1", To: "https://a"}, {From: "https://root1", To: "https://b"}}) {
+		t.Errorf("Wrong links: %v", links)
+	}
+}
+
+func TestCrossGraphLinkNormalized(t *testing.T) {
+	layers := compileLinkTestLayers(t, "testdata/link_norm/root.json", "testdata/link_norm/2.json")
+	rootLayer, layer2 := layers[0], layers[1]
+
+	index := &memEntityIndex{entities: map[string][]string{}, pending: map[string][]LinkRecord{}}
+	links := make([]LinkRecord, 0)
+	newBuilder := func() GraphBuilder {
+		return NewGraphBuilder(nil, GraphBuilderOptions{
+			EmbedSchemaNodes: true,
+			EntityIndex:      index,
+			LinkRecordFunc:   func(l LinkRecord) { links = append(links, l) },
+		})
+	}
+	ingestRoot := func(nodeID, id string) {
+		builder := newBuilder()
+		_, root, _ := builder.ObjectAsNode(rootLayer.GetSchemaRootNode(), nil)
+		SetNodeID(root, nodeID)
+		builder.RawValueAsNode(rootLayer.GetAttributeByID("https://idField"), root, id)
+		if err := builder.LinkNodes(DefaultContext(), rootLayer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ingest2 := func(nodeID, fk string) {
+		builder := newBuilder()
+		_, root, _ := builder.ObjectAsNode(layer2.GetSchemaRootNode(), nil)
+		SetNodeID(root, nodeID)
+		builder.RawValueAsNode(layer2.GetAttributeByID("idField"), root, nodeID)
+		builder.RawValueAsNode(layer2.GetAttributeByID("https://rootid"), root, fk)
+		if err := builder.LinkNodes(DefaultContext(), layer2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The foreign key is normalized to upper case before it is
+	// looked up, and recorded as pending with the normalized key
+	ingest2("https://a", "ab-1")
+	if _, ok := index.pending[index.key("https://root", []string{"AB-1"})]; !ok {
+		t.Errorf("Pending link not recorded with the normalized key: %v", index.pending)
+	}
+	ingestRoot("https://root1", "AB-1")
+	if !reflect.DeepEqual(links, []LinkRecord{{From: "https://root1", To: "https://a"}}) {
+		t.Errorf("Wrong links: %v", links)
+	}
+	if len(index.pending) != 0 {
+		t.Errorf("Pending links not removed")
+	}
+	// References to entities ingested earlier use the normalized key
+	ingest2("https://b", "Ab-1")
+	if !reflect.DeepEqual(links, []LinkRecord{{From: "https://root1", To: "https://a"}, {From: "https://root1", To: "https://b"}}) {
+		t.Errorf("Wrong links: %v", links)
+	}
+
+	// Entities are also recorded with normalized ids for the link
+	// specs that refer to them
+	specs, err := layer2.GetLinkSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := newBuilder()
+	_, root, _ := builder.ObjectAsNode(rootLayer.GetSchemaRootNode(), nil)
+	SetNodeID(root, "https://root2")
+	builder.RawValueAsNode(rootLayer.GetAttributeByID("https://idField"), root, "cd-2")
+	if err := builder.recordEntities(GetEntityInfo(builder.GetGraph()), specs); err != nil {
+		t.Fatal(err)
+	}
+	ingest2("https://c", "cd-2")
+	if l := links[len(links)-1]; l != (LinkRecord{From: "https://root2", To: "https://c"}) {
+		t.Errorf("Wrong links: %v", links)
+	}
+}
@@ -33,3 +33,7 @@ var EntityIDFieldsTerm = RegisterStringSliceTerm(NewTerm(LS, "entityIdFields").
 // EntityIDTerm is a string or []string that gives the unique ID of
 // an entity. This is a node property at the root node of an entity
 var EntityIDTerm = RegisterStringSliceTerm(NewTerm(LS, "entityId").SetComposition(OverrideComposition))
+
+// PlaceholderTerm marks the entity root nodes created for references
+// to entities that are not ingested
+var PlaceholderTerm = RegisterBooleanTerm(NewTerm(LS, "placeholder").SetComposition(OverrideComposition))
@@ -0,0 +1,42 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ls
+
+import (
+	"github.com/cloudprivacylabs/opencypher"
+)
+
+// IsFunctionDefined returns true if there is a function with the
+// given name that can be called from openCypher expressions
+func IsFunctionDefined(name string) bool {
+	_, err := opencypher.NewEvalContext(nil).GetFunction([]string{name})
+	return err == nil
+}
+
+// RegisterFunction registers a Go function that can be called from
+// openCypher expressions, including the expressions in
+// transformation scripts. Function names are global, so they should
+// be qualified with a namespace, as in "types.parseDate". This is
+// usually called from init(). Panics if the function name is already
+// in use.
+func RegisterFunction(fn opencypher.Function) {
+	if len(fn.Name) == 0 {
+		panic("Empty function name")
+	}
+	if IsFunctionDefined(fn.Name) {
+		panic("Function already defined: " + fn.Name)
+	}
+	opencypher.RegisterGlobalFunc(fn)
+}
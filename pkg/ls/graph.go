@@ -168,10 +168,15 @@ func IsDocumentEdge(edge *lpg.Edge) bool {
 	return !IsAttributeTreeEdge(edge)
 }
 
-// SortNodes sorts nodes by their node index
+// SortNodes sorts nodes by their node index. Nodes with the same
+// index are sorted by node id.
 func SortNodes(nodes []*lpg.Node) {
 	sort.Slice(nodes, func(i, j int) bool {
-		return GetNodeIndex(nodes[i]) < GetNodeIndex(nodes[j])
+		ix, jx := GetNodeIndex(nodes[i]), GetNodeIndex(nodes[j])
+		if ix != jx {
+			return ix < jx
+		}
+		return GetNodeID(nodes[i]) < GetNodeID(nodes[j])
 	})
 }
 
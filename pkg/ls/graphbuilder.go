@@ -29,6 +29,16 @@ type GraphBuilderOptions struct {
 	// If OnlySchemaAttributes is true, only ingest data points if there is a schema for it.
 	// If OnlySchemaAttributes is false, ingest whether or not there is a schema for it.
 	OnlySchemaAttributes bool
+	// If EntityIndex is set, the entities of the graph are recorded
+	// in the index, and references that cannot be resolved in the
+	// graph are resolved using the index. The links across graphs are
+	// passed to LinkRecordFunc.
+	EntityIndex    PersistentEntityIndex
+	LinkRecordFunc func(LinkRecord)
+	// If set, UnresolvedReferenceFunc is called for every foreign key
+	// that does not resolve to an entity, or resolves to more than one
+	// entity for a reference that is not multi.
+	UnresolvedReferenceFunc func(UnresolvedReference)
 }
 
 // GraphBuilder contains the methods to ingest a graph
@@ -539,6 +549,14 @@ func (gb GraphBuilder) linkNode(spec *LinkSpec, docNode, parentNode, entityRoot
 		docNode.SetProperty(ReferenceFKFor.Name, ReferenceFKFor.MustPropertyValue(spec.TargetEntity))
 		docNode.SetProperty(ReferenceFK.Name, ReferenceFK.MustPropertyValue(foreignKeys[0].ForeignKey))
 	}
+	// The node linked to entities of other graphs
+	crossGraphSource := parentNode
+	switch {
+	case specIsValueNode:
+		crossGraphSource = linkNode
+	case spec.IngestAs != IngestAsEdge && docNode != nil:
+		crossGraphSource = docNode
+	}
 	var nodeProperties map[string]interface{}
 	if spec.IngestAs == IngestAsEdge && docNode != nil {
 		// This document node is removed and a link from the parent to the target is created
@@ -588,10 +606,36 @@ func (gb GraphBuilder) linkNode(spec *LinkSpec, docNode, parentNode, entityRoot
 		return nil
 	}
 	for _, fk := range foreignKeys {
-		ref, err := spec.FindReference(entityInfo, fk.ForeignKey)
+		key, err := spec.NormalizeKey(fk.ForeignKey)
+		if err != nil {
+			return err
+		}
+		if len(key) == 0 {
+			continue
+		}
+		ref, err := spec.FindReference(entityInfo, key)
 		if err != nil {
 			return err
 		}
+		// A placeholder is not a resolved reference
+		unresolved := len(ref) == 0 || isPlaceholder(ref)
+		if unresolved {
+			if gb.options.EntityIndex != nil {
+				found, err := gb.linkAcrossGraphs(spec, crossGraphSource, key)
+				if err != nil {
+					return err
+				}
+				if found {
+					continue
+				}
+			}
+		}
+		if unresolved || (len(ref) > 1 && !spec.Multi) {
+			ref, err = gb.applyReferencePolicy(spec, entityRoot, key, ref, entityInfo)
+			if err != nil {
+				return err
+			}
+		}
 		if len(ref) == 0 {
 			continue
 		}
@@ -608,6 +652,11 @@ func (gb GraphBuilder) LinkNodes(ctx *Context, schema *Layer) error {
 	if err != nil {
 		return err
 	}
+	if gb.options.EntityIndex != nil {
+		if err := gb.recordEntities(entityInfo, specs); err != nil {
+			return err
+		}
+	}
 	if err := gb.LinkNodesWithSpecs(ctx, specs, eix); err != nil {
 		return err
 	}
@@ -618,6 +667,16 @@ func (gb GraphBuilder) LinkNodesWithSpecs(ctx *Context, specs []*LinkSpec, eix E
 	for _, spec := range specs {
 		attrId := GetNodeID(spec.SchemaNode)
 		ctx.GetLogger().Debug(map[string]interface{}{"graphBuilder": "linkNodes", "linking": attrId})
+		// If the foreign keys are normalized, the target entity ids
+		// are normalized the same way
+		specIndex := eix
+		if spec.HasKeyTransform() {
+			var err error
+			specIndex, err = spec.indexTargets(eix)
+			if err != nil {
+				return err
+			}
+		}
 		// Find nodes that are instance of this node
 		parentSchemaNodeID := GetNodeID(spec.ParentSchemaNode)
 		parentDocNodes := GetNodesInstanceOf(gb.targetGraph, parentSchemaNodeID)
@@ -656,12 +715,12 @@ func (gb GraphBuilder) LinkNodesWithSpecs(ctx *Context, specs []*LinkSpec, eix E
 				}
 				// childNode is an instance of attrNode, which is a link
 				childFound = true
-				if err := gb.linkNode(spec, childNode, parent, entityRoot, foreignKeys, eix); err != nil {
+				if err := gb.linkNode(spec, childNode, parent, entityRoot, foreignKeys, specIndex); err != nil {
 					return err
 				}
 			}
 			if !childFound {
-				if err := gb.linkNode(spec, nil, parent, entityRoot, foreignKeys, eix); err != nil {
+				if err := gb.linkNode(spec, nil, parent, entityRoot, foreignKeys, specIndex); err != nil {
 					return err
 				}
 			}
@@ -32,6 +32,21 @@ var HashTerm = StringSliceTerm{NewTerm(LS, "hash").SetComposition(OverrideCompos
 
 type hashSemantics struct{}
 
+// GetHashFunc returns the constructor for the named hash
+// function. The name is one of sha256, sha1, or sha512. Empty name
+// defaults to sha256.
+func GetHashFunc(name string) (func() hash.Hash, error) {
+	switch name {
+	case "sha256", "":
+		return sha256.New, nil
+	case "sha1":
+		return sha1.New, nil
+	case "sha512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("Unknown hash function: %s", name)
+}
+
 // ProcessNodePostDocIngest will search for nodes that are instances of
 // the schema node ids given in the docnode, get a hash of those, and
 // populate this node value with that hash
@@ -42,12 +57,34 @@ func (hashSemantics) ProcessNodePostDocIngest(schemaRootNode, schemaNode *lpg.No
 	if ix != -1 {
 		hashFunc = termName[ix+1:]
 	}
+	collected := CollectReferencedValues(schemaRootNode, docNode, term.AsStringSlice())
+	newHash, err := GetHashFunc(hashFunc)
+	if err != nil {
+		return err
+	}
+	h := newHash()
+	for _, values := range collected {
+		for _, y := range values {
+			h.Write([]byte(y))
+		}
+	}
+	value := fmt.Sprintf("%x", h.Sum(nil))
+	SetRawNodeValue(docNode, value)
+	SetEntityIDVectorElementFromNode(docNode, value)
+	return nil
+}
+
+// CollectReferencedValues finds the instances of the given schema
+// node ids in the entity containing docNode, and returns their
+// values. The returned slice is in the same order as schemaNodeIDs,
+// and each element contains the values of all instances of that
+// schema node in the entity.
+func CollectReferencedValues(schemaRootNode, docNode *lpg.Node, schemaNodeIDs []string) [][]string {
 	entityRoot := GetEntityRoot(docNode)
-	nodes := term.AsStringSlice()
 	schemaNodes := make(map[string]*lpg.Node)
 	IterateDescendants(schemaRootNode, func(node *lpg.Node) bool {
 		id := GetNodeID(node)
-		for _, n := range nodes {
+		for _, n := range schemaNodeIDs {
 			if id == n {
 				schemaNodes[id] = node
 				break
@@ -55,9 +92,9 @@ func (hashSemantics) ProcessNodePostDocIngest(schemaRootNode, schemaNode *lpg.No
 		}
 		return true
 	}, SkipDocumentNodes, false)
-	refs := make([]AttributeReference, len(nodes))
-	for i := range nodes {
-		sch := schemaNodes[nodes[i]]
+	refs := make([]AttributeReference, len(schemaNodeIDs))
+	for i := range schemaNodeIDs {
+		sch := schemaNodes[schemaNodeIDs[i]]
 		if sch != nil {
 			ref, exists := GetAttributeReferenceBySchemaNode(schemaRootNode, sch, entityRoot)
 			if exists {
@@ -87,30 +124,15 @@ func (hashSemantics) ProcessNodePostDocIngest(schemaRootNode, schemaNode *lpg.No
 		}
 		return true
 	}, FollowEdgesInEntity, false)
-	var h hash.Hash
-	switch hashFunc {
-	case "sha256", "":
-		h = sha256.New()
-	case "sha1":
-		h = sha1.New()
-	case "sha512":
-		h = sha512.New()
-	default:
-		return fmt.Errorf("Unknown hash function: %s", hashFunc)
-	}
+	ret := make([][]string, len(refs))
 	for i, x := range refs {
 		var key string
 		if x.IsProperty() {
 			key = SchemaNodeIDTerm.PropertyValue(x.Node)
 		} else {
-			key = nodes[i]
-		}
-		for _, y := range collected[key] {
-			h.Write([]byte(y))
+			key = schemaNodeIDs[i]
 		}
+		ret[i] = collected[key]
 	}
-	value := fmt.Sprintf("%x", h.Sum(nil))
-	SetRawNodeValue(docNode, value)
-	SetEntityIDVectorElementFromNode(docNode, value)
-	return nil
+	return ret
 }
@@ -16,8 +16,10 @@ package ls
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/opencypher"
 )
 
 /*
@@ -44,6 +46,8 @@ import (
       "ingestAs": "edge" or "node"
       "linkNode": "nodeId to create the link if aField is a value field",
       "label": "edgeLabel" if ingestAs=edge
+      "fkNormalize": ["trim|zeroPad:8"] // Normalization for each fk
+      "fkExpr": "return key[0] + '-' + key[1]" // Key computed from normalized fks
     }
   }
 
@@ -77,8 +81,48 @@ var (
 
 	// ReferenceMultiTerm specifies if there can be more than one link targets
 	ReferenceMultiTerm = RegisterStringTerm(NewTerm(LS+"Reference/", "multi").SetComposition(OverrideComposition).SetTags(SchemaElementTag))
+
+	// ReferencePolicyTerm specifies what to do if a foreign key does
+	// not resolve to an entity, or resolves to more than one entity
+	// when multi is false. One of fail, skip, createPlaceholder, or
+	// linkAll. Default is linkAll.
+	ReferencePolicyTerm = RegisterStringTerm(NewTerm(LS+"Reference/", "policy").SetComposition(OverrideComposition).SetTags(SchemaElementTag))
+)
+
+// Reference policies for unresolved and ambiguous references
+const (
+	// ReferencePolicyFail returns an error
+	ReferencePolicyFail = "fail"
+	// ReferencePolicySkip does not link unresolved or ambiguous references
+	ReferencePolicySkip = "skip"
+	// ReferencePolicyCreatePlaceholder links unresolved references to a
+	// new placeholder entity, and ambiguous references to all targets
+	ReferencePolicyCreatePlaceholder = "createPlaceholder"
+	// ReferencePolicyLinkAll skips unresolved references, and links
+	// ambiguous references to all targets
+	ReferencePolicyLinkAll = "linkAll"
 )
 
+// UnresolvedReference describes a foreign key that did not resolve
+// to an entity, or that resolved to more than one entity when the
+// reference is not multi
+type UnresolvedReference struct {
+	// SchemaNodeID is the id of the reference schema node
+	SchemaNodeID string   `json:"schemaNodeId"`
+	TargetEntity string   `json:"targetEntity"`
+	ForeignKey   []string `json:"foreignKey"`
+	// SourceEntity is the node id of the entity containing the reference
+	SourceEntity string `json:"sourceEntity"`
+	// Targets are the node ids of the entities matching the foreign
+	// key. Empty if the reference is unresolved.
+	Targets []string `json:"targets,omitempty"`
+	// Policy is the policy applied to the reference
+	Policy string `json:"policy"`
+}
+
+// IsAmbiguous returns true if the foreign key matched more than one entity
+func (u UnresolvedReference) IsAmbiguous() bool { return len(u.Targets) > 1 }
+
 type ForeignKeyInfo struct {
 	DocumentNodes []*lpg.Node
 	ForeignKey    []string
@@ -107,6 +151,14 @@ func (err ErrCannotResolveLink) Error() string {
 	return fmt.Sprintf("Cannot resolve link: %+v", LinkSpec(err))
 }
 
+// ErrUnresolvedReference is returned for an unresolved reference if
+// the reference policy is fail
+type ErrUnresolvedReference UnresolvedReference
+
+func (err ErrUnresolvedReference) Error() string {
+	return fmt.Sprintf("Cannot resolve reference %s to %s with foreign key %v in %s", err.SchemaNodeID, err.TargetEntity, err.ForeignKey, err.SourceEntity)
+}
+
 type ErrInvalidForeignKeys struct {
 	Spec LinkSpec
 	Msg  string
@@ -136,6 +188,12 @@ type LinkSpec struct {
 	Multi bool
 	// IngestAs node or edge
 	IngestAs string
+	// Policy for unresolved and ambiguous references
+	Policy string
+	// FKNormalize are the normalization functions for foreign keys
+	FKNormalize []KeyNormalizer
+	// FKExpr computes the key from the normalized foreign keys
+	FKExpr opencypher.Evaluatable
 
 	// Initialized when linkSpec is initialized
 	ParentSchemaNode *lpg.Node
@@ -173,6 +231,14 @@ func GetLinkSpec(schemaNode *lpg.Node) (*LinkSpec, error) {
 	ret.Label = ReferenceLabelTerm.PropertyValue(schemaNode)
 	s := ReferenceMultiTerm.PropertyValue(schemaNode)
 	ret.Multi = s != "false"
+	ret.Policy = ReferencePolicyTerm.PropertyValue(schemaNode)
+	switch ret.Policy {
+	case "":
+		ret.Policy = ReferencePolicyLinkAll
+	case ReferencePolicyFail, ReferencePolicySkip, ReferencePolicyCreatePlaceholder, ReferencePolicyLinkAll:
+	default:
+		return nil, ErrInvalidLinkSpec{ID: GetNodeID(schemaNode), Msg: "Policy is not one of: `fail`, `skip`, `createPlaceholder`, `linkAll`"}
+	}
 	if len(ret.Label) == 0 {
 		ret.Label = AttributeNameTerm.PropertyValue(schemaNode)
 	}
@@ -201,6 +267,9 @@ func GetLinkSpec(schemaNode *lpg.Node) (*LinkSpec, error) {
 			ret.FK = []string{GetNodeID(schemaNode)}
 		}
 	}
+	if err := ret.initKeyTransform(schemaNode); err != nil {
+		return nil, err
+	}
 	// Found a link spec. Find corresponding parent nodes in the document
 	ret.ParentSchemaNode = GetParentAttribute(schemaNode)
 	schemaNode.SetProperty("$linkSpec", &ret)
@@ -248,12 +317,74 @@ func (spec *LinkSpec) GetForeignKeys(entityRoot *lpg.Node) ([]ForeignKeyInfo, er
 	foreignKeyInfo := make([]ForeignKeyInfo, numKeys)
 	for i := 0; i < numKeys; i++ {
 		for key := 0; key < len(spec.FK); key++ {
-			v, _ := GetRawNodeValue(foreignKeyNodes[i][key])
-			foreignKeyInfo[i] = ForeignKeyInfo{
-				DocumentNodes: []*lpg.Node{foreignKeyNodes[i][key]},
-				ForeignKey:    []string{v},
-			}
+			v, _ := GetRawNodeValue(foreignKeyNodes[key][i])
+			foreignKeyInfo[i].DocumentNodes = append(foreignKeyInfo[i].DocumentNodes, foreignKeyNodes[key][i])
+			foreignKeyInfo[i].ForeignKey = append(foreignKeyInfo[i].ForeignKey, v)
 		}
 	}
 	return foreignKeyInfo, nil
 }
+
+// isPlaceholder returns true if the targets are placeholder entities
+func isPlaceholder(targets []*lpg.Node) bool {
+	for _, t := range targets {
+		if !PlaceholderTerm.PropertyValue(t) {
+			return false
+		}
+	}
+	return len(targets) > 0
+}
+
+// applyReferencePolicy reports an unresolved or ambiguous reference,
+// and returns the entities to link based on the reference policy. A
+// reference resolving to a placeholder entity is reported as
+// unresolved.
+func (gb GraphBuilder) applyReferencePolicy(spec *LinkSpec, entityRoot *lpg.Node, fk []string, targets []*lpg.Node, entityInfo EntityInfoIndex) ([]*lpg.Node, error) {
+	var placeholders []*lpg.Node
+	if isPlaceholder(targets) {
+		placeholders, targets = targets, nil
+	}
+	report := UnresolvedReference{
+		SchemaNodeID: GetNodeID(spec.SchemaNode),
+		TargetEntity: spec.TargetEntity,
+		ForeignKey:   fk,
+		SourceEntity: GetNodeID(entityRoot),
+		Policy:       spec.Policy,
+	}
+	for _, t := range targets {
+		report.Targets = append(report.Targets, GetNodeID(t))
+	}
+	if gb.options.UnresolvedReferenceFunc != nil {
+		gb.options.UnresolvedReferenceFunc(report)
+	}
+	switch spec.Policy {
+	case ReferencePolicyFail:
+		if len(targets) == 0 {
+			return nil, ErrUnresolvedReference(report)
+		}
+		return nil, ErrMultipleTargetsFound{ID: fmt.Sprintf("%s %v", report.SchemaNodeID, fk)}
+	case ReferencePolicySkip:
+		return nil, nil
+	case ReferencePolicyCreatePlaceholder:
+		if len(placeholders) > 0 {
+			return placeholders, nil
+		}
+		if len(targets) == 0 {
+			return []*lpg.Node{gb.newPlaceholderEntity(spec, fk, entityInfo)}, nil
+		}
+	}
+	return targets, nil
+}
+
+// newPlaceholderEntity creates an entity root node for a target
+// entity that is not ingested, and adds it to the entity index so
+// other references to the same entity link to it
+func (gb GraphBuilder) newPlaceholderEntity(spec *LinkSpec, fk []string, entityInfo EntityInfoIndex) *lpg.Node {
+	node := gb.targetGraph.NewNode([]string{DocumentNodeTerm.Name}, nil)
+	SetNodeID(node, spec.TargetEntity+"#"+strings.Join(fk, ","))
+	node.SetProperty(EntitySchemaTerm.Name, EntitySchemaTerm.MustPropertyValue(spec.TargetEntity))
+	node.SetProperty(EntityIDTerm.Name, EntityIDTerm.MustPropertyValue(fk))
+	node.SetProperty(PlaceholderTerm.Name, PlaceholderTerm.MustPropertyValue(true))
+	entityInfo.add(spec.TargetEntity, entityInfo.getFkHash(fk), node)
+	return node
+}
@@ -160,3 +160,138 @@ func TestValueLink(t *testing.T) {
 	}
 
 }
+
+func compileLinkTestLayers(t *testing.T, files ...string) []*Layer {
+	schemas := make([]*Layer, len(files))
+	for i, x := range files {
+		var err error
+		schemas[i], err = ReadLayerFromFile(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	compiler := Compiler{
+		Loader: SchemaLoaderFunc(func(ref string) (*Layer, error) {
+			for i := range schemas {
+				if ref == schemas[i].GetID() {
+					return schemas[i], nil
+				}
+			}
+			return nil, fmt.Errorf("Not found: %s", ref)
+		}),
+	}
+	ret := make([]*Layer, len(schemas))
+	for i := range schemas {
+		var err error
+		ret[i], err = compiler.Compile(DefaultContext(), schemas[i].GetID())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ret
+}
+
+func TestReferencePolicy(t *testing.T) {
+	run := func(policy string) (GraphBuilder, []UnresolvedReference, error) {
+		layers := compileLinkTestLayers(t, "testdata/link_1/root.json", "testdata/link_1/2.json")
+		layers[1].GetAttributeByID("https://test_ref").SetProperty(ReferencePolicyTerm.Name, ReferencePolicyTerm.MustPropertyValue(policy))
+		report := make([]UnresolvedReference, 0)
+		builder := NewGraphBuilder(nil, GraphBuilderOptions{
+			EmbedSchemaNodes:        true,
+			UnresolvedReferenceFunc: func(u UnresolvedReference) { report = append(report, u) },
+		})
+		_, root1, _ := builder.ObjectAsNode(layers[0].GetSchemaRootNode(), nil)
+		builder.RawValueAsNode(layers[0].GetAttributeByID("https://idField"), root1, "123")
+		for _, id := range []string{"a", "b"} {
+			_, root, _ := builder.ObjectAsNode(layers[1].GetSchemaRootNode(), nil)
+			SetNodeID(root, id)
+			builder.RawValueAsNode(layers[1].GetAttributeByID("idField"), root, id)
+			builder.RawValueAsNode(layers[1].GetAttributeByID("https://rootid"), root, "999")
+		}
+		err := builder.LinkNodes(DefaultContext(), layers[1])
+		return builder, report, err
+	}
+
+	_, report, err := run(ReferencePolicyFail)
+	if _, ok := err.(ErrUnresolvedReference); !ok {
+		t.Errorf("Expecting unresolved reference error, got %v", err)
+	}
+	if len(report) != 1 || report[0].IsAmbiguous() {
+		t.Errorf("Wrong report: %+v", report)
+	}
+
+	builder, report, err := run(ReferencePolicySkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 2 || !reflect.DeepEqual(report[1].ForeignKey, []string{"999"}) || report[1].TargetEntity != "https://root" {
+		t.Errorf("Wrong report: %+v", report)
+	}
+	if n := len(lpg.NodeSlice(builder.GetGraph().GetNodesWithProperty(PlaceholderTerm.Name))); n != 0 {
+		t.Errorf("Unexpected placeholders: %d", n)
+	}
+
+	builder, report, err = run(ReferencePolicyCreatePlaceholder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	placeholders := lpg.NodeSlice(builder.GetGraph().GetNodesWithProperty(PlaceholderTerm.Name))
+	if len(placeholders) != 1 {
+		t.Fatalf("Expecting 1 placeholder, got %d", len(placeholders))
+	}
+	if !reflect.DeepEqual(EntityIDTerm.PropertyValue(placeholders[0]), []string{"999"}) {
+		t.Errorf("Wrong placeholder id")
+	}
+	// Both references are reported, the second links to the placeholder
+	if len(report) != 2 || len(report[1].Targets) != 0 || !reflect.DeepEqual(report[1].ForeignKey, []string{"999"}) {
+		t.Errorf("Wrong report: %+v", report)
+	}
+	if n := len(lpg.EdgeSlice(placeholders[0].GetEdges(lpg.OutgoingEdge))); n != 2 {
+		t.Errorf("Expecting 2 links from placeholder, got %d", n)
+	}
+}
+
+func TestLinkKeyNormalization(t *testing.T) {
+	layers := compileLinkTestLayers(t, "testdata/link_1/root.json", "testdata/link_1/2.json")
+	ref := layers[1].GetAttributeByID("https://test_ref")
+	ref.SetProperty(ReferenceFKNormalizeTerm.Name, ReferenceFKNormalizeTerm.MustPropertyValue([]string{"digits|zeroPad:6"}))
+	ref.SetProperty(ReferenceFKExprTerm.Name, ReferenceFKExprTerm.MustPropertyValue("return 'MRN' + key[0]"))
+	builder := NewGraphBuilder(nil, GraphBuilderOptions{
+		EmbedSchemaNodes: true,
+	})
+	_, root1, _ := builder.ObjectAsNode(layers[0].GetSchemaRootNode(), nil)
+	builder.RawValueAsNode(layers[0].GetAttributeByID("https://idField"), root1, "123")
+	_, root2, _ := builder.ObjectAsNode(layers[1].GetSchemaRootNode(), nil)
+	builder.RawValueAsNode(layers[1].GetAttributeByID("idField"), root2, "456")
+	builder.RawValueAsNode(layers[1].GetAttributeByID("https://rootid"), root2, " 00-0123")
+	if err := builder.LinkNodes(DefaultContext(), layers[1]); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for edges := root1.GetEdges(lpg.OutgoingEdge); edges.Next(); {
+		if edges.Edge().GetTo() == root2 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("No edges from root1 to root2")
+	}
+
+	spec := &LinkSpec{SchemaNode: ref, FK: []string{"a", "b"}}
+	ref.SetProperty(ReferenceFKNormalizeTerm.Name, ReferenceFKNormalizeTerm.MustPropertyValue([]string{"trim|upper", "zeroPad:3"}))
+	ref.SetProperty(ReferenceFKExprTerm.Name, ReferenceFKExprTerm.MustPropertyValue("return key[0] + '-' + key[1]"))
+	if err := spec.initKeyTransform(ref); err != nil {
+		t.Fatal(err)
+	}
+	key, err := spec.NormalizeKey([]string{" ab ", "7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(key, []string{"AB-007"}) {
+		t.Errorf("Wrong key: %v", key)
+	}
+	ref.SetProperty(ReferenceFKNormalizeTerm.Name, ReferenceFKNormalizeTerm.MustPropertyValue([]string{"unknown"}))
+	if err := (&LinkSpec{SchemaNode: ref}).initKeyTransform(ref); err == nil {
+		t.Errorf("Expecting error for unknown normalizer")
+	}
+}
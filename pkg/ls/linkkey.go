@@ -0,0 +1,215 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ls
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/opencypher"
+)
+
+var (
+	// ReferenceFKNormalizeTerm gives the normalization functions for
+	// the foreign key values. Each element applies to the foreign key
+	// at the same position. If there is only one element, it applies
+	// to all foreign keys. An element is a list of functions
+	// separated by '|', applied in order:
+	//
+	//	trim: Remove leading and trailing space
+	//	lower, upper: Change case
+	//	digits: Remove all characters except digits
+	//	alnum: Remove all characters except letters and digits
+	//	stripZeros: Remove leading zeros
+	//	zeroPad:<n>: Pad with leading zeros to n characters
+	//
+	// The entity ids of the target entities are normalized the same way.
+	//
+	//	"fkNormalize": ["trim|zeroPad:8"]
+	ReferenceFKNormalizeTerm = RegisterStringSliceTerm(NewTerm(LS+"Reference/", "fkNormalize").SetComposition(OverrideComposition).SetTags(SchemaElementTag))
+
+	// ReferenceFKExprTerm gives an opencypher expression that computes
+	// the key from the normalized foreign key values given in the
+	// `key` list variable. The same expression computes the key of
+	// the target entities from their entity ids.
+	//
+	//	"fkExpr": "return key[0] + '-' + key[1]"
+	ReferenceFKExprTerm = RegisterStringTerm(NewTerm(LS+"Reference/", "fkExpr").SetComposition(OverrideComposition).SetTags(SchemaElementTag))
+)
+
+// KeyNormalizer normalizes a key value
+type KeyNormalizer func(string) string
+
+var keyNormalizers = map[string]KeyNormalizer{
+	"trim":  strings.TrimSpace,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"digits": func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, s)
+	},
+	"alnum": func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) || unicode.IsLetter(r) {
+				return r
+			}
+			return -1
+		}, s)
+	},
+	"stripZeros": func(s string) string {
+		return strings.TrimLeft(s, "0")
+	},
+}
+
+// RegisterKeyNormalizer registers a named key normalization function
+// that can be used in Reference/fkNormalize
+func RegisterKeyNormalizer(name string, f KeyNormalizer) {
+	keyNormalizers[name] = f
+}
+
+// parseKeyNormalizer parses a '|' separated list of normalization
+// functions into a single function
+func parseKeyNormalizer(spec string) (KeyNormalizer, error) {
+	funcs := make([]KeyNormalizer, 0)
+	for _, name := range strings.Split(spec, "|") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		if strings.HasPrefix(name, "zeroPad:") {
+			n, err := strconv.Atoi(strings.TrimPrefix(name, "zeroPad:"))
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("Invalid key normalizer: %s", name)
+			}
+			funcs = append(funcs, func(s string) string {
+				if len(s) >= n {
+					return s
+				}
+				return strings.Repeat("0", n-len(s)) + s
+			})
+			continue
+		}
+		f, ok := keyNormalizers[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown key normalizer: %s", name)
+		}
+		funcs = append(funcs, f)
+	}
+	return func(s string) string {
+		for _, f := range funcs {
+			s = f(s)
+		}
+		return s
+	}, nil
+}
+
+// initKeyTransform parses the key normalization and expression terms
+// of the schema node
+func (spec *LinkSpec) initKeyTransform(schemaNode *lpg.Node) error {
+	for _, n := range ReferenceFKNormalizeTerm.PropertyValue(schemaNode) {
+		f, err := parseKeyNormalizer(n)
+		if err != nil {
+			return ErrInvalidLinkSpec{ID: GetNodeID(schemaNode), Msg: err.Error()}
+		}
+		spec.FKNormalize = append(spec.FKNormalize, f)
+	}
+	if len(spec.FKNormalize) > 1 && len(spec.FKNormalize) != len(spec.FK) {
+		return ErrInvalidLinkSpec{ID: GetNodeID(schemaNode), Msg: "Number of fkNormalize elements does not match the foreign keys"}
+	}
+	if expr := ReferenceFKExprTerm.PropertyValue(schemaNode); len(expr) > 0 {
+		e, err := opencypher.Parse(expr)
+		if err != nil {
+			return ErrInvalidLinkSpec{ID: GetNodeID(schemaNode), Msg: err.Error()}
+		}
+		spec.FKExpr = e
+	}
+	return nil
+}
+
+// HasKeyTransform returns true if the foreign keys are normalized or
+// computed using an expression
+func (spec *LinkSpec) HasKeyTransform() bool {
+	return len(spec.FKNormalize) > 0 || spec.FKExpr != nil
+}
+
+// NormalizeKey applies the key normalization functions and the key
+// expression to the key values. The result is compared to the
+// target entity ids that are normalized the same way.
+func (spec *LinkSpec) NormalizeKey(key []string) ([]string, error) {
+	if !spec.HasKeyTransform() {
+		return key, nil
+	}
+	ret := make([]string, len(key))
+	for i, k := range key {
+		switch {
+		case len(spec.FKNormalize) == 1:
+			ret[i] = spec.FKNormalize[0](k)
+		case i < len(spec.FKNormalize):
+			ret[i] = spec.FKNormalize[i](k)
+		default:
+			ret[i] = k
+		}
+	}
+	if spec.FKExpr == nil {
+		return ret, nil
+	}
+	values := make([]opencypher.Value, 0, len(ret))
+	for _, k := range ret {
+		values = append(values, opencypher.ValueOf(k))
+	}
+	evalctx := opencypher.NewEvalContext(nil)
+	evalctx.SetVar("key", opencypher.ValueOf(values))
+	result, err := spec.FKExpr.Evaluate(evalctx)
+	if err != nil {
+		return nil, err
+	}
+	rs, ok := result.Get().(opencypher.ResultSet)
+	if !ok || len(rs.Rows) != 1 || len(rs.Rows[0]) != 1 {
+		return nil, ErrInvalidLinkSpec{ID: GetNodeID(spec.SchemaNode), Msg: "Key expression must return a single value"}
+	}
+	for _, v := range rs.Rows[0] {
+		if v.Get() == nil {
+			return nil, nil
+		}
+		return []string{fmt.Sprint(v.Get())}, nil
+	}
+	return nil, nil
+}
+
+// indexTargets returns an entity index for the target entities of
+// the spec keyed by their normalized entity ids
+func (spec *LinkSpec) indexTargets(eix EntityInfoIndex) (EntityInfoIndex, error) {
+	ret := EntityInfoIndex{indexByType: make(map[string]map[string][]*lpg.Node)}
+	for _, nodes := range eix.indexByType[spec.TargetEntity] {
+		for _, node := range nodes {
+			key, err := spec.NormalizeKey(EntityIDTerm.PropertyValue(node))
+			if err != nil {
+				return ret, err
+			}
+			if len(key) == 0 {
+				continue
+			}
+			ret.add(spec.TargetEntity, ret.getFkHash(key), node)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ls
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+)
+
+// IRILastSegment returns the last part of an IRI, after the last '/',
+// '#', or ':'
+func IRILastSegment(id string) string {
+	id = strings.TrimRight(id, "/#")
+	if ix := strings.LastIndexAny(id, "/#:"); ix != -1 {
+		id = id[ix+1:]
+	}
+	return id
+}
+
+// GetAttributeLocalName returns the attributeName of the schema
+// attribute, or the last part of the attribute id
+func GetAttributeLocalName(node *lpg.Node) string {
+	if name := AttributeNameTerm.PropertyValue(node); len(name) > 0 {
+		return name
+	}
+	return IRILastSegment(GetNodeID(node))
+}
+
+// GetDescription returns the description of the node. Multiple
+// descriptions are joined by newlines.
+func GetDescription(node *lpg.Node) string {
+	pv, ok := GetPropertyValue(node, DescriptionTerm.Name)
+	if !ok {
+		return ""
+	}
+	return strings.Join(pv.AsStringSlice(), "\n")
+}
+
+// SplitWords splits a name into words. Word boundaries are
+// non-alphanumeric characters, lower-to-upper case transitions, and
+// the last capital of an upper case prefix followed by a lower case
+// letter, so "HTTPRequest" is split into "HTTP" and "Request".
+func SplitWords(name string) []string {
+	words := make([]string, 0)
+	word := make([]rune, 0)
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prev := runes[i-1]
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(prev)) {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
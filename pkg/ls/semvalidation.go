@@ -108,6 +108,80 @@ func ValidateValueBySchema(v *string, schemaNode *lpg.Node) error {
 	return err
 }
 
+// ValidateGraph runs the validators of the layer attributes for the
+// document nodes of the graph, and calls f for every validation
+// error. Unlike ValidateDocumentNodeBySchema, it does not stop at the
+// first error of a node. The validators are also called with a nil
+// document node for the attributes missing from their parent
+// document nodes, so required attributes are checked. Validation
+// stops if f returns false.
+func ValidateGraph(g *lpg.Graph, layer *Layer, f func(docNode, schemaNode *lpg.Node, err error) bool) {
+	validate := func(docNode, schemaNode *lpg.Node) bool {
+		var nodeValue *string
+		if docNode != nil {
+			if v, ok := GetRawNodeValue(docNode); ok {
+				nodeValue = &v
+			}
+		}
+		cont := true
+		schemaNode.ForEachProperty(func(key string, value interface{}) bool {
+			nval, vval := GetAttributeValidator(key)
+			if err := nval.ValidateNode(docNode, schemaNode); err != nil {
+				if cont = f(docNode, schemaNode, err); !cont {
+					return false
+				}
+			}
+			// Node validators usually validate the value as well. Call
+			// value validator only if this is not a node validator
+			if _, ok := nval.(nopValidator); !ok {
+				return true
+			}
+			if err := vval.ValidateValue(nodeValue, schemaNode); err != nil {
+				cont = f(docNode, schemaNode, err)
+			}
+			return cont
+		})
+		return cont
+	}
+	root := layer.GetSchemaRootNode()
+	if root == nil {
+		return
+	}
+	withValidators := GetNodesWithValidators(root)
+	schemaNodes := make([]*lpg.Node, 0, len(withValidators))
+	ForEachAttributeNodeOrdered(root, func(node *lpg.Node, _ []*lpg.Node) bool {
+		if _, ok := withValidators[node]; ok {
+			schemaNodes = append(schemaNodes, node)
+		}
+		return true
+	})
+	for _, schemaNode := range schemaNodes {
+		schemaNodeID := GetNodeID(schemaNode)
+		parent := GetParentAttribute(schemaNode)
+		if parent == nil {
+			for _, docNode := range GetNodesInstanceOf(g, schemaNodeID) {
+				if !validate(docNode, schemaNode) {
+					return
+				}
+			}
+			continue
+		}
+		for _, parentDocNode := range GetNodesInstanceOf(g, GetNodeID(parent)) {
+			children := FindChildInstanceOf(parentDocNode, schemaNodeID)
+			if len(children) == 0 && !parent.HasLabel(AttributeTypeArray.Name) {
+				if !validate(nil, schemaNode) {
+					return
+				}
+			}
+			for _, docNode := range children {
+				if !validate(docNode, schemaNode) {
+					return
+				}
+			}
+		}
+	}
+}
+
 // ErrValidatorCompile is returned for validator compilation errors
 type ErrValidatorCompile struct {
 	Validator string
@@ -16,6 +16,9 @@ package ls
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/cloudprivacylabs/lpg/v2"
 	"github.com/cloudprivacylabs/opencypher"
@@ -35,6 +38,10 @@ type ValuesetLookupRequest struct {
 // inserted into the graph
 type ValuesetLookupResponse struct {
 	KeyValues map[string]string
+	// Score is the confidence of the match, between 0 and 1. If the
+	// lookup does not compute a match score, this is 0 and no score is
+	// written to the graph
+	Score float64
 }
 
 var (
@@ -91,6 +98,12 @@ var (
 	// will be added. This is needed if the results will be added under
 	// a different entity attached to the valueset context.
 	ValuesetResultContextTerm = RegisterStringTerm(NewTerm(LS, "vs/resultContext").SetComposition(OverrideComposition).SetTags(SchemaElementTag))
+
+	// ValuesetMatchScoreTerm is set on the document nodes receiving
+	// valueset lookup results if the lookup returned a match
+	// score. Downstream steps can use this to filter low-confidence
+	// mappings.
+	ValuesetMatchScoreTerm = RegisterFloatTerm(NewTerm(LS, "vs/matchScore").SetComposition(OverrideComposition))
 )
 
 // ValuesetInfo describes value set information for a schema node.
@@ -450,7 +463,7 @@ func (vsi *ValuesetInfo) findResultNodes(contextDocumentNode, contextSchemaNode,
 				depth = i + 1
 				if i == len(idPath)-1 {
 					// Found the node
-					resultNodes = []*lpg.Node{path[i]}
+					resultNodes = []*lpg.Node{node}
 					return false
 				}
 				// Found an ancestor
@@ -464,15 +477,26 @@ func (vsi *ValuesetInfo) findResultNodes(contextDocumentNode, contextSchemaNode,
 	return
 }
 
-func (vsi *ValuesetInfo) createResultNodes(ctx *Context, builder GraphBuilder, layer *Layer, contextDocumentNode, contextSchemaNode *lpg.Node, resultSchemaNodeID string, resultValue string) error {
+// setMatchScore records the match score of the lookup result on the
+// result node
+func setMatchScore(node *lpg.Node, score float64) {
+	if node == nil || score == 0 {
+		return
+	}
+	node.SetProperty(ValuesetMatchScoreTerm.Name, ValuesetMatchScoreTerm.MustPropertyValue(score))
+}
+
+// createResultNodes creates or updates the result node, and returns
+// it. If the result is ingested as a property, returns nil.
+func (vsi *ValuesetInfo) createResultNodes(ctx *Context, builder GraphBuilder, layer *Layer, contextDocumentNode, contextSchemaNode *lpg.Node, resultSchemaNodeID string, resultValue string) (*lpg.Node, error) {
 	// There is value. If there is a node, update it. Otherwise, insert it
 	resultSchemaNode := layer.GetAttributeByID(resultSchemaNodeID)
 	if resultSchemaNode == nil {
-		return ErrValueset{SchemaNodeID: vsi.ContextID, Msg: fmt.Sprintf("Target schema node %s does not exist in layer", resultSchemaNodeID)}
+		return nil, ErrValueset{SchemaNodeID: vsi.ContextID, Msg: fmt.Sprintf("Target schema node %s does not exist in layer", resultSchemaNodeID)}
 	}
 	resultParent, resultNodes, err := vsi.findResultNodes(contextDocumentNode, contextSchemaNode, resultSchemaNode)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	switch len(resultNodes) {
@@ -484,7 +508,7 @@ func (vsi *ValuesetInfo) createResultNodes(ctx *Context, builder GraphBuilder, l
 		}
 		switch GetIngestAs(resultSchemaNode) {
 		case "node":
-			_, err := EnsurePath(contextDocumentNode, nil, contextSchemaNode, resultSchemaNode, func(parentDocNode, childSchemaNode *lpg.Node) (*lpg.Node, error) {
+			resultNode, err := EnsurePath(contextDocumentNode, nil, contextSchemaNode, resultSchemaNode, func(parentDocNode, childSchemaNode *lpg.Node) (*lpg.Node, error) {
 				if GetNodeID(childSchemaNode) == resultSchemaNodeID {
 					_, n, err := builder.RawValueAsNode(childSchemaNode, parentDocNode, resultValue)
 					if err != nil {
@@ -498,29 +522,34 @@ func (vsi *ValuesetInfo) createResultNodes(ctx *Context, builder GraphBuilder, l
 				return newNode, nil
 			})
 			if err != nil {
-				return ErrValueset{SchemaNodeID: vsi.ContextID, Msg: fmt.Sprintf("Cannot create path: %s", err.Error())}
+				return nil, ErrValueset{SchemaNodeID: vsi.ContextID, Msg: fmt.Sprintf("Cannot create path: %s", err.Error())}
 			}
+			return resultNode, nil
 
 		case "edge":
-			_, err := builder.RawValueAsEdge(resultSchemaNode, parent, resultValue)
+			edge, err := builder.RawValueAsEdge(resultSchemaNode, parent, resultValue)
 			if err != nil {
-				return ErrValueset{SchemaNodeID: vsi.ContextID, Msg: fmt.Sprintf("Cannot create new node: %s", err.Error())}
+				return nil, ErrValueset{SchemaNodeID: vsi.ContextID, Msg: fmt.Sprintf("Cannot create new node: %s", err.Error())}
+			}
+			if edge != nil {
+				return edge.GetTo(), nil
 			}
 		case "property":
 			err := builder.RawValueAsProperty(resultSchemaNode, []*lpg.Node{parent}, resultValue)
 			if err != nil {
-				return ErrValueset{SchemaNodeID: vsi.ContextID, Msg: fmt.Sprintf("Cannot create new node: %s", err.Error())}
+				return nil, ErrValueset{SchemaNodeID: vsi.ContextID, Msg: fmt.Sprintf("Cannot create new node: %s", err.Error())}
 			}
 		}
 	case 1: // update it
 		switch GetIngestAs(resultSchemaNode) {
 		case "node", "edge":
 			SetRawNodeValue(resultNodes[0], resultValue)
+			return resultNodes[0], nil
 		default:
-			return ErrValueset{SchemaNodeID: vsi.ContextID, Msg: "Cannot update value in property, inconsistent graph"}
+			return nil, ErrValueset{SchemaNodeID: vsi.ContextID, Msg: "Cannot update value in property, inconsistent graph"}
 		}
 	}
-	return nil
+	return nil, nil
 }
 
 func (vsi *ValuesetInfo) ApplyValuesetResponse(ctx *Context, builder GraphBuilder, layer *Layer, contextDocumentNode, contextSchemaNode, resultContextSchemaNode *lpg.Node, result ValuesetLookupResponse) error {
@@ -539,6 +568,7 @@ func (vsi *ValuesetInfo) ApplyValuesetResponse(ctx *Context, builder GraphBuilde
 		for _, v := range result.KeyValues {
 			SetRawNodeValue(contextDocumentNode, v)
 		}
+		setMatchScore(contextDocumentNode, result.Score)
 		return nil
 	}
 	// We have to make sure the context document node that will receive the result exists in the document
@@ -566,9 +596,11 @@ func (vsi *ValuesetInfo) ApplyValuesetResponse(ctx *Context, builder GraphBuilde
 		for _, v := range result.KeyValues {
 			resultValue = v
 		}
-		if err := vsi.createResultNodes(ctx, builder, layer, resultContextDocumentNode, resultContextSchemaNode, resultNodeID, resultValue); err != nil {
+		resultNode, err := vsi.createResultNodes(ctx, builder, layer, resultContextDocumentNode, resultContextSchemaNode, resultNodeID, resultValue)
+		if err != nil {
 			return err
 		}
+		setMatchScore(resultNode, result.Score)
 		return nil
 	}
 	ctx.GetLogger().Debug(map[string]interface{}{"mth": "valueset.keyValues"})
@@ -587,9 +619,11 @@ func (vsi *ValuesetInfo) ApplyValuesetResponse(ctx *Context, builder GraphBuilde
 			}
 			return nil
 		}
-		if err := vsi.createResultNodes(ctx, builder, layer, resultContextDocumentNode, resultContextSchemaNode, resultNodeID, resultValue); err != nil {
+		resultNode, err := vsi.createResultNodes(ctx, builder, layer, resultContextDocumentNode, resultContextSchemaNode, resultNodeID, resultValue)
+		if err != nil {
 			return err
 		}
+		setMatchScore(resultNode, result.Score)
 	}
 	return nil
 }
@@ -603,13 +637,17 @@ func (prc *ValuesetProcessor) ProcessByContextNode(ctx *Context, builder GraphBu
 	ctx.GetLogger().Debug(map[string]interface{}{"mth": "valueset.process", "request": kv})
 	if len(kv) != 0 {
 		// Perform the lookup
-		result, err := prc.lookupFunc(ctx, ValuesetLookupRequest{
+		req := ValuesetLookupRequest{
 			TableIDs:  vsi.TableIDs,
 			KeyValues: kv,
-		})
+		}
+		result, err := prc.lookupFunc(ctx, req)
 		if err != nil {
 			return err
 		}
+		if prc.LookupHook != nil {
+			prc.LookupHook(ctx, req, result, contextDocNode)
+		}
 		ctx.GetLogger().Debug(map[string]interface{}{"mth": "valueset.process", "result": result, "contextDocNode": contextDocNode})
 		// If there is nonzero result, put it back into the doc
 		if len(result.KeyValues) > 0 {
@@ -631,11 +669,23 @@ func (prc *ValuesetProcessor) Process(ctx *Context, builder GraphBuilder, vsiDoc
 	return prc.ProcessByContextNode(ctx, builder, contextDocNode, contextSchemaNode, resultContextSchemaNode, vsiDocNode, vsi)
 }
 
+// ValuesetBatchLookupFunc looks up multiple requests at once. It
+// must return a response for each request, in the same order.
+type ValuesetBatchLookupFunc func(*Context, []ValuesetLookupRequest) ([]ValuesetLookupResponse, error)
+
 type ValuesetProcessor struct {
 	layer      *Layer
 	lookupFunc func(*Context, ValuesetLookupRequest) (ValuesetLookupResponse, error)
 	vsis       []ValuesetInfo
 	tables     []string
+
+	batchLookupFunc ValuesetBatchLookupFunc
+	batchSize       int
+
+	// LookupHook is called for every lookup with the request, the
+	// response, and the context document node of the request. The
+	// response has no key-values if the lookup did not match.
+	LookupHook func(ctx *Context, req ValuesetLookupRequest, rsp ValuesetLookupResponse, contextDocNode *lpg.Node)
 }
 
 func NewValuesetProcessor(layer *Layer, lookupFunc func(*Context, ValuesetLookupRequest) (ValuesetLookupResponse, error), tables []string) (ValuesetProcessor, error) {
@@ -650,6 +700,25 @@ func NewValuesetProcessor(layer *Layer, lookupFunc func(*Context, ValuesetLookup
 	return ret, nil
 }
 
+// NewBatchValuesetProcessor returns a valueset processor that
+// collects the distinct lookup requests of each valueset in the
+// graph, and resolves them using the batch lookup function. At most
+// batchSize requests are passed to the lookup function at once. If
+// batchSize is not positive, all requests of a valueset are passed
+// in one batch.
+func NewBatchValuesetProcessor(layer *Layer, lookupFunc ValuesetBatchLookupFunc, batchSize int, tables []string) (ValuesetProcessor, error) {
+	ret := ValuesetProcessor{
+		layer:           layer,
+		batchLookupFunc: lookupFunc,
+		batchSize:       batchSize,
+		tables:          tables,
+	}
+	if err := ret.init(); err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
 func (prc *ValuesetProcessor) init() error {
 	if prc.vsis != nil {
 		return nil
@@ -742,7 +811,134 @@ func (prc *ValuesetProcessor) ProcessGraphValueset(ctx *Context, builder GraphBu
 func (prc *ValuesetProcessor) ProcessGraph(ctx *Context, builder GraphBuilder) error {
 	ctx.GetLogger().Debug(map[string]interface{}{"mth": "processGraph", "nVSI": len(prc.vsis)})
 	for i := range prc.vsis {
-		if err := prc.ProcessGraphValueset(ctx, builder, &prc.vsis[i]); err != nil {
+		var err error
+		if prc.batchLookupFunc != nil {
+			err = prc.ProcessGraphValuesetBatch(ctx, builder, &prc.vsis[i])
+		} else {
+			err = prc.ProcessGraphValueset(ctx, builder, &prc.vsis[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// valuesetRequestKey returns a string that is the same for equivalent requests
+func valuesetRequestKey(req ValuesetLookupRequest) string {
+	keys := make([]string, 0, len(req.KeyValues))
+	for k := range req.KeyValues {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, t := range req.TableIDs {
+		b.WriteString(strconv.Quote(t))
+	}
+	b.WriteByte(':')
+	for _, k := range keys {
+		b.WriteString(strconv.Quote(k))
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(req.KeyValues[k]))
+	}
+	return b.String()
+}
+
+// ProcessGraphValuesetBatch collects the distinct lookup requests for
+// the valueset in the graph, resolves them using the batch lookup
+// function, and applies the responses.
+func (prc *ValuesetProcessor) ProcessGraphValuesetBatch(ctx *Context, builder GraphBuilder, vsi *ValuesetInfo) error {
+	contextSchemaNode := prc.layer.GetAttributeByID(vsi.ContextID)
+	if contextSchemaNode == nil {
+		ctx.GetLogger().Debug(map[string]interface{}{"mth": "processGraphValuesetBatch", "stage": "No context node", "id": vsi.ContextID})
+		return nil
+	}
+	resultContextSchemaNode := contextSchemaNode
+	if len(vsi.ResultContext) > 0 {
+		resultContextSchemaNode = prc.layer.GetAttributeByID(vsi.ResultContext)
+		if resultContextSchemaNode == nil {
+			ctx.GetLogger().Debug(map[string]interface{}{"mth": "processGraphValuesetBatch", "stage": "No result context node", "id": vsi.ResultContext})
+			return nil
+		}
+	}
+
+	type workItem struct {
+		contextDocNode *lpg.Node
+		request        int
+	}
+	items := make([]workItem, 0)
+	requests := make([]ValuesetLookupRequest, 0)
+	requestIndex := make(map[string]int)
+	addItem := func(contextDocNode, vsiDocNode *lpg.Node) error {
+		kv, err := vsi.GetRequest(ctx, contextDocNode, vsiDocNode)
+		if err != nil {
+			return err
+		}
+		if len(kv) == 0 {
+			return nil
+		}
+		req := ValuesetLookupRequest{TableIDs: vsi.TableIDs, KeyValues: kv}
+		key := valuesetRequestKey(req)
+		ix, ok := requestIndex[key]
+		if !ok {
+			ix = len(requests)
+			requests = append(requests, req)
+			requestIndex[key] = ix
+		}
+		items = append(items, workItem{contextDocNode: contextDocNode, request: ix})
+		return nil
+	}
+
+	vsiDocNodes := vsi.GetDocNodes(builder.GetGraph())
+	if len(vsiDocNodes) == 0 {
+		contextNodes, err := vsi.getContextNodes(builder.GetGraph(), vsi.ContextID)
+		if err != nil {
+			return err
+		}
+		for _, contextNode := range contextNodes {
+			if err := addItem(contextNode, nil); err != nil {
+				return err
+			}
+		}
+	} else {
+		for _, vsiDocNode := range vsiDocNodes {
+			contextDocNode, err := vsi.GetContextNode(vsiDocNode)
+			if err != nil {
+				return err
+			}
+			if err := addItem(contextDocNode, vsiDocNode); err != nil {
+				return err
+			}
+		}
+	}
+	ctx.GetLogger().Debug(map[string]interface{}{"mth": "processGraphValuesetBatch", "vsi": GetNodeID(vsi.SchemaNode), "nItems": len(items), "nRequests": len(requests)})
+
+	responses := make([]ValuesetLookupResponse, 0, len(requests))
+	for start := 0; start < len(requests); {
+		end := len(requests)
+		if prc.batchSize > 0 && start+prc.batchSize < end {
+			end = start + prc.batchSize
+		}
+		rsp, err := prc.batchLookupFunc(ctx, requests[start:end])
+		if err != nil {
+			return err
+		}
+		if len(rsp) != end-start {
+			return ErrValueset{SchemaNodeID: GetNodeID(vsi.SchemaNode), Msg: fmt.Sprintf("Batch lookup returned %d responses for %d requests", len(rsp), end-start)}
+		}
+		responses = append(responses, rsp...)
+		start = end
+	}
+
+	for _, item := range items {
+		result := responses[item.request]
+		if prc.LookupHook != nil {
+			prc.LookupHook(ctx, requests[item.request], result, item.contextDocNode)
+		}
+		if len(result.KeyValues) == 0 {
+			continue
+		}
+		if err := vsi.ApplyValuesetResponse(ctx, builder, prc.layer, item.contextDocNode, contextSchemaNode, resultContextSchemaNode, result); err != nil {
 			return err
 		}
 	}
@@ -15,13 +15,13 @@
 package ls
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/cloudprivacylabs/lpg/v2"
 )
 
-func TestBasicVS(t *testing.T) {
-	schText := `{
+const basicVSSchema = `{
   "nodes": [
     {
       "n": 3,
@@ -92,7 +92,9 @@ func TestBasicVS(t *testing.T) {
   ]
 }
 `
-	layer, err := UnmarshalLayerFromSlice([]byte(schText))
+
+func TestBasicVS(t *testing.T) {
+	layer, err := UnmarshalLayerFromSlice([]byte(basicVSSchema))
 	if err != nil {
 		t.Error(err)
 		return
@@ -105,6 +107,7 @@ func TestBasicVS(t *testing.T) {
 	vsFunc := func(_ *Context, req ValuesetLookupRequest) (ValuesetLookupResponse, error) {
 		ret := ValuesetLookupResponse{
 			KeyValues: map[string]string{"": "X"},
+			Score:     0.9,
 		}
 		return ret, nil
 	}
@@ -134,8 +137,81 @@ func TestBasicVS(t *testing.T) {
 	nodes := FindChildInstanceOf(root, "tgt")
 	if len(nodes) != 1 {
 		t.Errorf("Child nodes: %v", nodes)
+		return
+	}
+	if score := ValuesetMatchScoreTerm.PropertyValue(nodes[0]); score != 0.9 {
+		t.Errorf("Wrong match score: %v", score)
 	}
+}
 
+func TestBatchVS(t *testing.T) {
+	layer, err := UnmarshalLayerFromSlice([]byte(basicVSSchema))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	builder := NewGraphBuilder(nil, GraphBuilderOptions{
+		EmbedSchemaNodes: true,
+	})
+	roots := make([]*lpg.Node, 0)
+	for _, value := range []string{"a", "b", "a", "c", "b"} {
+		root := builder.NewNode(layer.GetAttributeByID("schroot"))
+		builder.RawValueAsNode(layer.GetAttributeByID("src"), root, value)
+		roots = append(roots, root)
+	}
+	batches := make([][]string, 0)
+	vsFunc := func(_ *Context, reqs []ValuesetLookupRequest) ([]ValuesetLookupResponse, error) {
+		batch := make([]string, 0)
+		ret := make([]ValuesetLookupResponse, 0)
+		for _, req := range reqs {
+			batch = append(batch, req.KeyValues[""])
+			if req.KeyValues[""] == "c" {
+				ret = append(ret, ValuesetLookupResponse{})
+				continue
+			}
+			ret = append(ret, ValuesetLookupResponse{KeyValues: map[string]string{"": strings.ToUpper(req.KeyValues[""])}})
+		}
+		batches = append(batches, batch)
+		return ret, nil
+	}
+	processor, err := NewBatchValuesetProcessor(layer, vsFunc, 2, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	unmatched := 0
+	processor.LookupHook = func(_ *Context, req ValuesetLookupRequest, rsp ValuesetLookupResponse, contextDocNode *lpg.Node) {
+		if len(rsp.KeyValues) == 0 {
+			unmatched++
+		}
+	}
+	if err := processor.ProcessGraph(DefaultContext(), builder); err != nil {
+		t.Error(err)
+		return
+	}
+	if unmatched != 1 {
+		t.Errorf("Unmatched: %d", unmatched)
+	}
+	// 3 distinct requests in batches of 2
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Errorf("Wrong batches: %v", batches)
+	}
+	for i, expected := range []string{"A", "B", "A", "", "B"} {
+		nodes := FindChildInstanceOf(roots[i], "tgt")
+		if len(expected) == 0 {
+			if len(nodes) != 0 {
+				t.Errorf("Unexpected result at %d", i)
+			}
+			continue
+		}
+		if len(nodes) != 1 {
+			t.Errorf("Child nodes at %d: %v", i, nodes)
+			continue
+		}
+		if v, _ := GetRawNodeValue(nodes[0]); v != expected {
+			t.Errorf("Wrong value at %d: %s", i, v)
+		}
+	}
 }
 
 func TestBasicVSExpr(t *testing.T) {
@@ -0,0 +1,60 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package privacy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoSecret is returned if a keyed transformation is requested without a secret
+var ErrNoSecret = errors.New("No secret key for privacy transformation")
+
+// ErrUnknownAction is returned if an action does not have a registered transformer
+type ErrUnknownAction string
+
+func (e ErrUnknownAction) Error() string {
+	return fmt.Sprintf("Unknown privacy action: %s", string(e))
+}
+
+// ErrInvalidParameter is returned for invalid transformation parameters
+type ErrInvalidParameter struct {
+	Term  string
+	Value string
+	Msg   string
+}
+
+func (e ErrInvalidParameter) Error() string {
+	return fmt.Sprintf("Invalid privacy parameter %s: %s %s", e.Term, e.Value, e.Msg)
+}
+
+// ErrVaultCorrupt is returned if a vault value cannot be decrypted,
+// usually because the vault is opened with the wrong key
+var ErrVaultCorrupt = errors.New("Cannot decrypt vault value, wrong key or corrupt vault")
+
+// ErrVaultKeyMismatch is returned if a vault is opened with a key
+// different from the key it was created with
+var ErrVaultKeyMismatch = errors.New("Vault key does not match the key the vault was created with")
+
+// ErrTokenSpaceExhausted is returned if a unique token cannot be
+// generated for a value. This happens for short values, or values
+// without letters or digits.
+type ErrTokenSpaceExhausted struct {
+	Domain string
+}
+
+func (e ErrTokenSpaceExhausted) Error() string {
+	return fmt.Sprintf("Cannot generate a unique token in vault domain %s", e.Domain)
+}
@@ -0,0 +1,258 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	jsoningest "github.com/cloudprivacylabs/lsa/pkg/json"
+	"github.com/cloudprivacylabs/lsa/pkg/jsonld"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+const testSchema = `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/id",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "root",
+  "attributes": {
+   "ssn": {
+     "@type": "Value",
+     "attributeName":"ssn",
+     "privacyAction": "mask"
+   },
+   "name": {
+     "@type": "Value",
+     "attributeName":"name",
+     "http://example.org/privacyClassification": "PII"
+   },
+   "mrn": {
+     "@type": "Value",
+     "attributeName":"mrn",
+     "privacyAction": "tokenize"
+   },
+   "age": {
+     "@type": "Value",
+     "attributeName":"age",
+     "privacyAction": "generalize",
+     "privacyGeneralize": "range:10"
+   },
+   "patientId": {
+     "@type": "Value",
+     "attributeName":"patientId",
+     "privacyVault": "patient"
+   },
+   "nameToken": {
+     "@type": "Value",
+     "attributeName":"nameToken",
+     "privacyVault": "names",
+     "privacyVaultSource": ["name","ssn"]
+   },
+   "address": {
+     "@type": "Object",
+     "attributeName": "address",
+     "privacyAction": "drop",
+     "attributes": {
+       "street": {
+         "@type": "Value",
+         "attributeName": "street",
+         "privacyAction": "mask"
+       }
+     }
+   }
+  }
+ }
+}`
+
+func ingestTestDoc(t *testing.T, doc string) *lpg.Graph {
+	var schMap interface{}
+	if err := json.Unmarshal([]byte(testSchema), &schMap); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := jsonld.UnmarshalLayer(schMap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiler := ls.Compiler{}
+	schema, err = compiler.CompileSchema(ls.DefaultContext(), schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bldr := ls.NewGraphBuilder(nil, ls.GraphBuilderOptions{
+		EmbedSchemaNodes: true,
+	})
+	_, err = jsoningest.IngestBytes(ls.DefaultContext(), "http://base", []byte(doc), jsoningest.Parser{Layer: schema}, bldr, &ls.Ingester{Schema: schema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bldr.GetGraph()
+}
+
+func getValue(g *lpg.Graph, schemaNodeID string) (string, bool) {
+	nodes := ls.GetNodesInstanceOf(g, schemaNodeID)
+	if len(nodes) == 0 {
+		return "", false
+	}
+	return ls.GetRawNodeValue(nodes[0])
+}
+
+func TestPrivacyTransform(t *testing.T) {
+	g := ingestTestDoc(t, `{
+  "ssn": "123-45-6789",
+  "name": "John Doe",
+  "mrn": "12345",
+  "age": 47,
+  "address": {
+    "street": "1 Main St"
+  }
+}`)
+	prc := Processor{
+		Policy: Policy{
+			Rules: []Rule{
+				{
+					Term:   "http://example.org/privacyClassification",
+					Values: []string{"PII"},
+					Action: "redact",
+					Params: map[string]string{"redactWith": "XXX"},
+				},
+			},
+		},
+		Secret: []byte("secret"),
+	}
+	report, err := prc.ProcessGraph(ls.DefaultContext(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := getValue(g, "ssn"); v != "*******6789" {
+		t.Errorf("Wrong mask: %s", v)
+	}
+	if v, _ := getValue(g, "name"); v != "XXX" {
+		t.Errorf("Wrong redact: %s", v)
+	}
+	h := hmac.New(sha256.New, []byte("secret"))
+	h.Write([]byte("12345"))
+	if v, _ := getValue(g, "mrn"); v != fmt.Sprintf("%x", h.Sum(nil)) {
+		t.Errorf("Wrong token: %s", v)
+	}
+	if v, _ := getValue(g, "age"); v != "[40,50)" {
+		t.Errorf("Wrong generalization: %s", v)
+	}
+	if len(ls.GetNodesInstanceOf(g, "address")) != 0 || len(ls.GetNodesInstanceOf(g, "street")) != 0 {
+		t.Errorf("Address not dropped")
+	}
+	rep := report.Sorted()
+	if len(rep) != 5 {
+		t.Errorf("Wrong report: %+v", rep)
+	}
+	for _, x := range rep {
+		if x.SchemaNodeID == "street" {
+			t.Errorf("Nodes under dropped node are transformed")
+		}
+	}
+}
+
+func TestMaskInvalidKeep(t *testing.T) {
+	g := ingestTestDoc(t, `{"ssn": "123-45-6789"}`)
+	node := ls.GetNodesInstanceOf(g, "ssn")[0]
+	ctx := &TransformContext{Context: ls.DefaultContext(), Params: map[string]string{MaskKeepTerm.Name: "-1"}}
+	if _, err := Mask(ctx, node); err == nil {
+		t.Errorf("Expecting error for negative mask.keep")
+	}
+	if v, _ := ls.GetRawNodeValue(node); v != "123-45-6789" {
+		t.Errorf("Value changed: %s", v)
+	}
+}
+
+func TestPrivacyTokenizeNoSecret(t *testing.T) {
+	g := ingestTestDoc(t, `{"mrn": "12345"}`)
+	prc := Processor{}
+	if _, err := prc.ProcessGraph(ls.DefaultContext(), g); err != ErrNoSecret {
+		t.Errorf("Expecting ErrNoSecret, got %v", err)
+	}
+}
+
+func TestVaultTokenize(t *testing.T) {
+	vaultFile := filepath.Join(t.TempDir(), "vault.db")
+	vault, err := OpenBoltVault(vaultFile, []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prc := VaultProcessor{Vault: vault}
+	g1 := ingestTestDoc(t, `{"patientId": "AB-1234", "name": "John", "ssn": "123"}`)
+	if v, _ := getValue(g1, "nameToken"); v != "John 123" {
+		t.Errorf("Wrong source value: %s", v)
+	}
+	n, err := prc.Tokenize(ls.DefaultContext(), g1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("Expecting 2 tokens, got %d", n)
+	}
+	token, _ := getValue(g1, "patientId")
+	if token == "AB-1234" || !regexp.MustCompile(`^[A-Z]{2}-[0-9]{4}$`).MatchString(token) {
+		t.Errorf("Wrong token format: %s", token)
+	}
+	nameToken, _ := getValue(g1, "nameToken")
+	if !regexp.MustCompile(`^[A-Z][a-z]{3} [0-9]{3}$`).MatchString(nameToken) {
+		t.Errorf("Wrong token format: %s", nameToken)
+	}
+	// Tokens are stable
+	g2 := ingestTestDoc(t, `{"patientId": "AB-1234"}`)
+	if _, err := prc.Tokenize(ls.DefaultContext(), g2); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := getValue(g2, "patientId"); v != token {
+		t.Errorf("Token not stable: %s %s", v, token)
+	}
+	if _, err := prc.Detokenize(ls.DefaultContext(), g1); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := getValue(g1, "patientId"); v != "AB-1234" {
+		t.Errorf("Wrong detokenized value: %s", v)
+	}
+	if v, _ := getValue(g1, "nameToken"); v != "John 123" {
+		t.Errorf("Wrong detokenized value: %s", v)
+	}
+	if err := vault.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wrong key cannot open the vault
+	if v, err := OpenBoltVault(vaultFile, []byte("wrong")); err != ErrVaultKeyMismatch {
+		if v != nil {
+			v.Close()
+		}
+		t.Errorf("Expecting ErrVaultKeyMismatch, got %v", err)
+	}
+	// The right key opens the vault again
+	vault, err = OpenBoltVault(vaultFile, []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vault.Close()
+	if v, ok, err := vault.Detokenize("patient", token); err != nil || !ok || v != "AB-1234" {
+		t.Errorf("Wrong detokenized value: %s %v %v", v, ok, err)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package privacy
+
+import (
+	"net/url"
+	"sort"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+// A Rule selects a privacy transformation for the document nodes
+// whose schema contains the given term. This allows using existing
+// annotations, such as PII classifications, to drive
+// transformations:
+//
+//	term: http://example.org/privacyClassification
+//	values:
+//	  - PII
+//	action: mask
+//	params:
+//	  mask.keep: 2
+type Rule struct {
+	// Term is the schema annotation to look for
+	Term string `json:"term" yaml:"term"`
+	// Values lists the term values for which this rule applies. If
+	// empty, the rule applies if the term exists
+	Values []string `json:"values" yaml:"values"`
+	// Action is the transformer name
+	Action string `json:"action" yaml:"action"`
+	// Params are keyed by term. Relative term names are interpreted
+	// under the privacy namespace
+	Params map[string]string `json:"params" yaml:"params"`
+}
+
+// Policy is a list of rules. The first matching rule determines the
+// transformation for a node. If none of the rules match, the
+// privacy/action annotation of the node is used, unless
+// IgnoreSchemaActions is set.
+type Policy struct {
+	Rules               []Rule `json:"rules" yaml:"rules"`
+	IgnoreSchemaActions bool   `json:"ignoreSchemaActions" yaml:"ignoreSchemaActions"`
+}
+
+func (r Rule) matches(docNode *lpg.Node) bool {
+	pv, ok := ls.GetNodeOrSchemaProperty(docNode, r.Term)
+	if !ok {
+		return false
+	}
+	if len(r.Values) == 0 {
+		return true
+	}
+	for _, v := range pv.AsStringSlice() {
+		for _, x := range r.Values {
+			if v == x {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func expandParams(params map[string]string) map[string]string {
+	ret := make(map[string]string, len(params))
+	for k, v := range params {
+		u, err := url.Parse(k)
+		if err != nil || u.IsAbs() {
+			ret[k] = v
+			continue
+		}
+		ret[PRIVACY+k] = v
+	}
+	return ret
+}
+
+// AttributeReport gives the transformations applied to the
+// instances of a schema attribute
+type AttributeReport struct {
+	SchemaNodeID  string `json:"schemaNodeId" yaml:"schemaNodeId"`
+	AttributeName string `json:"attributeName,omitempty" yaml:"attributeName,omitempty"`
+	Action        string `json:"action" yaml:"action"`
+	Count         int    `json:"count" yaml:"count"`
+}
+
+// Report lists the attributes that were transformed
+type Report struct {
+	// Attributes are keyed by schema node ID and action
+	Attributes map[string]*AttributeReport `json:"attributes" yaml:"attributes"`
+}
+
+func (r *Report) add(docNode *lpg.Node, action string, n int) {
+	if r.Attributes == nil {
+		r.Attributes = make(map[string]*AttributeReport)
+	}
+	id := ls.GetNodeSchemaNodeID(docNode)
+	key := id + " " + action
+	rep := r.Attributes[key]
+	if rep == nil {
+		rep = &AttributeReport{
+			SchemaNodeID: id,
+			Action:       action,
+		}
+		if pv, ok := ls.GetNodeOrSchemaProperty(docNode, ls.AttributeNameTerm.Name); ok {
+			rep.AttributeName, _ = pv.Value().(string)
+		}
+		r.Attributes[key] = rep
+	}
+	rep.Count += n
+}
+
+// Merge adds the counts of the given report to this report
+func (r *Report) Merge(report Report) {
+	if r.Attributes == nil {
+		r.Attributes = make(map[string]*AttributeReport)
+	}
+	for k, v := range report.Attributes {
+		rep := r.Attributes[k]
+		if rep == nil {
+			cp := *v
+			r.Attributes[k] = &cp
+			continue
+		}
+		rep.Count += v.Count
+	}
+}
+
+// Sorted returns the attribute reports sorted by schema node ID and action
+func (r Report) Sorted() []AttributeReport {
+	ret := make([]AttributeReport, 0, len(r.Attributes))
+	for _, x := range r.Attributes {
+		ret = append(ret, *x)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].SchemaNodeID == ret[j].SchemaNodeID {
+			return ret[i].Action < ret[j].Action
+		}
+		return ret[i].SchemaNodeID < ret[j].SchemaNodeID
+	})
+	return ret
+}
+
+// Processor applies a privacy policy to document graphs
+type Processor struct {
+	Policy Policy
+	// Secret is the key used for keyed transformations
+	Secret []byte
+}
+
+type nodeAction struct {
+	node   *lpg.Node
+	action string
+	params map[string]string
+}
+
+// GetAction returns the transformation name and the rule parameters
+// for the document node. Returns empty string if the node is not to
+// be transformed.
+func (p Processor) GetAction(docNode *lpg.Node) (string, map[string]string) {
+	for _, rule := range p.Policy.Rules {
+		if rule.matches(docNode) {
+			return rule.Action, expandParams(rule.Params)
+		}
+	}
+	if p.Policy.IgnoreSchemaActions {
+		return "", nil
+	}
+	pv, ok := ls.GetNodeOrSchemaProperty(docNode, ActionTerm.Name)
+	if !ok {
+		return "", nil
+	}
+	s, _ := pv.Value().(string)
+	return s, nil
+}
+
+// ProcessGraph applies the policy to all document nodes of the
+// graph, and returns a report of the transformed attributes. Nodes
+// are dropped first, so the transformations are not applied to the
+// nodes under a dropped node.
+func (p Processor) ProcessGraph(ctx *ls.Context, g *lpg.Graph) (Report, error) {
+	report := Report{Attributes: make(map[string]*AttributeReport)}
+	drops := make([]nodeAction, 0)
+	others := make([]nodeAction, 0)
+	for nodes := g.GetNodesWithAllLabels(lpg.NewStringSet(ls.DocumentNodeTerm.Name)); nodes.Next(); {
+		node := nodes.Node()
+		action, params := p.GetAction(node)
+		if len(action) == 0 {
+			continue
+		}
+		if GetTransformer(action) == nil {
+			return report, ErrUnknownAction(action)
+		}
+		if action == "drop" {
+			drops = append(drops, nodeAction{node: node, action: action, params: params})
+		} else {
+			others = append(others, nodeAction{node: node, action: action, params: params})
+		}
+	}
+	removed := make(map[*lpg.Node]struct{})
+	for _, x := range drops {
+		if _, ok := removed[x.node]; ok {
+			continue
+		}
+		// Record the removed nodes before dropping, so nodes under a
+		// dropped node are skipped
+		ls.IterateDescendants(x.node, func(n *lpg.Node) bool {
+			removed[n] = struct{}{}
+			return true
+		}, func(edge *lpg.Edge) ls.EdgeFuncResult {
+			if !ls.IsDocumentNode(edge.GetTo()) {
+				return ls.SkipEdgeResult
+			}
+			return ls.FollowEdgesInEntity(edge)
+		}, false)
+		report.add(x.node, x.action, 1)
+		tctx := &TransformContext{Context: ctx, Secret: p.Secret, Params: x.params}
+		if _, err := GetTransformer(x.action).Transform(tctx, x.node); err != nil {
+			return report, err
+		}
+	}
+	for _, x := range others {
+		if _, ok := removed[x.node]; ok {
+			continue
+		}
+		tctx := &TransformContext{Context: ctx, Secret: p.Secret, Params: x.params}
+		ctx.GetLogger().Debug(map[string]any{"privacy": x.action, "node": ls.GetNodeSchemaNodeID(x.node)})
+		transformed, err := GetTransformer(x.action).Transform(tctx, x.node)
+		if err != nil {
+			return report, err
+		}
+		if transformed {
+			report.add(x.node, x.action, 1)
+		}
+	}
+	return report, nil
+}
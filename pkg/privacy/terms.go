@@ -0,0 +1,79 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package privacy
+
+import (
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+const PRIVACY = ls.LS + "privacy/"
+
+// ActionTerm gives the privacy transformation that will be applied
+// to the instances of an attribute. The value is one of the
+// registered transformer names: redact, mask, tokenize, generalize,
+// drop
+//
+//	{
+//	   @id: attrId,
+//	   @type: Value,
+//	   privacy/action: "mask"
+//	}
+var ActionTerm = ls.RegisterStringTerm(ls.NewTerm(PRIVACY, "action").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// RedactWithTerm gives the replacement value for redaction. If
+// empty, the node value is removed.
+var RedactWithTerm = ls.RegisterStringTerm(ls.NewTerm(PRIVACY, "redactWith").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// MaskKeepTerm gives the number of trailing characters left
+// unmasked. Default is 4.
+var MaskKeepTerm = ls.RegisterIntegerTerm(ls.NewTerm(PRIVACY, "mask.keep").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// MaskCharTerm gives the masking character. Default is '*'
+var MaskCharTerm = ls.RegisterStringTerm(ls.NewTerm(PRIVACY, "mask.char").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// TokenizeHashTerm gives the hash function used for HMAC
+// tokenization. One of sha256, sha1, sha512. Default is sha256.
+var TokenizeHashTerm = ls.RegisterStringTerm(ls.NewTerm(PRIVACY, "tokenize.hash").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// GeneralizeTerm specifies how a value is generalized:
+//
+//	year, month: Date values are truncated to the year or month
+//	range:<width>: Numeric values are replaced with a range, e.g. range:10 gives [30,40)
+//	prefix:<n>: String values are truncated to the first n characters
+var GeneralizeTerm = ls.RegisterStringTerm(ls.NewTerm(PRIVACY, "generalize").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// VaultTerm marks an attribute for reversible tokenization. The
+// value of the term is the vault domain. The same value is mapped to
+// the same token within a domain.
+//
+//	{
+//	   @id: attrId,
+//	   @type: Value,
+//	   privacy/vault: "patientId"
+//	}
+var VaultTerm = ls.RegisterStringTerm(ls.NewTerm(PRIVACY, "vault").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// VaultSourceTerm gives the schema node ids whose values are
+// tokenized. Similar to ls:hash, the node value is computed from the
+// instances of the given schema nodes after ingestion by joining them
+// with a space. The tokenize step then replaces this value with a token.
+//
+//	{
+//	   @id: nameToken,
+//	   @type: Value,
+//	   privacy/vault: "names",
+//	   privacy/vault.source: [ "firstName", "lastName" ]
+//	}
+var VaultSourceTerm = ls.RegisterStringSliceTerm(ls.NewTerm(PRIVACY, "vault.source").SetComposition(ls.OverrideComposition).SetMetadata(vaultSourceSemantics{}).SetTags(ls.SchemaElementTag))
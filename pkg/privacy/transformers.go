@@ -0,0 +1,226 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package privacy
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+// TransformContext is passed to the transformers. It contains the
+// secret for keyed transformations, and the parameters of the rule
+// that selected the transformation.
+type TransformContext struct {
+	*ls.Context
+	// Secret is the key used for keyed transformations (tokenize)
+	Secret []byte
+	// Params are keyed by term, and override the schema annotations
+	Params map[string]string
+}
+
+// GetParam returns the parameter for the term. The rule parameters
+// are checked first, and then the node and its schema node.
+func (ctx *TransformContext) GetParam(docNode *lpg.Node, term string) (string, bool) {
+	if v, ok := ctx.Params[term]; ok {
+		return v, true
+	}
+	pv, ok := ls.GetNodeOrSchemaProperty(docNode, term)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(pv.Value()), true
+}
+
+// A Transformer applies a privacy transformation to a document
+// node. Returns true if the node is transformed.
+type Transformer interface {
+	Transform(ctx *TransformContext, docNode *lpg.Node) (bool, error)
+}
+
+// TransformerFunc is a Transformer implemented as a function
+type TransformerFunc func(*TransformContext, *lpg.Node) (bool, error)
+
+func (f TransformerFunc) Transform(ctx *TransformContext, docNode *lpg.Node) (bool, error) {
+	return f(ctx, docNode)
+}
+
+var registeredTransformers = map[string]Transformer{}
+
+// RegisterTransformer registers a new transformer by name. The name
+// can then be used as the value of the privacy/action term.
+func RegisterTransformer(name string, t Transformer) {
+	registeredTransformers[name] = t
+}
+
+// GetTransformer returns the transformer registered with the name, or nil
+func GetTransformer(name string) Transformer {
+	return registeredTransformers[name]
+}
+
+func init() {
+	RegisterTransformer("redact", TransformerFunc(Redact))
+	RegisterTransformer("mask", TransformerFunc(Mask))
+	RegisterTransformer("tokenize", TransformerFunc(Tokenize))
+	RegisterTransformer("generalize", TransformerFunc(Generalize))
+	RegisterTransformer("drop", TransformerFunc(Drop))
+}
+
+// setValue sets the raw node value, and updates the entity ID if the
+// node is part of it
+func setValue(docNode *lpg.Node, value string) {
+	ls.SetRawNodeValue(docNode, value)
+	ls.SetEntityIDVectorElementFromNode(docNode, value)
+}
+
+// Redact replaces the node value with the privacy/redactWith value,
+// or removes it if there is no replacement
+func Redact(ctx *TransformContext, docNode *lpg.Node) (bool, error) {
+	if _, ok := ls.GetRawNodeValue(docNode); !ok {
+		return false, nil
+	}
+	if with, ok := ctx.GetParam(docNode, RedactWithTerm.Name); ok && len(with) > 0 {
+		setValue(docNode, with)
+		return true, nil
+	}
+	ls.RemoveRawNodeValue(docNode)
+	return true, nil
+}
+
+// Mask replaces all but the last privacy/mask.keep characters of
+// the node value with privacy/mask.char
+func Mask(ctx *TransformContext, docNode *lpg.Node) (bool, error) {
+	value, ok := ls.GetRawNodeValue(docNode)
+	if !ok {
+		return false, nil
+	}
+	keep := 4
+	if s, ok := ctx.GetParam(docNode, MaskKeepTerm.Name); ok {
+		k, err := strconv.Atoi(s)
+		if err != nil || k < 0 {
+			return false, ErrInvalidParameter{Term: MaskKeepTerm.Name, Value: s}
+		}
+		keep = k
+	}
+	maskChar := '*'
+	if s, ok := ctx.GetParam(docNode, MaskCharTerm.Name); ok && len(s) > 0 {
+		maskChar = []rune(s)[0]
+	}
+	runes := []rune(value)
+	for i := 0; i < len(runes)-keep; i++ {
+		runes[i] = maskChar
+	}
+	setValue(docNode, string(runes))
+	return true, nil
+}
+
+// Tokenize replaces the node value with the keyed hash (HMAC) of
+// the value. The hash function is given by privacy/tokenize.hash
+func Tokenize(ctx *TransformContext, docNode *lpg.Node) (bool, error) {
+	value, ok := ls.GetRawNodeValue(docNode)
+	if !ok {
+		return false, nil
+	}
+	if len(ctx.Secret) == 0 {
+		return false, ErrNoSecret
+	}
+	hashName, _ := ctx.GetParam(docNode, TokenizeHashTerm.Name)
+	newHash, err := ls.GetHashFunc(hashName)
+	if err != nil {
+		return false, err
+	}
+	h := hmac.New(newHash, ctx.Secret)
+	h.Write([]byte(value))
+	setValue(docNode, fmt.Sprintf("%x", h.Sum(nil)))
+	return true, nil
+}
+
+// Generalize replaces the node value with a less precise version
+// based on privacy/generalize
+func Generalize(ctx *TransformContext, docNode *lpg.Node) (bool, error) {
+	value, ok := ls.GetRawNodeValue(docNode)
+	if !ok {
+		return false, nil
+	}
+	spec, _ := ctx.GetParam(docNode, GeneralizeTerm.Name)
+	method, arg, _ := strings.Cut(spec, ":")
+	switch method {
+	case "year", "month":
+		native, err := ls.GetNodeValue(docNode)
+		if err != nil {
+			return false, err
+		}
+		t, ok := native.(interface{ ToTime() time.Time })
+		if !ok {
+			return false, ErrInvalidParameter{Term: GeneralizeTerm.Name, Value: spec, Msg: "Not a date value: " + value}
+		}
+		if method == "year" {
+			setValue(docNode, strconv.Itoa(t.ToTime().Year()))
+		} else {
+			setValue(docNode, t.ToTime().Format("2006-01"))
+		}
+	case "range":
+		width, err := strconv.ParseFloat(arg, 64)
+		if err != nil || width <= 0 {
+			return false, ErrInvalidParameter{Term: GeneralizeTerm.Name, Value: spec}
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return false, ErrInvalidParameter{Term: GeneralizeTerm.Name, Value: spec, Msg: "Not a numeric value: " + value}
+		}
+		low := math.Floor(v/width) * width
+		setValue(docNode, fmt.Sprintf("[%s,%s)", strconv.FormatFloat(low, 'f', -1, 64), strconv.FormatFloat(low+width, 'f', -1, 64)))
+	case "prefix":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return false, ErrInvalidParameter{Term: GeneralizeTerm.Name, Value: spec}
+		}
+		runes := []rune(value)
+		if len(runes) > n {
+			runes = runes[:n]
+		}
+		setValue(docNode, string(runes))
+	default:
+		return false, ErrInvalidParameter{Term: GeneralizeTerm.Name, Value: spec}
+	}
+	return true, nil
+}
+
+// Drop removes the document node and all document nodes under it
+// that are in the same entity
+func Drop(ctx *TransformContext, docNode *lpg.Node) (bool, error) {
+	nodes := make([]*lpg.Node, 0)
+	ls.IterateDescendants(docNode, func(node *lpg.Node) bool {
+		if ls.IsDocumentNode(node) {
+			nodes = append(nodes, node)
+		}
+		return true
+	}, func(edge *lpg.Edge) ls.EdgeFuncResult {
+		if !ls.IsDocumentNode(edge.GetTo()) {
+			return ls.SkipEdgeResult
+		}
+		return ls.FollowEdgesInEntity(edge)
+	}, false)
+	for _, node := range nodes {
+		node.DetachAndRemove()
+	}
+	return true, nil
+}
@@ -0,0 +1,270 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package privacy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"math/big"
+	"time"
+	"unicode"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// A Vault stores token-value mappings so tokenization can be
+// reversed. Tokens are stable: the same value in the same domain is
+// always mapped to the same token.
+type Vault interface {
+	// Tokenize returns the token for the value in the domain, creating
+	// a new token if necessary
+	Tokenize(domain, value string) (string, error)
+	// Detokenize returns the value for the token in the domain
+	Detokenize(domain, token string) (string, bool, error)
+	Close() error
+}
+
+var (
+	vaultTokensBucket = []byte("tokens")
+	vaultValuesBucket = []byte("values")
+	// vaultMetaBucket contains the key check record. The name is not a
+	// valid domain name, so it does not collide with the domains.
+	vaultMetaBucket = []byte("\x00meta")
+	vaultKeyCheck   = []byte("keyCheck")
+)
+
+// vaultKeyCheckValue is encrypted with the vault key when the vault
+// is created. It is decrypted when the vault is opened to verify the
+// key.
+const vaultKeyCheckValue = "lsa-vault-key-check"
+
+// maxTokenAttempts is the number of times a token is regenerated
+// when it collides with an existing token
+const maxTokenAttempts = 100
+
+// BoltVault is a file-backed vault. The values are encrypted using
+// AES-GCM with a key derived from the vault key. The values are
+// indexed by their keyed hash, so the plaintext values are not
+// stored in the vault.
+//
+// Each domain is a bucket containing two nested buckets: tokens
+// maps tokens to encrypted values, and values maps the keyed hash
+// of values to tokens.
+type BoltVault struct {
+	db     *bolt.DB
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+// OpenBoltVault opens or creates a vault file. The key is used to
+// encrypt the values, so the same key must be used to open an
+// existing vault. Returns ErrVaultKeyMismatch if the vault was
+// created with a different key.
+func OpenBoltVault(file string, key []byte) (*BoltVault, error) {
+	if len(key) == 0 {
+		return nil, ErrNoSecret
+	}
+	encKey := sha256.Sum256(append([]byte("lsa-vault-enc:"), key...))
+	block, err := aes.NewCipher(encKey[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	macKey := sha256.Sum256(append([]byte("lsa-vault-mac:"), key...))
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	ret := &BoltVault{db: db, aead: aead, macKey: macKey[:]}
+	if err := ret.checkKey(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return ret, nil
+}
+
+// checkKey verifies the vault key using the key check record, or
+// writes the key check record if the vault does not have one
+func (v *BoltVault) checkKey() error {
+	return v.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(vaultMetaBucket)
+		if err != nil {
+			return err
+		}
+		if data := meta.Get(vaultKeyCheck); data != nil {
+			s, err := v.decrypt(data)
+			if err != nil || s != vaultKeyCheckValue {
+				return ErrVaultKeyMismatch
+			}
+			return nil
+		}
+		enc, err := v.encrypt(vaultKeyCheckValue)
+		if err != nil {
+			return err
+		}
+		return meta.Put(vaultKeyCheck, enc)
+	})
+}
+
+// Close closes the vault file
+func (v *BoltVault) Close() error {
+	return v.db.Close()
+}
+
+func (v *BoltVault) valueKey(value string) []byte {
+	h := hmac.New(sha256.New, v.macKey)
+	h.Write([]byte(value))
+	return h.Sum(nil)
+}
+
+func (v *BoltVault) encrypt(value string) ([]byte, error) {
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return v.aead.Seal(nonce, nonce, []byte(value), nil), nil
+}
+
+func (v *BoltVault) decrypt(data []byte) (string, error) {
+	n := v.aead.NonceSize()
+	if len(data) < n {
+		return "", ErrVaultCorrupt
+	}
+	out, err := v.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return "", ErrVaultCorrupt
+	}
+	return string(out), nil
+}
+
+// Tokenize returns the token for the value, or creates a new
+// format-preserving token for it
+func (v *BoltVault) Tokenize(domain, value string) (string, error) {
+	vkey := v.valueKey(value)
+	var token string
+	err := v.db.Update(func(tx *bolt.Tx) error {
+		dom, err := tx.CreateBucketIfNotExists([]byte(domain))
+		if err != nil {
+			return err
+		}
+		tokens, err := dom.CreateBucketIfNotExists(vaultTokensBucket)
+		if err != nil {
+			return err
+		}
+		values, err := dom.CreateBucketIfNotExists(vaultValuesBucket)
+		if err != nil {
+			return err
+		}
+		if t := values.Get(vkey); t != nil {
+			token = string(t)
+			return nil
+		}
+		for i := 0; i < maxTokenAttempts; i++ {
+			t, err := FormatPreservingToken(value)
+			if err != nil {
+				return err
+			}
+			if t == value || tokens.Get([]byte(t)) != nil {
+				continue
+			}
+			token = t
+			break
+		}
+		if len(token) == 0 {
+			return ErrTokenSpaceExhausted{Domain: domain}
+		}
+		enc, err := v.encrypt(value)
+		if err != nil {
+			return err
+		}
+		if err := tokens.Put([]byte(token), enc); err != nil {
+			return err
+		}
+		return values.Put(vkey, []byte(token))
+	})
+	return token, err
+}
+
+// Detokenize returns the value for the token. Returns false if the
+// token is not in the vault
+func (v *BoltVault) Detokenize(domain, token string) (string, bool, error) {
+	var value string
+	var found bool
+	err := v.db.View(func(tx *bolt.Tx) error {
+		dom := tx.Bucket([]byte(domain))
+		if dom == nil {
+			return nil
+		}
+		tokens := dom.Bucket(vaultTokensBucket)
+		if tokens == nil {
+			return nil
+		}
+		data := tokens.Get([]byte(token))
+		if data == nil {
+			return nil
+		}
+		s, err := v.decrypt(data)
+		if err != nil {
+			return err
+		}
+		value = s
+		found = true
+		return nil
+	})
+	return value, found, err
+}
+
+func randomRune(from rune, n int64) (rune, error) {
+	x, err := rand.Int(rand.Reader, big.NewInt(n))
+	if err != nil {
+		return 0, err
+	}
+	return from + rune(x.Int64()), nil
+}
+
+// FormatPreservingToken returns a random token with the same format
+// as the value: digits are replaced with random digits, ASCII
+// letters are replaced with random letters of the same case, and
+// all other characters are kept.
+func FormatPreservingToken(value string) (string, error) {
+	runes := []rune(value)
+	for i, r := range runes {
+		var err error
+		switch {
+		case r >= '0' && r <= '9':
+			runes[i], err = randomRune('0', 10)
+		case r >= 'a' && r <= 'z':
+			runes[i], err = randomRune('a', 26)
+		case r >= 'A' && r <= 'Z':
+			runes[i], err = randomRune('A', 26)
+		case unicode.IsLetter(r):
+			runes[i], err = randomRune('a', 26)
+			if err == nil && unicode.IsUpper(r) {
+				runes[i] = unicode.ToUpper(runes[i])
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return string(runes), nil
+}
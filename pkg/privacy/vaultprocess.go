@@ -0,0 +1,104 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package privacy
+
+import (
+	"strings"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+type vaultSourceSemantics struct{}
+
+// ProcessNodePostDocIngest collects the values of the source nodes
+// and sets the node value. The value is tokenized later by the
+// VaultProcessor.
+func (vaultSourceSemantics) ProcessNodePostDocIngest(schemaRootNode, schemaNode *lpg.Node, term ls.PropertyValue, docNode *lpg.Node) error {
+	values := make([]string, 0)
+	for _, x := range ls.CollectReferencedValues(schemaRootNode, docNode, term.AsStringSlice()) {
+		values = append(values, x...)
+	}
+	value := strings.Join(values, " ")
+	ls.SetRawNodeValue(docNode, value)
+	ls.SetEntityIDVectorElementFromNode(docNode, value)
+	return nil
+}
+
+// VaultProcessor tokenizes or detokenizes the values of document
+// nodes whose schema nodes have the privacy/vault annotation.
+type VaultProcessor struct {
+	Vault Vault
+}
+
+func (p VaultProcessor) forEachVaultNode(g *lpg.Graph, f func(node *lpg.Node, domain, value string) error) error {
+	for nodes := g.GetNodesWithAllLabels(lpg.NewStringSet(ls.DocumentNodeTerm.Name)); nodes.Next(); {
+		node := nodes.Node()
+		pv, ok := ls.GetNodeOrSchemaProperty(node, VaultTerm.Name)
+		if !ok {
+			continue
+		}
+		domain, _ := pv.Value().(string)
+		if len(domain) == 0 {
+			continue
+		}
+		value, ok := ls.GetRawNodeValue(node)
+		if !ok || len(value) == 0 {
+			continue
+		}
+		if err := f(node, domain, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tokenize replaces the values of the annotated nodes with tokens,
+// and returns the number of nodes tokenized
+func (p VaultProcessor) Tokenize(ctx *ls.Context, g *lpg.Graph) (int, error) {
+	n := 0
+	err := p.forEachVaultNode(g, func(node *lpg.Node, domain, value string) error {
+		token, err := p.Vault.Tokenize(domain, value)
+		if err != nil {
+			return err
+		}
+		ctx.GetLogger().Debug(map[string]any{"vault.tokenize": ls.GetNodeSchemaNodeID(node), "domain": domain})
+		setValue(node, token)
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// Detokenize replaces the tokens in the annotated nodes with the
+// original values, and returns the number of nodes
+// detokenized. Values that are not in the vault are left as is.
+func (p VaultProcessor) Detokenize(ctx *ls.Context, g *lpg.Graph) (int, error) {
+	n := 0
+	err := p.forEachVaultNode(g, func(node *lpg.Node, domain, token string) error {
+		value, found, err := p.Vault.Detokenize(domain, token)
+		if err != nil {
+			return err
+		}
+		if !found {
+			ctx.GetLogger().Debug(map[string]any{"vault.detokenize": ls.GetNodeSchemaNodeID(node), "domain": domain, "notFound": true})
+			return nil
+		}
+		setValue(node, value)
+		n++
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relational
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// QuoteIdentifier returns the identifier as a quoted SQL identifier
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteIdentifiers(names []string) string {
+	ret := make([]string, 0, len(names))
+	for _, x := range names {
+		ret = append(ret, QuoteIdentifier(x))
+	}
+	return strings.Join(ret, ", ")
+}
+
+// SortedTables returns the tables so that the tables referred to by
+// foreign keys come before the tables referring to them, as long as
+// there are no cycles
+func (m *Model) SortedTables() []*Table {
+	ret := make([]*Table, 0, len(m.Tables))
+	byName := make(map[string]*Table, len(m.Tables))
+	for _, t := range m.Tables {
+		byName[t.Name] = t
+	}
+	// 0: not visited, 1: in progress, 2: done
+	state := make(map[*Table]int)
+	var visit func(*Table)
+	visit = func(t *Table) {
+		if state[t] != 0 {
+			return
+		}
+		state[t] = 1
+		for _, fk := range t.ForeignKeys {
+			if ref := byName[fk.Table]; ref != nil && ref != t {
+				visit(ref)
+			}
+		}
+		state[t] = 2
+		ret = append(ret, t)
+	}
+	for _, t := range m.Tables {
+		visit(t)
+	}
+	return ret
+}
+
+// CreateTableStatement returns the CREATE TABLE statement for the table
+func (t *Table) CreateTableStatement() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "CREATE TABLE IF NOT EXISTS %s (\n", QuoteIdentifier(t.Name))
+	lines := make([]string, 0, len(t.Columns)+len(t.ForeignKeys)+1)
+	for _, col := range t.Columns {
+		line := fmt.Sprintf("  %s %s", QuoteIdentifier(col.Name), col.Type)
+		if col.Name == IDColumn {
+			line += " PRIMARY KEY"
+		}
+		lines = append(lines, line)
+	}
+	if len(t.Unique) > 0 {
+		lines = append(lines, fmt.Sprintf("  UNIQUE (%s)", quoteIdentifiers(t.Unique)))
+	}
+	for _, fk := range t.ForeignKeys {
+		lines = append(lines, fmt.Sprintf("  FOREIGN KEY (%s) REFERENCES %s (%s)", quoteIdentifiers(fk.Columns), QuoteIdentifier(fk.Table), quoteIdentifiers(fk.RefColumns)))
+	}
+	out.WriteString(strings.Join(lines, ",\n"))
+	out.WriteString("\n);")
+	return out.String()
+}
+
+// WriteDDL writes the CREATE TABLE statements for the model
+func (m *Model) WriteDDL(w io.Writer) error {
+	for i, t := range m.SortedTables() {
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, t.CreateTableStatement()+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package relational derives relational tables from compiled layered
+// schemas, and exports ingested graphs as rows of those tables.
+//
+// There is one table for each entity. Value attributes of the entity
+// become columns, and nested objects are flattened into the entity
+// table. Arrays become child tables that refer to the parent table
+// row. Embedded entities are written to their own tables, and the
+// parent table refers to them. Reference link specs become foreign
+// key constraints to the entity id columns of the target entity.
+package relational
+
+import (
+	"fmt"
+	"unicode"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/types"
+)
+
+const (
+	// IDColumn is the primary key column of every table. It contains
+	// the document node id of the row
+	IDColumn = "_id"
+	// ParentColumn is the column of array tables that refers to the
+	// parent table row
+	ParentColumn = "_parent"
+	// IndexColumn is the column of array tables that contains the
+	// array index of the element
+	IndexColumn = "_index"
+	// ValueColumn is the column of array tables that contains the
+	// array element if the element is a value or an entity
+	ValueColumn = "_value"
+)
+
+// ErrCannotGenerate is returned if a schema attribute cannot be
+// represented as tables
+type ErrCannotGenerate struct {
+	ID  string
+	Msg string
+}
+
+func (e ErrCannotGenerate) Error() string {
+	return fmt.Sprintf("Cannot generate tables for %s: %s", e.ID, e.Msg)
+}
+
+// sqlTypes maps primitive kinds to SQL column types
+var sqlTypes = map[types.Primitive]string{
+	types.PrimitiveString:   "TEXT",
+	types.PrimitiveInteger:  "BIGINT",
+	types.PrimitiveNumber:   "DOUBLE PRECISION",
+	types.PrimitiveBoolean:  "BOOLEAN",
+	types.PrimitiveDate:     "DATE",
+	types.PrimitiveDateTime: "TIMESTAMP",
+	types.PrimitiveTime:     "TIME",
+}
+
+// Column is a table column
+type Column struct {
+	Name string
+	// SQL type of the column
+	Type      string
+	Primitive types.Primitive
+	// SchemaNodeID is the id of the schema attribute the column value
+	// is read from
+	SchemaNodeID string
+}
+
+// ForeignKey is a foreign key constraint
+type ForeignKey struct {
+	Columns    []string
+	Table      string
+	RefColumns []string
+}
+
+// Table is a relational table derived from an entity or an array
+type Table struct {
+	Name string
+	// EntitySchema is the entity schema id for entity tables
+	EntitySchema string
+	// ArrayNodeID is the schema node id of the array for array tables
+	ArrayNodeID string
+	// Parent is the parent table of an array table
+	Parent *Table
+
+	Columns     []Column
+	Unique      []string
+	ForeignKeys []ForeignKey
+
+	columnsBySchemaNode map[string]int
+}
+
+// GetColumn returns the column with the given name
+func (t *Table) GetColumn(name string) *Column {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+func (t *Table) addColumn(col Column) {
+	if len(col.Type) == 0 {
+		col.Type = sqlTypes[col.Primitive]
+	}
+	base := col.Name
+	for i := 1; t.GetColumn(col.Name) != nil; i++ {
+		col.Name = fmt.Sprintf("%s_%d", base, i)
+	}
+	if len(col.SchemaNodeID) > 0 {
+		t.columnsBySchemaNode[col.SchemaNodeID] = len(t.Columns)
+	}
+	t.Columns = append(t.Columns, col)
+}
+
+// columnForSchemaNode returns the column populated from the schema
+// node
+func (t *Table) columnForSchemaNode(id string) *Column {
+	ix, ok := t.columnsBySchemaNode[id]
+	if !ok {
+		return nil
+	}
+	return &t.Columns[ix]
+}
+
+// Model contains the tables derived from a schema
+type Model struct {
+	// Tables are ordered so that a table comes after its parent
+	Tables []*Table
+
+	entities    map[string]*Table
+	arrays      map[string]*Table
+	names       map[string]struct{}
+	linkSources []linkSource
+}
+
+type linkSource struct {
+	table *Table
+	spec  *ls.LinkSpec
+}
+
+// GetEntityTable returns the table for the entity schema
+func (m *Model) GetEntityTable(entitySchema string) *Table {
+	return m.entities[entitySchema]
+}
+
+// BuildModel builds the tables for the compiled layer
+func BuildModel(layer *ls.Layer) (*Model, error) {
+	root := layer.GetSchemaRootNode()
+	if root == nil {
+		return nil, ErrCannotGenerate{ID: layer.GetID(), Msg: "No schema root"}
+	}
+	m := &Model{
+		entities: make(map[string]*Table),
+		arrays:   make(map[string]*Table),
+		names:    make(map[string]struct{}),
+	}
+	if _, err := m.entityTable(root); err != nil {
+		return nil, err
+	}
+	for _, src := range m.linkSources {
+		m.linkForeignKey(src)
+	}
+	return m, nil
+}
+
+func (m *Model) newTable(name string) *Table {
+	base := name
+	for i := 1; ; i++ {
+		if _, used := m.names[name]; !used {
+			break
+		}
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	m.names[name] = struct{}{}
+	t := &Table{
+		Name:                name,
+		columnsBySchemaNode: make(map[string]int),
+	}
+	t.addColumn(Column{Name: IDColumn, Primitive: types.PrimitiveString})
+	m.Tables = append(m.Tables, t)
+	return t
+}
+
+// entityTable returns the table for the entity rooted at node,
+// creating it if necessary
+func (m *Model) entityTable(node *lpg.Node) (*Table, error) {
+	entitySchema := ls.EntitySchemaTerm.PropertyValue(node)
+	if t, ok := m.entities[entitySchema]; ok {
+		return t, nil
+	}
+	name := entitySchema
+	if len(name) == 0 {
+		name = ls.GetNodeID(node)
+	}
+	t := m.newTable(sqlName(ls.IRILastSegment(name)))
+	t.EntitySchema = entitySchema
+	m.entities[entitySchema] = t
+	if err := m.objectColumns(node, t, ""); err != nil {
+		return nil, err
+	}
+	for _, id := range ls.EntityIDFieldsTerm.PropertyValue(node) {
+		if col := t.columnForSchemaNode(id); col != nil {
+			t.Unique = append(t.Unique, col.Name)
+		}
+	}
+	return t, nil
+}
+
+// objectColumns adds the columns for the attributes of an object
+func (m *Model) objectColumns(node *lpg.Node, t *Table, prefix string) error {
+	children := ls.GetObjectAttributeNodes(node)
+	ls.SortNodes(children)
+	for _, child := range children {
+		if err := m.attribute(child, t, prefix+sqlName(ls.GetAttributeLocalName(child))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isEntity returns true if the schema node is a compiled reference
+// to an entity
+func isEntity(node *lpg.Node) bool {
+	if node.HasLabel(ls.AttributeTypeValue.Name) || node.HasLabel(ls.AttributeTypeReference.Name) {
+		return false
+	}
+	return len(ls.ReferenceTerm.PropertyValue(node)) > 0 && len(ls.EntitySchemaTerm.PropertyValue(node)) > 0
+}
+
+// attribute adds the columns and tables for the attribute to t. If
+// name is empty, the attribute is an array element
+func (m *Model) attribute(node *lpg.Node, t *Table, name string) error {
+	spec, err := ls.GetLinkSpec(node)
+	if err != nil {
+		return err
+	}
+	if spec != nil {
+		m.linkSources = append(m.linkSources, linkSource{table: t, spec: spec})
+		if !node.HasLabel(ls.AttributeTypeValue.Name) {
+			// The link target is a separate entity
+			if isEntity(node) {
+				_, err := m.entityTable(node)
+				return err
+			}
+			return nil
+		}
+	}
+	columnName := name
+	if len(columnName) == 0 {
+		columnName = ValueColumn
+	}
+	switch {
+	case node.HasLabel(ls.AttributeTypeValue.Name):
+		valueType, _ := ls.GetPropertyValueAs[string](node, ls.ValueTypeTerm.Name)
+		t.addColumn(Column{
+			Name:         columnName,
+			Primitive:    types.GetPrimitive(valueType),
+			SchemaNodeID: ls.GetNodeID(node),
+		})
+
+	case isEntity(node):
+		et, err := m.entityTable(node)
+		if err != nil {
+			return err
+		}
+		if len(name) > 0 {
+			columnName = name + "_id"
+		}
+		t.addColumn(Column{
+			Name:         columnName,
+			Primitive:    types.PrimitiveString,
+			SchemaNodeID: ls.GetNodeID(node),
+		})
+		col := t.Columns[len(t.Columns)-1].Name
+		t.ForeignKeys = append(t.ForeignKeys, ForeignKey{Columns: []string{col}, Table: et.Name, RefColumns: []string{IDColumn}})
+
+	case node.HasLabel(ls.AttributeTypeObject.Name):
+		prefix := ""
+		if len(name) > 0 {
+			prefix = name + "_"
+		}
+		return m.objectColumns(node, t, prefix)
+
+	case node.HasLabel(ls.AttributeTypeArray.Name):
+		tableName := t.Name + "_" + name
+		if len(name) == 0 {
+			tableName = t.Name + "_items"
+		}
+		at := m.newTable(tableName)
+		at.ArrayNodeID = ls.GetNodeID(node)
+		at.Parent = t
+		at.addColumn(Column{Name: ParentColumn, Primitive: types.PrimitiveString})
+		at.addColumn(Column{Name: IndexColumn, Primitive: types.PrimitiveInteger})
+		at.ForeignKeys = append(at.ForeignKeys, ForeignKey{Columns: []string{ParentColumn}, Table: t.Name, RefColumns: []string{IDColumn}})
+		m.arrays[at.ArrayNodeID] = at
+		if elem := ls.GetArrayElementNode(node); elem != nil {
+			return m.attribute(elem, at, "")
+		}
+
+	case node.HasLabel(ls.AttributeTypePolymorphic.Name):
+		// The columns of all options are added to the table
+		options := ls.GetPolymorphicOptions(node)
+		ls.SortNodes(options)
+		for _, option := range options {
+			if err := m.attribute(option, t, name); err != nil {
+				return err
+			}
+		}
+
+	case node.HasLabel(ls.AttributeTypeReference.Name):
+		// Not compiled
+		return ErrCannotGenerate{ID: ls.GetNodeID(node), Msg: "Schema is not compiled"}
+	}
+	return nil
+}
+
+// linkForeignKey adds the foreign key constraint for a link spec if
+// the foreign key columns and the target entity id columns are
+// known
+func (m *Model) linkForeignKey(src linkSource) {
+	target := m.entities[src.spec.TargetEntity]
+	if target == nil || len(src.spec.FK) == 0 {
+		return
+	}
+	targetRoot := src.spec.SchemaNode
+	if !isEntity(targetRoot) {
+		return
+	}
+	idFields := ls.EntityIDFieldsTerm.PropertyValue(targetRoot)
+	if len(idFields) != len(src.spec.FK) {
+		return
+	}
+	fk := ForeignKey{Table: target.Name}
+	for i := range idFields {
+		col := src.table.columnForSchemaNode(src.spec.FK[i])
+		refCol := target.columnForSchemaNode(idFields[i])
+		if col == nil || refCol == nil {
+			return
+		}
+		fk.Columns = append(fk.Columns, col.Name)
+		fk.RefColumns = append(fk.RefColumns, refCol.Name)
+	}
+	src.table.ForeignKeys = append(src.table.ForeignKeys, fk)
+}
+
+// sqlName replaces the characters that are not letters, digits, or
+// underscore with underscore
+func sqlName(name string) string {
+	ret := []rune(name)
+	for i, r := range ret {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			ret[i] = '_'
+		}
+	}
+	if len(ret) == 0 {
+		return "_"
+	}
+	return string(ret)
+}
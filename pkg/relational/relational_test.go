@@ -0,0 +1,235 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relational
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+
+	jsoningest "github.com/cloudprivacylabs/lsa/pkg/json"
+	"github.com/cloudprivacylabs/lsa/pkg/jsonld"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+var testSchemas = map[string]string{
+	"http://example.org/Person": `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/Person",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "person",
+  "entityIdFields": "person.id",
+  "attributes": {
+   "person.id": {
+     "@type": "Value",
+     "attributeName":"id",
+     "valueType": "xsd:integer"
+   },
+   "person.name": {
+     "@type": "Object",
+     "attributeName":"name",
+     "attributes": {
+       "person.name.given": {
+         "@type": "Value",
+         "attributeName": "given"
+       }
+     }
+   },
+   "person.phones": {
+     "@type": "Array",
+     "attributeName":"phones",
+     "arrayElements": {
+       "@type": "Value",
+       "@id": "person.phones.item"
+     }
+   },
+   "person.addresses": {
+     "@type": "Array",
+     "attributeName": "addresses",
+     "arrayElements": {
+       "@type": "Object",
+       "@id": "person.addresses.item",
+       "attributes": {
+         "person.addresses.city": {
+           "@type": "Value",
+           "attributeName": "city"
+         }
+       }
+     }
+   },
+   "person.employerId": {
+     "@type": "Value",
+     "attributeName": "employerId"
+   },
+   "person.employer": {
+     "@type": "Reference",
+     "attributeName": "employer",
+     "ref": "http://example.org/Company",
+     "dir": "to",
+     "fk": "person.employerId"
+   }
+  }
+ }
+}`,
+	"http://example.org/Company": `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/Company",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "company",
+  "entityIdFields": "company.id",
+  "attributes": {
+   "company.id": {
+     "@type": "Value",
+     "attributeName":"id"
+   }
+  }
+ }
+}`,
+}
+
+func compileTestSchema(t *testing.T) *ls.Layer {
+	compiler := ls.Compiler{
+		Loader: ls.SchemaLoaderFunc(func(ref string) (*ls.Layer, error) {
+			s, ok := testSchemas[ref]
+			if !ok {
+				return nil, fmt.Errorf("Not found: %s", ref)
+			}
+			var v interface{}
+			if err := json.Unmarshal([]byte(s), &v); err != nil {
+				return nil, err
+			}
+			return jsonld.UnmarshalLayer(v, nil)
+		}),
+	}
+	layer, err := compiler.Compile(ls.DefaultContext(), "http://example.org/Person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer
+}
+
+func TestDDL(t *testing.T) {
+	m, err := BuildModel(compileTestSchema(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := bytes.Buffer{}
+	if err := m.WriteDDL(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `CREATE TABLE IF NOT EXISTS "Company" (
+  "_id" TEXT PRIMARY KEY,
+  "id" TEXT,
+  UNIQUE ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "Person" (
+  "_id" TEXT PRIMARY KEY,
+  "employerId" TEXT,
+  "id" BIGINT,
+  "name_given" TEXT,
+  UNIQUE ("id"),
+  FOREIGN KEY ("employerId") REFERENCES "Company" ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "Person_addresses" (
+  "_id" TEXT PRIMARY KEY,
+  "_parent" TEXT,
+  "_index" BIGINT,
+  "city" TEXT,
+  FOREIGN KEY ("_parent") REFERENCES "Person" ("_id")
+);
+
+CREATE TABLE IF NOT EXISTS "Person_phones" (
+  "_id" TEXT PRIMARY KEY,
+  "_parent" TEXT,
+  "_index" BIGINT,
+  "_value" TEXT,
+  FOREIGN KEY ("_parent") REFERENCES "Person" ("_id")
+);
+`
+	if out.String() != expected {
+		t.Errorf("Got %s", out.String())
+	}
+}
+
+func TestRows(t *testing.T) {
+	layer := compileTestSchema(t)
+	m, err := BuildModel(layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := `{"id": 1, "name": {"given": "John"}, "phones": ["123", "456"], "addresses": [{"city": "Denver"}], "employerId": "c1"}`
+	bldr := ls.NewGraphBuilder(nil, ls.GraphBuilderOptions{})
+	parser := jsoningest.Parser{Layer: layer}
+	if _, err := jsoningest.IngestBytes(ls.DefaultContext(), "http://base", []byte(input), parser, bldr, &ls.Ingester{Schema: layer}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := m.Rows(bldr.GetGraph())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts := make([]string, 0)
+	for _, r := range rows {
+		stmts = append(stmts, r.InsertStatement())
+	}
+	expected := `INSERT INTO "Person" ("_id", "employerId", "id", "name_given") VALUES ('http://base', 'c1', 1, 'John');
+INSERT INTO "Person_phones" ("_id", "_parent", "_index", "_value") VALUES ('http://base.phones.0', 'http://base', 0, '123');
+INSERT INTO "Person_phones" ("_id", "_parent", "_index", "_value") VALUES ('http://base.phones.1', 'http://base', 1, '456');
+INSERT INTO "Person_addresses" ("_id", "_parent", "_index", "city") VALUES ('http://base.addresses.0', 'http://base', 0, 'Denver');`
+	if s := strings.Join(stmts, "\n"); s != expected {
+		t.Errorf("Got %s", s)
+	}
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	if err := m.CreateTables(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rows {
+		if err := r.Insert(ctx, db, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var given string
+	var id int
+	if err := db.QueryRow(`SELECT "id", "name_given" FROM "Person"`).Scan(&id, &given); err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || given != "John" {
+		t.Errorf("Got %d %s", id, given)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM "Person_phones" WHERE "_parent"='http://base'`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("Phones: %d", n)
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relational
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/types"
+)
+
+// Row is a table row. Values are keyed by column name. Values are
+// strings, except the array index which is an int. Columns without
+// values are NULL.
+type Row struct {
+	Table  *Table
+	Values map[string]interface{}
+}
+
+// Execer is implemented by *sql.DB and *sql.Tx
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Rows returns the rows for the entities of the document graph. Rows
+// of embedded entities come before the rows referring to them, and
+// rows of array tables come after their parent rows.
+func (m *Model) Rows(g *lpg.Graph) ([]Row, error) {
+	roots := make([]*lpg.Node, 0)
+	for nodes := g.GetNodesWithProperty(ls.EntitySchemaTerm.Name); nodes.Next(); {
+		node := nodes.Node()
+		if !ls.IsDocumentNode(node) {
+			continue
+		}
+		if m.entities[ls.EntitySchemaTerm.PropertyValue(node)] == nil {
+			continue
+		}
+		roots = append(roots, node)
+	}
+	sort.Slice(roots, func(i, j int) bool { return ls.GetNodeID(roots[i]) < ls.GetNodeID(roots[j]) })
+	rb := rowBuilder{model: m, seen: make(map[*lpg.Node]struct{})}
+	ret := make([]Row, 0)
+	for _, root := range roots {
+		rows, err := rb.entityRows(root)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, rows...)
+	}
+	return ret, nil
+}
+
+type rowBuilder struct {
+	model *Model
+	seen  map[*lpg.Node]struct{}
+}
+
+// childNodes returns the document children of the node in order
+func childNodes(node *lpg.Node) []*lpg.Node {
+	ret := lpg.TargetNodes(node.GetEdgesWithLabel(lpg.OutgoingEdge, ls.HasTerm.Name))
+	ls.SortNodes(ret)
+	return ret
+}
+
+func (rb *rowBuilder) entityRows(node *lpg.Node) ([]Row, error) {
+	if _, seen := rb.seen[node]; seen {
+		return nil, nil
+	}
+	rb.seen[node] = struct{}{}
+	t := rb.model.entities[ls.EntitySchemaTerm.PropertyValue(node)]
+	if t == nil {
+		return nil, nil
+	}
+	row := Row{Table: t, Values: map[string]interface{}{IDColumn: ls.GetNodeID(node)}}
+	before, after, err := rb.collect(node, row)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(before, row), after...), nil
+}
+
+// collect sets the column values of the row from the descendants of
+// node, and returns the rows that must come before and after the row
+func (rb *rowBuilder) collect(node *lpg.Node, row Row) (before, after []Row, err error) {
+	for _, child := range childNodes(node) {
+		schemaNodeID := ls.SchemaNodeIDTerm.PropertyValue(child)
+		if ls.IsEntityRoot(child) {
+			if col := row.Table.columnForSchemaNode(schemaNodeID); col != nil {
+				row.Values[col.Name] = ls.GetNodeID(child)
+			}
+			rows, err := rb.entityRows(child)
+			if err != nil {
+				return nil, nil, err
+			}
+			before = append(before, rows...)
+			continue
+		}
+		switch {
+		case child.HasLabel(ls.AttributeTypeValue.Name):
+			if col := row.Table.columnForSchemaNode(schemaNodeID); col != nil {
+				if v, ok := ls.GetRawNodeValue(child); ok {
+					row.Values[col.Name] = v
+				}
+			}
+		case child.HasLabel(ls.AttributeTypeArray.Name):
+			if at := rb.model.arrays[schemaNodeID]; at != nil {
+				rowID, _ := row.Values[IDColumn].(string)
+				b, a, err := rb.arrayRows(child, at, rowID)
+				if err != nil {
+					return nil, nil, err
+				}
+				before = append(before, b...)
+				after = append(after, a...)
+			}
+		case child.HasLabel(ls.AttributeTypeObject.Name):
+			b, a, err := rb.collect(child, row)
+			if err != nil {
+				return nil, nil, err
+			}
+			before = append(before, b...)
+			after = append(after, a...)
+		}
+	}
+	return before, after, nil
+}
+
+// arrayRows returns the rows for the elements of the array node. The
+// rows are given as the rows that must come before the parent row,
+// and the rows that must come after it.
+func (rb *rowBuilder) arrayRows(node *lpg.Node, t *Table, parentID string) (before, after []Row, err error) {
+	for index, elem := range childNodes(node) {
+		row := Row{Table: t, Values: map[string]interface{}{
+			IDColumn:     ls.GetNodeID(elem),
+			ParentColumn: parentID,
+			IndexColumn:  index,
+		}}
+		var elemAfter []Row
+		switch {
+		case ls.IsEntityRoot(elem):
+			row.Values[ValueColumn] = ls.GetNodeID(elem)
+			rows, err := rb.entityRows(elem)
+			if err != nil {
+				return nil, nil, err
+			}
+			before = append(before, rows...)
+		case elem.HasLabel(ls.AttributeTypeValue.Name):
+			if v, ok := ls.GetRawNodeValue(elem); ok && t.GetColumn(ValueColumn) != nil {
+				row.Values[ValueColumn] = v
+			}
+		case elem.HasLabel(ls.AttributeTypeArray.Name):
+			if nested := rb.model.arrays[ls.SchemaNodeIDTerm.PropertyValue(elem)]; nested != nil {
+				b, a, err := rb.arrayRows(elem, nested, ls.GetNodeID(elem))
+				if err != nil {
+					return nil, nil, err
+				}
+				before = append(before, b...)
+				elemAfter = a
+			}
+		case elem.HasLabel(ls.AttributeTypeObject.Name):
+			b, a, err := rb.collect(elem, row)
+			if err != nil {
+				return nil, nil, err
+			}
+			before = append(before, b...)
+			elemAfter = a
+		}
+		after = append(after, row)
+		after = append(after, elemAfter...)
+	}
+	return before, after, nil
+}
+
+// columns returns the columns of the row that have values, in table
+// order
+func (r Row) columns() []Column {
+	ret := make([]Column, 0, len(r.Values))
+	for _, col := range r.Table.Columns {
+		if _, ok := r.Values[col.Name]; ok {
+			ret = append(ret, col)
+		}
+	}
+	return ret
+}
+
+// sqlValue converts the column value to the Go type of the column. If
+// the value cannot be converted, it is returned as is.
+func sqlValue(col Column, value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	switch col.Primitive {
+	case types.PrimitiveInteger:
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return v
+		}
+	case types.PrimitiveNumber:
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return v
+		}
+	case types.PrimitiveBoolean:
+		if v, err := strconv.ParseBool(s); err == nil {
+			return v
+		}
+	}
+	return s
+}
+
+// sqlLiteral returns the value as an SQL literal
+func sqlLiteral(col Column, value interface{}) string {
+	switch v := sqlValue(col, value).(type) {
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	return "NULL"
+}
+
+// InsertStatement returns the INSERT statement for the row with the
+// values written as literals
+func (r Row) InsertStatement() string {
+	cols := r.columns()
+	names := make([]string, 0, len(cols))
+	values := make([]string, 0, len(cols))
+	for _, col := range cols {
+		names = append(names, col.Name)
+		values = append(values, sqlLiteral(col, r.Values[col.Name]))
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);", QuoteIdentifier(r.Table.Name), quoteIdentifiers(names), strings.Join(values, ", "))
+}
+
+// Insert inserts the row using a parameterized statement. The
+// placeholder function returns the parameter placeholder for the
+// n'th parameter, starting from 1. If placeholder is nil, "?" is used.
+func (r Row) Insert(ctx context.Context, db Execer, placeholder func(int) string) error {
+	cols := r.columns()
+	names := make([]string, 0, len(cols))
+	params := make([]string, 0, len(cols))
+	args := make([]interface{}, 0, len(cols))
+	for i, col := range cols {
+		names = append(names, col.Name)
+		if placeholder == nil {
+			params = append(params, "?")
+		} else {
+			params = append(params, placeholder(i+1))
+		}
+		args = append(args, sqlValue(col, r.Values[col.Name]))
+	}
+	_, err := db.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", QuoteIdentifier(r.Table.Name), quoteIdentifiers(names), strings.Join(params, ", ")), args...)
+	return err
+}
+
+// CreateTables runs the CREATE TABLE statements of the model
+func (m *Model) CreateTables(ctx context.Context, db Execer) error {
+	for _, t := range m.SortedTables() {
+		if _, err := db.ExecContext(ctx, t.CreateTableStatement()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolution
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	jsoningest "github.com/cloudprivacylabs/lsa/pkg/json"
+	"github.com/cloudprivacylabs/lsa/pkg/jsonld"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+const testSchema = `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/id",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "root",
+  "erThreshold": 4,
+  "attributes": {
+   "firstName": {
+     "@type": "Value",
+     "attributeName":"firstName",
+     "erComparator": "similarity"
+   },
+   "lastName": {
+     "@type": "Value",
+     "attributeName":"lastName",
+     "erComparator": "phonetic",
+     "erBlock": ["name"]
+   },
+   "dob": {
+     "@type": "Value",
+     "attributeName":"dob",
+     "erComparator": "date",
+     "erDateTolerance": 1,
+     "erM": 0.95,
+     "erU": 0.01
+   }
+  }
+ }
+}`
+
+func ingestTestDocs(t *testing.T, docs ...string) (*ls.Layer, *lpg.Graph) {
+	var schMap interface{}
+	if err := json.Unmarshal([]byte(testSchema), &schMap); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := jsonld.UnmarshalLayer(schMap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiler := ls.Compiler{}
+	schema, err = compiler.CompileSchema(ls.DefaultContext(), schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bldr := ls.NewGraphBuilder(nil, ls.GraphBuilderOptions{
+		EmbedSchemaNodes: true,
+	})
+	for i, doc := range docs {
+		_, err = jsoningest.IngestBytes(ls.DefaultContext(), fmt.Sprintf("http://doc%d", i), []byte(doc), jsoningest.Parser{Layer: schema}, bldr, &ls.Ingester{Schema: schema})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return schema, bldr.GetGraph()
+}
+
+var testDocs = []string{
+	`{"firstName": "John", "lastName": "Smith", "dob": "1980-01-02"}`,
+	`{"firstName": "Jon", "lastName": "Smyth", "dob": "1980-01-03"}`,
+	`{"firstName": "Mary", "lastName": "Smith", "dob": "1975-05-05"}`,
+	`{"firstName": "John", "lastName": "Brown", "dob": "1980-01-02"}`,
+}
+
+func TestResolveLink(t *testing.T) {
+	layer, g := ingestTestDocs(t, testDocs...)
+	r, err := NewResolver(layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Fields) != 3 || r.Threshold != 4 || r.Action != ActionLink {
+		t.Fatalf("Wrong resolver: %+v", r)
+	}
+	matches := r.Resolve(g)
+	if len(matches) != 1 {
+		t.Fatalf("Expecting 1 match, got %v", matches)
+	}
+	edges := 0
+	for it := g.GetEdgesWithAnyLabel(lpg.NewStringSet(SameAsLabel)); it.Next(); {
+		edge := it.Edge()
+		edges++
+		if ScoreTerm.PropertyValue(edge) != r.MaxScore() {
+			t.Errorf("Wrong score: %v", ScoreTerm.PropertyValue(edge))
+		}
+		if ls.GetNodeID(edge.GetFrom()) != "http://doc0" || ls.GetNodeID(edge.GetTo()) != "http://doc1" {
+			t.Errorf("Wrong link: %s -> %s", ls.GetNodeID(edge.GetFrom()), ls.GetNodeID(edge.GetTo()))
+		}
+	}
+	if edges != 1 {
+		t.Errorf("Expecting 1 sameAs edge, got %d", edges)
+	}
+}
+
+func TestResolveMerge(t *testing.T) {
+	layer, g := ingestTestDocs(t, append(testDocs, `{"firstName": "Johnny", "lastName": "Smith", "dob": "1980-01-02"}`)...)
+	r, err := NewResolver(layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Action = ActionMerge
+	matches := r.Resolve(g)
+	if len(matches) != 3 {
+		t.Fatalf("Expecting 3 matches, got %v", matches)
+	}
+	if n := len(ls.GetNodesInstanceOf(g, "root")); n != 3 {
+		t.Errorf("Expecting 3 entities, got %d", n)
+	}
+	var head *lpg.Node
+	for _, node := range ls.GetNodesInstanceOf(g, "root") {
+		if ls.GetNodeID(node) == "http://doc0" {
+			head = node
+		}
+	}
+	if head == nil {
+		t.Fatalf("Merged into wrong entity")
+	}
+	if n := len(ls.GetNodesInstanceOf(g, "lastName")); n != 5 {
+		t.Errorf("Attributes lost: %d", n)
+	}
+	names := 0
+	for edges := head.GetEdges(lpg.OutgoingEdge); edges.Next(); {
+		if ls.GetNodeSchemaNodeID(edges.Edge().GetTo()) == "lastName" {
+			names++
+		}
+	}
+	if names != 3 {
+		t.Errorf("Expecting 3 lastName nodes under merged entity, got %d", names)
+	}
+}
@@ -0,0 +1,479 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolution
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/cloudprivacylabs/lpg/v2"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/similarity"
+)
+
+// Field comparators
+const (
+	CompareExact      = "exact"
+	ComparePhonetic   = "phonetic"
+	CompareDate       = "date"
+	CompareSimilarity = "similarity"
+)
+
+// Resolution actions
+const (
+	ActionLink  = "link"
+	ActionMerge = "merge"
+)
+
+// Default field parameters
+const (
+	DefaultM                   = 0.9
+	DefaultU                   = 0.1
+	DefaultSimilarityThreshold = 0.85
+)
+
+// ErrInvalidField is returned if the entity resolution annotations of
+// a schema attribute are invalid
+type ErrInvalidField struct {
+	SchemaNodeID string
+	Msg          string
+}
+
+func (e ErrInvalidField) Error() string {
+	return fmt.Sprintf("Invalid entity resolution field %s: %s", e.SchemaNodeID, e.Msg)
+}
+
+// Field is a schema attribute used to compare entities
+type Field struct {
+	SchemaNodeID        string
+	Comparator          string
+	M                   float64
+	U                   float64
+	DateTolerance       int
+	SimilarityThreshold float64
+	Blocks              []string
+}
+
+// AgreementWeight returns log2(m/u), the weight added to the match
+// score if the field values agree
+func (f Field) AgreementWeight() float64 {
+	return math.Log2(f.M / f.U)
+}
+
+// DisagreementWeight returns log2((1-m)/(1-u)), the weight added to
+// the match score if the field values disagree
+func (f Field) DisagreementWeight() float64 {
+	return math.Log2((1 - f.M) / (1 - f.U))
+}
+
+// Compare returns true if the two values agree
+func (f Field) Compare(v1, v2 string) bool {
+	switch f.Comparator {
+	case CompareExact:
+		return strings.EqualFold(strings.TrimSpace(v1), strings.TrimSpace(v2))
+	case ComparePhonetic:
+		k := similarity.PhoneticKey(v1)
+		return len(k) > 0 && k == similarity.PhoneticKey(v2)
+	case CompareDate:
+		t1, err := dateparse.ParseAny(strings.TrimSpace(v1))
+		if err != nil {
+			return false
+		}
+		t2, err := dateparse.ParseAny(strings.TrimSpace(v2))
+		if err != nil {
+			return false
+		}
+		diff := t1.Sub(t2)
+		if diff < 0 {
+			diff = -diff
+		}
+		return diff <= time.Duration(f.DateTolerance)*24*time.Hour
+	case CompareSimilarity:
+		return similarity.JaroWinklerSimilarity(strings.ToLower(strings.TrimSpace(v1)), strings.ToLower(strings.TrimSpace(v2))) >= f.SimilarityThreshold
+	}
+	return false
+}
+
+// blockKey returns the value used to build blocking keys
+func (f Field) blockKey(v string) string {
+	switch f.Comparator {
+	case ComparePhonetic:
+		return similarity.PhoneticKey(v)
+	case CompareDate:
+		if t, err := dateparse.ParseAny(strings.TrimSpace(v)); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(v))
+}
+
+// fieldFromSchemaNode reads the entity resolution annotations of a
+// schema attribute. Returns nil if the attribute is not a matching field.
+func fieldFromSchemaNode(node *lpg.Node) (*Field, error) {
+	cmp := ComparatorTerm.PropertyValue(node)
+	if len(cmp) == 0 {
+		return nil, nil
+	}
+	ret := &Field{
+		SchemaNodeID:        ls.GetNodeID(node),
+		Comparator:          cmp,
+		M:                   DefaultM,
+		U:                   DefaultU,
+		DateTolerance:       DateToleranceTerm.PropertyValue(node),
+		SimilarityThreshold: DefaultSimilarityThreshold,
+		Blocks:              BlockTerm.PropertyValue(node),
+	}
+	switch cmp {
+	case CompareExact, ComparePhonetic, CompareDate, CompareSimilarity:
+	default:
+		return nil, ErrInvalidField{SchemaNodeID: ret.SchemaNodeID, Msg: "Unknown comparator " + cmp}
+	}
+	if _, ok := node.GetProperty(MProbabilityTerm.Name); ok {
+		ret.M = MProbabilityTerm.PropertyValue(node)
+	}
+	if _, ok := node.GetProperty(UProbabilityTerm.Name); ok {
+		ret.U = UProbabilityTerm.PropertyValue(node)
+	}
+	if _, ok := node.GetProperty(SimilarityThresholdTerm.Name); ok {
+		ret.SimilarityThreshold = SimilarityThresholdTerm.PropertyValue(node)
+	}
+	if ret.M <= 0 || ret.M >= 1 || ret.U <= 0 || ret.U >= 1 {
+		return nil, ErrInvalidField{SchemaNodeID: ret.SchemaNodeID, Msg: "m and u must be between 0 and 1"}
+	}
+	if ret.M <= ret.U {
+		return nil, ErrInvalidField{SchemaNodeID: ret.SchemaNodeID, Msg: "m must be greater than u"}
+	}
+	if ret.DateTolerance < 0 {
+		return nil, ErrInvalidField{SchemaNodeID: ret.SchemaNodeID, Msg: "Negative date tolerance"}
+	}
+	return ret, nil
+}
+
+// Resolver finds the document entities that refer to the same
+// real-world entity using the Fellegi-Sunter model. Each matching
+// field adds its agreement weight to the match score if the field
+// values of the two entities agree, and its disagreement weight if
+// they disagree. Fields missing in either entity do not change the
+// score. Pairs with a score at or above the threshold are matches.
+type Resolver struct {
+	// EntitySchemaNodeID is the schema node id of the entity roots
+	EntitySchemaNodeID string
+	Fields             []Field
+	Threshold          float64
+	// Action is link or merge
+	Action string
+}
+
+// NewResolver returns a resolver using the entity resolution
+// annotations of the layer. The instances of the layer root are the
+// entities. Returns nil if the layer has no matching fields.
+func NewResolver(layer *ls.Layer) (*Resolver, error) {
+	root := layer.GetSchemaRootNode()
+	if root == nil {
+		return nil, nil
+	}
+	ret := &Resolver{
+		EntitySchemaNodeID: ls.GetNodeID(root),
+		Action:             ActionTerm.PropertyValue(root),
+	}
+	var err error
+	layer.ForEachAttributeOrdered(func(node *lpg.Node, _ []*lpg.Node) bool {
+		var f *Field
+		f, err = fieldFromSchemaNode(node)
+		if err != nil {
+			return false
+		}
+		if f != nil {
+			ret.Fields = append(ret.Fields, *f)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ret.Fields) == 0 {
+		return nil, nil
+	}
+	switch ret.Action {
+	case "":
+		ret.Action = ActionLink
+	case ActionLink, ActionMerge:
+	default:
+		return nil, fmt.Errorf("Unknown entity resolution action: %s", ret.Action)
+	}
+	if _, ok := root.GetProperty(ThresholdTerm.Name); ok {
+		ret.Threshold = ThresholdTerm.PropertyValue(root)
+	} else {
+		ret.Threshold = ret.MaxScore() / 2
+	}
+	return ret, nil
+}
+
+// MaxScore returns the score of two entities that agree on all fields
+func (r *Resolver) MaxScore() float64 {
+	ret := 0.0
+	for _, f := range r.Fields {
+		ret += f.AgreementWeight()
+	}
+	return ret
+}
+
+// Match is a pair of matching entities
+type Match struct {
+	Entity1 *lpg.Node
+	Entity2 *lpg.Node
+	Score   float64
+}
+
+type entityValues struct {
+	root *lpg.Node
+	// values[i] are the values of Fields[i]
+	values [][]string
+}
+
+// collect returns the entities and their field values in node order
+func (r *Resolver) collect(g *lpg.Graph) []entityValues {
+	fieldIndex := make(map[string]int, len(r.Fields))
+	for i, f := range r.Fields {
+		fieldIndex[f.SchemaNodeID] = i
+	}
+	roots := ls.GetNodesInstanceOf(g, r.EntitySchemaNodeID)
+	sort.Slice(roots, func(i, j int) bool { return roots[i].GetID() < roots[j].GetID() })
+	ret := make([]entityValues, 0, len(roots))
+	for _, root := range roots {
+		ev := entityValues{root: root, values: make([][]string, len(r.Fields))}
+		ls.IterateDescendants(root, func(node *lpg.Node) bool {
+			ix, ok := fieldIndex[ls.SchemaNodeIDTerm.PropertyValue(node)]
+			if !ok {
+				return true
+			}
+			if v, ok := ls.GetRawNodeValue(node); ok && len(strings.TrimSpace(v)) > 0 {
+				ev.values[ix] = append(ev.values[ix], v)
+			}
+			return true
+		}, ls.FollowEdgesInEntity, false)
+		ret = append(ret, ev)
+	}
+	return ret
+}
+
+// Score returns the match score of two entities given their field
+// values. If a field has multiple values, the field agrees if any
+// pair of values agree.
+func (r *Resolver) Score(values1, values2 [][]string) float64 {
+	score := 0.0
+	for i, f := range r.Fields {
+		if len(values1[i]) == 0 || len(values2[i]) == 0 {
+			continue
+		}
+		agree := false
+		for _, v1 := range values1[i] {
+			for _, v2 := range values2[i] {
+				if f.Compare(v1, v2) {
+					agree = true
+					break
+				}
+			}
+			if agree {
+				break
+			}
+		}
+		if agree {
+			score += f.AgreementWeight()
+		} else {
+			score += f.DisagreementWeight()
+		}
+	}
+	return score
+}
+
+// candidatePairs returns the pairs of entity indexes that share a
+// blocking key. If there are no blocking keys, all pairs are returned.
+func (r *Resolver) candidatePairs(entities []entityValues) [][2]int {
+	blocks := make(map[string][]int)
+	blockFields := make(map[string][]int)
+	blockNames := make([]string, 0)
+	for i, f := range r.Fields {
+		for _, b := range f.Blocks {
+			if _, ok := blockFields[b]; !ok {
+				blockNames = append(blockNames, b)
+			}
+			blockFields[b] = append(blockFields[b], i)
+		}
+	}
+	if len(blockNames) == 0 {
+		ret := make([][2]int, 0)
+		for i := range entities {
+			for j := i + 1; j < len(entities); j++ {
+				ret = append(ret, [2]int{i, j})
+			}
+		}
+		return ret
+	}
+	keys := make([]string, 0)
+	for ix, e := range entities {
+		for _, name := range blockNames {
+			// A blocking key is built for each combination of field values
+			entityKeys := []string{name}
+			for _, fieldIx := range blockFields[name] {
+				next := make([]string, 0)
+				for _, v := range e.values[fieldIx] {
+					bk := r.Fields[fieldIx].blockKey(v)
+					if len(bk) == 0 {
+						continue
+					}
+					for _, k := range entityKeys {
+						next = append(next, k+"\x00"+bk)
+					}
+				}
+				entityKeys = next
+			}
+			for _, k := range entityKeys {
+				if _, ok := blocks[k]; !ok {
+					keys = append(keys, k)
+				}
+				blocks[k] = append(blocks[k], ix)
+			}
+		}
+	}
+	seen := make(map[[2]int]struct{})
+	ret := make([][2]int, 0)
+	for _, k := range keys {
+		members := blocks[k]
+		for i := range members {
+			for j := i + 1; j < len(members); j++ {
+				pair := [2]int{members[i], members[j]}
+				if pair[0] == pair[1] {
+					continue
+				}
+				if pair[0] > pair[1] {
+					pair[0], pair[1] = pair[1], pair[0]
+				}
+				if _, ok := seen[pair]; ok {
+					continue
+				}
+				seen[pair] = struct{}{}
+				ret = append(ret, pair)
+			}
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i][0] != ret[j][0] {
+			return ret[i][0] < ret[j][0]
+		}
+		return ret[i][1] < ret[j][1]
+	})
+	return ret
+}
+
+// FindMatches returns the pairs of matching entities in the graph
+func (r *Resolver) FindMatches(g *lpg.Graph) []Match {
+	entities := r.collect(g)
+	ret := make([]Match, 0)
+	for _, pair := range r.candidatePairs(entities) {
+		e1, e2 := entities[pair[0]], entities[pair[1]]
+		score := r.Score(e1.values, e2.values)
+		if score >= r.Threshold {
+			ret = append(ret, Match{Entity1: e1.root, Entity2: e2.root, Score: score})
+		}
+	}
+	return ret
+}
+
+// Resolve finds the matching entities in the graph and links or
+// merges them based on the resolver action, and returns the matches.
+func (r *Resolver) Resolve(g *lpg.Graph) []Match {
+	matches := r.FindMatches(g)
+	if r.Action == ActionMerge {
+		MergeEntities(g, matches)
+	} else {
+		LinkEntities(g, matches)
+	}
+	return matches
+}
+
+// LinkEntities connects the matching entities with a sameAs edge
+// carrying the match score
+func LinkEntities(g *lpg.Graph, matches []Match) {
+	for _, m := range matches {
+		g.NewEdge(m.Entity1, m.Entity2, SameAsLabel, map[string]any{
+			ScoreTerm.Name: ScoreTerm.MustPropertyValue(m.Score),
+		})
+	}
+}
+
+// MergeEntities merges the groups of matching entities. Matches are
+// transitive, so an entity matching any entity of a group joins that
+// group. The first entity of each group in node order is kept. The
+// edges of the other entities are moved to the kept entity, and the
+// other entities are removed.
+func MergeEntities(g *lpg.Graph, matches []Match) {
+	parent := make(map[*lpg.Node]*lpg.Node)
+	var find func(*lpg.Node) *lpg.Node
+	find = func(n *lpg.Node) *lpg.Node {
+		p, ok := parent[n]
+		if !ok || p == n {
+			return n
+		}
+		root := find(p)
+		parent[n] = root
+		return root
+	}
+	for _, m := range matches {
+		r1, r2 := find(m.Entity1), find(m.Entity2)
+		if r1 == r2 {
+			continue
+		}
+		if r2.GetID() < r1.GetID() {
+			r1, r2 = r2, r1
+		}
+		parent[r2] = r1
+	}
+	merged := make([]*lpg.Node, 0, len(parent))
+	for n := range parent {
+		merged = append(merged, n)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].GetID() < merged[j].GetID() })
+	for _, node := range merged {
+		head := find(node)
+		if head == node {
+			continue
+		}
+		rm := make([]*lpg.Edge, 0)
+		for edges := node.GetEdges(lpg.IncomingEdge); edges.Next(); {
+			edge := edges.Edge()
+			rm = append(rm, edge)
+			if edge.GetFrom() != head {
+				g.NewEdge(edge.GetFrom(), head, edge.GetLabel(), ls.CloneProperties(edge))
+			}
+		}
+		for edges := node.GetEdges(lpg.OutgoingEdge); edges.Next(); {
+			edge := edges.Edge()
+			rm = append(rm, edge)
+			if edge.GetTo() != head {
+				g.NewEdge(head, edge.GetTo(), edge.GetLabel(), ls.CloneProperties(edge))
+			}
+		}
+		for _, edge := range rm {
+			edge.Remove()
+		}
+		node.DetachAndRemove()
+	}
+}
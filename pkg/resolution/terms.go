@@ -0,0 +1,74 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolution
+
+import (
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+const ER = ls.LS + "er/"
+
+// ComparatorTerm marks an attribute as a matching field for entity
+// resolution. The value is one of exact, phonetic, date, or
+// similarity.
+//
+//	{
+//	   @id: lastName,
+//	   @type: Value,
+//	   er/comparator: "phonetic",
+//	   er/m: 0.95,
+//	   er/u: 0.01
+//	}
+var ComparatorTerm = ls.RegisterStringTerm(ls.NewTerm(ER, "comparator").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// MProbabilityTerm gives the probability that the field values agree
+// if the two entities are the same. Default is 0.9.
+var MProbabilityTerm = ls.RegisterFloatTerm(ls.NewTerm(ER, "m").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// UProbabilityTerm gives the probability that the field values agree
+// if the two entities are different. Default is 0.1.
+var UProbabilityTerm = ls.RegisterFloatTerm(ls.NewTerm(ER, "u").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// DateToleranceTerm gives the maximum difference in days for two
+// dates to agree. Default is 0.
+var DateToleranceTerm = ls.RegisterIntegerTerm(ls.NewTerm(ER, "dateTolerance").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// SimilarityThresholdTerm gives the minimum Jaro-Winkler similarity
+// for two strings to agree. Default is 0.85.
+var SimilarityThresholdTerm = ls.RegisterFloatTerm(ls.NewTerm(ER, "similarityThreshold").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// BlockTerm gives the names of the blocking keys that include this
+// field. Only the entities that share the values of all fields of a
+// blocking key are compared. Phonetic fields are blocked by their
+// Soundex codes. If there are no blocking keys, all entity pairs are
+// compared.
+var BlockTerm = ls.RegisterStringSliceTerm(ls.NewTerm(ER, "block").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// ThresholdTerm is specified at the schema root, and gives the
+// minimum match weight for two entities to be considered the
+// same. If not given, half of the maximum possible weight is used.
+var ThresholdTerm = ls.RegisterFloatTerm(ls.NewTerm(ER, "threshold").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// ActionTerm is specified at the schema root, and gives what to do
+// with matching entities. It is either "link" (default), which
+// connects the entities with a sameAs edge, or "merge", which
+// merges the matching entities into one.
+var ActionTerm = ls.RegisterStringTerm(ls.NewTerm(ER, "action").SetComposition(ls.OverrideComposition).SetTags(ls.SchemaElementTag))
+
+// SameAsLabel is the label of the edges linking matching entities
+var SameAsLabel = ER + "sameAs"
+
+// ScoreTerm is the match weight stored in sameAs edges
+var ScoreTerm = ls.RegisterFloatTerm(ls.NewTerm(ER, "score"))
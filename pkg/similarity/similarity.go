@@ -0,0 +1,279 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package similarity contains string similarity and phonetic
+// encoding functions used for fuzzy matching.
+package similarity
+
+import (
+	"strings"
+	"unicode"
+)
+
+// TokenSetSimilarity returns the ratio of the common words to all
+// words in the two strings, ignoring word order, duplicates, and
+// punctuation
+func TokenSetSimilarity(s1, s2 string) float64 {
+	tokens := func(s string) []string {
+		return strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	}
+	t1, t2 := tokens(s1), tokens(s2)
+	if len(t1) == 0 && len(t2) == 0 {
+		return 1
+	}
+	return Jaccard(t1, t2)
+}
+
+func wordSet(words []string) map[string]struct{} {
+	ret := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		ret[w] = struct{}{}
+	}
+	return ret
+}
+
+// Jaccard returns the ratio of the common words to all words of the
+// two word lists, ignoring duplicates. Returns 0 if either list is
+// empty.
+func Jaccard(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	sa, sb := wordSet(a), wordSet(b)
+	common := 0
+	for w := range sa {
+		if _, ok := sb[w]; ok {
+			common++
+		}
+	}
+	return float64(common) / float64(len(sa)+len(sb)-common)
+}
+
+// Overlap returns the fraction of the words of the shorter word list
+// contained in the other. Returns 0 if either list is empty.
+func Overlap(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	sa, sb := wordSet(a), wordSet(b)
+	if len(sa) > len(sb) {
+		sa, sb = sb, sa
+	}
+	common := 0
+	for w := range sa {
+		if _, ok := sb[w]; ok {
+			common++
+		}
+	}
+	return float64(common) / float64(len(sa))
+}
+
+// BigramDice returns the Sorensen-Dice coefficient of the character
+// bigrams of two strings
+func BigramDice(s1, s2 string) float64 {
+	if s1 == s2 {
+		return 1
+	}
+	bigrams := func(s string) map[string]int {
+		r := []rune(s)
+		ret := make(map[string]int)
+		for i := 0; i+1 < len(r); i++ {
+			ret[string(r[i:i+2])]++
+		}
+		return ret
+	}
+	b1, b2 := bigrams(s1), bigrams(s2)
+	n1, n2 := 0, 0
+	common := 0
+	for k, v := range b1 {
+		n1 += v
+		if x := b2[k]; x < v {
+			common += x
+		} else {
+			common += v
+		}
+	}
+	for _, v := range b2 {
+		n2 += v
+	}
+	if n1+n2 == 0 {
+		return 0
+	}
+	return 2 * float64(common) / float64(n1+n2)
+}
+
+// LevenshteinSimilarity returns 1-d/n where d is the edit distance
+// and n is the length of the longer string
+func LevenshteinSimilarity(s1, s2 string) float64 {
+	r1, r2 := []rune(s1), []rune(s2)
+	n := len(r1)
+	if len(r2) > n {
+		n = len(r2)
+	}
+	if n == 0 {
+		return 1
+	}
+	prev := make([]int, len(r2)+1)
+	cur := make([]int, len(r2)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(r1); i++ {
+		cur[0] = i
+		for j := 1; j <= len(r2); j++ {
+			cost := 1
+			if r1[i-1] == r2[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(r2)])/float64(n)
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// JaroWinklerSimilarity returns the Jaro-Winkler similarity of the
+// two strings, using a prefix scale of 0.1 for up to 4 characters
+func JaroWinklerSimilarity(s1, s2 string) float64 {
+	r1, r2 := []rune(s1), []rune(s2)
+	if len(r1) == 0 && len(r2) == 0 {
+		return 1
+	}
+	if len(r1) == 0 || len(r2) == 0 {
+		return 0
+	}
+	window := len(r1)
+	if len(r2) > window {
+		window = len(r2)
+	}
+	window = window/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matched1 := make([]bool, len(r1))
+	matched2 := make([]bool, len(r2))
+	matches := 0
+	for i := range r1 {
+		lo, hi := i-window, i+window+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(r2) {
+			hi = len(r2)
+		}
+		for j := lo; j < hi; j++ {
+			if !matched2[j] && r1[i] == r2[j] {
+				matched1[i], matched2[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+	transpositions := 0
+	j := 0
+	for i := range r1 {
+		if !matched1[i] {
+			continue
+		}
+		for !matched2[j] {
+			j++
+		}
+		if r1[i] != r2[j] {
+			transpositions++
+		}
+		j++
+	}
+	m := float64(matches)
+	jaro := (m/float64(len(r1)) + m/float64(len(r2)) + (m-float64(transpositions/2))/m) / 3
+	prefix := 0
+	for prefix < 4 && prefix < len(r1) && prefix < len(r2) && r1[prefix] == r2[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+var soundexCodes = map[rune]byte{
+	'b': '1', 'f': '1', 'p': '1', 'v': '1',
+	'c': '2', 'g': '2', 'j': '2', 'k': '2', 'q': '2', 's': '2', 'x': '2', 'z': '2',
+	'd': '3', 't': '3',
+	'l': '4',
+	'm': '5', 'n': '5',
+	'r': '6',
+}
+
+// Soundex returns the American Soundex code of a word. Non-letters
+// are ignored. Returns empty string if the word has no letters.
+func Soundex(word string) string {
+	out := make([]byte, 0, 4)
+	var last byte
+	for _, r := range strings.ToLower(word) {
+		if r < 'a' || r > 'z' {
+			continue
+		}
+		code, hasCode := soundexCodes[r]
+		if len(out) == 0 {
+			out = append(out, byte(unicode.ToUpper(r)))
+			last = code
+			continue
+		}
+		switch {
+		case hasCode:
+			if code != last {
+				out = append(out, code)
+			}
+			last = code
+		case r == 'h' || r == 'w':
+			// h and w do not separate letters with the same code
+		default:
+			// vowels separate letters with the same code
+			last = 0
+		}
+		if len(out) == 4 {
+			break
+		}
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	for len(out) < 4 {
+		out = append(out, '0')
+	}
+	return string(out[:4])
+}
+
+// PhoneticKey returns the Soundex codes of the words of s, separated
+// by space
+func PhoneticKey(s string) string {
+	words := strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) })
+	codes := make([]string, 0, len(words))
+	for _, w := range words {
+		if c := Soundex(w); len(c) > 0 {
+			codes = append(codes, c)
+		}
+	}
+	return strings.Join(codes, " ")
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package similarity
+
+import (
+	"testing"
+)
+
+func TestSoundex(t *testing.T) {
+	for word, code := range map[string]string{
+		"Robert":   "R163",
+		"Rupert":   "R163",
+		"Ashcraft": "A261",
+		"Tymczak":  "T522",
+		"Pfister":  "P236",
+		"Lee":      "L000",
+		"123":      "",
+	} {
+		if s := Soundex(word); s != code {
+			t.Errorf("Soundex %s: expected %s got %s", word, code, s)
+		}
+	}
+}
+
+func TestWordSimilarity(t *testing.T) {
+	if s := Jaccard([]string{"home", "city", "city"}, []string{"city"}); s != 0.5 {
+		t.Errorf("Wrong jaccard: %v", s)
+	}
+	if s := Overlap([]string{"home", "city"}, []string{"city"}); s != 1 {
+		t.Errorf("Wrong overlap: %v", s)
+	}
+	if s := BigramDice("night", "nacht"); s != 0.25 {
+		t.Errorf("Wrong dice: %v", s)
+	}
+	if s := TokenSetSimilarity("New York, NY", "NY New York"); s != 1 {
+		t.Errorf("Wrong token set similarity: %v", s)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/opencypher"
+)
+
+// ScriptFunction is a function defined in the functions section of a
+// transformation script. The function body is an openCypher query
+// that can refer to the parameters as variables. If the query returns
+// a single value, that value is the function result.
+//
+// The body is evaluated in a subcontext of the calling expression, so
+// the variables of the caller that are not shadowed by the parameters
+// are visible in the body. Functions should only use their
+// parameters. Functions can call other script functions, and can be
+// recursive up to MaxScriptFunctionCallDepth nested calls.
+//
+//	functions:
+//	  fullName:
+//	    params: [given, family]
+//	    expr: return trim(given + ' ' + family)
+type ScriptFunction struct {
+	Params []string `json:"params,omitempty" yaml:"params,omitempty"`
+	Expr   string   `json:"expr" yaml:"expr"`
+
+	name     string
+	compiled opencypher.Evaluatable
+}
+
+// scriptFunctionsParameter is the evaluation context parameter that
+// holds the functions of the script being evaluated. It is not a
+// valid parameter name in openCypher, so it cannot be referenced
+// from expressions.
+const scriptFunctionsParameter = "$transform/functions"
+
+// scriptFunctionDepthParameter is the evaluation context parameter
+// that holds the number of nested script function calls
+const scriptFunctionDepthParameter = "$transform/callDepth"
+
+// MaxScriptFunctionCallDepth is the maximum number of nested script
+// function calls
+const MaxScriptFunctionCallDepth = 100
+
+var (
+	identifierPattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	functionNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+	// Script function names registered as global dispatchers
+	scriptFunctionNames   = map[string]struct{}{}
+	scriptFunctionNamesMu sync.Mutex
+)
+
+// registerScriptFunction registers a global function that dispatches
+// the call to the function with the same name in the calling
+// script. This allows different scripts to define functions with the
+// same name.
+func registerScriptFunction(name string) error {
+	scriptFunctionNamesMu.Lock()
+	defer scriptFunctionNamesMu.Unlock()
+	if _, ok := scriptFunctionNames[name]; ok {
+		return nil
+	}
+	if ls.IsFunctionDefined(name) {
+		return fmt.Errorf("Function %s is already defined", name)
+	}
+	opencypher.RegisterGlobalFunc(opencypher.Function{
+		Name:    name,
+		MinArgs: 0,
+		MaxArgs: -1,
+		ValueFunc: func(ctx *opencypher.EvalContext, args []opencypher.Value) (opencypher.Value, error) {
+			fn := getScriptFunction(ctx, name)
+			if fn == nil {
+				return nil, opencypher.ErrUnknownFunction{Name: name}
+			}
+			return fn.call(ctx, args)
+		},
+	})
+	scriptFunctionNames[name] = struct{}{}
+	return nil
+}
+
+func getScriptFunction(ctx *opencypher.EvalContext, name string) *ScriptFunction {
+	v, err := ctx.GetParameter(scriptFunctionsParameter)
+	if err != nil || v == nil {
+		return nil
+	}
+	functions, _ := v.Get().(map[string]*ScriptFunction)
+	return functions[name]
+}
+
+func (fn *ScriptFunction) compile(cctx *ls.CompileContext, name string) error {
+	if !functionNamePattern.MatchString(name) {
+		return fmt.Errorf("Invalid function name: %s", name)
+	}
+	seen := make(map[string]struct{})
+	for _, p := range fn.Params {
+		if !identifierPattern.MatchString(p) {
+			return fmt.Errorf("Function %s: invalid parameter name: %s", name, p)
+		}
+		if _, ok := seen[p]; ok {
+			return fmt.Errorf("Function %s: duplicate parameter: %s", name, p)
+		}
+		seen[p] = struct{}{}
+	}
+	compiled, err := cctx.CompileOpencypher(fn.Expr)
+	if err != nil {
+		return fmt.Errorf("Function %s: %w", name, err)
+	}
+	fn.name = name
+	fn.compiled = compiled
+	return registerScriptFunction(name)
+}
+
+func (fn *ScriptFunction) call(ctx *opencypher.EvalContext, args []opencypher.Value) (opencypher.Value, error) {
+	if len(args) != len(fn.Params) {
+		return nil, opencypher.ErrInvalidFunctionCall{Msg: fmt.Sprintf("'%s' needs %d arguments, got %d", fn.name, len(fn.Params), len(args))}
+	}
+	depth := 0
+	if v, err := ctx.GetParameter(scriptFunctionDepthParameter); err == nil && v != nil {
+		depth, _ = v.Get().(int)
+	}
+	if depth >= MaxScriptFunctionCallDepth {
+		return nil, fmt.Errorf("In %s: maximum function call depth %d exceeded", fn.name, MaxScriptFunctionCallDepth)
+	}
+	sub := ctx.SubContext()
+	sub.SetParameter(scriptFunctionDepthParameter, opencypher.RValue{Value: depth + 1})
+	for i, p := range fn.Params {
+		sub.SetVar(p, args[i])
+	}
+	v, err := fn.compiled.Evaluate(sub)
+	if err != nil {
+		return nil, fmt.Errorf("In %s: %w", fn.name, err)
+	}
+	rs, ok := v.Get().(opencypher.ResultSet)
+	if !ok {
+		return v, nil
+	}
+	if len(rs.Rows) == 0 {
+		return opencypher.RValue{}, nil
+	}
+	if len(rs.Rows) == 1 && len(rs.Rows[0]) == 1 {
+		for _, x := range rs.Rows[0] {
+			return x, nil
+		}
+	}
+	return v, nil
+}
+
+// SetFunctions sets the script functions in the evaluation
+// context. Expressions evaluated using ctx, or one of its
+// subcontexts, can call the script functions.
+func (t *TransformScript) SetFunctions(ctx *opencypher.EvalContext) {
+	if t == nil || len(t.Functions) == 0 {
+		return
+	}
+	ctx.SetParameter(scriptFunctionsParameter, opencypher.RValue{Value: t.Functions})
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/opencypher"
+)
+
+func compileTestScript(t *testing.T, str string) *TransformScript {
+	var script TransformScript
+	if err := json.Unmarshal([]byte(str), &script); err != nil {
+		t.Fatal(err)
+	}
+	if err := script.Compile(ls.DefaultContext()); err != nil {
+		t.Fatal(err)
+	}
+	return &script
+}
+
+func evalWithScript(script *TransformScript, expr string) (any, error) {
+	ectx := ls.NewEvalContext(ls.NewDocumentGraph())
+	script.SetFunctions(ectx)
+	e, err := opencypher.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	v, err := e.Evaluate(ectx)
+	if err != nil {
+		return nil, err
+	}
+	rs := v.Get().(opencypher.ResultSet)
+	for _, x := range rs.Rows[0] {
+		return x.Get(), nil
+	}
+	return nil, nil
+}
+
+func TestScriptFunctions(t *testing.T) {
+	script := compileTestScript(t, `{
+ "functions": {
+   "fullName": {
+     "params": ["given", "family"],
+     "expr": "return trim(given + ' ' + family)"
+   },
+   "test.initials": {
+     "params": ["given", "family"],
+     "expr": "return left(given, 1) + left(family, 1) + ' ' + fullName(given, family)"
+   },
+   "birthDate": {
+     "params": ["d"],
+     "expr": "return types.parseDate(d, '01/02/2006')"
+   }
+ }
+}`)
+	for expr, expected := range map[string]any{
+		"return fullName('John', 'Doe')":       "John Doe",
+		"return test.initials('John', 'Doe')":  "JD John Doe",
+		"return birthDate('12/31/2021')":       "2021-12-31",
+		"return types.parseDate('2021-12-31')": "2021-12-31",
+	} {
+		v, err := evalWithScript(script, expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if v != expected {
+			t.Errorf("%s: expected %v, got %v", expr, expected, v)
+		}
+	}
+	if _, err := evalWithScript(script, "return fullName('John')"); err == nil {
+		t.Errorf("Expected argument count error")
+	}
+
+	// Another script can define a function with the same name
+	other := compileTestScript(t, `{"functions": {"fullName": {"params": ["a", "b"], "expr": "return b + ', ' + a"}}}`)
+	v, err := evalWithScript(other, "return fullName('John', 'Doe')")
+	if err != nil || v != "Doe, John" {
+		t.Errorf("Wrong result from other script: %v %v", v, err)
+	}
+	// Script functions are not visible without the script
+	if _, err := evalWithScript(nil, "return fullName('John', 'Doe')"); err == nil {
+		t.Errorf("Expected unknown function error")
+	}
+
+	// Unbounded recursion is an error
+	recursive := compileTestScript(t, `{
+ "functions": {
+   "countdown": {"params": ["n"], "expr": "return case when n = 0 then 'done' else countdown(n - 1) end"},
+   "ping": {"params": ["x"], "expr": "return pong(x)"},
+   "pong": {"params": ["x"], "expr": "return ping(x)"}
+ }
+}`)
+	if v, err := evalWithScript(recursive, "return countdown(10)"); err != nil || v != "done" {
+		t.Errorf("Wrong recursive result: %v %v", v, err)
+	}
+	if _, err := evalWithScript(recursive, "return countdown(-1)"); err == nil {
+		t.Errorf("Expected call depth error")
+	}
+	if _, err := evalWithScript(recursive, "return ping(1)"); err == nil {
+		t.Errorf("Expected call depth error")
+	}
+
+	// Builtin functions cannot be redefined
+	var bad TransformScript
+	if err := json.Unmarshal([]byte(`{"functions": {"trim": {"params": ["x"], "expr": "return x"}}}`), &bad); err != nil {
+		t.Fatal(err)
+	}
+	if err := bad.Compile(ls.DefaultContext()); err == nil {
+		t.Errorf("Expected error redefining trim")
+	}
+}
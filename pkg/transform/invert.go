@@ -0,0 +1,182 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+// NonInvertibleMapping describes a reshape node of a script that
+// cannot be inverted
+type NonInvertibleMapping struct {
+	Target string `json:"target" yaml:"target"`
+	Reason string `json:"reason" yaml:"reason"`
+}
+
+func (n NonInvertibleMapping) String() string {
+	return fmt.Sprintf("%s: %s", n.Target, n.Reason)
+}
+
+var (
+	quotedStringPattern = `(?:'((?:[^'\\]|\\.)*)'|"((?:[^"\\]|\\.)*)")`
+	// match (n) where n.`schemaNodeId`='id' return n
+	directNodeRefWhere = regexp.MustCompile(`(?is)^\s*match\s*\(\s*(\w+)\s*\)\s*where\s+(\w+)\s*\.\s*` + "`" + regexp.QuoteMeta(ls.SchemaNodeIDTerm.Name) + "`" + `\s*=\s*` + quotedStringPattern + `\s+return\s+(\w+)\s*$`)
+	// match (n {`schemaNodeId`: 'id'}) return n
+	directNodeRefProperty = regexp.MustCompile(`(?is)^\s*match\s*\(\s*(\w+)\s*\{\s*` + "`" + regexp.QuoteMeta(ls.SchemaNodeIDTerm.Name) + "`" + `\s*:\s*` + quotedStringPattern + `\s*\}\s*\)\s*return\s+(\w+)\s*$`)
+)
+
+func unescapeQuoted(s string) string {
+	var b strings.Builder
+	escape := false
+	for _, r := range s {
+		if escape {
+			b.WriteRune(r)
+			escape = false
+			continue
+		}
+		if r == '\\' {
+			escape = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ParseSourceNodeExpr parses a direct node reference expression, and
+// returns the referenced source schema node id. The expression is of
+// the form
+//
+//	match (n) where n.`https://lschema.org/schemaNodeId`='id' return n
+//
+// or
+//
+//	match (n {`https://lschema.org/schemaNodeId`: 'id'}) return n
+func ParseSourceNodeExpr(expr string) (string, bool) {
+	if m := directNodeRefWhere.FindStringSubmatch(expr); m != nil {
+		if m[1] != m[2] || m[1] != m[5] {
+			return "", false
+		}
+		return unescapeQuoted(m[3] + m[4]), true
+	}
+	if m := directNodeRefProperty.FindStringSubmatch(expr); m != nil {
+		if m[1] != m[4] {
+			return "", false
+		}
+		return unescapeQuoted(m[2] + m[3]), true
+	}
+	return "", false
+}
+
+// directSource returns the source schema node id of a reshape node
+// that is a direct field mapping
+func directSource(ann NodeTransformAnnotations) (string, error) {
+	source := ""
+	keys := make([]string, 0, len(ann))
+	for k := range ann {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var values []string
+		switch v := ann[k].(type) {
+		case ls.PropertyValue:
+			values = v.AsStringSlice()
+		case string:
+			values = []string{v}
+		case []string:
+			values = v
+		}
+		switch k {
+		case ValueExprTerm.Name, SourceTerm.Name, SourcesTerm.Name:
+			if len(source) > 0 {
+				return "", fmt.Errorf("Multiple value sources")
+			}
+		}
+		switch k {
+		case ValueExprTerm.Name:
+			if len(values) != 1 {
+				return "", fmt.Errorf("%s has %d expressions, exactly one is required", k, len(values))
+			}
+			id, ok := ParseSourceNodeExpr(values[0])
+			if !ok {
+				return "", fmt.Errorf("%s is not a direct node reference: %s", k, values[0])
+			}
+			source = id
+		case SourceTerm.Name, SourcesTerm.Name:
+			if len(values) != 1 {
+				return "", fmt.Errorf("%s has %d source nodes, exactly one is required", k, len(values))
+			}
+			source = values[0]
+		default:
+			return "", fmt.Errorf("Uses %s", k)
+		}
+	}
+	if len(source) == 0 {
+		return "", fmt.Errorf("No value source")
+	}
+	return source, nil
+}
+
+// Invert returns a script that maps the target schema of t back to
+// its source schema. Only reshape nodes that copy a single source
+// node using a source mapping, or a direct valueExpr node reference
+// (see ParseSourceNodeExpr) can be inverted. The inverse uses source
+// mappings, so the source nodes are selected under the map context. The returned
+// list describes the reshape nodes that cannot be inverted, sorted
+// by target. If multiple targets use the same source node, the first
+// target in sort order is used in the inverse.
+func (t *TransformScript) Invert() (*TransformScript, []NonInvertibleMapping) {
+	ret := &TransformScript{
+		TargetSchemaNodes: make(map[string]NodeTransformAnnotations),
+	}
+	nonInvertible := make([]NonInvertibleMapping, 0)
+	if t == nil {
+		return ret, nonInvertible
+	}
+	targets := make([]string, 0, len(t.TargetSchemaNodes))
+	for k := range t.TargetSchemaNodes {
+		targets = append(targets, k)
+	}
+	sort.Strings(targets)
+	inverseOf := make(map[string]string)
+	for _, target := range targets {
+		source, err := directSource(t.TargetSchemaNodes[target])
+		if err != nil {
+			nonInvertible = append(nonInvertible, NonInvertibleMapping{Target: target, Reason: err.Error()})
+			continue
+		}
+		// Target key may be a path. The last element is the schema node id
+		fields := strings.Fields(target)
+		if len(fields) == 0 {
+			nonInvertible = append(nonInvertible, NonInvertibleMapping{Target: target, Reason: "Empty target"})
+			continue
+		}
+		if existing, ok := inverseOf[source]; ok {
+			nonInvertible = append(nonInvertible, NonInvertibleMapping{Target: target, Reason: fmt.Sprintf("Source %s is already mapped to %s", source, existing)})
+			continue
+		}
+		inverseOf[source] = target
+		ret.TargetSchemaNodes[source] = NodeTransformAnnotations{
+			SourceTerm.Name: ls.NewPropertyValue(SourceTerm.Name, fields[len(fields)-1]),
+		}
+	}
+	return ret, nonInvertible
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseSourceNodeExpr(t *testing.T) {
+	for expr, id := range map[string]string{
+		"match (n) where n.`https://lschema.org/schemaNodeId`='src.a' return n":                  "src.a",
+		"match (n) where n.`https://lschema.org/schemaNodeId`='http://example.org/a#b' return n": "http://example.org/a#b",
+		"match (n) where n.`https://lschema.org/schemaNodeId`='it\\'s' return n":                 `it's`,
+	} {
+		got, ok := ParseSourceNodeExpr(expr)
+		if !ok || got != id {
+			t.Errorf("Cannot parse %s: %s", expr, got)
+		}
+	}
+	for _, id := range []string{"src.a", "http://example.org/a#b", `it's`} {
+		if got, ok := ParseSourceNodeExpr(SourceNodeExpr(id)); !ok || got != id {
+			t.Errorf("Cannot parse %s: %s", SourceNodeExpr(id), got)
+		}
+	}
+	if got, ok := ParseSourceNodeExpr("MATCH (x {`https://lschema.org/schemaNodeId`: \"src.a\"}) RETURN x"); !ok || got != "src.a" {
+		t.Errorf("Cannot parse property form: %s", got)
+	}
+	for _, expr := range []string{
+		"return 'literal'",
+		"match (n) where m.`https://lschema.org/schemaNodeId`='a' return n",
+		"match (n)-[]->(m) where n.`https://lschema.org/schemaNodeId`='a' return m",
+	} {
+		if _, ok := ParseSourceNodeExpr(expr); ok {
+			t.Errorf("Expected not to parse: %s", expr)
+		}
+	}
+}
+
+func TestInvertScript(t *testing.T) {
+	var script TransformScript
+	if err := json.Unmarshal([]byte(`{
+ "reshapeNodes": {
+   "tgt.name": {
+     "valueExpr": "match (n) where n.`+"`https://lschema.org/schemaNodeId`"+`='src.name' return n"
+   },
+   "tgt.addr tgt.addr.city": {
+     "source": "src.city"
+   },
+   "tgt.literal": {
+     "valueExpr": "return 'literal'"
+   },
+   "tgt.full": {
+     "sources": ["src.first", "src.last"]
+   },
+   "tgt.name2": {
+     "valueExpr": "match (n) where n.`+"`https://lschema.org/schemaNodeId`"+`='src.name' return n"
+   },
+   "tgt.ctx": {
+     "mapContext": "match (n) return n"
+   },
+   " ": {
+     "source": "src.blank"
+   }
+ }
+}`), &script); err != nil {
+		t.Fatal(err)
+	}
+	inverse, nonInvertible := script.Invert()
+	sources := make(map[string]string)
+	for k, ann := range inverse.TargetSchemaNodes {
+		if _, ok := ann[SourceTerm.Name]; !ok {
+			t.Errorf("%s: expected source mapping: %v", k, ann)
+		}
+		src, err := directSource(ann)
+		if err != nil {
+			t.Errorf("%s: %v", k, err)
+		}
+		sources[k] = src
+	}
+	expected := map[string]string{
+		"src.name": "tgt.name",
+		"src.city": "tgt.addr.city",
+	}
+	if !reflect.DeepEqual(sources, expected) {
+		t.Errorf("Expected %v got %v", expected, sources)
+	}
+	targets := make([]string, 0)
+	for _, x := range nonInvertible {
+		targets = append(targets, x.Target)
+	}
+	if !reflect.DeepEqual(targets, []string{" ", "tgt.ctx", "tgt.full", "tgt.literal", "tgt.name2"}) {
+		t.Errorf("Wrong non-invertible mappings: %v", nonInvertible)
+	}
+	// The inverse must be usable as a script
+	data, err := json.Marshal(inverse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s TransformScript
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.TargetSchemaNodes) != 2 {
+		t.Errorf("Wrong unmarshaled inverse: %s", string(data))
+	}
+}
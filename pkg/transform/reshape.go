@@ -31,6 +31,12 @@ type Reshaper struct {
 	Script       *TransformScript
 
 	Config ReshapeConfig
+
+	// If Trace is not nil, the processing of each target schema node
+	// is recorded in it
+	Trace *ReshapeTrace
+	// If DryRun is set, the target graph is not built
+	DryRun bool
 }
 
 type ReshapeConfig struct {
@@ -64,6 +70,7 @@ type reshapeContext struct {
 	parent      *reshapeContext
 	symbols     map[string]opencypher.Value
 	sourceGraph *lpg.Graph
+	script      *TransformScript
 
 	schemaPath    path[*lpg.Node]
 	generatedPath path[*txDocNode]
@@ -165,6 +172,7 @@ func (ctx *reshapeContext) fillEvalContext(ectx *opencypher.EvalContext) {
 
 func (ctx *reshapeContext) getEvalContext() *opencypher.EvalContext {
 	ectx := ls.NewEvalContext(ctx.sourceGraph)
+	ctx.script.SetFunctions(ectx)
 	ctx.fillEvalContext(ectx)
 	return ectx
 }
@@ -218,6 +226,7 @@ func (reshaper Reshaper) Reshape(ctx *ls.Context, sourceGraph *lpg.Graph, ingest
 		Context:                  ctx,
 		symbols:                  make(map[string]opencypher.Value),
 		sourceGraph:              sourceGraph,
+		script:                   reshaper.Script,
 		preserveNodeNamespaces:   make(map[string]struct{}),
 		preserveNodePropertyTags: make(map[string]struct{}),
 	}
@@ -241,6 +250,9 @@ func (reshaper Reshaper) Reshape(ctx *ls.Context, sourceGraph *lpg.Graph, ingest
 	if err := reshaper.fillNodes(roots); err != nil {
 		return err
 	}
+	if reshaper.DryRun {
+		return nil
+	}
 	for _, root := range roots {
 		_, err := ingester.Ingest(reshaper.Builder, root)
 		if err != nil {
@@ -254,20 +266,27 @@ func (reshaper Reshaper) Reshape(ctx *ls.Context, sourceGraph *lpg.Graph, ingest
 }
 
 // Returns true if operation produced any output
-func (reshaper Reshaper) reshapeNode(ctx *reshapeContext) ([]*txDocNode, error) {
+func (reshaper Reshaper) reshapeNode(ctx *reshapeContext) (output []*txDocNode, err error) {
 	// last element of schemaPath is the schema node to reshape
 	ctx = ctx.sub()
 	schemaNode := ctx.schemaPath.last()
 	schemaNodeID := ls.GetNodeID(schemaNode)
 	ctx.GetLogger().Debug(map[string]interface{}{"mth": "reshapeNode", "building": schemaNodeID})
 
+	trace := reshaper.Trace.newEntry(ctx.schemaPath.items)
+	reason := ""
+	defer func() {
+		trace.finish(output, reason, err)
+	}()
+
 	// Evaluate expressions and export values
-	for _, expr := range EvaluateTermSemantics.GetEvaluatables(reshaper.Script.GetProperties(ctx.schemaPath.items)) {
+	for i, expr := range EvaluateTermSemantics.GetEvaluatables(reshaper.Script.GetProperties(ctx.schemaPath.items)) {
 		evalContext := ctx.getEvalContext()
 		v, err := expr.Evaluate(evalContext)
 		if err != nil {
 			return nil, wrapReshapeError(err, schemaNodeID)
 		}
+		trace.addEvaluation(EvaluateTerm.Name, exprString(reshaper.Script.GetProperties(ctx.schemaPath.items), EvaluateTerm.Name, i), v)
 		ctx.GetLogger().Info(map[string]interface{}{"reshape": schemaNodeID,
 			"evaluateTermExpr": EvaluateTermSemantics.Get(reshaper.Script.GetProperties(ctx.schemaPath.items)),
 			"result":           v})
@@ -281,18 +300,20 @@ func (reshaper Reshaper) reshapeNode(ctx *reshapeContext) ([]*txDocNode, error)
 			}
 		}
 	}
+	trace.exportVars(ctx.symbols)
 	processValueExpr := func(term string) ([]opencypher.Value, error) {
 		evaluatables := ValueExprTermSemantics.GetEvaluatables(term, reshaper.Script.GetProperties(ctx.schemaPath.items))
 		if len(evaluatables) == 0 {
 			return nil, nil
 		}
 		ret := make([]opencypher.Value, 0, len(evaluatables))
-		for _, evaluatable := range evaluatables {
+		for i, evaluatable := range evaluatables {
 			evalContext := ctx.getEvalContext()
 			sv, err := evaluatable.Evaluate(evalContext)
 			if err != nil {
 				return nil, err
 			}
+			trace.addEvaluation(term, exprString(reshaper.Script.GetProperties(ctx.schemaPath.items), term, i), sv)
 			ret = append(ret, sv)
 			if term == ValueExprTerm.Name || term == ValueExprFirstTerm.Name {
 				if !isEmptyValue(sv) {
@@ -355,6 +376,7 @@ func (reshaper Reshaper) reshapeNode(ctx *reshapeContext) ([]*txDocNode, error)
 		ctx.GetLogger().Debug(map[string]interface{}{"reshape": schemaNodeID, "valueFrom": MapPropertyTerm.Name})
 		// Find the nodes under the map context whose mapProperty property points to schemaNodeID
 		nodeValues := reshaper.findNodesUnderMapContext(ctx, mapProperty, []string{schemaNodeID})
+		trace.addSources(MapPropertyTerm.Name, nodeValues)
 		for _, v := range nodeValues {
 			results = append(results, opencypher.RValue{Value: v})
 		}
@@ -368,6 +390,7 @@ func (reshaper Reshaper) reshapeNode(ctx *reshapeContext) ([]*txDocNode, error)
 		ctx.GetLogger().Debug(map[string]interface{}{"reshape": schemaNodeID, "valueFrom": "map by target"})
 		// Find the nodes under the map context whose source node ID is given in
 		nodeValues := reshaper.findNodesUnderMapContext(ctx, ls.SchemaNodeIDTerm.Name, nodeMappings)
+		trace.addSources(SourceTerm.Name, nodeValues)
 		for _, v := range nodeValues {
 			results = append(results, opencypher.RValue{Value: v})
 		}
@@ -383,6 +406,7 @@ func (reshaper Reshaper) reshapeNode(ctx *reshapeContext) ([]*txDocNode, error)
 				if err != nil {
 					return nil, wrapReshapeError(err, schemaNodeID)
 				}
+				trace.addEvaluation(MapContextTerm.Name, MapContextTerm.PropertyValue(reshaper.Script.GetProperties(ctx.schemaPath.items)), mapContext)
 				ctx.GetLogger().Debug(map[string]interface{}{"reshape": schemaNodeID, "mapContext": mapContext})
 				node, err := getAtMostOneNode(mapContext)
 				if err != nil {
@@ -413,6 +437,7 @@ func (reshaper Reshaper) reshapeNode(ctx *reshapeContext) ([]*txDocNode, error)
 				for _, row := range rs.Rows {
 					if !isEmptyRow(row) {
 						ctx.exportVars(row)
+						trace.exportVars(ctx.symbols)
 						v, err := process(opencypher.ResultSet{Rows: []map[string]opencypher.Value{row}})
 						if err != nil {
 							return nil, err
@@ -436,6 +461,11 @@ func (reshaper Reshaper) reshapeNode(ctx *reshapeContext) ([]*txDocNode, error)
 				ret = append(ret, v...)
 			}
 		}
+		if len(ret) == 0 {
+			reason = "Expressions and mappings returned only empty results"
+		} else {
+			reason = fmt.Sprintf("Generated from %d expression/mapping results", len(results))
+		}
 		return ret, nil
 	}
 
@@ -446,10 +476,13 @@ func (reshaper Reshaper) reshapeNode(ctx *reshapeContext) ([]*txDocNode, error)
 			return nil, err
 		}
 		if v == nil {
+			reason = "No expression or mapping results, and no child nodes were generated"
 			return nil, nil
 		}
+		reason = "No expression or mapping results, generated from child nodes"
 		return []*txDocNode{v}, nil
 	}
+	reason = "No expression or mapping results for value node"
 	return nil, nil
 }
 
@@ -0,0 +1,368 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/similarity"
+	"github.com/cloudprivacylabs/lsa/pkg/types"
+)
+
+// OWLSameAs is the default concept term. Source and target attributes
+// annotated with the same owl:sameAs value are matched
+const OWLSameAs = "http://www.w3.org/2002/07/owl#sameAs"
+
+// SuggestOptions control how source and target attributes are
+// compared
+type SuggestOptions struct {
+	// Matches with score at least Threshold are used in the draft
+	// script. Default 0.75
+	Threshold float64 `json:"threshold" yaml:"threshold"`
+	// Candidates with score less than MinScore are not reported. Default 0.4
+	MinScore float64 `json:"minScore" yaml:"minScore"`
+	// Maximum number of candidates reported for a target
+	// attribute. Default 3
+	MaxCandidates int `json:"maxCandidates" yaml:"maxCandidates"`
+	// ConceptTerms are the terms whose values identify what an
+	// attribute represents. If a source and a target attribute share a
+	// value for any of these terms, they are matched. Default
+	// owl:sameAs
+	ConceptTerms []string `json:"conceptTerms" yaml:"conceptTerms"`
+}
+
+func (opt SuggestOptions) withDefaults() SuggestOptions {
+	if opt.Threshold == 0 {
+		opt.Threshold = 0.75
+	}
+	if opt.MinScore == 0 {
+		opt.MinScore = 0.4
+	}
+	if opt.MaxCandidates == 0 {
+		opt.MaxCandidates = 3
+	}
+	if len(opt.ConceptTerms) == 0 {
+		opt.ConceptTerms = []string{OWLSameAs}
+	}
+	return opt
+}
+
+// MappingCandidate is a source attribute that can be mapped to a
+// target attribute
+type MappingCandidate struct {
+	SourceID string   `json:"source" yaml:"source"`
+	Score    float64  `json:"score" yaml:"score"`
+	Reasons  []string `json:"reasons,omitempty" yaml:"reasons,omitempty"`
+}
+
+func (c MappingCandidate) String() string {
+	return fmt.Sprintf("%s (%.2f: %s)", c.SourceID, c.Score, strings.Join(c.Reasons, ", "))
+}
+
+// MappingSuggestion gives the suggested mapping for a target
+// attribute. If Match is nil, there is no confident match.
+type MappingSuggestion struct {
+	TargetID   string             `json:"target" yaml:"target"`
+	Match      *MappingCandidate  `json:"match,omitempty" yaml:"match,omitempty"`
+	Candidates []MappingCandidate `json:"candidates,omitempty" yaml:"candidates,omitempty"`
+}
+
+// attributeFeatures contains the normalized features of an attribute
+// used for comparison
+type attributeFeatures struct {
+	id        string
+	name      []string
+	path      []string
+	desc      []string
+	primitive types.Primitive
+	hasType   bool
+	concepts  []string
+}
+
+func nodeStrings(node *lpg.Node, term string) []string {
+	v, ok := node.GetProperty(term)
+	if !ok {
+		return nil
+	}
+	if pv, ok := v.(ls.PropertyValue); ok {
+		return pv.AsStringSlice()
+	}
+	if s, ok := v.(string); ok {
+		return []string{s}
+	}
+	return nil
+}
+
+func nodeString(node *lpg.Node, term string) string {
+	return strings.Join(nodeStrings(node, term), " ")
+}
+
+// splitWords splits an identifier or text into lowercase words
+func splitWords(s string) []string {
+	ret := ls.SplitWords(s)
+	for i := range ret {
+		ret[i] = strings.ToLower(ret[i])
+	}
+	return ret
+}
+
+var descriptionStopWords = map[string]struct{}{
+	"a": {}, "an": {}, "the": {}, "of": {}, "and": {}, "or": {}, "to": {}, "in": {}, "is": {}, "for": {}, "on": {}, "by": {}, "with": {}, "this": {}, "that": {}, "as": {}, "be": {}, "it": {}, "at": {},
+}
+
+// attributeLocalName returns the attribute name, or the last part of
+// the attribute id
+func attributeLocalName(node *lpg.Node) string {
+	if s := nodeString(node, ls.AttributeNameTerm.Name); len(s) > 0 {
+		return s
+	}
+	id := ls.GetNodeID(node)
+	if ix := strings.LastIndexAny(id, "/#:."); ix != -1 && ix+1 < len(id) {
+		return id[ix+1:]
+	}
+	return id
+}
+
+func getAttributeFeatures(node *lpg.Node, path []*lpg.Node, conceptTerms []string) attributeFeatures {
+	ret := attributeFeatures{
+		id:   ls.GetNodeID(node),
+		name: splitWords(attributeLocalName(node)),
+	}
+	// Path does not include the schema root and the node itself
+	for i := 1; i < len(path)-1; i++ {
+		if ls.IsAttributeNode(path[i]) && path[i].HasLabel(ls.AttributeTypeArray.Name) {
+			// Array elements usually have no name
+			continue
+		}
+		ret.path = append(ret.path, splitWords(attributeLocalName(path[i]))...)
+	}
+	for _, w := range splitWords(nodeString(node, ls.DescriptionTerm.Name)) {
+		if _, stop := descriptionStopWords[w]; !stop {
+			ret.desc = append(ret.desc, w)
+		}
+	}
+	if vt := nodeString(node, ls.ValueTypeTerm.Name); len(vt) > 0 {
+		ret.hasType = true
+		ret.primitive = types.GetPrimitive(vt)
+	}
+	for _, term := range conceptTerms {
+		ret.concepts = append(ret.concepts, nodeStrings(node, term)...)
+	}
+	return ret
+}
+
+// nameSimilarity returns the best of word similarity, character
+// similarity, and containment (homeCity and city), with containment
+// scored lower than an exact match
+func nameSimilarity(a, b []string) float64 {
+	ret := similarity.Jaccard(a, b)
+	if d := similarity.BigramDice(strings.Join(a, ""), strings.Join(b, "")); d > ret {
+		ret = d
+	}
+	if o := 0.8 * similarity.Overlap(a, b); o > ret {
+		ret = o
+	}
+	return ret
+}
+
+func typeCompatibility(a, b attributeFeatures) float64 {
+	if !a.hasType || !b.hasType {
+		return 0.5
+	}
+	if a.primitive == b.primitive {
+		return 1
+	}
+	numeric := func(p types.Primitive) bool {
+		return p == types.PrimitiveInteger || p == types.PrimitiveNumber
+	}
+	temporal := func(p types.Primitive) bool {
+		return p == types.PrimitiveDate || p == types.PrimitiveDateTime
+	}
+	if (numeric(a.primitive) && numeric(b.primitive)) || (temporal(a.primitive) && temporal(b.primitive)) {
+		return 0.8
+	}
+	if a.primitive == types.PrimitiveString || b.primitive == types.PrimitiveString {
+		return 0.4
+	}
+	return 0
+}
+
+// compareAttributes returns a similarity score between 0 and 1, and
+// the reasons contributing to the score
+func compareAttributes(source, target attributeFeatures) (float64, []string) {
+	for _, c := range source.concepts {
+		for _, x := range target.concepts {
+			if c == x {
+				return 1, []string{"concept " + c}
+			}
+		}
+	}
+	type component struct {
+		name   string
+		weight float64
+		score  float64
+	}
+	components := []component{
+		{name: "name", weight: 0.5, score: nameSimilarity(source.name, target.name)},
+		{name: "type", weight: 0.15, score: typeCompatibility(source, target)},
+	}
+	if len(source.path) > 0 && len(target.path) > 0 {
+		components = append(components, component{name: "path", weight: 0.2, score: similarity.Jaccard(source.path, target.path)})
+	}
+	if len(source.desc) > 0 && len(target.desc) > 0 {
+		components = append(components, component{name: "description", weight: 0.15, score: similarity.Jaccard(source.desc, target.desc)})
+	}
+	total := 0.0
+	weights := 0.0
+	reasons := make([]string, 0, len(components))
+	for _, c := range components {
+		total += c.weight * c.score
+		weights += c.weight
+		if c.score > 0 {
+			reasons = append(reasons, fmt.Sprintf("%s %.2f", c.name, c.score))
+		}
+	}
+	score := total / weights
+	// An incompatible value type rules out the match
+	if source.hasType && target.hasType && typeCompatibility(source, target) == 0 {
+		score /= 2
+	}
+	return score, reasons
+}
+
+// valueAttributes returns the features of the value attributes of
+// the layer, in schema order
+func valueAttributes(layer *ls.Layer, conceptTerms []string) []attributeFeatures {
+	ret := make([]attributeFeatures, 0)
+	layer.ForEachAttributeOrdered(func(node *lpg.Node, path []*lpg.Node) bool {
+		if node.HasLabel(ls.AttributeTypeValue.Name) {
+			ret = append(ret, getAttributeFeatures(node, path, conceptTerms))
+		}
+		return true
+	})
+	return ret
+}
+
+// SuggestMappings compares the value attributes of the source and
+// target schemas, and returns a mapping suggestion for each target
+// value attribute. Confident matches are assigned one-to-one, best
+// scores first.
+func SuggestMappings(source, target *ls.Layer, options SuggestOptions) []MappingSuggestion {
+	options = options.withDefaults()
+	sourceAttrs := valueAttributes(source, options.ConceptTerms)
+	targetAttrs := valueAttributes(target, options.ConceptTerms)
+
+	type scoredPair struct {
+		target    int
+		candidate MappingCandidate
+	}
+	ret := make([]MappingSuggestion, len(targetAttrs))
+	confident := make([]scoredPair, 0)
+	for ti, t := range targetAttrs {
+		ret[ti].TargetID = t.id
+		candidates := make([]MappingCandidate, 0)
+		for _, s := range sourceAttrs {
+			score, reasons := compareAttributes(s, t)
+			if score < options.MinScore {
+				continue
+			}
+			c := MappingCandidate{SourceID: s.id, Score: score, Reasons: reasons}
+			candidates = append(candidates, c)
+			if score >= options.Threshold {
+				confident = append(confident, scoredPair{target: ti, candidate: c})
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].Score == candidates[j].Score {
+				return candidates[i].SourceID < candidates[j].SourceID
+			}
+			return candidates[i].Score > candidates[j].Score
+		})
+		if len(candidates) > options.MaxCandidates {
+			candidates = candidates[:options.MaxCandidates]
+		}
+		ret[ti].Candidates = candidates
+	}
+
+	sort.SliceStable(confident, func(i, j int) bool {
+		if confident[i].candidate.Score != confident[j].candidate.Score {
+			return confident[i].candidate.Score > confident[j].candidate.Score
+		}
+		if confident[i].target != confident[j].target {
+			return confident[i].target < confident[j].target
+		}
+		return confident[i].candidate.SourceID < confident[j].candidate.SourceID
+	})
+	usedSources := make(map[string]struct{})
+	for _, pair := range confident {
+		if ret[pair.target].Match != nil {
+			continue
+		}
+		if _, used := usedSources[pair.candidate.SourceID]; used {
+			continue
+		}
+		usedSources[pair.candidate.SourceID] = struct{}{}
+		c := pair.candidate
+		ret[pair.target].Match = &c
+	}
+	return ret
+}
+
+// SourceNodeExpr returns an openCypher expression that returns the
+// source graph nodes that are instances of the source schema node
+func SourceNodeExpr(sourceID string) string {
+	escaped := strings.ReplaceAll(strings.ReplaceAll(sourceID, `\`, `\\`), `'`, `\'`)
+	return fmt.Sprintf("match (n) where n.`%s`='%s' return n", ls.SchemaNodeIDTerm.Name, escaped)
+}
+
+// DraftScript is a transformation script draft generated from mapping
+// suggestions. It is marshaled as a reshape script.
+type DraftScript struct {
+	ReshapeNodes map[string]map[string]any `json:"reshapeNodes" yaml:"reshapeNodes"`
+}
+
+// BuildDraftScript builds a reshape script draft from the
+// suggestions. Target attributes with a confident match get a
+// valueExpr selecting the instances of the source attribute. Others
+// get a todo entry listing the candidates, if any. The todo entries
+// must be edited before the script is used.
+func BuildDraftScript(suggestions []MappingSuggestion) DraftScript {
+	ret := DraftScript{ReshapeNodes: make(map[string]map[string]any)}
+	for _, s := range suggestions {
+		if s.Match != nil {
+			ret.ReshapeNodes[s.TargetID] = map[string]any{
+				"valueExpr": []string{SourceNodeExpr(s.Match.SourceID)},
+			}
+			continue
+		}
+		entry := map[string]any{}
+		if len(s.Candidates) == 0 {
+			entry["todo"] = "No matching source attribute"
+		} else {
+			entry["todo"] = "Select a source attribute"
+			candidates := make([]string, 0, len(s.Candidates))
+			for _, c := range s.Candidates {
+				candidates = append(candidates, c.String())
+			}
+			entry["candidates"] = candidates
+		}
+		ret.ReshapeNodes[s.TargetID] = entry
+	}
+	return ret
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/cloudprivacylabs/lsa/pkg/jsonld"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+func TestSplitWords(t *testing.T) {
+	for input, expected := range map[string][]string{
+		"firstName":      {"first", "name"},
+		"last_name":      {"last", "name"},
+		"HTTPRequest":    {"http", "request"},
+		"address.line1":  {"address", "line1"},
+		"Date of birth.": {"date", "of", "birth"},
+	} {
+		if got := splitWords(input); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %v got %v", input, expected, got)
+		}
+	}
+}
+
+func unmarshalTestLayer(t *testing.T, str string) *ls.Layer {
+	var v any
+	if err := json.Unmarshal([]byte(str), &v); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := jsonld.UnmarshalLayer(v, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer
+}
+
+func TestSuggestMappings(t *testing.T) {
+	source := unmarshalTestLayer(t, `{
+ "@context": "../../schemas/ls.json",
+ "@id": "http://source",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "src",
+  "attributeList": [
+   {"@id": "src.lastName", "@type": "Value", "attributeName": "last_name", "valueType": "string"},
+   {"@id": "src.dob", "@type": "Value", "attributeName": "dob", "valueType": "xsd:date",
+    "http://www.w3.org/2002/07/owl#sameAs": "http://example.org/birthDate"},
+   {"@id": "src.address", "@type": "Object", "attributeName": "address", "attributeList": [
+     {"@id": "src.address.city", "@type": "Value", "attributeName": "city"}
+   ]}
+  ]
+ }
+}`)
+	target := unmarshalTestLayer(t, `{
+ "@context": "../../schemas/ls.json",
+ "@id": "http://target",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "tgt",
+  "attributeList": [
+   {"@id": "tgt.familyName", "@type": "Value", "attributeName": "LastName", "valueType": "string"},
+   {"@id": "tgt.birth", "@type": "Value", "attributeName": "birthDate", "valueType": "xsd:date",
+    "http://www.w3.org/2002/07/owl#sameAs": "http://example.org/birthDate"},
+   {"@id": "tgt.city", "@type": "Value", "attributeName": "homeCity"},
+   {"@id": "tgt.gender", "@type": "Value", "attributeName": "gender"}
+  ]
+ }
+}`)
+	suggestions := SuggestMappings(source, target, SuggestOptions{})
+	matches := make(map[string]string)
+	candidates := make(map[string][]string)
+	for _, s := range suggestions {
+		if s.Match != nil {
+			matches[s.TargetID] = s.Match.SourceID
+		}
+		for _, c := range s.Candidates {
+			candidates[s.TargetID] = append(candidates[s.TargetID], c.SourceID)
+		}
+	}
+	expectedMatches := map[string]string{
+		"tgt.familyName": "src.lastName",
+		"tgt.birth":      "src.dob",
+	}
+	if !reflect.DeepEqual(matches, expectedMatches) {
+		t.Errorf("Expected matches %v, got %v", expectedMatches, matches)
+	}
+	if !reflect.DeepEqual(candidates["tgt.city"], []string{"src.address.city"}) {
+		t.Errorf("Wrong candidates for city: %v", candidates["tgt.city"])
+	}
+	if len(candidates["tgt.gender"]) != 0 {
+		t.Errorf("Unexpected candidates for gender: %v", candidates["tgt.gender"])
+	}
+
+	draft := BuildDraftScript(suggestions)
+	if len(draft.ReshapeNodes) != 4 {
+		t.Errorf("Expected 4 reshape nodes, got %d", len(draft.ReshapeNodes))
+	}
+	if _, ok := draft.ReshapeNodes["tgt.gender"]["todo"]; !ok {
+		t.Errorf("Expected todo for gender")
+	}
+	if expr, _ := draft.ReshapeNodes["tgt.familyName"]["valueExpr"].([]string); len(expr) != 1 || expr[0] != SourceNodeExpr("src.lastName") {
+		t.Errorf("Expected valueExpr for familyName, got %v", expr)
+	}
+	// The draft must be usable as a transformation script
+	data, err := json.Marshal(draft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var script TransformScript
+	if err := json.Unmarshal(data, &script); err != nil {
+		t.Fatal(err)
+	}
+	if err := script.Compile(ls.DefaultContext()); err != nil {
+		t.Error(err)
+	}
+	if err := script.Validate(target); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/opencypher"
+)
+
+// ReshapeTrace records how each target schema node is processed
+// during reshaping. Set Reshaper.Trace to a non-nil trace to record.
+type ReshapeTrace struct {
+	// Entries are in the order target schema nodes are visited, so a
+	// parent entry comes before the entries of its children
+	Entries []*TraceEntry `json:"entries"`
+}
+
+// TraceEntry describes the processing of a target schema node
+type TraceEntry struct {
+	SchemaNodeID string `json:"schemaNodeId"`
+	// SchemaPath is the path of schema node IDs from the root
+	SchemaPath []string `json:"schemaPath"`
+	// Evaluations are the expressions evaluated for this node, in
+	// evaluation order
+	Evaluations []TraceEvaluation `json:"evaluations,omitempty"`
+	// ExportedVars are the variables exported by the evaluate
+	// expressions and by the result rows
+	ExportedVars map[string]any `json:"exportedVars,omitempty"`
+	// Sources are the source nodes selected by mapProperty or source
+	// mappings
+	Sources []any `json:"sources,omitempty"`
+	// Generated is the number of nodes generated for this schema node
+	Generated int `json:"generated"`
+	// Reason explains why nodes were or were not generated
+	Reason string `json:"reason"`
+	Error  string `json:"error,omitempty"`
+}
+
+// TraceEvaluation is an evaluated expression and its result
+type TraceEvaluation struct {
+	Term   string `json:"term"`
+	Expr   string `json:"expr"`
+	Result any    `json:"result"`
+}
+
+func (t *ReshapeTrace) newEntry(schemaPath []*lpg.Node) *TraceEntry {
+	if t == nil {
+		return nil
+	}
+	entry := &TraceEntry{
+		SchemaNodeID: ls.GetNodeID(schemaPath[len(schemaPath)-1]),
+		SchemaPath:   make([]string, 0, len(schemaPath)),
+	}
+	for _, x := range schemaPath {
+		entry.SchemaPath = append(entry.SchemaPath, ls.GetNodeID(x))
+	}
+	t.Entries = append(t.Entries, entry)
+	return entry
+}
+
+// exprString returns the source of the i'th expression of term
+func exprString(node ls.CompilablePropertyContainer, term string, i int) string {
+	v, ok := node.GetProperty(term)
+	if !ok {
+		return ""
+	}
+	pv, ok := v.(ls.PropertyValue)
+	if !ok {
+		return ""
+	}
+	s := pv.AsStringSlice()
+	if i < len(s) {
+		return s[i]
+	}
+	return ""
+}
+
+func (e *TraceEntry) addEvaluation(term, expr string, result any) {
+	if e == nil {
+		return
+	}
+	e.Evaluations = append(e.Evaluations, TraceEvaluation{
+		Term:   term,
+		Expr:   expr,
+		Result: traceValue(result),
+	})
+}
+
+func (e *TraceEntry) exportVars(symbols map[string]opencypher.Value) {
+	if e == nil || len(symbols) == 0 {
+		return
+	}
+	if e.ExportedVars == nil {
+		e.ExportedVars = make(map[string]any)
+	}
+	for k, v := range symbols {
+		e.ExportedVars[k] = traceValue(v)
+	}
+}
+
+func (e *TraceEntry) addSources(term string, nodes []*lpg.Node) {
+	if e == nil {
+		return
+	}
+	for _, x := range nodes {
+		e.Sources = append(e.Sources, map[string]any{
+			"term": term,
+			"node": traceValue(x),
+		})
+	}
+}
+
+func (e *TraceEntry) finish(generated []*txDocNode, reason string, err error) {
+	if e == nil {
+		return
+	}
+	e.Generated = len(generated)
+	e.Reason = reason
+	if err != nil {
+		e.Error = err.Error()
+	}
+}
+
+// traceValue converts an expression result into a value that can be
+// marshaled. Nodes are described using their id, schema node id, and
+// value
+func traceValue(in any) any {
+	switch value := in.(type) {
+	case nil:
+		return nil
+	case opencypher.Value:
+		return traceValue(value.Get())
+	case *lpg.Node:
+		ret := map[string]any{}
+		if id := ls.GetNodeID(value); len(id) > 0 {
+			ret["id"] = id
+		}
+		if s, ok := ls.GetPropertyValueAs[string](value, ls.SchemaNodeIDTerm.Name); ok {
+			ret["schemaNodeId"] = s
+		}
+		if v, ok := ls.GetRawNodeValue(value); ok {
+			ret["value"] = v
+		}
+		labels := value.GetLabels().Slice()
+		sort.Strings(labels)
+		ret["labels"] = labels
+		return ret
+	case []*lpg.Node:
+		ret := make([]any, 0, len(value))
+		for _, x := range value {
+			ret = append(ret, traceValue(x))
+		}
+		return ret
+	case []opencypher.Value:
+		ret := make([]any, 0, len(value))
+		for _, x := range value {
+			ret = append(ret, traceValue(x))
+		}
+		return ret
+	case opencypher.ResultSet:
+		rows := make([]map[string]any, 0, len(value.Rows))
+		for _, row := range value.Rows {
+			r := make(map[string]any, len(row))
+			for k, v := range row {
+				r[k] = traceValue(v)
+			}
+			rows = append(rows, r)
+		}
+		return map[string]any{
+			"cols": value.Cols,
+			"rows": rows,
+		}
+	case string, bool, int, int64, float64:
+		return value
+	}
+	return fmt.Sprint(in)
+}
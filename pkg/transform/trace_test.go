@@ -0,0 +1,98 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+func TestReshapeTrace(t *testing.T) {
+	target := unmarshalTestLayer(t, `{
+ "@context": "../../schemas/ls.json",
+ "@id": "http://target",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "tgt",
+  "attributeList": [
+   {"@id": "tgt.name", "@type": "Value", "attributeName": "name"},
+   {"@id": "tgt.other", "@type": "Value", "attributeName": "other"}
+  ]
+ }
+}`)
+	var script TransformScript
+	if err := json.Unmarshal([]byte(`{
+ "reshapeNodes": {
+   "tgt": {
+     "evaluate": "match (n {`+"`https://lschema.org/schemaNodeId`"+`: 'src.name'}) return n as src"
+   },
+   "tgt.name": {
+     "valueExpr": "return src"
+   }
+ }
+}`), &script); err != nil {
+		t.Fatal(err)
+	}
+	if err := script.Compile(ls.DefaultContext()); err != nil {
+		t.Fatal(err)
+	}
+
+	source := ls.NewDocumentGraph()
+	node := source.NewNode([]string{ls.DocumentNodeTerm.Name, ls.AttributeTypeValue.Name}, map[string]any{
+		ls.SchemaNodeIDTerm.Name: ls.NewPropertyValue(ls.SchemaNodeIDTerm.Name, "src.name"),
+	})
+	ls.SetRawNodeValue(node, "John")
+
+	reshaper := Reshaper{
+		TargetSchema: target,
+		Script:       &script,
+		Trace:        &ReshapeTrace{},
+		DryRun:       true,
+	}
+	if err := reshaper.Reshape(ls.DefaultContext(), source, &ls.Ingester{Schema: target}); err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]*TraceEntry)
+	for _, e := range reshaper.Trace.Entries {
+		entries[e.SchemaNodeID] = e
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	root := entries["tgt"]
+	if len(root.Evaluations) != 1 || root.Evaluations[0].Term != EvaluateTerm.Name {
+		t.Errorf("Wrong root evaluations: %+v", root.Evaluations)
+	}
+	if _, ok := root.ExportedVars["src"]; !ok {
+		t.Errorf("src not exported: %+v", root.ExportedVars)
+	}
+	if root.Generated != 1 {
+		t.Errorf("Root not generated")
+	}
+	name := entries["tgt.name"]
+	if len(name.Evaluations) != 1 || name.Evaluations[0].Expr != "return src" || name.Generated != 1 {
+		t.Errorf("Wrong name entry: %+v", name)
+	}
+	other := entries["tgt.other"]
+	if other.Generated != 0 || len(other.Reason) == 0 {
+		t.Errorf("Wrong other entry: %+v", other)
+	}
+	if _, err := json.Marshal(reshaper.Trace); err != nil {
+		t.Error(err)
+	}
+}
@@ -34,6 +34,10 @@ type TransformScript struct {
 	// elements separated by space
 	TargetSchemaNodes map[string]NodeTransformAnnotations `json:"reshapeNodes,omitempty" yaml:"reshapeNodes,omitempty"`
 
+	// Functions are keyed by function name. They can be called from
+	// the expressions of the script
+	Functions map[string]*ScriptFunction `json:"functions,omitempty" yaml:"functions,omitempty"`
+
 	// Keyed by the last part of the target schema node key
 	compiledTargetSchemaNodes map[string][]*compiledAnnotations
 }
@@ -75,6 +79,14 @@ func (t *TransformScript) Compile(ctx *ls.Context) error {
 		return nil
 	}
 	cctx := &ls.CompileContext{}
+	for name, fn := range t.Functions {
+		if fn == nil {
+			return fmt.Errorf("Function %s has no definition", name)
+		}
+		if err := fn.compile(cctx, name); err != nil {
+			return err
+		}
+	}
 	t.compiledTargetSchemaNodes = make(map[string][]*compiledAnnotations)
 	for sid, ann := range t.TargetSchemaNodes {
 		ctx.GetLogger().Debug(map[string]any{"script.compile.schemaNodeId": sid})
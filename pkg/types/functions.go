@@ -0,0 +1,77 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/araddon/dateparse"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/opencypher"
+)
+
+func init() {
+	ls.RegisterFunction(opencypher.Function{
+		Name:      "types.parseDate",
+		MinArgs:   1,
+		MaxArgs:   2,
+		ValueFunc: temporalFunc("2006-01-02"),
+	})
+	ls.RegisterFunction(opencypher.Function{
+		Name:      "types.parseDateTime",
+		MinArgs:   1,
+		MaxArgs:   2,
+		ValueFunc: temporalFunc(time.RFC3339Nano),
+	})
+}
+
+// temporalFunc returns a function that parses its first argument
+// using the optional Go time layout given in the second argument, and
+// formats it using outputLayout. If there is no layout, the input
+// format is detected. Empty input gives null.
+//
+//	types.parseDate('12/31/2021') = '2021-12-31'
+//	types.parseDate('31.12.2021', '02.01.2006') = '2021-12-31'
+func temporalFunc(outputLayout string) func(*opencypher.EvalContext, []opencypher.Value) (opencypher.Value, error) {
+	return func(ctx *opencypher.EvalContext, args []opencypher.Value) (opencypher.Value, error) {
+		if args[0].Get() == nil {
+			return opencypher.RValue{}, nil
+		}
+		str, ok := args[0].Get().(string)
+		if !ok {
+			return nil, opencypher.ErrInvalidFunctionCall{Msg: fmt.Sprintf("String argument expected, got %T", args[0].Get())}
+		}
+		if len(str) == 0 {
+			return opencypher.RValue{}, nil
+		}
+		var t time.Time
+		var err error
+		if len(args) == 2 {
+			layout, ok := args[1].Get().(string)
+			if !ok {
+				return nil, opencypher.ErrInvalidFunctionCall{Msg: "String time layout expected"}
+			}
+			t, err = time.Parse(layout, str)
+		} else {
+			t, err = dateparse.ParseStrict(str)
+		}
+		if err != nil {
+			return nil, ErrCannotParseTemporalValue(str)
+		}
+		return opencypher.RValue{Value: t.Format(outputLayout)}, nil
+	}
+}
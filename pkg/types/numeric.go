@@ -40,9 +40,9 @@ var JSONNumber = ls.NewTerm(JSON, "number", "json:number").SetComposition(ls.Ove
 }).Register()
 
 var JSONInteger = ls.NewTerm(JSON, "integer", "json:integer").SetComposition(ls.OverrideComposition).SetMetadata(struct {
-	SignedIntParser[int8]
+	SignedIntParser[int64]
 }{
-	SignedIntParser[int8]{},
+	SignedIntParser[int64]{},
 }).Register()
 
 var one64 = int64(1)
@@ -0,0 +1,67 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+// Primitive is the primitive kind of a value type. Schema and code
+// generators use it to map value types to the types of the target
+// language.
+type Primitive string
+
+const (
+	PrimitiveString   Primitive = "string"
+	PrimitiveInteger  Primitive = "integer"
+	PrimitiveNumber   Primitive = "number"
+	PrimitiveBoolean  Primitive = "boolean"
+	PrimitiveDate     Primitive = "date"
+	PrimitiveDateTime Primitive = "dateTime"
+	PrimitiveTime     Primitive = "time"
+)
+
+var primitives = map[string]Primitive{}
+
+func init() {
+	for _, t := range []ls.Term{JSONInteger, XSDByte, XSDInt, XSDLong, XSDNegativeInteger, XSDNonNegativeInteger,
+		XSDPositiveInteger, XSDNonPositiverInteger, XSDShort, XSDUnsignedLong, XSDUnsignedInt, XSDUnsignedShort,
+		XSDUnsignedByte, UnixTimeTerm, UnixTimeNanoTerm} {
+		primitives[t.Name] = PrimitiveInteger
+	}
+	primitives[JSONNumber.Name] = PrimitiveNumber
+	primitives[XSDDecimal.Name] = PrimitiveNumber
+	primitives[JSONBooleanTerm.Name] = PrimitiveBoolean
+	primitives[XMLBooleanTerm.Name] = PrimitiveBoolean
+	for _, t := range []ls.Term{XSDDateTerm, JSONDateTerm, PatternDateTerm} {
+		primitives[t.Name] = PrimitiveDate
+	}
+	for _, t := range []ls.Term{XSDDateTimeTerm, JSONDateTimeTerm, PatternDateTimeTerm} {
+		primitives[t.Name] = PrimitiveDateTime
+	}
+	for _, t := range []ls.Term{XSDTimeTerm, JSONTimeTerm, PatternTimeTerm} {
+		primitives[t.Name] = PrimitiveTime
+	}
+}
+
+// GetPrimitive returns the primitive kind of the value type. Aliases
+// of the value type terms are recognized. Unknown value types are
+// strings.
+func GetPrimitive(valueType string) Primitive {
+	if p, ok := primitives[ls.GetTerm(valueType).Name]; ok {
+		return p
+	}
+	return PrimitiveString
+}
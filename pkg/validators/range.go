@@ -0,0 +1,472 @@
+package validators
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/araddon/dateparse"
+	"github.com/cloudprivacylabs/lpg/v2"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/types"
+)
+
+// MinimumTerm validates that the value is greater than or equal to
+// the given bound. The bound can be a number, a date/time, or a
+// measure. The value is interpreted using the value type of the
+// attribute.
+//
+//	{
+//	   @id: attrId,
+//	   @type: Value,
+//	   validation/minimum: "0"
+//	}
+var MinimumTerm = ls.NewTerm(ls.LS, "validation/minimum").SetComposition(ls.OverrideComposition).SetTags(ls.ValidationTag, ls.SchemaElementTag).SetMetadata(RangeValidator{Term: ls.LS + "validation/minimum", Op: ">="}).Register()
+
+// MaximumTerm validates that the value is less than or equal to the
+// given bound.
+//
+//	{
+//	   @id: attrId,
+//	   @type: Value,
+//	   valueType: xsd:date,
+//	   validation/maximum: "2030-01-01"
+//	}
+var MaximumTerm = ls.NewTerm(ls.LS, "validation/maximum").SetComposition(ls.OverrideComposition).SetTags(ls.ValidationTag, ls.SchemaElementTag).SetMetadata(RangeValidator{Term: ls.LS + "validation/maximum", Op: "<="}).Register()
+
+// ExclusiveMinimumTerm validates that the value is greater than the
+// given bound.
+var ExclusiveMinimumTerm = ls.NewTerm(ls.LS, "validation/exclusiveMinimum").SetComposition(ls.OverrideComposition).SetTags(ls.ValidationTag, ls.SchemaElementTag).SetMetadata(RangeValidator{Term: ls.LS + "validation/exclusiveMinimum", Op: ">"}).Register()
+
+// ExclusiveMaximumTerm validates that the value is less than the
+// given bound.
+var ExclusiveMaximumTerm = ls.NewTerm(ls.LS, "validation/exclusiveMaximum").SetComposition(ls.OverrideComposition).SetTags(ls.ValidationTag, ls.SchemaElementTag).SetMetadata(RangeValidator{Term: ls.LS + "validation/exclusiveMaximum", Op: "<"}).Register()
+
+// RangeValidator compares the value with a bound
+type RangeValidator struct {
+	// Term is the validation term containing the bound
+	Term string
+	// Op is the comparison operator, one of >=, >, <=, <
+	Op string
+}
+
+// rangeBound is the compiled bound of a range validator. The bound
+// is parsed as a number, a date/time, or a measure.
+type rangeBound struct {
+	raw string
+
+	isNumber bool
+	number   float64
+
+	isMeasure bool
+	measure   float64
+	unit      string
+
+	isTime bool
+	time   time.Time
+}
+
+func parseRangeBound(s string) (rangeBound, error) {
+	ret := rangeBound{raw: strings.TrimSpace(s)}
+	if v, err := strconv.ParseFloat(ret.raw, 64); err == nil {
+		ret.isNumber = true
+		ret.number = v
+		return ret, nil
+	}
+	// Dates are tried before measures, because 2020-01-01 parses
+	// as the measure 2020 with unit -01-01
+	if t, err := dateparse.ParseAny(ret.raw); err == nil {
+		ret.isTime = true
+		ret.time = t
+		return ret, nil
+	}
+	if m, err := types.ParseMeasure(ret.raw); err == nil && isUnit(m.Unit) {
+		if v, err := strconv.ParseFloat(m.Value, 64); err == nil {
+			ret.isMeasure = true
+			ret.measure = v
+			ret.unit = m.Unit
+			return ret, nil
+		}
+	}
+	return ret, fmt.Errorf("Not a number, measure, or date: %s", s)
+}
+
+// isUnit returns true if the unit starts with a letter, a symbol
+// (°C), or %
+func isUnit(unit string) bool {
+	for _, r := range strings.TrimSpace(unit) {
+		return unicode.IsLetter(r) || unicode.IsSymbol(r) || r == '%'
+	}
+	return false
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compare returns -1, 0, 1 if value is less than, equal to, or
+// greater than the bound
+func (bound rangeBound) compare(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return bound.compareNumber(float64(v))
+	case int8:
+		return bound.compareNumber(float64(v))
+	case int16:
+		return bound.compareNumber(float64(v))
+	case int32:
+		return bound.compareNumber(float64(v))
+	case int64:
+		return bound.compareNumber(float64(v))
+	case uint:
+		return bound.compareNumber(float64(v))
+	case uint8:
+		return bound.compareNumber(float64(v))
+	case uint16:
+		return bound.compareNumber(float64(v))
+	case uint32:
+		return bound.compareNumber(float64(v))
+	case uint64:
+		return bound.compareNumber(float64(v))
+	case float32:
+		return bound.compareNumber(float64(v))
+	case float64:
+		return bound.compareNumber(v)
+	case types.Measure:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v.Value), 64)
+		if err != nil {
+			return 0, fmt.Errorf("Not a numeric measure: %s", v)
+		}
+		if bound.isMeasure {
+			if bound.unit != v.Unit {
+				return 0, fmt.Errorf("Incompatible units: %s %s", v.Unit, bound.unit)
+			}
+			return compareFloat(f, bound.measure), nil
+		}
+		return bound.compareNumber(f)
+	case interface{ ToTime() time.Time }:
+		return bound.compareTime(v.ToTime())
+	case time.Time:
+		return bound.compareTime(v)
+	case string:
+		s := strings.TrimSpace(v)
+		if bound.isTime {
+			t, err := dateparse.ParseAny(s)
+			if err != nil {
+				return 0, fmt.Errorf("Not a date/time: %s", v)
+			}
+			return bound.compareTime(t)
+		}
+		if bound.isMeasure {
+			m, err := types.ParseMeasure(s)
+			if err != nil {
+				return 0, err
+			}
+			return bound.compare(m)
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Not a number: %s", v)
+		}
+		return bound.compareNumber(f)
+	}
+	return 0, fmt.Errorf("Cannot compare %v with %s", value, bound.raw)
+}
+
+func (bound rangeBound) compareNumber(v float64) (int, error) {
+	switch {
+	case bound.isNumber:
+		return compareFloat(v, bound.number), nil
+	case bound.isMeasure:
+		return compareFloat(v, bound.measure), nil
+	}
+	return 0, fmt.Errorf("Cannot compare number with %s", bound.raw)
+}
+
+func (bound rangeBound) compareTime(t time.Time) (int, error) {
+	if !bound.isTime {
+		return 0, fmt.Errorf("Cannot compare date/time with %s", bound.raw)
+	}
+	switch {
+	case t.Before(bound.time):
+		return -1, nil
+	case t.After(bound.time):
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// CompileTerm parses the bound
+func (validator RangeValidator) CompileTerm(_ *ls.CompileContext, target ls.CompilablePropertyContainer, term string, value ls.PropertyValue) error {
+	if value.Value() == nil {
+		return nil
+	}
+	bound, err := parseRangeBound(fmt.Sprint(value.Value()))
+	if err != nil {
+		return ls.ErrValidatorCompile{Validator: validator.Term, Object: target, Msg: "Invalid bound", Err: err}
+	}
+	target.SetProperty("$compiled_"+validator.Term, bound)
+	return nil
+}
+
+func (validator RangeValidator) validate(value interface{}, raw string, schemaNode *lpg.Node) error {
+	c, ok := schemaNode.GetProperty("$compiled_" + validator.Term)
+	if !ok {
+		return nil
+	}
+	bound := c.(rangeBound)
+	cmp, err := bound.compare(value)
+	if err != nil {
+		return ls.ErrValidation{Validator: validator.Term, Msg: "Cannot compare value", Value: raw, Err: err}
+	}
+	var valid bool
+	switch validator.Op {
+	case ">=":
+		valid = cmp >= 0
+	case ">":
+		valid = cmp > 0
+	case "<=":
+		valid = cmp <= 0
+	case "<":
+		valid = cmp < 0
+	}
+	if !valid {
+		return ls.ErrValidation{Validator: validator.Term, Msg: fmt.Sprintf("Value must be %s %s", validator.Op, bound.raw), Value: raw}
+	}
+	return nil
+}
+
+// ValidateValue parses the value using the value type of the schema
+// node and compares it with the bound
+func (validator RangeValidator) ValidateValue(value *string, schemaNode *lpg.Node) error {
+	if value == nil || len(*value) == 0 {
+		return nil
+	}
+	var native interface{} = *value
+	accessor, err := ls.GetNodeValueAccessor(schemaNode)
+	if err != nil {
+		return err
+	}
+	if accessor != nil {
+		native, err = accessor.GetNativeValue(*value, schemaNode)
+		if err != nil {
+			return ls.ErrValidation{Validator: validator.Term, Msg: "Invalid value", Value: *value, Err: err}
+		}
+	}
+	return validator.validate(native, *value, schemaNode)
+}
+
+// ValidateNode compares the node value with the bound
+func (validator RangeValidator) ValidateNode(docNode, schemaNode *lpg.Node) error {
+	if docNode == nil {
+		return nil
+	}
+	raw, ok := ls.GetRawNodeValue(docNode)
+	if !ok || len(raw) == 0 {
+		return nil
+	}
+	native, err := ls.GetNodeValue(docNode)
+	if err != nil {
+		return ls.ErrValidation{Validator: validator.Term, Msg: "Invalid value", Value: raw, Err: err}
+	}
+	return validator.validate(native, raw, schemaNode)
+}
+
+// MinLengthTerm validates the minimum number of characters of a
+// value
+//
+//	{
+//	   @id: attrId,
+//	   @type: Value,
+//	   validation/minLength: 2
+//	}
+var MinLengthTerm = ls.NewTerm(ls.LS, "validation/minLength").SetComposition(ls.OverrideComposition).SetTags(ls.ValidationTag, ls.SchemaElementTag).SetMetadata(LengthValidator{Term: ls.LS + "validation/minLength"}).Register()
+
+// MaxLengthTerm validates the maximum number of characters of a
+// value
+var MaxLengthTerm = ls.NewTerm(ls.LS, "validation/maxLength").SetComposition(ls.OverrideComposition).SetTags(ls.ValidationTag, ls.SchemaElementTag).SetMetadata(LengthValidator{Term: ls.LS + "validation/maxLength", Max: true}).Register()
+
+// LengthValidator validates the number of characters of a value
+type LengthValidator struct {
+	Term string
+	// If Max is true, the term gives the maximum length, otherwise the
+	// minimum length
+	Max bool
+}
+
+// getIntTerm returns the integer value of the term
+func getIntTerm(node *lpg.Node, term string) (int, bool) {
+	pv, ok := ls.GetPropertyValue(node, term)
+	if !ok {
+		return 0, false
+	}
+	v, err := ls.IntegerType{}.Coerce(pv.Value())
+	if err != nil {
+		return 0, false
+	}
+	i, ok := v.(int)
+	return i, ok
+}
+
+func compileIntTerm(validator string, target ls.CompilablePropertyContainer, value ls.PropertyValue) error {
+	if value.Value() == nil {
+		return nil
+	}
+	if _, err := (ls.IntegerType{}).Coerce(value.Value()); err != nil {
+		return ls.ErrValidatorCompile{Validator: validator, Object: target, Msg: "Integer value expected", Err: err}
+	}
+	return nil
+}
+
+// CompileTerm checks if the term value is an integer
+func (validator LengthValidator) CompileTerm(_ *ls.CompileContext, target ls.CompilablePropertyContainer, term string, value ls.PropertyValue) error {
+	return compileIntTerm(validator.Term, target, value)
+}
+
+// ValidateValue checks the length of the value
+func (validator LengthValidator) ValidateValue(value *string, schemaNode *lpg.Node) error {
+	if value == nil {
+		return nil
+	}
+	n, ok := getIntTerm(schemaNode, validator.Term)
+	if !ok {
+		return nil
+	}
+	length := len([]rune(*value))
+	if validator.Max && length > n {
+		return ls.ErrValidation{Validator: validator.Term, Msg: fmt.Sprintf("Value is longer than %d", n), Value: *value}
+	}
+	if !validator.Max && length < n {
+		return ls.ErrValidation{Validator: validator.Term, Msg: fmt.Sprintf("Value is shorter than %d", n), Value: *value}
+	}
+	return nil
+}
+
+// ValidateNode checks the length of the node value
+func (validator LengthValidator) ValidateNode(docNode, schemaNode *lpg.Node) error {
+	if docNode == nil {
+		return nil
+	}
+	value, ok := ls.GetRawNodeValue(docNode)
+	if !ok {
+		return nil
+	}
+	return validator.ValidateValue(&value, schemaNode)
+}
+
+// MinItemsTerm validates the minimum number of elements of an array
+//
+//	{
+//	   @id: attrId,
+//	   @type: Array,
+//	   validation/minItems: 1
+//	}
+var MinItemsTerm = ls.NewTerm(ls.LS, "validation/minItems").SetComposition(ls.OverrideComposition).SetTags(ls.ValidationTag, ls.SchemaElementTag).SetMetadata(ItemsValidator{Term: ls.LS + "validation/minItems"}).Register()
+
+// MaxItemsTerm validates the maximum number of elements of an array
+var MaxItemsTerm = ls.NewTerm(ls.LS, "validation/maxItems").SetComposition(ls.OverrideComposition).SetTags(ls.ValidationTag, ls.SchemaElementTag).SetMetadata(ItemsValidator{Term: ls.LS + "validation/maxItems", Max: true}).Register()
+
+// UniqueItemsTerm validates that the array elements are distinct
+//
+//	{
+//	   @id: attrId,
+//	   @type: Array,
+//	   validation/uniqueItems: true
+//	}
+var UniqueItemsTerm = ls.NewTerm(ls.LS, "validation/uniqueItems").SetComposition(ls.OverrideComposition).SetTags(ls.ValidationTag, ls.SchemaElementTag).SetMetadata(UniqueItemsValidator{}).Register()
+
+// ItemsValidator validates the number of array elements
+type ItemsValidator struct {
+	Term string
+	// If Max is true, the term gives the maximum number of elements,
+	// otherwise the minimum
+	Max bool
+}
+
+// arrayElements returns the element nodes of an array document node
+func arrayElements(docNode *lpg.Node) []*lpg.Node {
+	ret := make([]*lpg.Node, 0)
+	for edges := docNode.GetEdges(lpg.OutgoingEdge); edges.Next(); {
+		to := edges.Edge().GetTo()
+		if ls.IsDocumentNode(to) && to != docNode {
+			ret = append(ret, to)
+		}
+	}
+	ls.SortNodes(ret)
+	return ret
+}
+
+// CompileTerm checks if the term value is an integer
+func (validator ItemsValidator) CompileTerm(_ *ls.CompileContext, target ls.CompilablePropertyContainer, term string, value ls.PropertyValue) error {
+	return compileIntTerm(validator.Term, target, value)
+}
+
+// ValidateNode checks the number of array elements
+func (validator ItemsValidator) ValidateNode(docNode, schemaNode *lpg.Node) error {
+	if docNode == nil {
+		return nil
+	}
+	n, ok := getIntTerm(schemaNode, validator.Term)
+	if !ok {
+		return nil
+	}
+	count := len(arrayElements(docNode))
+	if validator.Max && count > n {
+		return ls.ErrValidation{Validator: validator.Term, Msg: fmt.Sprintf("More than %d items", n), Value: strconv.Itoa(count)}
+	}
+	if !validator.Max && count < n {
+		return ls.ErrValidation{Validator: validator.Term, Msg: fmt.Sprintf("Less than %d items", n), Value: strconv.Itoa(count)}
+	}
+	return nil
+}
+
+// UniqueItemsValidator checks if array elements are distinct. Value
+// elements are compared by their values, and object elements are
+// compared by the values of all their descendants.
+type UniqueItemsValidator struct{}
+
+// elementKey returns a string that is equal for elements with the same contents
+func elementKey(node *lpg.Node) string {
+	items := make([]string, 0)
+	prefix := len(ls.GetDocumentNodePath(node))
+	ls.IterateDescendants(node, func(n *lpg.Node) bool {
+		if v, ok := ls.GetRawNodeValue(n); ok {
+			items = append(items, ls.GetDocumentNodePath(n)[prefix:]+"="+v)
+		}
+		return true
+	}, ls.OnlyDocumentNodes, true)
+	return strings.Join(items, "\x00")
+}
+
+// ValidateNode checks if the array elements are unique
+func (validator UniqueItemsValidator) ValidateNode(docNode, schemaNode *lpg.Node) error {
+	if docNode == nil {
+		return nil
+	}
+	pv, ok := ls.GetPropertyValue(schemaNode, UniqueItemsTerm.Name)
+	if !ok {
+		return nil
+	}
+	b, _ := ls.BooleanType{}.Coerce(pv.Value())
+	if unique, _ := b.(bool); !unique {
+		return nil
+	}
+	seen := make(map[string]struct{})
+	for _, element := range arrayElements(docNode) {
+		key := elementKey(element)
+		if _, ok := seen[key]; ok {
+			return ls.ErrValidation{Validator: UniqueItemsTerm.Name, Msg: "Duplicate array element", Value: ls.GetDocumentNodePath(element)}
+		}
+		seen[key] = struct{}{}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package validators_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	jsoningest "github.com/cloudprivacylabs/lsa/pkg/json"
+	"github.com/cloudprivacylabs/lsa/pkg/jsonld"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/validators"
+)
+
+const rangeSchema = `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/id",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "person",
+  "attributes": {
+   "dob": {
+     "@type": "Value",
+     "attributeName":"dob",
+     "valueType": "xsd:date",
+     "minimum": "1900-01-01",
+     "maximum": "2030-01-01"
+   },
+   "weight": {
+     "@type": "Value",
+     "attributeName":"weight",
+     "maximum": "200 kg"
+   }
+  }
+ }
+}`
+
+func validateRange(t *testing.T, doc string) []ls.ErrValidation {
+	var schMap interface{}
+	if err := json.Unmarshal([]byte(rangeSchema), &schMap); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := jsonld.UnmarshalLayer(schMap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err = (&ls.Compiler{}).CompileSchema(ls.DefaultContext(), schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bldr := ls.NewGraphBuilder(nil, ls.GraphBuilderOptions{EmbedSchemaNodes: true})
+	parser := jsoningest.Parser{Layer: schema, SkipValueValidation: true}
+	if _, err := jsoningest.IngestBytes(ls.DefaultContext(), "http://base", []byte(doc), parser, bldr, &ls.Ingester{Schema: schema}); err != nil {
+		t.Fatal(err)
+	}
+	ret := make([]ls.ErrValidation, 0)
+	ls.ValidateGraph(bldr.GetGraph(), schema, func(docNode, schemaNode *lpg.Node, err error) bool {
+		var v ls.ErrValidation
+		if !errors.As(err, &v) {
+			t.Errorf("Unexpected error: %v", err)
+			return true
+		}
+		ret = append(ret, v)
+		return true
+	})
+	return ret
+}
+
+func TestDateRange(t *testing.T) {
+	if v := validateRange(t, `{"dob": "2020-01-01", "weight": "80 kg"}`); len(v) != 0 {
+		t.Errorf("Unexpected violations: %+v", v)
+	}
+	v := validateRange(t, `{"dob": "2031-01-01"}`)
+	if len(v) != 1 || v[0].Validator != validators.MaximumTerm.Name || v[0].Err != nil {
+		t.Errorf("Expecting maximum violation, got %+v", v)
+	}
+	v = validateRange(t, `{"dob": "1850-01-01", "weight": "250 kg"}`)
+	if len(v) != 2 {
+		t.Errorf("Expecting 2 violations, got %+v", v)
+	}
+}
@@ -0,0 +1,290 @@
+package validators
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+// Violation describes a single validation failure
+type Violation struct {
+	// Validator is the validation term that failed
+	Validator string `json:"validator"`
+	// Attribute is the path of the schema attribute, given as the
+	// attribute names from the schema root
+	Attribute string `json:"attribute"`
+	// AttributeID is the schema attribute id
+	AttributeID string `json:"attributeId,omitempty"`
+	// Path is the location of the node in the document
+	Path string `json:"path,omitempty"`
+	// Location is the document location, the input file name and row
+	Location string `json:"location,omitempty"`
+	Value    string `json:"value,omitempty"`
+	Message  string `json:"message"`
+}
+
+// AttributeSummary gives the number of violations for an attribute
+type AttributeSummary struct {
+	Attribute   string         `json:"attribute"`
+	AttributeID string         `json:"attributeId,omitempty"`
+	Violations  int            `json:"violations"`
+	Validators  map[string]int `json:"validators"`
+}
+
+// ValidationReport collects the validation failures of a set of
+// documents
+type ValidationReport struct {
+	Documents  int                `json:"documents"`
+	Failed     int                `json:"failed"`
+	Violations []Violation        `json:"violations"`
+	Summary    []AttributeSummary `json:"summary"`
+
+	// Document locations, and violations for each
+	documents []reportDocument
+}
+
+type reportDocument struct {
+	location   string
+	violations []Violation
+}
+
+// AddDocument adds a validated document to the report with its
+// violations
+func (r *ValidationReport) AddDocument(location string, violations ...Violation) {
+	r.Documents++
+	if len(violations) > 0 {
+		r.Failed++
+	}
+	for i := range violations {
+		if len(violations[i].Location) == 0 {
+			violations[i].Location = location
+		}
+	}
+	r.Violations = append(r.Violations, violations...)
+	r.documents = append(r.documents, reportDocument{location: location, violations: violations})
+}
+
+// ValidateGraph validates the document graph using the layer, and
+// adds the violations to the report as a single document. The
+// location is used for nodes whose source cannot be determined. If
+// location is empty, the source of the document is used. It returns
+// the number of violations.
+func (r *ValidationReport) ValidateGraph(g *lpg.Graph, layer *ls.Layer, location string) int {
+	if len(location) == 0 {
+		for nodes := g.GetNodesWithAllLabels(lpg.NewStringSet(ls.DocumentNodeTerm.Name)); nodes.Next(); {
+			if src, ok := ls.GetPropertyValueAs[string](nodes.Node(), ls.SourceTerm.Name); ok && len(src) > 0 {
+				location = src
+				break
+			}
+		}
+	}
+	violations := make([]Violation, 0)
+	ls.ValidateGraph(g, layer, func(docNode, schemaNode *lpg.Node, err error) bool {
+		violations = append(violations, newViolations(layer, docNode, schemaNode, err)...)
+		return true
+	})
+	r.AddDocument(location, violations...)
+	return len(violations)
+}
+
+// GetAttributeNamePath returns the attribute names from the schema
+// root to the schema node, separated by dots. Attributes without a
+// name are represented by their ids.
+func GetAttributeNamePath(layer *ls.Layer, schemaNode *lpg.Node) string {
+	path := layer.GetAttributePath(schemaNode)
+	elements := make([]string, 0, len(path))
+	for i, node := range path {
+		if i == 0 && len(path) > 1 {
+			// Skip the root
+			continue
+		}
+		name := ls.AttributeNameTerm.PropertyValue(node)
+		if len(name) == 0 {
+			name = ls.GetNodeID(node)
+		}
+		elements = append(elements, name)
+	}
+	if len(elements) == 0 {
+		return ls.GetNodeID(schemaNode)
+	}
+	return strings.Join(elements, ".")
+}
+
+// getDocumentSource returns the source of the closest ancestor of
+// the document node that has one
+func getDocumentSource(node *lpg.Node) string {
+	seen := make(map[*lpg.Node]struct{})
+	for node != nil {
+		if _, ok := seen[node]; ok {
+			break
+		}
+		seen[node] = struct{}{}
+		if src, ok := ls.GetPropertyValueAs[string](node, ls.SourceTerm.Name); ok && len(src) > 0 {
+			return src
+		}
+		var parent *lpg.Node
+		for edges := node.GetEdges(lpg.IncomingEdge); edges.Next(); {
+			if from := edges.Edge().GetFrom(); ls.IsDocumentNode(from) && from != node {
+				parent = from
+				break
+			}
+		}
+		node = parent
+	}
+	return ""
+}
+
+func newViolations(layer *ls.Layer, docNode, schemaNode *lpg.Node, err error) []Violation {
+	base := Violation{
+		Attribute:   GetAttributeNamePath(layer, schemaNode),
+		AttributeID: ls.GetNodeID(schemaNode),
+		Message:     err.Error(),
+	}
+	if docNode != nil {
+		base.Path = ls.GetDocumentNodePath(docNode)
+		base.Location = getDocumentSource(docNode)
+		base.Value, _ = ls.GetRawNodeValue(docNode)
+	}
+	var verr ls.ErrValidation
+	if !errors.As(err, &verr) {
+		return []Violation{base}
+	}
+	base.Validator = verr.Validator
+	base.Message = verr.Msg
+	if verr.Err != nil {
+		base.Message += ": " + verr.Err.Error()
+	}
+	if len(verr.Value) > 0 {
+		base.Value = verr.Value
+	}
+	var rules ErrRuleViolations
+	if !errors.As(err, &rules) {
+		return []Violation{base}
+	}
+	// Report each failed rule separately
+	ret := make([]Violation, 0, len(rules))
+	for _, rule := range rules {
+		v := base
+		v.Message = "Rule violation: " + rule.Rule
+		v.Value = ""
+		if len(rule.Paths) > 0 {
+			v.Path = strings.Join(rule.Paths, ", ")
+		}
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+// Summarize computes the per-attribute violation counts
+func (r *ValidationReport) Summarize() {
+	summary := make(map[string]*AttributeSummary)
+	for _, v := range r.Violations {
+		s := summary[v.Attribute]
+		if s == nil {
+			s = &AttributeSummary{Attribute: v.Attribute, AttributeID: v.AttributeID, Validators: make(map[string]int)}
+			summary[v.Attribute] = s
+		}
+		s.Violations++
+		s.Validators[v.Validator]++
+	}
+	r.Summary = make([]AttributeSummary, 0, len(summary))
+	for _, s := range summary {
+		r.Summary = append(r.Summary, *s)
+	}
+	sort.Slice(r.Summary, func(i, j int) bool { return r.Summary[i].Attribute < r.Summary[j].Attribute })
+}
+
+// WriteJSON writes the report as a JSON document
+func (r *ValidationReport) WriteJSON(w io.Writer) error {
+	r.Summarize()
+	if r.Violations == nil {
+		r.Violations = []Violation{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report in JUnit XML format. Each document is
+// a test suite, and each violation is a failed test case. Documents
+// without violations contain a single successful test case.
+func (r *ValidationReport) WriteJUnit(w io.Writer) error {
+	suites := junitTestSuites{Name: "validation"}
+	for _, doc := range r.documents {
+		suite := junitTestSuite{Name: doc.location}
+		if len(doc.violations) == 0 {
+			suite.Cases = append(suite.Cases, junitTestCase{Name: "valid", ClassName: doc.location})
+		}
+		for _, v := range doc.violations {
+			text := make([]string, 0)
+			if len(v.Path) > 0 {
+				text = append(text, "path: "+v.Path)
+			}
+			if len(v.Location) > 0 {
+				text = append(text, "location: "+v.Location)
+			}
+			if len(v.Value) > 0 {
+				text = append(text, "value: "+v.Value)
+			}
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      v.Attribute,
+				ClassName: v.Validator,
+				Failure: &junitFailure{
+					Message: v.Message,
+					Type:    v.Validator,
+					Text:    strings.Join(text, "\n"),
+				},
+			})
+			suite.Failures++
+		}
+		suite.Tests = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
@@ -0,0 +1,134 @@
+package validators_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	jsoningest "github.com/cloudprivacylabs/lsa/pkg/json"
+	"github.com/cloudprivacylabs/lsa/pkg/jsonld"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/validators"
+)
+
+const reportSchema = `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/id",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "person",
+  "rules": [ "(phone IS NULL) <> (email IS NULL)" ],
+  "attributes": {
+   "name": {
+     "@type": "Value",
+     "attributeName":"name",
+     "required": true,
+     "maxLength": 5
+   },
+   "age": {
+     "@type": "Value",
+     "attributeName":"age",
+     "valueType": "integer",
+     "minimum": 0
+   },
+   "phone": {
+     "@type": "Value",
+     "attributeName":"phone"
+   },
+   "email": {
+     "@type": "Value",
+     "attributeName":"email"
+   }
+  }
+ }
+}`
+
+func TestValidationReport(t *testing.T) {
+	var schMap interface{}
+	if err := json.Unmarshal([]byte(reportSchema), &schMap); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := jsonld.UnmarshalLayer(schMap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err = (&ls.Compiler{}).CompileSchema(ls.DefaultContext(), schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := validators.ValidationReport{}
+	for i, doc := range []string{
+		`{"name": "john", "age": 10, "phone": "123"}`,
+		`{"name": "johnny", "age": -1, "phone": "123", "email": "a@b"}`,
+		`{"age": -2}`,
+	} {
+		bldr := ls.NewGraphBuilder(nil, ls.GraphBuilderOptions{EmbedSchemaNodes: true})
+		// Ingest without value validation, so all violations are reported
+		parser := jsoningest.Parser{Layer: schema, SkipValueValidation: true}
+		if _, err := jsoningest.IngestBytes(ls.DefaultContext(), "http://base", []byte(doc), parser, bldr, &ls.Ingester{Schema: schema}); err != nil {
+			t.Fatal(err)
+		}
+		report.ValidateGraph(bldr.GetGraph(), schema, []string{"doc0", "doc1", "doc2"}[i])
+	}
+	if report.Documents != 3 || report.Failed != 2 {
+		t.Errorf("Wrong counts: %d %d", report.Documents, report.Failed)
+	}
+	found := make(map[string]validators.Violation)
+	for _, v := range report.Violations {
+		found[v.Location+" "+v.Attribute+" "+v.Validator] = v
+	}
+	for _, key := range []string{
+		"doc1 name " + validators.MaxLengthTerm.Name,
+		"doc1 age " + validators.MinimumTerm.Name,
+		"doc1 person " + validators.RulesTerm.Name,
+		"doc2 name " + validators.RequiredTerm.Name,
+		"doc2 age " + validators.MinimumTerm.Name,
+		"doc2 person " + validators.RulesTerm.Name,
+	} {
+		if _, ok := found[key]; !ok {
+			t.Errorf("Missing violation: %s in %+v", key, report.Violations)
+		}
+	}
+	if len(report.Violations) != 6 {
+		t.Errorf("Expecting 6 violations, got %+v", report.Violations)
+	}
+	if v := found["doc1 age "+validators.MinimumTerm.Name]; v.Path != "age" || v.Value != "-1" {
+		t.Errorf("Wrong violation: %+v", v)
+	}
+
+	buf := bytes.Buffer{}
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var out validators.ValidationReport
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Summary) != 3 || out.Summary[0].Attribute != "age" || out.Summary[0].Violations != 2 {
+		t.Errorf("Wrong summary: %+v", out.Summary)
+	}
+
+	buf = bytes.Buffer{}
+	if err := report.WriteJUnit(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var junit struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Suites   []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &junit); err != nil {
+		t.Fatal(err)
+	}
+	if junit.Tests != 7 || junit.Failures != 6 || len(junit.Suites) != 3 || junit.Suites[0].Name != "doc0" {
+		t.Errorf("Wrong junit report: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `<failure message=`) {
+		t.Errorf("No failures in junit report: %s", buf.String())
+	}
+}
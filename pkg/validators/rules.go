@@ -0,0 +1,233 @@
+package validators
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/opencypher"
+
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/types"
+)
+
+// RulesTerm declares cross-field and cross-entity validation rules on
+// an object or entity attribute. Each rule is an openCypher query,
+// or an openCypher expression:
+//
+//	{
+//	   @id: encounter,
+//	   @type: Object,
+//	   validation/rules: [
+//	     "admitDate <= dischargeDate",
+//	     "(phone IS NULL) <> (email IS NULL)",
+//	     "MATCH (this)-[]->(s {`https://lschema.org/schemaNodeId`: 'subject'}) WHERE NOT (s)-[]->(:`https://hl7.org/fhir/Patient`) RETURN s"
+//	   ]
+//	}
+//
+// The rules are evaluated with `this` bound to the document node of
+// the annotated attribute. The attribute names of the direct child
+// attributes are bound to the values of the corresponding document
+// nodes, or null if they don't exist. Dates and times are bound as
+// normalized ISO 8601 strings, so they can be compared with each
+// other and with string literals.
+//
+// A rule that evaluates to false is a violation. A rule that returns
+// a result set reports a violation for each row, involving the nodes
+// in that row. Rules evaluating to true or null pass.
+var RulesTerm = ls.NewTerm(ls.LS, "validation/rules").SetComposition(ls.SetComposition).SetTags(ls.ValidationTag, ls.SchemaElementTag).SetMetadata(struct {
+	RulesValidator
+}{
+	RulesValidator{},
+}).Register()
+
+// RulesValidator evaluates the validation rules of a document node
+type RulesValidator struct{}
+
+const compiledRulesTerm = "$compiledRules"
+
+type compiledRule struct {
+	rule string
+	expr opencypher.Evaluatable
+	// If true, the rule is an expression, not a query
+	isExpr bool
+	// Variables referenced in the rule
+	vars map[string]struct{}
+}
+
+// RuleViolation describes a failed rule, and the document nodes
+// involved in the failure
+type RuleViolation struct {
+	Rule  string
+	Nodes []*lpg.Node
+	// Paths contains the document paths of the nodes
+	Paths []string
+}
+
+// ErrRuleViolations is the list of rules that failed for a node. It
+// is returned wrapped in an ls.ErrValidation
+type ErrRuleViolations []RuleViolation
+
+func (e ErrRuleViolations) Error() string {
+	items := make([]string, 0, len(e))
+	for _, x := range e {
+		items = append(items, fmt.Sprintf("%s (%s)", x.Rule, strings.Join(x.Paths, ", ")))
+	}
+	return "Rule violations: " + strings.Join(items, "; ")
+}
+
+var queryRegex = regexp.MustCompile(`(?i)^\s*(MATCH|OPTIONAL|WITH|UNWIND|CALL|RETURN)\b`)
+
+var identifierRegex = regexp.MustCompile("`[^`]+`|[A-Za-z_][A-Za-z0-9_]*")
+
+// CompileTerm compiles the rule expressions
+func (validator RulesValidator) CompileTerm(ctx *ls.CompileContext, target ls.CompilablePropertyContainer, term string, value ls.PropertyValue) error {
+	if value.Value() == nil {
+		return nil
+	}
+	rules := make([]compiledRule, 0)
+	for _, str := range value.AsStringSlice() {
+		query := str
+		isExpr := !queryRegex.MatchString(str)
+		if isExpr {
+			query = "RETURN " + str
+		}
+		expr, err := ctx.CompileOpencypher(query)
+		if err != nil {
+			return ls.ErrValidatorCompile{Validator: RulesTerm.Name, Object: target, Msg: "Invalid rule: " + str, Err: err}
+		}
+		rule := compiledRule{rule: str, expr: expr, isExpr: isExpr, vars: make(map[string]struct{})}
+		for _, id := range identifierRegex.FindAllString(str, -1) {
+			rule.vars[strings.Trim(id, "`")] = struct{}{}
+		}
+		rules = append(rules, rule)
+	}
+	target.SetProperty(compiledRulesTerm, rules)
+	return nil
+}
+
+// ruleValue converts a node value to a value that can be used in
+// openCypher expressions. Temporal values are converted to
+// normalized ISO 8601 strings that sort chronologically.
+func ruleValue(node *lpg.Node) opencypher.Value {
+	v, err := ls.GetNodeValue(node)
+	if err != nil {
+		// Use the raw value if the value cannot be parsed
+		raw, _ := ls.GetRawNodeValue(node)
+		return opencypher.RValue{Value: raw}
+	}
+	switch t := v.(type) {
+	case types.Date:
+		return opencypher.RValue{Value: t.ToTime().Format("2006-01-02")}
+	case types.TimeOfDay:
+		return opencypher.RValue{Value: t.ToTime().Format("15:04:05.000000000")}
+	case interface{ ToTime() time.Time }:
+		return opencypher.RValue{Value: t.ToTime().UTC().Format("2006-01-02T15:04:05.000000000Z")}
+	}
+	return opencypher.ValueOf(v)
+}
+
+// ValidateNode evaluates the rules for the document node. Returns an
+// ls.ErrValidation wrapping ErrRuleViolations if there are any
+// failed rules.
+func (validator RulesValidator) ValidateNode(docNode, schemaNode *lpg.Node) error {
+	if docNode == nil {
+		return nil
+	}
+	c, _ := schemaNode.GetProperty(compiledRulesTerm)
+	rules, _ := c.([]compiledRule)
+	if len(rules) == 0 {
+		return nil
+	}
+	// Collect the child attribute values
+	vars := make(map[string]opencypher.Value)
+	varNodes := make(map[string]*lpg.Node)
+	for _, attr := range ls.GetObjectAttributeNodes(schemaNode) {
+		name := ls.AttributeNameTerm.PropertyValue(attr)
+		if len(name) == 0 {
+			continue
+		}
+		vars[name] = opencypher.RValue{}
+		if nodes := ls.FindChildInstanceOf(docNode, ls.GetNodeID(attr)); len(nodes) > 0 {
+			varNodes[name] = nodes[0]
+			vars[name] = ruleValue(nodes[0])
+		}
+	}
+	violations := make(ErrRuleViolations, 0)
+	for _, rule := range rules {
+		evalCtx := ls.NewEvalContext(docNode.GetGraph())
+		for k, v := range vars {
+			evalCtx.SetVar(k, v)
+		}
+		evalCtx.SetVar("this", opencypher.ValueOf(docNode))
+		result, err := rule.expr.Evaluate(evalCtx)
+		if err != nil {
+			return ls.ErrValidation{Validator: RulesTerm.Name, Msg: "Cannot evaluate rule: " + rule.rule, Err: err}
+		}
+		value := result.Get()
+		if rs, ok := value.(opencypher.ResultSet); ok && rule.isExpr {
+			// Expressions return a single value
+			value = nil
+			if len(rs.Rows) == 1 {
+				for _, v := range rs.Rows[0] {
+					value = v.Get()
+				}
+			}
+		}
+		switch value := value.(type) {
+		case bool:
+			if value {
+				continue
+			}
+			nodes := []*lpg.Node{docNode}
+			for name := range rule.vars {
+				if n := varNodes[name]; n != nil {
+					nodes = append(nodes, n)
+				}
+			}
+			violations = append(violations, newRuleViolation(rule.rule, nodes))
+		case opencypher.ResultSet:
+			for _, row := range value.Rows {
+				nodes := make([]*lpg.Node, 0)
+				for _, v := range row {
+					if n, ok := v.Get().(*lpg.Node); ok {
+						nodes = append(nodes, n)
+					}
+				}
+				if len(nodes) == 0 {
+					nodes = append(nodes, docNode)
+				}
+				violations = append(violations, newRuleViolation(rule.rule, nodes))
+			}
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return ls.ErrValidation{Validator: RulesTerm.Name, Msg: violations.Error(), Err: violations}
+}
+
+func newRuleViolation(rule string, nodes []*lpg.Node) RuleViolation {
+	ret := RuleViolation{Rule: rule}
+	seen := make(map[*lpg.Node]struct{})
+	for _, n := range nodes {
+		if _, ok := seen[n]; ok {
+			continue
+		}
+		seen[n] = struct{}{}
+		ret.Nodes = append(ret.Nodes, n)
+		ret.Paths = append(ret.Paths, ls.GetDocumentNodePath(n))
+	}
+	sort.Sort(ret)
+	return ret
+}
+
+func (r RuleViolation) Len() int           { return len(r.Nodes) }
+func (r RuleViolation) Less(i, j int) bool { return r.Paths[i] < r.Paths[j] }
+func (r RuleViolation) Swap(i, j int) {
+	r.Nodes[i], r.Nodes[j] = r.Nodes[j], r.Nodes[i]
+	r.Paths[i], r.Paths[j] = r.Paths[j], r.Paths[i]
+}
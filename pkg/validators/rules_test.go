@@ -0,0 +1,233 @@
+package validators_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	jsoningest "github.com/cloudprivacylabs/lsa/pkg/json"
+	"github.com/cloudprivacylabs/lsa/pkg/jsonld"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+	"github.com/cloudprivacylabs/lsa/pkg/validators"
+)
+
+const rulesSchema = `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/id",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "encounter",
+  "rules": [
+    "admitDate <= dischargeDate",
+    "(phone IS NULL) <> (email IS NULL)",
+    "MATCH (this)-[]->(d {` + "`https://lschema.org/schemaNodeId`" + `:'diagnosis'}) WHERE d.` + "`https://lschema.org/value`" + ` = 'none' RETURN d"
+  ],
+  "attributes": {
+   "admitDate": {
+     "@type": "Value",
+     "attributeName":"admitDate",
+     "valueType": "http://www.w3.org/2001/XMLSchema#date"
+   },
+   "dischargeDate": {
+     "@type": "Value",
+     "attributeName":"dischargeDate",
+     "valueType": "http://www.w3.org/2001/XMLSchema#date"
+   },
+   "phone": {
+     "@type": "Value",
+     "attributeName":"phone"
+   },
+   "email": {
+     "@type": "Value",
+     "attributeName":"email"
+   },
+   "diagnosis": {
+     "@type": "Value",
+     "attributeName":"diagnosis"
+   }
+  }
+ }
+}`
+
+func validateRules(t *testing.T, doc string) []validators.RuleViolation {
+	var schMap interface{}
+	if err := json.Unmarshal([]byte(rulesSchema), &schMap); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := jsonld.UnmarshalLayer(schMap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiler := ls.Compiler{}
+	schema, err = compiler.CompileSchema(ls.DefaultContext(), schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bldr := ls.NewGraphBuilder(nil, ls.GraphBuilderOptions{
+		EmbedSchemaNodes: true,
+	})
+	_, err = jsoningest.IngestBytes(ls.DefaultContext(), "http://base", []byte(doc), jsoningest.Parser{Layer: schema}, bldr, &ls.Ingester{Schema: schema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := make([]validators.RuleViolation, 0)
+	ls.ValidateGraph(bldr.GetGraph(), schema, func(docNode, schemaNode *lpg.Node, err error) bool {
+		var v validators.ErrRuleViolations
+		if !errors.As(err, &v) {
+			t.Errorf("Unexpected error: %v", err)
+			return true
+		}
+		ret = append(ret, v...)
+		return true
+	})
+	return ret
+}
+
+func TestRules(t *testing.T) {
+	v := validateRules(t, `{"admitDate": "2020-01-10", "dischargeDate": "2020-01-12", "phone": "123", "diagnosis": "x"}`)
+	if len(v) != 0 {
+		t.Errorf("Unexpected violations: %+v", v)
+	}
+
+	v = validateRules(t, `{"admitDate": "2020-01-10", "dischargeDate": "2020-01-02", "phone": "123", "email": "a@b", "diagnosis": "none"}`)
+	if len(v) != 3 {
+		t.Fatalf("Expecting 3 violations, got %+v", v)
+	}
+	if v[0].Rule != "admitDate <= dischargeDate" || len(v[0].Paths) != 3 || v[0].Paths[1] != "admitDate" || v[0].Paths[2] != "dischargeDate" {
+		t.Errorf("Wrong violation: %+v", v[0])
+	}
+	if len(v[1].Paths) != 3 || v[1].Paths[1] != "email" || v[1].Paths[2] != "phone" {
+		t.Errorf("Wrong violation: %+v", v[1])
+	}
+	if len(v[2].Paths) != 1 || v[2].Paths[0] != "diagnosis" {
+		t.Errorf("Wrong violation: %+v", v[2])
+	}
+}
+
+// The observation rule refers to the linked patient entity
+var linkedRulesSchemas = map[string]string{
+	"http://example.org/Observation": `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/Observation",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "observation",
+  "entityIdFields": "observation.id",
+  "rules": [
+    "MATCH (this)-[:subject]->(p)-[]->(g {` + "`https://lschema.org/schemaNodeId`" + `:'patient.gender'}) WHERE code = 'pregnancy' AND g.` + "`https://lschema.org/value`" + ` = 'male' RETURN g"
+  ],
+  "attributes": {
+   "observation.id": {
+     "@type": "Value",
+     "attributeName":"id"
+   },
+   "observation.code": {
+     "@type": "Value",
+     "attributeName":"code"
+   },
+   "observation.patientId": {
+     "@type": "Value",
+     "attributeName":"patientId"
+   },
+   "observation.subject": {
+     "@type": "Reference",
+     "attributeName": "subject",
+     "ref": "http://example.org/Patient",
+     "dir": "to",
+     "ingestAs": "edge",
+     "fk": "observation.patientId"
+   }
+  }
+ }
+}`,
+	"http://example.org/Patient": `{
+ "@context": "../../schemas/ls.json",
+ "@id":"http://example.org/Patient",
+ "@type": "Schema",
+ "layer": {
+  "@type": "Object",
+  "@id": "patient",
+  "entityIdFields": "patient.id",
+  "attributes": {
+   "patient.id": {
+     "@type": "Value",
+     "attributeName":"id"
+   },
+   "patient.gender": {
+     "@type": "Value",
+     "attributeName":"gender"
+   }
+  }
+ }
+}`,
+}
+
+func validateLinkedRules(t *testing.T, patient, observation string) []validators.RuleViolation {
+	compiler := ls.Compiler{
+		Loader: ls.SchemaLoaderFunc(func(ref string) (*ls.Layer, error) {
+			s, ok := linkedRulesSchemas[ref]
+			if !ok {
+				return nil, fmt.Errorf("Not found: %s", ref)
+			}
+			var v interface{}
+			if err := json.Unmarshal([]byte(s), &v); err != nil {
+				return nil, err
+			}
+			return jsonld.UnmarshalLayer(v, nil)
+		}),
+	}
+	patientSchema, err := compiler.Compile(ls.DefaultContext(), "http://example.org/Patient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	observationSchema, err := compiler.Compile(ls.DefaultContext(), "http://example.org/Observation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bldr := ls.NewGraphBuilder(nil, ls.GraphBuilderOptions{
+		EmbedSchemaNodes: true,
+	})
+	if _, err := jsoningest.IngestBytes(ls.DefaultContext(), "http://patient", []byte(patient), jsoningest.Parser{Layer: patientSchema}, bldr, &ls.Ingester{Schema: patientSchema}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jsoningest.IngestBytes(ls.DefaultContext(), "http://observation", []byte(observation), jsoningest.Parser{Layer: observationSchema}, bldr, &ls.Ingester{Schema: observationSchema}); err != nil {
+		t.Fatal(err)
+	}
+	links := 0
+	for edges := bldr.GetGraph().GetEdgesWithAnyLabel(lpg.NewStringSet("subject")); edges.Next(); {
+		links++
+	}
+	if links != 1 {
+		t.Fatalf("Observation is not linked to the patient")
+	}
+	ret := make([]validators.RuleViolation, 0)
+	ls.ValidateGraph(bldr.GetGraph(), observationSchema, func(docNode, schemaNode *lpg.Node, err error) bool {
+		var v validators.ErrRuleViolations
+		if !errors.As(err, &v) {
+			t.Errorf("Unexpected error: %v", err)
+			return true
+		}
+		ret = append(ret, v...)
+		return true
+	})
+	return ret
+}
+
+func TestCrossEntityRules(t *testing.T) {
+	v := validateLinkedRules(t, `{"id": "p1", "gender": "female"}`, `{"id": "o1", "code": "pregnancy", "patientId": "p1"}`)
+	if len(v) != 0 {
+		t.Errorf("Unexpected violations: %+v", v)
+	}
+	v = validateLinkedRules(t, `{"id": "p1", "gender": "male"}`, `{"id": "o1", "code": "pregnancy", "patientId": "p1"}`)
+	if len(v) != 1 {
+		t.Fatalf("Expecting 1 violation, got %+v", v)
+	}
+	// The violation involves the gender node of the linked patient
+	if len(v[0].Nodes) != 1 || ls.GetNodeID(v[0].Nodes[0]) != "http://patient.gender" {
+		t.Errorf("Wrong violation: %+v", v[0])
+	}
+}
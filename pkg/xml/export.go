@@ -0,0 +1,483 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xml
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+const (
+	// XMLNamespace is the namespace bound to the "xml" prefix
+	XMLNamespace = "http://www.w3.org/XML/1998/namespace"
+	// XSINamespace is the XML schema instance namespace
+	XSINamespace = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// ExportOptions control how a document graph is written as XML
+type ExportOptions struct {
+	// Prefixes maps namespaces to the prefixes used in the
+	// output. The namespace of the root element becomes the default
+	// namespace unless it has a prefix here. Other namespaces without a
+	// prefix are assigned generated prefixes ns1, ns2, ...
+	Prefixes map[string]string
+
+	// Indent is used to indent nested elements. If empty, the output
+	// is not indented. Elements with text content are never indented.
+	Indent string
+
+	// If OmitHeader is set, the XML declaration is not written
+	OmitHeader bool
+
+	// RootElement is the name of the element that wraps the exported
+	// nodes if there are more than one. If empty, exporting more than
+	// one node returns ErrMultipleRoots.
+	RootElement xml.Name
+}
+
+// ErrCannotExport is returned if a document node cannot be written as XML
+type ErrCannotExport struct {
+	NodeID string
+	Msg    string
+}
+
+func (e ErrCannotExport) Error() string {
+	return fmt.Sprintf("Cannot export %s as XML: %s", e.NodeID, e.Msg)
+}
+
+// Export writes the document subtree rooted at node as XML. Element
+// and attribute names and namespaces are taken from the document
+// nodes, or from their schema nodes if the document nodes do not
+// have them. Schema attributes marked with xml:attribute are written
+// as XML attributes, and values of schema attributes with
+// xml:valueAttr are written to the named attribute. Values are
+// formatted using the value types of the nodes.
+//
+// If layer is not nil, schema nodes are looked up from the layer
+// using the schemaNodeId of the document nodes, and object children
+// are written in Object/attributeList order.
+func Export(node *lpg.Node, layer *ls.Layer, options ExportOptions, w io.Writer) error {
+	return ExportNodes([]*lpg.Node{node}, layer, options, w)
+}
+
+// ExportNodes writes the document subtrees rooted at nodes as a
+// single XML document. If more than one node is exported, the
+// elements are wrapped in options.RootElement.
+func ExportNodes(nodes []*lpg.Node, layer *ls.Layer, options ExportOptions, w io.Writer) error {
+	exp := exporter{layer: layer, seen: make(map[*lpg.Node]struct{})}
+	elements := make([]*xmlElement, 0, len(nodes))
+	for _, node := range nodes {
+		el, err := exp.element(node)
+		if err != nil {
+			return err
+		}
+		if el != nil {
+			elements = append(elements, el)
+		}
+	}
+	var root *xmlElement
+	switch {
+	case len(elements) == 0:
+		return nil
+	case len(elements) == 1:
+		root = elements[0]
+	case len(options.RootElement.Local) == 0:
+		return ErrMultipleRoots
+	default:
+		root = &xmlElement{name: options.RootElement}
+		for _, el := range elements {
+			root.children = append(root.children, el)
+		}
+	}
+	out := bufio.NewWriter(w)
+	if !options.OmitHeader {
+		out.WriteString(xml.Header)
+	}
+	ns := newNamespaces(root, options.Prefixes)
+	if err := ns.writeElement(out, root, options.Indent, 0, true); err != nil {
+		return err
+	}
+	if len(options.Indent) > 0 {
+		out.WriteString("\n")
+	}
+	return out.Flush()
+}
+
+type exporter struct {
+	layer *ls.Layer
+	seen  map[*lpg.Node]struct{}
+}
+
+// schemaNodes returns the schema nodes of the document node
+func (exp *exporter) schemaNodes(node *lpg.Node) []*lpg.Node {
+	ret := ls.InstanceOf(node)
+	if exp.layer != nil {
+		if id := ls.SchemaNodeIDTerm.PropertyValue(node); len(id) > 0 {
+			if schemaNode := exp.layer.GetAttributeByID(id); schemaNode != nil {
+				ret = append(ret, schemaNode)
+			}
+		}
+	}
+	return ret
+}
+
+// nodeString returns the value of the term from the document node,
+// or from its schema node if the document node does not have it
+func (exp *exporter) nodeString(node *lpg.Node, term ls.StringTerm) string {
+	if _, ok := node.GetProperty(term.Name); ok {
+		return term.PropertyValue(node)
+	}
+	for _, schemaNode := range exp.schemaNodes(node) {
+		if _, ok := schemaNode.GetProperty(term.Name); ok {
+			return term.PropertyValue(schemaNode)
+		}
+	}
+	return ""
+}
+
+// isXMLAttribute returns if the document node is an XML attribute
+func (exp *exporter) isXMLAttribute(node *lpg.Node) bool {
+	if _, ok := node.GetProperty(AttributeTerm.Name); ok {
+		return true
+	}
+	for _, schemaNode := range exp.schemaNodes(node) {
+		if _, ok := schemaNode.GetProperty(AttributeTerm.Name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// xmlName returns the XML name of the document node
+func (exp *exporter) xmlName(node *lpg.Node) xml.Name {
+	return xml.Name{
+		Space: exp.nodeString(node, NamespaceTerm),
+		Local: exp.nodeString(node, ls.AttributeNameTerm),
+	}
+}
+
+// isNamespaceDecl returns if the name is a namespace declaration
+// attribute. These are ingested as attributes, but the output
+// namespaces are declared by the exporter.
+func isNamespaceDecl(name xml.Name) bool {
+	return name.Space == "xmlns" || (len(name.Space) == 0 && name.Local == "xmlns")
+}
+
+// formatValue returns the node value formatted by its value type
+func formatValue(node *lpg.Node) (string, bool, error) {
+	accessor, err := ls.GetNodeValueAccessor(node)
+	if err != nil {
+		return "", false, err
+	}
+	raw, ok := ls.GetRawNodeValue(node)
+	if accessor == nil || !ok {
+		return raw, ok, nil
+	}
+	value, err := ls.GetNodeValue(node)
+	if err != nil {
+		return "", false, err
+	}
+	if value == nil {
+		return "", false, nil
+	}
+	str, err := accessor.FormatNativeValue(value, nil, node)
+	if err != nil {
+		return "", false, err
+	}
+	return str, true, nil
+}
+
+// sortChildren sorts the children of an object node by their
+// index. If the object has an ordered attribute list, the children
+// are then sorted by the index of their schema attributes in the
+// attribute list.
+func (exp *exporter) sortChildren(node *lpg.Node, children []*lpg.Node) {
+	sort.SliceStable(children, func(i, j int) bool {
+		return ls.GetNodeIndex(children[i]) < ls.GetNodeIndex(children[j])
+	})
+	order := make(map[string]int)
+	for _, schemaNode := range exp.schemaNodes(node) {
+		for _, attr := range lpg.TargetNodes(schemaNode.GetEdgesWithLabel(lpg.OutgoingEdge, ls.ObjectAttributeListTerm.Name)) {
+			order[ls.GetNodeID(attr)] = ls.GetNodeIndex(attr)
+		}
+	}
+	if len(order) == 0 {
+		return
+	}
+	// Children that are not in the attribute list are written last
+	position := func(n *lpg.Node) int {
+		if p, ok := order[ls.SchemaNodeIDTerm.PropertyValue(n)]; ok {
+			return p
+		}
+		return len(order)
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		return position(children[i]) < position(children[j])
+	})
+}
+
+func (exp *exporter) element(node *lpg.Node) (*xmlElement, error) {
+	if _, exists := exp.seen[node]; exists {
+		return nil, nil
+	}
+	exp.seen[node] = struct{}{}
+	if !node.HasLabel(ls.DocumentNodeTerm.Name) {
+		return nil, nil
+	}
+	name := exp.xmlName(node)
+	if len(name.Local) == 0 {
+		return nil, ErrCannotExport{NodeID: ls.GetNodeID(node), Msg: "No element name"}
+	}
+	element := &xmlElement{name: name}
+	switch {
+	case node.HasLabel(ls.AttributeTypeValue.Name):
+		value, ok, err := formatValue(node)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return element, nil
+		}
+		if valueAttr := exp.nodeString(node, ValueAttributeTerm); len(valueAttr) > 0 {
+			element.attributes = append(element.attributes, xmlAttribute{name: xml.Name{Local: valueAttr}, value: value})
+		} else if len(value) > 0 {
+			element.children = append(element.children, &xmlText{text: []byte(value)})
+		}
+
+	case node.HasLabel(ls.AttributeTypeObject.Name), node.HasLabel(ls.AttributeTypeArray.Name):
+		children := lpg.TargetNodes(node.GetEdgesWithLabel(lpg.OutgoingEdge, ls.HasTerm.Name))
+		if node.HasLabel(ls.AttributeTypeObject.Name) {
+			exp.sortChildren(node, children)
+		} else {
+			ls.SortNodes(children)
+		}
+		for _, child := range children {
+			if !child.HasLabel(ls.DocumentNodeTerm.Name) {
+				continue
+			}
+			childName := exp.xmlName(child)
+			if isNamespaceDecl(childName) {
+				continue
+			}
+			if exp.isXMLAttribute(child) {
+				value, ok, err := formatValue(child)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					element.attributes = append(element.attributes, xmlAttribute{name: childName, value: value})
+				}
+				continue
+			}
+			// Text nodes of mixed content do not have names
+			if child.HasLabel(ls.AttributeTypeValue.Name) && len(childName.Local) == 0 {
+				value, ok, err := formatValue(child)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					element.children = append(element.children, &xmlText{text: []byte(value)})
+				}
+				continue
+			}
+			el, err := exp.element(child)
+			if err != nil {
+				return nil, err
+			}
+			if el != nil {
+				element.children = append(element.children, el)
+			}
+		}
+	default:
+		return nil, nil
+	}
+	return element, nil
+}
+
+// walk calls f for el and all the elements under it
+func (el *xmlElement) walk(f func(*xmlElement)) {
+	f(el)
+	for _, ch := range el.children {
+		if child, ok := ch.(*xmlElement); ok {
+			child.walk(f)
+		}
+	}
+}
+
+// namespaces keeps the namespace prefixes used in the output
+type namespaces struct {
+	// namespace -> prefix. Empty prefix is the default namespace
+	prefixes map[string]string
+	// Prefixes for attributes in the default namespace. Attributes
+	// are not in the default namespace unless they are prefixed
+	attrPrefixes map[string]string
+	// Namespace declarations in the order they are written
+	declared []xml.Attr
+	used     map[string]struct{}
+	n        int
+}
+
+func newNamespaces(root *xmlElement, prefixes map[string]string) *namespaces {
+	ns := &namespaces{
+		prefixes:     map[string]string{XMLNamespace: "xml"},
+		attrPrefixes: make(map[string]string),
+		used:         map[string]struct{}{"xml": {}},
+	}
+	for space, prefix := range prefixes {
+		ns.prefixes[space] = prefix
+		ns.used[prefix] = struct{}{}
+	}
+	// Elements without a namespace cannot be written if there is a
+	// default namespace
+	unqualified := false
+	root.walk(func(el *xmlElement) {
+		if len(el.name.Space) == 0 {
+			unqualified = true
+		}
+	})
+	if _, ok := ns.prefixes[root.name.Space]; !ok && len(root.name.Space) > 0 && !unqualified {
+		ns.prefixes[root.name.Space] = ""
+	}
+	declared := make(map[xml.Attr]struct{})
+	declare := func(prefix, space string) {
+		if space == XMLNamespace {
+			return
+		}
+		decl := xml.Attr{Name: xml.Name{Local: prefix}, Value: space}
+		if _, ok := declared[decl]; !ok {
+			declared[decl] = struct{}{}
+			ns.declared = append(ns.declared, decl)
+		}
+	}
+	root.walk(func(el *xmlElement) {
+		if len(el.name.Space) > 0 {
+			prefix, ok := ns.prefixes[el.name.Space]
+			if !ok {
+				prefix = ns.newPrefix(el.name.Space)
+				ns.prefixes[el.name.Space] = prefix
+			}
+			declare(prefix, el.name.Space)
+		}
+		for _, attr := range el.attributes {
+			if len(attr.name.Space) == 0 {
+				continue
+			}
+			prefix, ok := ns.prefixes[attr.name.Space]
+			if !ok {
+				prefix = ns.newPrefix(attr.name.Space)
+				ns.prefixes[attr.name.Space] = prefix
+			}
+			if len(prefix) == 0 {
+				if prefix, ok = ns.attrPrefixes[attr.name.Space]; !ok {
+					prefix = ns.newPrefix("")
+					ns.attrPrefixes[attr.name.Space] = prefix
+				}
+			}
+			declare(prefix, attr.name.Space)
+		}
+	})
+	return ns
+}
+
+// newPrefix returns an unused prefix for the namespace
+func (ns *namespaces) newPrefix(space string) string {
+	if space == XSINamespace {
+		if _, exists := ns.used["xsi"]; !exists {
+			ns.used["xsi"] = struct{}{}
+			return "xsi"
+		}
+	}
+	for {
+		ns.n++
+		prefix := fmt.Sprintf("ns%d", ns.n)
+		if _, exists := ns.used[prefix]; !exists {
+			ns.used[prefix] = struct{}{}
+			return prefix
+		}
+	}
+}
+
+func (ns *namespaces) qname(name xml.Name, attr bool) string {
+	if len(name.Space) == 0 {
+		return name.Local
+	}
+	prefix := ns.prefixes[name.Space]
+	if len(prefix) == 0 && attr {
+		prefix = ns.attrPrefixes[name.Space]
+	}
+	if len(prefix) == 0 {
+		return name.Local
+	}
+	return prefix + ":" + name.Local
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func (ns *namespaces) writeElement(out *bufio.Writer, el *xmlElement, indent string, depth int, root bool) error {
+	out.WriteString("<" + ns.qname(el.name, false))
+	if root {
+		for _, decl := range ns.declared {
+			if len(decl.Name.Local) == 0 {
+				out.WriteString(` xmlns="` + escape(decl.Value) + `"`)
+			} else {
+				out.WriteString(" xmlns:" + decl.Name.Local + `="` + escape(decl.Value) + `"`)
+			}
+		}
+	}
+	for _, attr := range el.attributes {
+		out.WriteString(" " + ns.qname(attr.name, true) + `="` + escape(attr.value) + `"`)
+	}
+	if len(el.children) == 0 {
+		_, err := out.WriteString("/>")
+		return err
+	}
+	out.WriteString(">")
+	hasText := false
+	for _, ch := range el.children {
+		if _, ok := ch.(*xmlText); ok {
+			hasText = true
+			break
+		}
+	}
+	for _, ch := range el.children {
+		switch child := ch.(type) {
+		case *xmlText:
+			out.WriteString(escape(string(child.text)))
+		case *xmlElement:
+			if len(indent) > 0 && !hasText {
+				out.WriteString("\n" + strings.Repeat(indent, depth+1))
+			}
+			if err := ns.writeElement(out, child, indent, depth+1, false); err != nil {
+				return err
+			}
+		}
+	}
+	if len(indent) > 0 && !hasText {
+		out.WriteString("\n" + strings.Repeat(indent, depth))
+	}
+	_, err := out.WriteString("</" + ns.qname(el.name, false) + ">")
+	return err
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 Cloud Privacy Labs, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xml
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"testing"
+
+	"github.com/cloudprivacylabs/lpg/v2"
+	"github.com/cloudprivacylabs/lsa/pkg/jsonld"
+	"github.com/cloudprivacylabs/lsa/pkg/ls"
+)
+
+func xmlIngest(t *testing.T, builder ls.GraphBuilder, xmlname, schemaName string) (*ls.Layer, *lpg.Node) {
+	s, err := os.ReadFile("testdata/" + schemaName + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(s, &v); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := jsonld.UnmarshalLayer(v, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := ls.Compiler{}
+	layer, err = c.CompileSchema(ls.DefaultContext(), layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open("testdata/" + xmlname + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	parser := Parser{Layer: layer, OnlySchemaAttributes: true}
+	parsed, err := parser.ParseStream(ls.DefaultContext(), "a", f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ing := ls.Ingester{Schema: layer}
+	root, err := ing.Ingest(builder, parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer, root
+}
+
+func xmlIngestAndExport(t *testing.T, xmlname, schemaName string, options ExportOptions) string {
+	layer, root := xmlIngest(t, ls.NewGraphBuilder(nil, ls.GraphBuilderOptions{}), xmlname, schemaName)
+	options.OmitHeader = true
+	out := bytes.Buffer{}
+	if err := Export(root, layer, options, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestExportAttrValue(t *testing.T) {
+	out := xmlIngestAndExport(t, "attrTest", "attrTestSchema", ExportOptions{})
+	expected := `<root><field1 value="value1"/><field2>value2</field2><nested><nestedField>nestedValue1</nestedField><nestedField>nestedValue2</nestedField></nested></root>`
+	if out != expected {
+		t.Errorf("Got %s", out)
+	}
+}
+
+func TestExportNamespaces(t *testing.T) {
+	// Elements are written in attributeList order
+	out := xmlIngestAndExport(t, "cda", "cdaSchema", ExportOptions{})
+	expected := `<ClinicalDocument xmlns="urn:hl7-org:v3" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><title>Good Health Clinic Consultation Note</title><code code="34133-9" displayName="Summary &amp; Note"/><id root="2.16.840.1.113883.19.5" extension="c266"/><effectiveTime value="20000407"/><value xsi:type="PQ" value="12"/></ClinicalDocument>`
+	if out != expected {
+		t.Errorf("Got %s", out)
+	}
+
+	out = xmlIngestAndExport(t, "cda", "cdaSchema", ExportOptions{Prefixes: map[string]string{"urn:hl7-org:v3": "hl7"}})
+	expected = `<hl7:ClinicalDocument xmlns:hl7="urn:hl7-org:v3" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><hl7:title>Good Health Clinic Consultation Note</hl7:title><hl7:code code="34133-9" displayName="Summary &amp; Note"/><hl7:id root="2.16.840.1.113883.19.5" extension="c266"/><hl7:effectiveTime value="20000407"/><hl7:value xsi:type="PQ" value="12"/></hl7:ClinicalDocument>`
+	if out != expected {
+		t.Errorf("Got %s", out)
+	}
+}
+
+func TestExportMultipleRoots(t *testing.T) {
+	builder := ls.NewGraphBuilder(nil, ls.GraphBuilderOptions{})
+	layer, root1 := xmlIngest(t, builder, "attrTest", "attrTestSchema")
+	_, root2 := xmlIngest(t, builder, "attrTest", "attrTestSchema")
+	out := bytes.Buffer{}
+	if err := ExportNodes([]*lpg.Node{root1, root2}, layer, ExportOptions{}, &out); err != ErrMultipleRoots {
+		t.Errorf("Expecting multiple roots error, got %v", err)
+	}
+	out = bytes.Buffer{}
+	if err := ExportNodes([]*lpg.Node{root1, root2}, layer, ExportOptions{RootElement: xml.Name{Local: "roots"}}, &out); err != nil {
+		t.Fatal(err)
+	}
+	doc := `<root><field1 value="value1"/><field2>value2</field2><nested><nestedField>nestedValue1</nestedField><nestedField>nestedValue2</nestedField></nested></root>`
+	if expected := xml.Header + "<roots>" + doc + doc + "</roots>"; out.String() != expected {
+		t.Errorf("Got %s", out.String())
+	}
+}
@@ -48,8 +48,11 @@ func (i ParsedDocNode) GetAttributeName() string              { return "" }
 type Parser struct {
 	OnlySchemaAttributes bool
 	IngestEmptyValues    bool
-	Layer                *ls.Layer
-	objectCache          map[*lpg.Node][]*lpg.Node
+	// If true, values are not validated during parsing. The ingested
+	// graph can be validated using ls.ValidateGraph
+	SkipValueValidation bool
+	Layer               *ls.Layer
+	objectCache         map[*lpg.Node][]*lpg.Node
 }
 
 type parserContext struct {
@@ -131,6 +134,13 @@ func (ing *Parser) element(ctx parserContext, element *xmlElement) (*ParsedDocNo
 	return ing.parseObject(ctx, element)
 }
 
+func (ing *Parser) validateValue(value *string, schemaNode *lpg.Node) error {
+	if ing.SkipValueValidation {
+		return nil
+	}
+	return ls.ValidateValueBySchema(value, schemaNode)
+}
+
 func (ing *Parser) parseValue(ctx parserContext, element *xmlElement) (*ParsedDocNode, error) {
 	// element has at most one text node, or valueAttr is set
 	var value string
@@ -139,7 +149,7 @@ func (ing *Parser) parseValue(ctx parserContext, element *xmlElement) (*ParsedDo
 		if len(pvalue) > 0 {
 			v, ok := element.findAttr(xml.Name{Local: pvalue})
 			if ok {
-				if err := ls.ValidateValueBySchema(&v, ctx.schemaNode); err != nil {
+				if err := ing.validateValue(&v, ctx.schemaNode); err != nil {
 					return nil, err
 				}
 				ret := &ParsedDocNode{
@@ -170,7 +180,7 @@ func (ing *Parser) parseValue(ctx parserContext, element *xmlElement) (*ParsedDo
 		}
 		value = string(t.text)
 	}
-	if err := ls.ValidateValueBySchema(&value, ctx.schemaNode); err != nil {
+	if err := ing.validateValue(&value, ctx.schemaNode); err != nil {
 		return nil, err
 	}
 	ret := &ParsedDocNode{